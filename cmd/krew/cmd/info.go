@@ -61,6 +61,9 @@ func printPluginInfo(out io.Writer, indexName string, plugin index.Plugin) {
 		if platform.URI != "" {
 			fmt.Fprintf(out, "URI: %s\n", platform.URI)
 			fmt.Fprintf(out, "SHA256: %s\n", platform.Sha256)
+			if platform.Sha512 != "" {
+				fmt.Fprintf(out, "SHA512: %s\n", platform.Sha512)
+			}
 		}
 	}
 	if plugin.Spec.Version != "" {
@@ -16,19 +16,23 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"k8s.io/klog"
 
 	"sigs.k8s.io/krew/cmd/krew/cmd/internal"
+	"sigs.k8s.io/krew/internal/download"
+	"sigs.k8s.io/krew/internal/index/indexoperations"
 	"sigs.k8s.io/krew/internal/index/indexscanner"
 	"sigs.k8s.io/krew/internal/index/validation"
 	"sigs.k8s.io/krew/internal/installation"
-	"sigs.k8s.io/krew/internal/pathutil"
+	"sigs.k8s.io/krew/internal/version"
 	"sigs.k8s.io/krew/pkg/constants"
 	"sigs.k8s.io/krew/pkg/index"
 )
@@ -40,8 +44,8 @@ type pluginEntry struct {
 
 func init() {
 	var (
-		manifest, manifestURL, archiveFileOverride *string
-		noUpdateIndex                              *bool
+		manifest, manifestURL, archiveFileOverride, manifestSHA256                     *string
+		noUpdateIndex, showFiles, forceReplace, skipLink, relativeLink, versionedAlias *bool
 	)
 
 	// installCmd represents the install command
@@ -68,6 +72,13 @@ Examples:
 Remarks:
   If a plugin is already installed, it will be skipped.
   Failure to install a plugin will not stop the installation of other plugins.
+  With --skip-link, the plugin executables are not linked into the bin
+  directory, and their paths are printed so that you can link them yourself.
+  With --versioned-alias, the plugin executables are also linked with the
+  plugin version in their name, like kubectl-foo@1.2.3, which keeps running
+  that version after the plugin is upgraded for as long as it is on disk.
+  With --manifest-sha256, a single plugin is installed only if its manifest
+  file has the given sha256 sum, e.g. the one you reviewed.
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var pluginNames = make([]string, len(args))
@@ -102,7 +113,10 @@ Remarks:
 
 			var install []pluginEntry
 			for _, name := range pluginNames {
-				indexName, pluginName := pathutil.CanonicalPluginName(name)
+				indexName, pluginName, err := indexoperations.ResolvePluginName(paths, name)
+				if err != nil {
+					return err
+				}
 				if !validation.IsSafePluginName(pluginName) {
 					return unsafePluginNameErr(pluginName)
 				}
@@ -110,7 +124,7 @@ Remarks:
 				plugin, err := indexscanner.LoadPluginByName(paths.IndexPluginsPath(indexName), pluginName)
 				if err != nil {
 					if os.IsNotExist(err) {
-						return errors.Errorf("plugin %q does not exist in the plugin index", name)
+						return pluginNotFoundErr(name, indexName, pluginName)
 					}
 					return errors.Wrapf(err, "failed to load plugin %q from the index", name)
 				}
@@ -127,7 +141,7 @@ Remarks:
 				}
 				install = append(install, pluginEntry{
 					p:         plugin,
-					indexName: "detached",
+					indexName: constants.DetachedIndexName,
 				})
 			} else if *manifestURL != "" {
 				plugin, err := readPluginFromURL(*manifestURL)
@@ -136,26 +150,56 @@ Remarks:
 				}
 				install = append(install, pluginEntry{
 					p:         plugin,
-					indexName: "detached",
+					indexName: constants.DetachedIndexName,
 				})
 			}
 
 			if len(install) == 0 {
 				return cmd.Help()
 			}
+			if *manifestSHA256 != "" && len(install) != 1 {
+				return errors.New("--manifest-sha256 can be specified only when installing a single plugin")
+			}
 
 			for _, pluginEntry := range install {
 				klog.V(2).Infof("Will install plugin: %s/%s\n", pluginEntry.indexName, pluginEntry.p.Name)
 			}
 
+			if *showFiles {
+				for _, entry := range install {
+					files, bin, err := installation.Preview(entry.p, installation.InstallOpts{
+						ArchiveFileOverride: *archiveFileOverride,
+						TempDir:             paths.StagingPath(),
+					})
+					if err != nil {
+						return errors.Wrapf(err, "failed to list the files of plugin %q", entry.p.Name)
+					}
+					fmt.Fprintf(os.Stdout, "Plugin %s would install:\n", entry.p.Name)
+					for _, f := range files {
+						fmt.Fprintf(os.Stdout, "\t%s\n", f)
+					}
+					fmt.Fprintf(os.Stdout, "Executable:\n\t%s\n", bin)
+				}
+				return nil
+			}
+
 			var failed []string
 			var returnErr error
 			for _, entry := range install {
 				plugin := entry.p
 				fmt.Fprintf(os.Stderr, "Installing plugin: %s\n", plugin.Name)
-				err := installation.Install(paths, plugin, entry.indexName, installation.InstallOpts{
+				progress, done := downloadProgress()
+				result, err := installation.InstallWithResult(context.Background(), paths, plugin, entry.indexName, installation.InstallOpts{
 					ArchiveFileOverride: *archiveFileOverride,
+					Progress:            progress,
+					DownloadCacheDir:    paths.DownloadCachePath(),
+					ForceReplace:        *forceReplace,
+					SkipLink:            *skipLink,
+					RelativeLink:        *relativeLink,
+					VersionedAlias:      *versionedAlias,
+					ManifestSHA256:      *manifestSHA256,
 				})
+				done()
 				if err == installation.ErrIsAlreadyInstalled {
 					klog.Warningf("Skipping plugin %q, it is already installed", plugin.Name)
 					continue
@@ -170,11 +214,14 @@ Remarks:
 				}
 				fmt.Fprintf(os.Stderr, "Installed plugin: %s\n", plugin.Name)
 				output := fmt.Sprintf("Use this plugin:\n\tkubectl %s\n", plugin.Name)
+				if *skipLink {
+					output = fmt.Sprintf("Executable (not linked into the bin directory):\n\t%s\n", result.Executable)
+				}
 				if plugin.Spec.Homepage != "" {
 					output += fmt.Sprintf("Documentation:\n\t%s\n", plugin.Spec.Homepage)
 				}
-				if plugin.Spec.Caveats != "" {
-					output += fmt.Sprintf("Caveats:\n%s\n", indent(plugin.Spec.Caveats))
+				if result.Caveats != "" {
+					output += fmt.Sprintf("Caveats:\n%s\n", indent(result.Caveats))
 				}
 				fmt.Fprintln(os.Stderr, indent(output))
 				if entry.indexName == constants.DefaultIndexName {
@@ -203,13 +250,54 @@ Remarks:
 	manifestURL = installCmd.Flags().String("manifest-url", "", "(Development-only) specify plugin manifest file from url")
 	archiveFileOverride = installCmd.Flags().String("archive", "", "(Development-only) force all downloads to use the specified file")
 	noUpdateIndex = installCmd.Flags().Bool("no-update-index", false, "(Experimental) do not update local copy of plugin index before installing")
+	forceReplace = installCmd.Flags().Bool("force-replace", false, "replace plugin executables in the bin directory that were not installed by krew, backing them up with a .bak suffix, or that are linked for another installed plugin")
+	skipLink = installCmd.Flags().Bool("skip-link", false, "do not link the plugin executables into the bin directory, for managing the PATH yourself")
+	relativeLink = installCmd.Flags().Bool("relative-link", false, "link the plugin executables with paths relative to the bin directory, so that the krew root directory can be moved")
+	versionedAlias = installCmd.Flags().Bool("versioned-alias", false, "also link the plugin executables with the plugin version in their name (e.g. kubectl-foo@1.2.3), for running multiple versions side by side")
+	manifestSHA256 = installCmd.Flags().String("manifest-sha256", "", "install the plugin only if its manifest file has this sha256 sum, for installing exactly the reviewed manifest")
+	showFiles = installCmd.Flags().Bool("show-files", false, "list the files the plugins would install without installing them")
 
 	rootCmd.AddCommand(installCmd)
 }
 
+// downloadProgress returns a function rendering the progress of a download on
+// stderr, and a function to call when the download is over. The progress is
+// not rendered if stderr is not a terminal.
+func downloadProgress() (download.ProgressFunc, func()) {
+	if !isTerminal(os.Stderr) {
+		return nil, func() {}
+	}
+	bar := internal.NewProgressBar(os.Stderr)
+	return bar.Update, bar.Done
+}
+
+// pluginNotFoundErr returns the error for the plugin name that does not exist
+// in the index, suggesting the plugins with similar names.
+func pluginNotFoundErr(name, indexName, pluginName string) error {
+	similar, err := indexoperations.SimilarPluginNames(paths, indexName, pluginName)
+	if err != nil {
+		klog.V(1).Infof("Failed to find plugins with names similar to %q: %v", pluginName, err)
+	}
+	if len(similar) == 0 {
+		return errors.Errorf("plugin %q does not exist in the plugin index", name)
+	}
+	for i, s := range similar {
+		if indexName != constants.DefaultIndexName {
+			s = indexName + "/" + s
+		}
+		similar[i] = fmt.Sprintf("%q", s)
+	}
+	return errors.Errorf("plugin %q does not exist in the plugin index, did you mean %s?", name, strings.Join(similar, " or "))
+}
+
 func readPluginFromURL(url string) (index.Plugin, error) {
 	klog.V(4).Infof("downloading manifest from url %s", url)
-	resp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return index.Plugin{}, errors.Wrapf(err, "invalid url (%s)", url)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return index.Plugin{}, errors.Wrapf(err, "request to url failed (%s)", url)
 	}
@@ -20,6 +20,8 @@ import (
 
 	"github.com/pkg/errors"
 	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/version"
 )
 
 const (
@@ -32,7 +34,12 @@ var versionURL = githubVersionURL
 // FetchLatestTag fetches the tag name of the latest release from GitHub.
 func FetchLatestTag() (string, error) {
 	klog.V(4).Infof("Fetching latest tag from GitHub")
-	response, err := http.Get(versionURL)
+	req, err := http.NewRequest(http.MethodGet, versionURL, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create the request for the latest release")
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	response, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", errors.Wrapf(err, "could not GET the latest release")
 	}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+)
+
+// ProgressBar prints the progress of a download on a single line of a
+// terminal.
+type ProgressBar struct {
+	w    io.Writer
+	last string
+}
+
+// NewProgressBar returns a ProgressBar printing to w.
+func NewProgressBar(w io.Writer) *ProgressBar {
+	return &ProgressBar{w: w}
+}
+
+// Update prints the downloaded bytes, and the percentage if the total is
+// known. It can be used as a download.ProgressFunc.
+func (b *ProgressBar) Update(downloaded, total int64) {
+	line := fmt.Sprintf("Downloading: %s", formatBytes(downloaded))
+	if total > 0 {
+		line = fmt.Sprintf("Downloading: %3d%% (%s / %s)", downloaded*100/total, formatBytes(downloaded), formatBytes(total))
+	}
+	if line == b.last {
+		return
+	}
+	fmt.Fprintf(b.w, "\r%s", line)
+	b.last = line
+}
+
+// Done ends the line of the progress bar, if anything was printed.
+func (b *ProgressBar) Done() {
+	if b.last != "" {
+		fmt.Fprintln(b.w)
+		b.last = ""
+	}
+}
+
+func formatBytes(n int64) string {
+	const mib = 1 << 20
+	if n < mib {
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/mib)
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates [][2]int64
+		want    string
+	}{
+		{
+			name:    "known total",
+			updates: [][2]int64{{512, 2048}, {1024, 2048}, {2048, 2048}},
+			want:    "\rDownloading:  25% (0.5 KiB / 2.0 KiB)\rDownloading:  50% (1.0 KiB / 2.0 KiB)\rDownloading: 100% (2.0 KiB / 2.0 KiB)\n",
+		},
+		{
+			name:    "unknown total",
+			updates: [][2]int64{{1 << 20, -1}, {3 << 20, -1}},
+			want:    "\rDownloading: 1.0 MiB\rDownloading: 3.0 MiB\n",
+		},
+		{
+			name:    "unchanged progress is not printed again",
+			updates: [][2]int64{{1, 1 << 30}, {2, 1 << 30}},
+			want:    "\rDownloading:   0% (0.0 KiB / 1024.0 MiB)\n",
+		},
+		{
+			name: "no progress",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			b := NewProgressBar(&buf)
+			for _, u := range tt.updates {
+				b.Update(u[0], u[1])
+			}
+			b.Done()
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -166,6 +166,9 @@ func preRun(cmd *cobra.Command, _ []string) error {
 			klog.Warningf("Failed to clean up old installations of krew (on windows).")
 			klog.Warningf("You may need to clean them up manually. Error: %v", err)
 		}
+		if err := installation.CleanupStaleLinks(paths.BinPath(), nil); err != nil {
+			klog.Warningf("Failed to clean up replaced plugin executables (on windows): %v", err)
+		}
 	}
 
 	return nil
@@ -204,7 +207,7 @@ func cleanupStaleKrewInstallations() error {
 	v := r.Spec.Version
 
 	klog.V(1).Infof("Clean up krew stale installations, current=%s", v)
-	return installation.CleanupStaleKrewInstallations(paths.PluginInstallPath(constants.KrewPluginName), v)
+	return installation.CleanupStaleKrewInstallations(paths.PluginInstallPath(constants.KrewPluginName), v, nil)
 }
 
 func checkIndex(_ *cobra.Command, _ []string) error {
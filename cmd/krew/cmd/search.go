@@ -16,7 +16,6 @@ package cmd
 
 import (
 	"os"
-	"runtime"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -106,7 +105,7 @@ Examples:
 			} else if ok {
 				status = "no"
 			} else {
-				status = "unavailable on " + runtime.GOOS
+				status = "unavailable on " + installation.OSArch().String()
 			}
 
 			rows = append(rows, []string{displayName(v.p, v.indexName), limitString(v.p.Spec.ShortDescription, 50), status})
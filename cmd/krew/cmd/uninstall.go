@@ -45,7 +45,7 @@ Remarks:
 				return unsafePluginNameErr(name)
 			}
 			klog.V(4).Infof("Going to uninstall plugin %s\n", name)
-			if err := installation.Uninstall(paths, name); err != nil {
+			if err := installation.Uninstall(paths, name, nil); err != nil {
 				return errors.Wrapf(err, "failed to uninstall plugin %s", name)
 			}
 			fmt.Fprintf(os.Stderr, "Uninstalled plugin: %s\n", name)
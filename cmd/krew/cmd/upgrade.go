@@ -78,10 +78,14 @@ kubectl krew upgrade foo bar"`,
 			var nErrors int
 			for _, name := range pluginNames {
 				indexName, pluginName := pathutil.CanonicalPluginName(name)
-				if indexName == "detached" {
+				if indexName == constants.DetachedIndexName {
 					klog.Warningf("Skipping upgrade for %q because it was installed via manifest\n", pluginName)
 					continue
 				}
+				if indexName == constants.URLIndexName {
+					klog.Warningf("Skipping upgrade for %q because it was installed from a URL\n", pluginName)
+					continue
+				}
 
 				plugin, err := indexscanner.LoadPluginByName(paths.IndexPluginsPath(indexName), pluginName)
 				if err != nil {
@@ -95,7 +99,14 @@ kubectl krew upgrade foo bar"`,
 				pluginDisplayName := displayName(plugin, indexName)
 				if err == nil {
 					fmt.Fprintf(os.Stderr, "Upgrading plugin: %s\n", pluginDisplayName)
-					err = installation.Upgrade(paths, plugin, indexName)
+					progress, done := downloadProgress()
+					err = installation.Upgrade(paths, plugin, indexName, installation.UpgradeOpts{
+						InstallOpts: installation.InstallOpts{
+							Progress:         progress,
+							DownloadCacheDir: paths.DownloadCachePath(),
+						},
+					})
+					done()
 					if ignoreUpgraded && err == installation.ErrIsAlreadyUpgraded {
 						fmt.Fprintf(os.Stderr, "Skipping plugin %s, it is already on the newest version\n", pluginDisplayName)
 						continue
@@ -97,6 +97,12 @@ func validateManifestFile(path string) error {
 	}
 	klog.Infof("no overlapping spec.platform[].selector")
 
+	// check that the archives of all platforms can be downloaded
+	if err := installation.ValidateManifestInstallable(p, false, ""); err != nil {
+		return errors.Wrap(err, "plugin archives are not reachable")
+	}
+	klog.Infof("all spec.platforms[].uri are reachable")
+
 	// exercise "install" for all platforms
 	for i, p := range p.Spec.Platforms {
 		klog.Infof("installing spec.platform[%d]", i)
@@ -110,12 +116,22 @@ func validateManifestFile(path string) error {
 }
 
 // isOverlappingPlatformSelectors validates if multiple platforms have selectors
-// that match to a supported <os,arch> pair.
+// that match to a supported <os,arch> pair. Like when installing, a platform
+// that constrains more of the architecture variant and the libc is preferred,
+// so only the equally specific matches overlap.
 func isOverlappingPlatformSelectors(platforms []index.Platform) error {
 	for _, env := range allPlatforms() {
 		var matchIndex []int
+		maxScore := -1
 		for i, p := range platforms {
-			if selectorMatchesOSArch(p.Selector, env) {
+			if !selectorMatchesOSArch(p.Selector, env) {
+				continue
+			}
+			score := installation.SelectorSpecificity(p.Selector)
+			if score > maxScore {
+				matchIndex, maxScore = nil, score
+			}
+			if score == maxScore {
 				matchIndex = append(matchIndex, i)
 			}
 		}
@@ -151,6 +167,8 @@ func installPlatformSpec(manifestFile string, p index.Platform) error {
 		"KREW_ROOT=" + tmpDir,
 		"KREW_OS=" + env.OS,
 		"KREW_ARCH=" + env.Arch,
+		"KREW_ARCH_VARIANT=" + env.Variant,
+		"KREW_LIBC=" + env.Libc,
 	}
 	klog.V(2).Infof("installing plugin with: %+v", cmd.Env)
 	cmd.Env = append(cmd.Env, "PATH="+os.Getenv("PATH"))
@@ -218,10 +236,17 @@ func selectorMatchesOSArch(selector *metav1.LabelSelector, env installation.OSAr
 		klog.Warningf("Failed to convert label selector: %+v", selector)
 		return false
 	}
-	return sel.Matches(labels.Set{
+	l := labels.Set{
 		"os":   env.OS,
 		"arch": env.Arch,
-	})
+	}
+	if env.Variant != "" {
+		l["variant"] = env.Variant
+	}
+	if env.Libc != "" {
+		l["libc"] = env.Libc
+	}
+	return sel.Matches(l)
 }
 
 // allPlatforms returns all <os,arch> pairs krew is supported on.
@@ -232,7 +257,11 @@ func allPlatforms() []installation.OSArchPair {
 		{OS: "windows", Arch: "amd64"},
 		{OS: "linux", Arch: "386"},
 		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "amd64", Libc: "glibc"},
+		{OS: "linux", Arch: "amd64", Libc: "musl"},
 		{OS: "linux", Arch: "arm"},
+		{OS: "linux", Arch: "arm", Variant: "v6"},
+		{OS: "linux", Arch: "arm", Variant: "v7"},
 		{OS: "linux", Arch: "arm64"},
 		{OS: "darwin", Arch: "386"},
 		{OS: "darwin", Arch: "amd64"},
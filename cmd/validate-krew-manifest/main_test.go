@@ -209,3 +209,48 @@ func Test_isOverlappingPlatformSelectors_overlap(t *testing.T) {
 		t.Fatal("expected overlap")
 	}
 }
+
+func Test_isOverlappingPlatformSelectors_specificity(t *testing.T) {
+	selector := func(labels map[string]string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: labels}
+	}
+	tests := []struct {
+		name      string
+		selectors []*metav1.LabelSelector
+		wantErr   bool
+	}{
+		{
+			name: "arm variant and generic arm",
+			selectors: []*metav1.LabelSelector{
+				selector(map[string]string{"os": "linux", "arch": "arm", "variant": "v7"}),
+				selector(map[string]string{"os": "linux", "arch": "arm"}),
+			},
+		},
+		{
+			name: "musl and generic amd64",
+			selectors: []*metav1.LabelSelector{
+				selector(map[string]string{"os": "linux", "arch": "amd64", "libc": "musl"}),
+				selector(map[string]string{"os": "linux", "arch": "amd64"}),
+			},
+		},
+		{
+			name: "same arm variant",
+			selectors: []*metav1.LabelSelector{
+				selector(map[string]string{"os": "linux", "arch": "arm", "variant": "v7"}),
+				selector(map[string]string{"os": "linux", "variant": "v7"}),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var platforms []index.Platform
+			for _, sel := range tt.selectors {
+				platforms = append(platforms, index.Platform{Selector: sel})
+			}
+			if err := isOverlappingPlatformSelectors(platforms); (err != nil) != tt.wantErr {
+				t.Errorf("isOverlappingPlatformSelectors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
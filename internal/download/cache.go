@@ -0,0 +1,105 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/environment"
+)
+
+// cacheMaxAge is how long an archive is kept in the download cache after it
+// was last used.
+const cacheMaxAge = 30 * 24 * time.Hour
+
+// cachePath returns the path of the archive with the sha256 checksum in the
+// cache dir, or an empty string if the cache is not used.
+func cachePath(dir, sha256 string) string {
+	if dir == "" {
+		return ""
+	}
+	sha256 = strings.ToLower(sha256)
+	if b, err := hex.DecodeString(sha256); err != nil || len(b) != 32 {
+		klog.V(2).Infof("Not using the download cache for invalid sha256 checksum %q", sha256)
+		return ""
+	}
+	return filepath.Join(dir, sha256)
+}
+
+// writeArchive writes the archive to path, e.g. in the cache. It is written to
+// a temporary file first, so that an interrupted write never leaves a partial
+// archive at path.
+func writeArchive(path string, archive io.ReaderAt, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory %q", filepath.Dir(path))
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file in %q", filepath.Dir(path))
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, io.NewSectionReader(archive, 0, size))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %q", f.Name())
+	}
+	klog.V(2).Infof("Wrote archive to %q", path)
+	return errors.Wrapf(os.Rename(f.Name(), path), "failed to write %q", path)
+}
+
+// markCacheUsed updates the modification time of the cached archive at path,
+// which is when it was last used.
+func markCacheUsed(path string) {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		klog.V(2).Infof("Failed to update the modification time of %q: %v", path, err)
+	}
+}
+
+// evictCache removes the files in the cache dir that were not used for
+// longer than maxAge.
+func evictCache(dir string, maxAge time.Duration) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read directory %q", dir)
+	}
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || time.Since(fi.ModTime()) < maxAge {
+			continue
+		}
+		klog.V(2).Infof("Removing %q from the download cache, it was last used at %s", fi.Name(), fi.ModTime())
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return errors.Wrapf(err, "failed to remove %q", fi.Name())
+		}
+	}
+	return nil
+}
+
+// PurgeCache removes all archives from the download cache of krew.
+func PurgeCache(p environment.Paths) error {
+	return errors.Wrap(os.RemoveAll(p.DownloadCachePath()), "failed to purge the download cache")
+}
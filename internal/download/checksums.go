@@ -0,0 +1,93 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+)
+
+// maxChecksumsFileSize limits the size of the checksums files read by
+// FetchSha256.
+const maxChecksumsFileSize = 1 << 20
+
+// FetchSha256 downloads the checksums file at checksumsURI and returns the
+// sha256 sum it lists for the file name of artifactURI.
+//
+// The checksums file has the format of the sha256sum command, a
+// "<sha256> <file name>" line per file. A file with a single sha256 sum and
+// no file names (like "archive.tar.gz.sha256") is also accepted.
+func FetchSha256(ctx context.Context, f Fetcher, checksumsURI, artifactURI string) (string, error) {
+	u, err := url.Parse(artifactURI)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse uri %q", artifactURI)
+	}
+	name := path.Base(u.Path)
+
+	klog.V(2).Infof("Fetching checksums from %q", checksumsURI)
+	body, err := f.Get(ctx, checksumsURI)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch checksums file")
+	}
+	defer body.Close()
+	sum, err := findSha256(io.LimitReader(body, maxChecksumsFileSize), name)
+	return sum, errors.Wrapf(err, "failed to read checksums file %q", checksumsURI)
+}
+
+// findSha256 returns the sha256 sum listed for the file name in the checksums
+// read from r.
+func findSha256(r io.Reader, name string) (string, error) {
+	var single []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) == 1 {
+			single = append(single, fields[0])
+			continue
+		}
+		// sha256sum marks files read in binary mode with "*"
+		file := strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")
+		if path.Base(file) == name {
+			return validSha256(fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	if len(single) == 1 {
+		return validSha256(single[0])
+	}
+	return "", errors.Errorf("no sha256 sum found for %q", name)
+}
+
+func validSha256(s string) (string, error) {
+	if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+		return "", errors.Errorf("invalid sha256 sum %q", s)
+	}
+	return strings.ToLower(s), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testSumA = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	testSumB = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func Test_findSha256(t *testing.T) {
+	tests := []struct {
+		name      string
+		checksums string
+		file      string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "sha256sum format",
+			checksums: testSumA + "  foo-linux.tar.gz\n" + testSumB + "  foo-darwin.tar.gz\n",
+			file:      "foo-darwin.tar.gz",
+			want:      testSumB,
+		},
+		{
+			name:      "binary mode and paths",
+			checksums: testSumA + " *dist/foo-linux.tar.gz\n" + testSumB + " *./dist/foo-darwin.tar.gz\n",
+			file:      "foo-linux.tar.gz",
+			want:      testSumA,
+		},
+		{
+			name:      "uppercase sum",
+			checksums: strings.ToUpper(testSumA) + "  foo.zip\n",
+			file:      "foo.zip",
+			want:      testSumA,
+		},
+		{
+			name:      "single sum without file name",
+			checksums: "\n" + testSumA + "\n",
+			file:      "foo.zip",
+			want:      testSumA,
+		},
+		{
+			name:      "file not listed",
+			checksums: testSumA + "  foo-linux.tar.gz\n",
+			file:      "foo-windows.zip",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid sum",
+			checksums: "abcd  foo.zip\n",
+			file:      "foo.zip",
+			wantErr:   true,
+		},
+		{
+			name:      "empty file",
+			checksums: "",
+			file:      "foo.zip",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findSha256(strings.NewReader(tt.checksums), tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findSha256() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("findSha256() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchSha256(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.0.0/checksums.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testSumA + "  foo%20linux.tar.gz\n" + testSumB + "  foo linux.tar.gz\n"))
+	}))
+	defer server.Close()
+
+	got, err := FetchSha256(context.Background(), HTTPFetcher{}, server.URL+"/v1.0.0/checksums.txt", server.URL+"/v1.0.0/foo%20linux.tar.gz?raw=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testSumB {
+		t.Errorf("FetchSha256() = %q, want %q", got, testSumB)
+	}
+
+	if _, err := FetchSha256(context.Background(), HTTPFetcher{}, server.URL+"/missing.txt", server.URL+"/foo.tar.gz"); err == nil {
+		t.Error("expected error for a missing checksums file")
+	}
+}
@@ -18,7 +18,10 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -27,49 +30,110 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
 	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/pathutil"
 )
 
-// download gets a file from the internet in memory and writes it content
-// to a Verifier.
-func download(url string, verifier Verifier, fetcher Fetcher) (io.ReaderAt, int64, error) {
-	body, err := fetcher.Get(url)
+// download gets a file from the internet and writes it to a temporary file in
+// tempDir, or in the temp directory of the OS if it is empty, passing its
+// content through a Verifier on the way, so that the archive is never held in
+// memory as a whole. The caller must release the returned file with
+// closeArchive.
+func download(ctx context.Context, url, tempDir string, verifier Verifier, fetcher Fetcher) (*os.File, int64, error) {
+	if closer, ok := verifier.(io.Closer); ok {
+		defer closer.Close()
+	}
+	body, err := fetcher.Get(ctx, url)
 	if err != nil {
 		return nil, 0, errors.Wrapf(err, "failed to obtain plugin archive")
 	}
 	defer body.Close()
 
-	klog.V(3).Infof("Reading archive file into memory")
-	data, err := ioutil.ReadAll(io.TeeReader(body, verifier))
+	f, err := ioutil.TempFile(tempDir, "krew-archive-")
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to create a temporary file for the archive")
+	}
+	klog.V(3).Infof("Writing archive file to %q", f.Name())
+	read := &readErrorReader{r: body}
+	size, err := io.Copy(f, io.TeeReader(read, verifier))
 	if err != nil {
+		closeArchive(f)
+		if read.err != nil {
+			err = networkError(ctx, err)
+		}
 		return nil, 0, errors.Wrap(err, "could not read archive")
 	}
-	klog.V(2).Infof("Read %d bytes from archive into memory", len(data))
+	klog.V(2).Infof("Wrote %d bytes of archive to %q", size, f.Name())
+	if err := verify(ctx, verifier); err != nil {
+		closeArchive(f)
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// closeArchive closes and removes the temporary archive file created by
+// download.
+func closeArchive(f *os.File) {
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		klog.V(2).Infof("Failed to remove temporary archive file %q: %v", f.Name(), err)
+	}
+}
+
+// DefaultMaxUncompressedBytes is the default limit of the total size of the
+// files extracted from an archive.
+const DefaultMaxUncompressedBytes int64 = 2 << 30
 
-	return bytes.NewReader(data), int64(len(data)), verifier.Verify()
+// sizeLimit tracks the total size of the extracted files to protect against
+// archives that expand to an excessive size.
+type sizeLimit struct{ max, written int64 }
+
+// copy copies src to dst, failing if the total size of the copied files
+// exceeds the limit.
+func (l *sizeLimit) copy(dst io.Writer, src io.Reader) error {
+	n, err := io.Copy(dst, io.LimitReader(src, l.max-l.written+1))
+	l.written += n
+	if err != nil {
+		return err
+	}
+	if l.written > l.max {
+		return errors.Errorf("archive exceeds the maximum uncompressed size of %d bytes", l.max)
+	}
+	return nil
 }
 
 // extractZIP extracts a zip file into the target directory.
-func extractZIP(targetDir string, read io.ReaderAt, size int64) error {
+func extractZIP(targetDir string, read io.ReaderAt, size int64, opts extractOptions) error {
 	klog.V(4).Infof("Extracting zip archive to %q", targetDir)
+	limit := &sizeLimit{max: opts.maxBytes}
 	zipReader, err := zip.NewReader(read, size)
 	if err != nil {
 		return err
 	}
 
 	for _, f := range zipReader.File {
-		if err := suspiciousPath(f.Name); err != nil {
+		name := zipEntryName(f)
+		path, err := extractPath(targetDir, name)
+		if err != nil {
 			return err
 		}
-
-		path := filepath.Join(targetDir, filepath.FromSlash(f.Name))
-		if f.FileInfo().IsDir() {
+		if f.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
 			if err := os.MkdirAll(path, f.Mode()); err != nil {
 				return errors.Wrap(err, "can't create directory tree")
 			}
 			continue
 		}
+		if opts.include != nil && !opts.include(name) {
+			klog.V(4).Infof("zip: skipping %q, it is not needed", name)
+			continue
+		}
 
+		// like in tar archives, the entries of directories are optional
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return errors.Wrap(err, "can't create directory tree")
+		}
 		src, err := f.Open()
 		if err != nil {
 			return errors.Wrap(err, "could not open inflating zip file")
@@ -85,28 +149,83 @@ func extractZIP(targetDir string, read io.ReaderAt, size int64) error {
 			dst.Close()
 		}
 
-		if _, err := io.Copy(dst, src); err != nil {
+		if err := limit.copy(dst, src); err != nil {
 			closeAll()
 			return errors.Wrap(err, "can't copy content to zip destination file")
 		}
 		closeAll()
+		if opts.preserveModes {
+			if err := os.Chmod(path, preservedMode(zipEntryMode(f))); err != nil {
+				return errors.Wrap(err, "can't set the mode of zip destination file")
+			}
+		}
 	}
 
 	return nil
 }
 
-// extractTARGZ extracts a gzipped tar file into the target directory.
-func extractTARGZ(targetDir string, at io.ReaderAt, size int64) error {
-	klog.V(4).Infof("tar: extracting to %q", targetDir)
-	in := io.NewSectionReader(at, 0, size)
+// zipEntryName returns the name of the zip entry with slash separators. Some
+// tools on Windows write entries with backslash separators, which the zip
+// format does not allow, so they are converted regardless of the host OS.
+func zipEntryName(f *zip.File) string {
+	return strings.ReplaceAll(f.Name, `\`, "/")
+}
 
-	gzr, err := gzip.NewReader(in)
+// The "version made by" host systems of zip entries whose external attributes
+// contain Unix permission bits.
+const (
+	zipCreatorUnix   = 3
+	zipCreatorMacOSX = 19
+)
+
+// zipEntryMode returns the permission bits of a regular file in the zip
+// archive. Entries created on other systems than Unix and macOS have no
+// permission bits, and get the mode 0644.
+func zipEntryMode(f *zip.File) os.FileMode {
+	switch f.CreatorVersion >> 8 {
+	case zipCreatorUnix, zipCreatorMacOSX:
+		return f.Mode().Perm()
+	default:
+		return 0644
+	}
+}
+
+// preservedMode returns the permission bits of an archive entry with the given
+// mode that are kept with extractOptions.preserveModes. Files are never made
+// writable by group or others, and special bits like setuid are dropped.
+func preservedMode(mode os.FileMode) os.FileMode {
+	return mode.Perm() &^ 0022
+}
+
+// extractTARGZ extracts a gzipped tar file into the target directory.
+func extractTARGZ(targetDir string, at io.ReaderAt, size int64, opts extractOptions) error {
+	gzr, err := gzip.NewReader(io.NewSectionReader(at, 0, size))
 	if err != nil {
 		return errors.Wrap(err, "failed to create gzip reader")
 	}
 	defer gzr.Close()
+	return extractTAR(targetDir, gzr, opts)
+}
+
+// extractTARXZ extracts a xz-compressed tar file into the target directory.
+func extractTARXZ(targetDir string, at io.ReaderAt, size int64, opts extractOptions) error {
+	xzr, err := xz.NewReader(io.NewSectionReader(at, 0, size))
+	if err != nil {
+		return errors.Wrap(err, "failed to create xz reader")
+	}
+	return extractTAR(targetDir, xzr, opts)
+}
 
-	tr := tar.NewReader(gzr)
+// extractTARBZ2 extracts a bzip2-compressed tar file into the target directory.
+func extractTARBZ2(targetDir string, at io.ReaderAt, size int64, opts extractOptions) error {
+	return extractTAR(targetDir, bzip2.NewReader(io.NewSectionReader(at, 0, size)), opts)
+}
+
+// extractTAR extracts an uncompressed tar stream into the target directory.
+func extractTAR(targetDir string, in io.Reader, opts extractOptions) error {
+	klog.V(4).Infof("tar: extracting to %q", targetDir)
+	limit := &sizeLimit{max: opts.maxBytes}
+	tr := tar.NewReader(in)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -122,17 +241,20 @@ func extractTARGZ(targetDir string, at io.ReaderAt, size int64) error {
 			continue
 		}
 
-		if err := suspiciousPath(hdr.Name); err != nil {
+		path, err := extractPath(targetDir, hdr.Name)
+		if err != nil {
 			return err
 		}
-
-		path := filepath.Join(targetDir, filepath.FromSlash(hdr.Name))
 		switch hdr.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(path, os.FileMode(hdr.Mode)); err != nil {
 				return errors.Wrap(err, "failed to create directory from tar")
 			}
 		case tar.TypeReg:
+			if opts.include != nil && !opts.include(hdr.Name) {
+				klog.V(4).Infof("tar: skipping %q, it is not needed", hdr.Name)
+				continue
+			}
 			dir := filepath.Dir(path)
 			klog.V(4).Infof("tar: ensuring parent dirs exist for regular file, dir=%s", dir)
 			if err := os.MkdirAll(dir, 0755); err != nil {
@@ -143,11 +265,16 @@ func extractTARGZ(targetDir string, at io.ReaderAt, size int64) error {
 				return errors.Wrapf(err, "failed to create file %q", path)
 			}
 
-			if _, err := io.Copy(f, tr); err != nil {
+			if err := limit.copy(f, tr); err != nil {
 				f.Close()
 				return errors.Wrapf(err, "failed to copy %q from tar into file", hdr.Name)
 			}
 			f.Close()
+			if opts.preserveModes {
+				if err := os.Chmod(path, preservedMode(os.FileMode(hdr.Mode))); err != nil {
+					return errors.Wrapf(err, "failed to set the mode of file %q", path)
+				}
+			}
 		default:
 			return errors.Errorf("unable to handle file type %d for %q in tar", hdr.Typeflag, hdr.Name)
 		}
@@ -157,9 +284,32 @@ func extractTARGZ(targetDir string, at io.ReaderAt, size int64) error {
 	return nil
 }
 
+// PathTraversalError is returned if an archive entry would be extracted
+// outside of the extraction directory (also known as "Zip Slip").
+type PathTraversalError struct {
+	Entry string
+}
+
+func (e *PathTraversalError) Error() string {
+	return fmt.Sprintf("refusing to unpack archive with entry %q outside of the extraction directory", e.Entry)
+}
+
+// extractPath returns the path the archive entry is extracted to, and fails if
+// the path is not inside targetDir.
+func extractPath(targetDir, entry string) (string, error) {
+	if err := suspiciousPath(entry); err != nil {
+		return "", err
+	}
+	path := filepath.Join(targetDir, filepath.FromSlash(entry))
+	if _, ok := pathutil.IsSubPath(filepath.Clean(targetDir), path); !ok {
+		return "", &PathTraversalError{Entry: entry}
+	}
+	return path, nil
+}
+
 func suspiciousPath(path string) error {
 	if strings.Contains(path, "..") {
-		return errors.Errorf("refusing to unpack archive with suspicious entry %q", path)
+		return &PathTraversalError{Entry: path}
 	}
 
 	if strings.HasPrefix(path, `/`) || strings.HasPrefix(path, `\`) {
@@ -169,6 +319,16 @@ func suspiciousPath(path string) error {
 	return nil
 }
 
+// magicNumbers identify the archive formats that http.DetectContentType does
+// not recognize.
+var magicNumbers = []struct {
+	mimeType string
+	magic    []byte
+}{
+	{mimeType: "application/x-xz", magic: []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}},
+	{mimeType: "application/x-bzip2", magic: []byte("BZh")},
+}
+
 func detectMIMEType(at io.ReaderAt) (string, error) {
 	buf := make([]byte, 512)
 	n, err := at.ReadAt(buf, 0)
@@ -179,23 +339,44 @@ func detectMIMEType(at io.ReaderAt) (string, error) {
 		klog.V(5).Infof("Did only read %d of 512 bytes to determine the file type", n)
 	}
 
+	for _, m := range magicNumbers {
+		if bytes.HasPrefix(buf[:n], m.magic) {
+			return m.mimeType, nil
+		}
+	}
+
 	// Cut off mime extra info beginning with ';' i.e:
 	// "text/plain; charset=utf-8" should result in "text/plain".
 	return strings.Split(http.DetectContentType(buf[:n]), ";")[0], nil
 }
 
-type extractor func(targetDir string, read io.ReaderAt, size int64) error
+// extractOptions configure the extraction of an archive.
+type extractOptions struct {
+	// maxBytes limits the total size of the extracted files.
+	maxBytes int64
 
-var defaultExtractors = map[string]extractor{
-	"application/zip":    extractZIP,
-	"application/x-gzip": extractTARGZ,
+	// include, if set, reports whether a regular file of the archive, given
+	// its slash-separated path in the archive, is extracted. Directories are
+	// always created.
+	include func(string) bool
+
+	// preserveModes sets the permission bits of the extracted files to the
+	// ones in the archive (see preservedMode), regardless of the umask of the
+	// process.
+	preserveModes bool
 }
 
-func extractArchive(dst string, at io.ReaderAt, size int64) error {
-	// TODO(ahmetb) This package is not architected well, this method should not
-	// be receiving this many args. Primary problem is at GetInsecure and
-	// GetWithSha256 methods that embed extraction in them, which is orthogonal.
+// extractor extracts an archive into targetDir.
+type extractor func(targetDir string, read io.ReaderAt, size int64, opts extractOptions) error
+
+var defaultExtractors = map[string]extractor{
+	"application/zip":     extractZIP,
+	"application/x-gzip":  extractTARGZ,
+	"application/x-xz":    extractTARXZ,
+	"application/x-bzip2": extractTARBZ2,
+}
 
+func extractArchive(dst string, at io.ReaderAt, size int64, opts extractOptions) error {
 	t, err := detectMIMEType(at)
 	if err != nil {
 		return errors.Wrap(err, "failed to determine content type")
@@ -203,9 +384,9 @@ func extractArchive(dst string, at io.ReaderAt, size int64) error {
 	klog.V(4).Infof("detected %q file type", t)
 	exf, ok := defaultExtractors[t]
 	if !ok {
-		return errors.Errorf("mime type %q for archive file is not a supported archive format", t)
+		return errors.Errorf("unsupported archive format, detected mime type %q", t)
 	}
-	return errors.Wrap(exf(dst, at, size), "failed to extract file")
+	return errors.Wrap(exf(dst, at, size, opts), "failed to extract file")
 
 }
 
@@ -213,6 +394,39 @@ func extractArchive(dst string, at io.ReaderAt, size int64) error {
 type Downloader struct {
 	verifier Verifier
 	fetcher  Fetcher
+
+	// MaxUncompressedBytes limits the total size of the extracted files. If
+	// zero, DefaultMaxUncompressedBytes is used.
+	MaxUncompressedBytes int64
+
+	// CacheDir, if set together with SHA256, is a directory where the
+	// archive is stored after it is verified, named by its sha256 checksum.
+	// If the archive is already in the cache, it is read from there instead
+	// of being downloaded, unless it does not match its checksum. Archives
+	// that were not used for a while are removed when another is stored.
+	CacheDir string
+
+	// SHA256 is the expected sha256 checksum of the archive, which is its
+	// key in CacheDir.
+	SHA256 string
+
+	// Include, if set, reports whether a regular file of the archive, given
+	// its slash-separated path in the archive, is needed. The files it returns
+	// false for are not extracted, which saves writing the files of large
+	// archives that are not used. Directories are always extracted.
+	Include func(entry string) bool
+
+	// PreserveModes sets the permission bits of the extracted files to the
+	// ones in the archive, instead of applying the umask of the process,
+	// except that files are not made writable by group or others. Files of
+	// zip archives created on systems without permission bits get the mode
+	// 0644.
+	PreserveModes bool
+
+	// TempDir is the directory where the archive is written while it is
+	// downloaded and extracted. If empty, the temp directory of the OS is
+	// used.
+	TempDir string
 }
 
 // NewDownloader builds a new Downloader.
@@ -224,11 +438,73 @@ func NewDownloader(v Verifier, f Fetcher) Downloader {
 }
 
 // Get pulls the uri and verifies it. On success, the download gets extracted
-// into dst.
+// into dst. If it fails, the error wraps ErrNetwork, ErrNotFound,
+// ErrChecksumMismatch or ErrExtraction when the cause is one of them.
 func (d Downloader) Get(uri, dst string) error {
-	body, size, err := download(uri, d.verifier, d.fetcher)
+	return d.GetContext(context.Background(), uri, dst)
+}
+
+// GetContext is like Get, but the download is aborted if ctx is cancelled.
+func (d Downloader) GetContext(ctx context.Context, uri, dst string) error {
+	body, size, err := d.archive(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer closeArchive(body)
+	opts := extractOptions{
+		maxBytes:      d.MaxUncompressedBytes,
+		include:       d.Include,
+		preserveModes: d.PreserveModes,
+	}
+	if opts.maxBytes == 0 {
+		opts.maxBytes = DefaultMaxUncompressedBytes
+	}
+	return withKind(ErrExtraction, extractArchive(dst, body, size, opts))
+}
+
+// SaveContext pulls the uri and verifies it like GetContext, but writes the
+// archive to the file dst instead of extracting it. The file is written only
+// if the archive is verified successfully.
+func (d Downloader) SaveContext(ctx context.Context, uri, dst string) error {
+	body, size, err := d.archive(ctx, uri)
 	if err != nil {
 		return err
 	}
-	return extractArchive(dst, body, size)
+	defer closeArchive(body)
+	return writeArchive(dst, body, size)
+}
+
+// archive downloads and verifies the archive at uri, or reads it from the
+// download cache. The caller must release the returned file with
+// closeArchive.
+func (d Downloader) archive(ctx context.Context, uri string) (*os.File, int64, error) {
+	cached := cachePath(d.CacheDir, d.SHA256)
+	if cached != "" {
+		// the cached archive is checked before it goes through the verifier,
+		// which cannot be reused for downloading the archive instead
+		switch err := VerifyFile(cached, d.SHA256); {
+		case err == nil:
+			klog.V(2).Infof("Reading archive of %q from the download cache at %q", uri, cached)
+			markCacheUsed(cached)
+			return download(ctx, uri, d.TempDir, d.verifier, NewFileFetcher(cached))
+		case os.IsNotExist(err):
+		default:
+			klog.Warningf("Removing invalid archive %q from the download cache and downloading it again: %v", cached, err)
+			if err := os.Remove(cached); err != nil {
+				klog.V(2).Infof("Failed to remove invalid cached archive: %v", err)
+			}
+		}
+	}
+	body, size, err := download(ctx, uri, d.TempDir, d.verifier, d.fetcher)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cached != "" {
+		if err := writeArchive(cached, body, size); err != nil {
+			klog.Warningf("Failed to store the archive in the download cache: %v", err)
+		} else if err := evictCache(d.CacheDir, cacheMaxAge); err != nil {
+			klog.V(2).Infof("Failed to evict unused archives from the download cache: %v", err)
+		}
+	}
+	return body, size, nil
 }
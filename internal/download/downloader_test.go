@@ -19,16 +19,24 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"sigs.k8s.io/krew/internal/environment"
 	"sigs.k8s.io/krew/internal/testutil"
 )
 
@@ -71,7 +79,7 @@ func Test_extractZIP(t *testing.T) {
 		}
 		defer zipReader.Close()
 		stat, _ := zipReader.Stat()
-		if err := extractZIP(tmpDir.Root(), zipReader, stat.Size()); err != nil {
+		if err := extractZIP(tmpDir.Root(), zipReader, stat.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes}); err != nil {
 			t.Fatalf("extractZIP(%s) error = %v", tt.in, err)
 		}
 
@@ -82,6 +90,52 @@ func Test_extractZIP(t *testing.T) {
 	}
 }
 
+func Test_extractZIP_backslashSeparators(t *testing.T) {
+	zr, err := zipArchiveReaderForTesting(map[string]string{
+		`foo-v1.0.0\`:          "",
+		`foo-v1.0.0\bin\foo`:   "binary",
+		`foo-v1.0.0\README.md`: "readme",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := testutil.NewTempDir(t)
+	include := func(name string) bool { return name != "foo-v1.0.0/README.md" }
+	if err := extractZIP(tmpDir.Root(), zr, zr.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes, include: include}); err != nil {
+		t.Fatalf("extractZIP() error = %v", err)
+	}
+
+	want := []string{"/foo-v1.0.0/", "/foo-v1.0.0/bin/", "/foo-v1.0.0/bin/foo"}
+	if got := collectFiles(t, tmpDir.Root()); !reflect.DeepEqual(got, want) {
+		t.Errorf("extractZIP() extracted %v, want %v", got, want)
+	}
+}
+
+func Test_extractTARCompressed(t *testing.T) {
+	tests := []struct {
+		in        string
+		extractor extractor
+	}{
+		{in: "test-without-directory.tar.xz", extractor: extractTARXZ},
+		{in: "test-without-directory.tar.bz2", extractor: extractTARBZ2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			b, err := ioutil.ReadFile(filepath.Join(testdataPath(), tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.extractor(tmpDir.Root(), bytes.NewReader(b), int64(len(b)), extractOptions{maxBytes: DefaultMaxUncompressedBytes}); err != nil {
+				t.Fatalf("failed to extract %q. error=%v", tt.in, err)
+			}
+			if outFiles := collectFiles(t, tmpDir.Root()); !reflect.DeepEqual(outFiles, []string{"/foo"}) {
+				t.Fatalf("for %q, expected=%v, got=%v", tt.in, []string{"/foo"}, outFiles)
+			}
+		})
+	}
+}
+
 func Test_extractTARGZ(t *testing.T) {
 	tests := []struct {
 		in    string
@@ -121,7 +175,7 @@ func Test_extractTARGZ(t *testing.T) {
 			t.Fatal(err)
 			return
 		}
-		if err := extractTARGZ(tmpDir.Root(), tf, st.Size()); err != nil {
+		if err := extractTARGZ(tmpDir.Root(), tf, st.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes}); err != nil {
 			t.Fatalf("failed to extract %q. error=%v", tt.in, err)
 		}
 
@@ -156,7 +210,10 @@ var _ Fetcher = errorFetcher{}
 
 type errorFetcher struct{}
 
-func (f errorFetcher) Get(_ string) (io.ReadCloser, error) { return nil, errors.New("test fail") }
+func (f errorFetcher) Get(_ context.Context, _ string) (io.ReadCloser, error) {
+	return nil, errors.New("test fail")
+}
+func (f errorFetcher) Head(_ context.Context, _ string) error { return errors.New("test fail") }
 
 func TestDownloader_Get(t *testing.T) {
 	type fields struct {
@@ -200,6 +257,219 @@ func TestDownloader_Get(t *testing.T) {
 	}
 }
 
+func TestDownloader_Get_cache(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	archive := filepath.Join(testdataPath(), "test-with-directory.zip")
+	const sha = "693173c09a2d0fd5911aff818ca932a2e10d63dbd0f962aff2aad19a2d5341af"
+	cacheDir := tmpDir.Path("cache")
+
+	d := NewDownloader(NewSha256Verifier(sha), NewFileFetcher(archive))
+	d.CacheDir, d.SHA256 = cacheDir, sha
+	if err := d.Get("foo/bar/test-with-directory.zip", tmpDir.Path("first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, sha)); err != nil {
+		t.Fatalf("archive was not stored in the cache: %v", err)
+	}
+
+	d = NewDownloader(NewSha256Verifier(sha), errorFetcher{})
+	d.CacheDir, d.SHA256 = cacheDir, sha
+	if err := d.Get("foo/bar/test-with-directory.zip", tmpDir.Path("second")); err != nil {
+		t.Fatalf("cached archive was not used: %v", err)
+	}
+	if _, err := os.Stat(tmpDir.Path("second")); err != nil {
+		t.Errorf("cached archive was not extracted: %v", err)
+	}
+
+	tmpDir.Write(filepath.Join("cache", sha), []byte("corrupt"))
+	d = NewDownloader(NewSha256Verifier(sha), errorFetcher{})
+	d.CacheDir, d.SHA256 = cacheDir, sha
+	if err := d.Get("foo/bar/test-with-directory.zip", tmpDir.Path("third")); err == nil {
+		t.Fatal("expected error for corrupt cached archive that cannot be downloaded")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, sha)); !os.IsNotExist(err) {
+		t.Errorf("corrupt cached archive was not removed, err=%v", err)
+	}
+
+	// a corrupt cached archive is downloaded again
+	tmpDir.Write(filepath.Join("cache", sha), []byte("corrupt"))
+	d = NewDownloader(NewSha256Verifier(sha), NewFileFetcher(archive))
+	d.CacheDir, d.SHA256 = cacheDir, sha
+	if err := d.Get("foo/bar/test-with-directory.zip", tmpDir.Path("fourth")); err != nil {
+		t.Fatalf("corrupt cached archive was not downloaded again: %v", err)
+	}
+	if err := VerifyFile(filepath.Join(cacheDir, sha), sha); err != nil {
+		t.Errorf("expected the downloaded archive in the cache: %v", err)
+	}
+}
+
+func Test_evictCache(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("used", []byte("content"))
+	tmpDir.Write("unused", []byte("content"))
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(tmpDir.Path("unused"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmpDir.Path("used"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	markCacheUsed(tmpDir.Path("used"))
+
+	if err := evictCache(tmpDir.Root(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmpDir.Path("used")); err != nil {
+		t.Errorf("recently used archive was removed: %v", err)
+	}
+	if _, err := os.Stat(tmpDir.Path("unused")); !os.IsNotExist(err) {
+		t.Errorf("unused archive was not removed, err=%v", err)
+	}
+}
+
+func TestDownloader_Get_errorKinds(t *testing.T) {
+	archive := filepath.Join(testdataPath(), "test-with-directory.zip")
+	const archiveSha = "693173c09a2d0fd5911aff818ca932a2e10d63dbd0f962aff2aad19a2d5341af"
+	notArchive := filepath.Join(testdataPath(), "bash-ascii-file")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/missing":
+			http.NotFound(w, req)
+		case "/error":
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			http.ServeFile(w, req, archive)
+		}
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	notArchiveContent, err := ioutil.ReadFile(notArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allKinds := []error{ErrNetwork, ErrNotFound, ErrChecksumMismatch, ErrExtraction}
+	tests := []struct {
+		name     string
+		verifier Verifier
+		fetcher  Fetcher
+		uri      string
+		want     error
+	}{
+		{
+			name:     "http 404",
+			verifier: newTrueVerifier(),
+			fetcher:  HTTPFetcher{},
+			uri:      server.URL + "/missing",
+			want:     ErrNotFound,
+		},
+		{
+			name:     "http 500",
+			verifier: newTrueVerifier(),
+			fetcher:  HTTPFetcher{},
+			uri:      server.URL + "/error",
+			want:     ErrNetwork,
+		},
+		{
+			name:     "connection refused",
+			verifier: newTrueVerifier(),
+			fetcher:  HTTPFetcher{},
+			uri:      closed.URL + "/archive.zip",
+			want:     ErrNetwork,
+		},
+		{
+			name:     "missing local file",
+			verifier: newTrueVerifier(),
+			fetcher:  NewFileFetcher(filepath.Join(testdataPath(), "does-not-exist.zip")),
+			uri:      "does-not-exist.zip",
+			want:     ErrNotFound,
+		},
+		{
+			name:     "checksum mismatch",
+			verifier: NewSha256Verifier(strings.Repeat("0", 64)),
+			fetcher:  HTTPFetcher{},
+			uri:      server.URL + "/archive.zip",
+			want:     ErrChecksumMismatch,
+		},
+		{
+			name:     "not an archive",
+			verifier: NewSha256Verifier(fmt.Sprintf("%x", sha256.Sum256(notArchiveContent))),
+			fetcher:  NewFileFetcher(notArchive),
+			uri:      "bash-ascii-file",
+			want:     ErrExtraction,
+		},
+		{
+			name:     "success",
+			verifier: NewSha256Verifier(archiveSha),
+			fetcher:  HTTPFetcher{},
+			uri:      server.URL + "/archive.zip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+
+			err := NewDownloader(tt.verifier, tt.fetcher).Get(tt.uri, tmpDir.Root())
+			if (err != nil) != (tt.want != nil) {
+				t.Fatalf("Downloader.Get() error = %v, expected %v", err, tt.want)
+			}
+			for _, kind := range allKinds {
+				if got := errors.Is(err, kind); got != (kind == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, kind, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloader_SaveContext(t *testing.T) {
+	archive := filepath.Join(testdataPath(), "test-with-directory.zip")
+	const sha = "693173c09a2d0fd5911aff818ca932a2e10d63dbd0f962aff2aad19a2d5341af"
+	want, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := testutil.NewTempDir(t)
+
+	dst := tmpDir.Path(filepath.Join("out", "archive.zip"))
+	if err := NewDownloader(NewSha256Verifier(sha), NewFileFetcher(archive)).SaveContext(context.Background(), "archive.zip", dst); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("saved archive differs from the downloaded archive")
+	}
+
+	invalid := tmpDir.Path(filepath.Join("out", "invalid.zip"))
+	err = NewDownloader(NewSha256Verifier(strings.Repeat("0", 64)), NewFileFetcher(archive)).SaveContext(context.Background(), "archive.zip", invalid)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("SaveContext() error = %v, expected %v", err, ErrChecksumMismatch)
+	}
+	if files, _ := ioutil.ReadDir(tmpDir.Path("out")); len(files) != 1 {
+		t.Errorf("expected only the valid archive in the output directory, found %d files", len(files))
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	p := environment.NewPaths(tmpDir.Root())
+	tmpDir.Write(filepath.Join("cache", "downloads", "archive"), []byte("content"))
+
+	if err := PurgeCache(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p.DownloadCachePath()); !os.IsNotExist(err) {
+		t.Errorf("download cache was not purged, err=%v", err)
+	}
+	if err := PurgeCache(p); err != nil {
+		t.Errorf("purging an empty cache failed: %v", err)
+	}
+}
+
 func Test_download(t *testing.T) {
 	filePath := filepath.Join(testdataPath(), "test-with-directory.zip")
 	downloadOriginal, err := ioutil.ReadFile(filePath)
@@ -244,7 +514,7 @@ func Test_download(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			reader, size, err := download(tt.args.url, tt.args.verifier, tt.args.fetcher)
+			reader, size, err := download(context.Background(), tt.args.url, "", tt.args.verifier, tt.args.fetcher)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("download() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -252,6 +522,7 @@ func Test_download(t *testing.T) {
 			if tt.wantErr {
 				return
 			}
+			defer closeArchive(reader)
 			downloadedData, err := ioutil.ReadAll(io.NewSectionReader(reader, 0, size))
 			if err != nil {
 				t.Errorf("failed to read download data: %v", err)
@@ -273,6 +544,84 @@ func Test_download(t *testing.T) {
 	}
 }
 
+func TestDownloader_Get_streamsLargeArchive(t *testing.T) {
+	const fileSize = 32 << 20
+	tmpDir := testutil.NewTempDir(t)
+	verifier := &countingVerifier{}
+	d := NewDownloader(verifier, largeArchiveFetcher{fileSize})
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := d.Get("foo/bar/large.tar.gz", tmpDir.Root()); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+
+	if verifier.n <= fileSize {
+		t.Errorf("verifier got %d bytes, expected the whole archive of more than %d bytes", verifier.n, fileSize)
+	}
+	fi, err := os.Stat(tmpDir.Path("large"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != fileSize {
+		t.Errorf("extracted file has %d bytes, expected %d", fi.Size(), fileSize)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > fileSize/4 {
+		t.Errorf("allocated %d bytes to download and extract an archive of %d bytes, expected it to be streamed", allocated, verifier.n)
+	}
+}
+
+// largeArchiveFetcher serves an uncompressed tar.gz archive with a single
+// file of zeros of the given size, generated as it is read.
+type largeArchiveFetcher struct{ size int64 }
+
+func (f largeArchiveFetcher) Get(_ context.Context, _ string) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		gz, err := gzip.NewWriterLevel(pw, gzip.NoCompression)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		tw := tar.NewWriter(gz)
+		err = tw.WriteHeader(&tar.Header{Name: "large", Mode: 0644, Size: f.size, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.CopyN(tw, zeroReader{}, f.size)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+func (f largeArchiveFetcher) Head(_ context.Context, _ string) error { return nil }
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// countingVerifier counts the bytes written to it, and always verifies.
+type countingVerifier struct{ n int64 }
+
+func (v *countingVerifier) Write(p []byte) (int, error) {
+	v.n += int64(len(p))
+	return len(p), nil
+}
+
+func (v *countingVerifier) Verify() error { return nil }
+
 var _ Verifier = trueVerifier{}
 
 type trueVerifier struct{ io.Writer }
@@ -315,6 +664,22 @@ func Test_detectMIMEType(t *testing.T) {
 			want:    "application/x-gzip",
 			wantErr: false,
 		},
+		{
+			name: "type tar.xz",
+			args: args{
+				file: filepath.Join(testdataPath(), "test-without-directory.tar.xz"),
+			},
+			want:    "application/x-xz",
+			wantErr: false,
+		},
+		{
+			name: "type tar.bz2",
+			args: args{
+				file: filepath.Join(testdataPath(), "test-without-directory.tar.bz2"),
+			},
+			want:    "application/x-bzip2",
+			wantErr: false,
+		},
 		{
 			name: "type bash-utf8",
 			args: args{
@@ -407,8 +772,8 @@ func Test_extractArchive(t *testing.T) {
 		defaultExtractors = oldextractors
 	}()
 	defaultExtractors = map[string]extractor{
-		"application/octet-stream": func(targetDir string, read io.ReaderAt, size int64) error { return nil },
-		"text/plain":               func(targetDir string, read io.ReaderAt, size int64) error { return errors.New("fail test") },
+		"application/octet-stream": func(string, io.ReaderAt, int64, extractOptions) error { return nil },
+		"text/plain":               func(string, io.ReaderAt, int64, extractOptions) error { return errors.New("fail test") },
 	}
 	type args struct {
 		filename string
@@ -452,7 +817,7 @@ func Test_extractArchive(t *testing.T) {
 				return
 			}
 
-			if err := extractArchive(tt.args.dst, fd, st.Size()); (err != nil) != tt.wantErr {
+			if err := extractArchive(tt.args.dst, fd, st.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes}); (err != nil) != tt.wantErr {
 				t.Errorf("extractArchive() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -519,6 +884,245 @@ func Test_suspiciousPath(t *testing.T) {
 	}
 }
 
+func Test_extractArchive_maxUncompressedBytes(t *testing.T) {
+	// 1 MiB of zeros compresses to about 1 KiB
+	files := map[string]string{"a": strings.Repeat("\x00", 512<<10), "b": strings.Repeat("\x00", 512<<10)}
+	tarGZ, err := tarGZArchiveForTesting(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zip, err := zipArchiveReaderForTesting(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		archive  *bytes.Reader
+		maxBytes int64
+		wantErr  bool
+	}{
+		{name: "tar.gz within limit", archive: tarGZ, maxBytes: 1 << 20},
+		{name: "tar.gz exceeds limit", archive: tarGZ, maxBytes: 1<<20 - 1, wantErr: true},
+		{name: "zip within limit", archive: zip, maxBytes: 1 << 20},
+		{name: "zip exceeds limit", archive: zip, maxBytes: 1<<20 - 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			err := extractArchive(tmpDir.Root(), tt.archive, tt.archive.Size(), extractOptions{maxBytes: tt.maxBytes})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "maximum uncompressed size") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func Test_extractArchive_include(t *testing.T) {
+	// a large archive of which only the executable is needed
+	files := map[string]string{"bin/foo": "#!/bin/sh"}
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("docs/page-%d.html", i)] = strings.Repeat("x", 16<<10)
+	}
+	include := func(entry string) bool { return strings.HasPrefix(entry, "bin/") }
+
+	for name, newArchive := range map[string]func(map[string]string) (*bytes.Reader, error){
+		"tar.gz": tarGZArchiveForTesting,
+		"zip":    zipArchiveReaderForTesting,
+	} {
+		t.Run(name, func(t *testing.T) {
+			archive, err := newArchive(files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmpDir := testutil.NewTempDir(t)
+			if err := extractArchive(tmpDir.Path("all"), archive, archive.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes}); err != nil {
+				t.Fatal(err)
+			}
+			if err := extractArchive(tmpDir.Path("included"), archive, archive.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes, include: include}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := collectFiles(t, tmpDir.Path("included")), []string{"/bin/", "/bin/foo"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("extracted files = %v, want %v", got, want)
+			}
+			all, included := dirSize(t, tmpDir.Path("all")), dirSize(t, tmpDir.Path("included"))
+			t.Logf("extracted %d bytes of the needed files instead of %d bytes", included, all)
+			if included != int64(len(files["bin/foo"])) {
+				t.Errorf("extracted %d bytes, expected only the %d bytes of the needed file", included, len(files["bin/foo"]))
+			}
+		})
+	}
+}
+
+func Test_extractArchive_preserveModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on windows")
+	}
+	modes := map[string]os.FileMode{
+		"bin/foo":       0755,
+		"lib/helper.sh": 0750,
+		"secret":        0600,
+		"setuid":        os.ModeSetuid | 0755,
+		"writable":      0777,
+	}
+
+	var tarBuf bytes.Buffer
+	gw := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gw)
+	for name, mode := range modes {
+		hdr := &tar.Header{Name: name, Size: 1, Mode: int64(mode.Perm())}
+		if mode&os.ModeSetuid != 0 {
+			hdr.Mode |= 04000
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for name, mode := range modes {
+		fh := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		fh.SetMode(mode)
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// entries created on Windows have no permission bits
+	w, err := zw.Create("windows.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		want    map[string]os.FileMode
+	}{
+		{
+			name:    "tar.gz",
+			archive: tarBuf.Bytes(),
+			want:    map[string]os.FileMode{"bin/foo": 0755, "lib/helper.sh": 0750, "secret": 0600, "setuid": 0755, "writable": 0755},
+		},
+		{
+			name:    "zip",
+			archive: zipBuf.Bytes(),
+			want:    map[string]os.FileMode{"bin/foo": 0755, "lib/helper.sh": 0750, "secret": 0600, "setuid": 0755, "writable": 0755, "windows.txt": 0644},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			r := bytes.NewReader(tt.archive)
+			if err := extractArchive(tmpDir.Root(), r, r.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes, preserveModes: true}); err != nil {
+				t.Fatal(err)
+			}
+			for file, mode := range tt.want {
+				fi, err := os.Stat(tmpDir.Path(file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.Mode() != mode {
+					t.Errorf("mode of %s = %v, want %v", file, fi.Mode(), mode)
+				}
+			}
+		})
+	}
+}
+
+// dirSize returns the total size of the files in dir.
+func dirSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return size
+}
+
+func TestDownloader_Get_maxUncompressedBytes(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	archive, err := tarGZArchiveForTesting(map[string]string{"foo": strings.Repeat("a", 1<<10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir.Write("archive.tar.gz", b)
+
+	d := NewDownloader(newTrueVerifier(), NewFileFetcher(tmpDir.Path("archive.tar.gz")))
+	d.MaxUncompressedBytes = 100
+	if err := d.Get("", tmpDir.Path("out")); err == nil || !strings.Contains(err.Error(), "maximum uncompressed size of 100 bytes") {
+		t.Fatalf("expected error for archive exceeding the maximum uncompressed size, got: %v", err)
+	}
+}
+
+func Test_extractArchive_pathTraversal(t *testing.T) {
+	for _, entry := range []string{"../evil", "a/../../evil", `..\evil`} {
+		for name, newArchive := range map[string]func(map[string]string) (*bytes.Reader, error){
+			"tar.gz": tarGZArchiveForTesting,
+			"zip":    zipArchiveReaderForTesting,
+		} {
+			t.Run(name+" "+entry, func(t *testing.T) {
+				tmpDir := testutil.NewTempDir(t)
+				archive, err := newArchive(map[string]string{entry: "malicious content"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = extractArchive(tmpDir.Path("extract"), archive, archive.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes})
+				if _, ok := errors.Cause(err).(*PathTraversalError); !ok {
+					t.Fatalf("expected PathTraversalError, got: %v", err)
+				}
+				if _, err := os.Stat(tmpDir.Path("evil")); !os.IsNotExist(err) {
+					t.Errorf("file was extracted outside of the extraction directory")
+				}
+			})
+		}
+	}
+}
+
+func Test_extractPath(t *testing.T) {
+	targetDir := filepath.Join("tmp", "extract")
+	if got, err := extractPath(targetDir, "foo/bar"); err != nil || got != filepath.Join(targetDir, "foo", "bar") {
+		t.Errorf("extractPath() = %q, %v", got, err)
+	}
+	if _, err := extractPath(targetDir, "foo/../../bar"); err == nil {
+		t.Error("expected error for entry outside of the extraction directory")
+	}
+}
+
 func Test_extractMaliciousArchive(t *testing.T) {
 	const testContent = "some file content"
 
@@ -546,7 +1150,7 @@ func Test_extractMaliciousArchive(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = extractTARGZ(tmpDir.Root(), reader, reader.Size())
+			err = extractTARGZ(tmpDir.Root(), reader, reader.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes})
 			if err == nil {
 				t.Errorf("Expected extractTARGZ to fail")
 			} else if !strings.HasPrefix(err.Error(), "refusing to unpack archive") {
@@ -565,7 +1169,7 @@ func Test_extractMaliciousArchive(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = extractZIP(tmpDir.Root(), reader, reader.Size())
+			err = extractZIP(tmpDir.Root(), reader, reader.Size(), extractOptions{maxBytes: DefaultMaxUncompressedBytes})
 			if err == nil {
 				t.Errorf("Expected extractZIP to fail")
 			} else if !strings.HasPrefix(err.Error(), "refusing to unpack archive") {
@@ -0,0 +1,109 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// The errors returned by Downloader and the Fetchers wrap one of these errors
+// to tell why a download failed, which can be checked with errors.Is.
+var (
+	// ErrNetwork is wrapped by errors of requests that fail or of responses
+	// that cannot be read, and of unexpected http status codes.
+	ErrNetwork = errors.New("network error")
+
+	// ErrNotFound is wrapped by errors of files that do not exist, like an
+	// http 404 response.
+	ErrNotFound = errors.New("file not found")
+
+	// ErrChecksumMismatch is matched by a *ChecksumMismatchError.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrExtraction is wrapped by errors of archives that cannot be extracted.
+	ErrExtraction = errors.New("extraction failed")
+)
+
+// kindError tags err with one of the sentinel errors of this package, without
+// changing its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Unwrap() error { return e.err }
+
+// Cause returns the underlying error for errors.Cause.
+func (e *kindError) Cause() error { return e.err }
+
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// withKind tags err with kind. It returns nil if err is nil.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// networkError tags err with ErrNetwork, unless it was caused by ctx being
+// cancelled.
+func networkError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	return withKind(ErrNetwork, err)
+}
+
+// fileError tags err with ErrNotFound if it reports that a file does not
+// exist.
+func fileError(err error) error {
+	if os.IsNotExist(err) {
+		return withKind(ErrNotFound, err)
+	}
+	return err
+}
+
+// statusError returns the error of an unexpected http status code of the
+// response from uri.
+func statusError(code int, uri string) error {
+	kind := ErrNetwork
+	if code == http.StatusNotFound || code == http.StatusGone {
+		kind = ErrNotFound
+	}
+	return withKind(kind, errors.Errorf("unexpected status code (http %d) from %q", code, uri))
+}
+
+// readErrorReader records the errors of reading from r, so that they can be
+// told apart from the errors of writing what was read.
+type readErrorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrorReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
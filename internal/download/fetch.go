@@ -15,44 +15,504 @@
 package download
 
 import (
+	"context"
+	"crypto/sha256"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/version"
 )
 
-// Fetcher is used to get files from a URI.
+// Fetcher is used to get files from a URI. Cancelling the context aborts an
+// in-flight request.
 type Fetcher interface {
 	// Get gets the file and returns an stream to read the file.
-	Get(uri string) (io.ReadCloser, error)
+	Get(ctx context.Context, uri string) (io.ReadCloser, error)
+
+	// Head checks that the file exists without reading it.
+	Head(ctx context.Context, uri string) error
 }
 
 var _ Fetcher = HTTPFetcher{}
 
+// Sizer is implemented by the Fetchers that can tell the size of a file
+// without downloading it.
+type Sizer interface {
+	// Size returns the size of the file in bytes, or -1 if it is unknown.
+	Size(ctx context.Context, uri string) (int64, error)
+}
+
+var (
+	_ Sizer = HTTPFetcher{}
+	_ Sizer = fileFetcher{}
+)
+
+// maxDownloadAttempts is the number of times HTTPFetcher tries to resume an
+// interrupted download before giving up.
+const maxDownloadAttempts = 5
+
+// defaultMaxRedirects is the number of redirects HTTPFetcher follows for a
+// request if its MaxRedirects is not set.
+const defaultMaxRedirects = 10
+
+// downloadTimeoutEnv is the environment variable limiting the duration of the
+// requests of HTTPFetcher, e.g. "90s", if its Timeout is not set.
+const downloadTimeoutEnv = "KREW_DOWNLOAD_TIMEOUT"
+
+var (
+	envDownloadTimeout     time.Duration
+	envDownloadTimeoutOnce sync.Once
+)
+
+// downloadTimeout returns the duration set in the KREW_DOWNLOAD_TIMEOUT
+// environment variable, or zero if it is not set or invalid.
+func downloadTimeout() time.Duration {
+	envDownloadTimeoutOnce.Do(func() {
+		envDownloadTimeout = parseDownloadTimeout(os.Getenv(downloadTimeoutEnv))
+	})
+	return envDownloadTimeout
+}
+
+// parseDownloadTimeout parses the value of KREW_DOWNLOAD_TIMEOUT. Invalid
+// values are ignored with a warning.
+func parseDownloadTimeout(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		klog.Warningf("Ignoring invalid %s=%q, it must be a duration like \"90s\"", downloadTimeoutEnv, v)
+		return 0
+	}
+	return d
+}
+
+// defaultHTTPClient is used by HTTPFetcher if no client is specified. It does
+// not limit the total duration of a request, as plugin archives can be large,
+// unless a timeout is configured.
+var defaultHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
 // HTTPFetcher is used to get a file from a http:// or https:// schema path.
-type HTTPFetcher struct{}
+type HTTPFetcher struct {
+	// Client is used to make the requests. If nil, a default client with
+	// connection timeouts is used.
+	Client *http.Client
+
+	// PartialDir, if set, is a directory where the file is downloaded to a
+	// ".partial" file first, so that an interrupted download is resumed using
+	// HTTP range requests instead of starting over.
+	PartialDir string
+
+	// Headers are added to the requests made to the host they are keyed by,
+	// e.g. to authenticate to a private artifact registry. A key is either
+	// a host name or a host:port. The headers are not sent to other hosts,
+	// including when a request is redirected.
+	Headers map[string]http.Header
+
+	// Progress, if set, is called as the file is downloaded.
+	Progress ProgressFunc
+
+	// Timeout limits the duration of each request, including reading the
+	// response body. If zero, the duration set in the KREW_DOWNLOAD_TIMEOUT
+	// environment variable is used, and requests are not limited if it is
+	// not set either.
+	Timeout time.Duration
+
+	// MaxRedirects limits the number of redirects followed for a request.
+	// If zero, up to 10 redirects are followed. If negative, redirects are
+	// not followed.
+	MaxRedirects int
+}
+
+// ProgressFunc is called as a file is read with the number of bytes read so
+// far and the size of the file, or -1 if the size is not known.
+type ProgressFunc func(downloaded, total int64)
+
+// progressReader calls fn after each read from r.
+type progressReader struct {
+	r        io.Reader
+	fn       ProgressFunc
+	n, total int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.fn(p.n, p.total)
+	}
+	return n, err
+}
+
+// withProgress returns rc that calls fn as it is read, if fn is not nil.
+func withProgress(rc io.ReadCloser, fn ProgressFunc, total int64) io.ReadCloser {
+	if fn == nil {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&progressReader{r: rc, fn: fn, total: total}, rc}
+}
+
+// NewHTTPFetcherWithClient returns an HTTPFetcher that makes requests with the
+// given client, e.g. to use a proxy or custom TLS configuration.
+func NewHTTPFetcherWithClient(c *http.Client) HTTPFetcher {
+	return HTTPFetcher{Client: c}
+}
+
+func (f HTTPFetcher) client() *http.Client {
+	c := defaultHTTPClient
+	if f.Client != nil {
+		c = f.Client
+	}
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = downloadTimeout()
+	}
+	if timeout <= 0 {
+		return c
+	}
+	withTimeout := *c
+	withTimeout.Timeout = timeout
+	return &withTimeout
+}
+
+// do sends the request, adding the Headers configured for its host, and the
+// User-Agent of krew unless the Headers set one. Redirects are followed as
+// allowed by checkRedirect.
+func (f HTTPFetcher) do(req *http.Request) (*http.Response, error) {
+	var keys []string
+	for k, h := range f.Headers {
+		if !matchesHost(k, req.URL) {
+			continue
+		}
+		keys = append(keys, k)
+		for name, values := range h {
+			for _, v := range values {
+				req.Header.Add(name, v)
+			}
+		}
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", version.UserAgent())
+	}
+
+	c := *f.client()
+	c.CheckRedirect = f.checkRedirect(keys, c.CheckRedirect)
+	resp, err := c.Do(req)
+	if err == nil && resp.Request != nil && resp.Request.URL.String() != req.URL.String() {
+		klog.V(2).Infof("Request to %q was redirected to %q", req.URL, resp.Request.URL)
+	}
+	return resp, err
+}
+
+// checkRedirect returns the redirect policy of a request, which logs each
+// redirect, stops after the maximum number of redirects, and removes the
+// Headers configured for the host keys from redirects to other hosts, as the
+// client copies the headers of the original request to redirects. The redirect
+// policy of the client, if not nil, is applied afterwards.
+func (f HTTPFetcher) checkRedirect(keys []string, next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		prev := via[len(via)-1]
+		klog.V(2).Infof("Following redirect #%d from %q to %q", len(via), prev.URL, req.URL)
+		if !strings.EqualFold(prev.URL.Host, req.URL.Host) {
+			klog.V(1).Infof("Request to %q is redirected from host %q to host %q", via[0].URL, prev.URL.Host, req.URL.Host)
+		}
+		limit := f.maxRedirects()
+		if limit == 0 {
+			return errors.Errorf("redirect to %q is not allowed", req.URL)
+		}
+		if len(via) > limit {
+			return errors.Errorf("stopped after %d redirects", limit)
+		}
+		for _, k := range keys {
+			if !matchesHost(k, req.URL) {
+				for name := range f.Headers[k] {
+					req.Header.Del(name)
+				}
+			}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+}
+
+// maxRedirects returns the maximum number of redirects followed for a request.
+func (f HTTPFetcher) maxRedirects() int {
+	switch {
+	case f.MaxRedirects < 0:
+		return 0
+	case f.MaxRedirects == 0:
+		return defaultMaxRedirects
+	default:
+		return f.MaxRedirects
+	}
+}
+
+// matchesHost checks if the host or host:port key refers to the host of u.
+func matchesHost(key string, u *url.URL) bool {
+	if strings.Contains(key, ":") {
+		return strings.EqualFold(key, u.Host)
+	}
+	return strings.EqualFold(key, u.Hostname())
+}
 
 // Get gets the file and returns an stream to read the file.
-func (HTTPFetcher) Get(uri string) (io.ReadCloser, error) {
+func (f HTTPFetcher) Get(ctx context.Context, uri string) (io.ReadCloser, error) {
+	if f.PartialDir != "" {
+		return f.getResumable(ctx, uri)
+	}
 	klog.V(2).Infof("Fetching %q", uri)
-	resp, err := http.Get(uri)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to download %q", uri)
+		return nil, errors.Wrapf(err, "failed to create request for %q", uri)
 	}
-	return resp.Body, nil
+	resp, err := f.do(req)
+	if err != nil {
+		return nil, errors.Wrapf(networkError(ctx, err), "failed to download %q", uri)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, statusError(resp.StatusCode, uri)
+	}
+	return withProgress(resp.Body, f.Progress, resp.ContentLength), nil
+}
+
+// getResumable downloads the file into PartialDir, resuming the download if
+// it gets interrupted. The returned file is deleted when it is closed.
+func (f HTTPFetcher) getResumable(ctx context.Context, uri string) (io.ReadCloser, error) {
+	path := filepath.Join(f.PartialDir, fmt.Sprintf("%x.partial", sha256.Sum256([]byte(uri))))
+	var err error
+	attempts := 0
+	for attempts < maxDownloadAttempts {
+		attempts++
+		klog.V(2).Infof("Fetching %q (attempt %d/%d)", uri, attempts, maxDownloadAttempts)
+		if err = f.downloadPartial(ctx, uri, path); err == nil {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to open downloaded file %q", path)
+			}
+			return partialFile{file}, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrNotFound) {
+			break
+		}
+		klog.V(2).Infof("Download of %q was interrupted: %v", uri, err)
+	}
+	os.Remove(path)
+	if ctx.Err() != nil {
+		return nil, errors.Wrapf(ctx.Err(), "download of %q was cancelled", uri)
+	}
+	if attempts == 1 {
+		return nil, err
+	}
+	return nil, errors.Wrapf(err, "failed to download %q after %d attempts", uri, attempts)
+}
+
+// downloadPartial appends the remainder of the file at uri to the file at
+// path, and returns an error unless the download is complete.
+func (f HTTPFetcher) downloadPartial(ctx context.Context, uri, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open partial download file %q", path)
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "failed to find the size of partial download")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for %q", uri)
+	}
+	if offset > 0 {
+		klog.V(2).Infof("Resuming download of %q from byte %d", uri, offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := f.do(req)
+	if err != nil {
+		return errors.Wrapf(networkError(ctx, err), "failed to download %q", uri)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start := contentRangeStart(resp.Header.Get("Content-Range")); start != offset {
+			// the content cannot be appended, the next attempt starts over
+			if err := file.Truncate(0); err != nil {
+				return errors.Wrap(err, "failed to truncate partial download")
+			}
+			return withKind(ErrNetwork, errors.Errorf("server returned content from byte %d instead of %d, restarting download", start, offset))
+		}
+	case http.StatusOK:
+		if offset > 0 {
+			klog.V(2).Infof("Server does not support range requests, restarting download")
+			if err := file.Truncate(0); err != nil {
+				return errors.Wrap(err, "failed to truncate partial download")
+			}
+			if offset, err = file.Seek(0, io.SeekStart); err != nil {
+				return errors.Wrap(err, "failed to truncate partial download")
+			}
+		}
+	default:
+		return statusError(resp.StatusCode, uri)
+	}
+
+	read := &readErrorReader{r: resp.Body}
+	var body io.Reader = read
+	if f.Progress != nil {
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+		body = &progressReader{r: read, fn: f.Progress, n: offset, total: total}
+	}
+	n, err := io.Copy(file, body)
+	if err != nil {
+		if read.err != nil {
+			err = networkError(ctx, err)
+		}
+		return errors.Wrapf(err, "failed to download %q", uri)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return withKind(ErrNetwork, errors.Errorf("incomplete download, got %d of %d bytes", offset+n, offset+resp.ContentLength))
+	}
+	return nil
+}
+
+// contentRangeStart returns the position of the first byte in the
+// Content-Range header of a partial response, or -1 if it cannot be parsed.
+func contentRangeStart(contentRange string) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end); err != nil {
+		return -1
+	}
+	return start
+}
+
+// partialFile is a completely downloaded file that is deleted on Close.
+type partialFile struct{ *os.File }
+
+func (f partialFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.Remove(f.Name()); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// Head checks that the file can be retrieved by sending a HEAD request.
+func (f HTTPFetcher) Head(ctx context.Context, uri string) error {
+	_, err := f.head(ctx, uri)
+	return err
+}
+
+// Size returns the Content-Length of the file reported for a HEAD request, or
+// -1 if it is unknown.
+func (f HTTPFetcher) Size(ctx context.Context, uri string) (int64, error) {
+	resp, err := f.head(ctx, uri)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+func (f HTTPFetcher) head(ctx context.Context, uri string) (*http.Response, error) {
+	klog.V(2).Infof("Checking %q", uri)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request for %q", uri)
+	}
+	resp, err := f.do(req)
+	if err != nil {
+		return nil, errors.Wrapf(networkError(ctx, err), "failed to reach %q", uri)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, statusError(resp.StatusCode, uri)
+	}
+	return resp, nil
 }
 
 var _ Fetcher = fileFetcher{}
 
-type fileFetcher struct{ f string }
+type fileFetcher struct {
+	f        string
+	progress ProgressFunc
+}
 
-func (f fileFetcher) Get(_ string) (io.ReadCloser, error) {
+func (f fileFetcher) Get(ctx context.Context, _ string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	klog.V(2).Infof("Reading %q", f.f)
 	file, err := os.Open(f.f)
-	return file, errors.Wrapf(err, "failed to open archive file %q for reading", f.f)
+	if err != nil {
+		return nil, errors.Wrapf(fileError(err), "failed to open archive file %q for reading", f.f)
+	}
+	if f.progress == nil {
+		return file, nil
+	}
+	st, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "failed to get size of archive file %q", f.f)
+	}
+	return withProgress(file, f.progress, st.Size()), nil
+}
+
+func (f fileFetcher) Head(ctx context.Context, _ string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := os.Stat(f.f)
+	return errors.Wrapf(fileError(err), "failed to find archive file %q", f.f)
+}
+
+func (f fileFetcher) Size(ctx context.Context, _ string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	st, err := os.Stat(f.f)
+	if err != nil {
+		return 0, errors.Wrapf(fileError(err), "failed to find archive file %q", f.f)
+	}
+	return st.Size(), nil
 }
 
 // NewFileFetcher returns a local file reader.
 func NewFileFetcher(path string) Fetcher { return fileFetcher{f: path} }
+
+// NewFileFetcherWithProgress returns a local file reader that calls fn as the
+// file is read, with the size of the file as the total.
+func NewFileFetcherWithProgress(path string, fn ProgressFunc) Fetcher {
+	return fileFetcher{f: path, progress: fn}
+}
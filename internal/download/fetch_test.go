@@ -0,0 +1,505 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/internal/version"
+)
+
+// interruptingHandler serves content, but the first response is cut off after
+// half of the content is sent.
+func interruptingHandler(content []byte, supportsRange bool) http.Handler {
+	var requests int
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			return
+		}
+		if !supportsRange {
+			req.Header.Del("Range")
+		}
+		http.ServeContent(w, req, "archive", time.Time{}, bytes.NewReader(content))
+	})
+}
+
+// ignoringRangeStartHandler serves the whole content as a partial response
+// to range requests, like a server ignoring the start of the range.
+func ignoringRangeStartHandler(content []byte, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Range") == "" {
+			h.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content)
+	})
+}
+
+func TestHTTPFetcher_resumesInterruptedDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("krew"), 1024)
+	tests := []struct {
+		name             string
+		supportsRange    bool
+		ignoresRangeFrom bool
+	}{
+		{name: "server supports range requests", supportsRange: true},
+		{name: "server ignores range requests", supportsRange: false},
+		{name: "server ignores the start of range requests", supportsRange: true, ignoresRangeFrom: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			handler := interruptingHandler(content, tt.supportsRange)
+			if tt.ignoresRangeFrom {
+				handler = ignoringRangeStartHandler(content, handler)
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			body, err := HTTPFetcher{PartialDir: tmpDir.Root()}.Get(context.Background(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := body.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("downloaded %d bytes, differs from the served %d bytes", len(got), len(content))
+			}
+			if files, _ := ioutil.ReadDir(tmpDir.Root()); len(files) != 0 {
+				t.Errorf("partial download file was not cleaned up")
+			}
+		})
+	}
+}
+
+func TestHTTPFetcher_failsOnErrorStatus(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := (HTTPFetcher{PartialDir: tmpDir.Root()}).Get(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("expected error for http 404 response")
+	}
+	if strings.Contains(err.Error(), "attempts") {
+		t.Errorf("expected a single attempt for http 404 response, got: %v", err)
+	}
+}
+
+func TestHTTPFetcher_cancelledContext(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	content := bytes.Repeat([]byte("krew"), 1024)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-req.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := HTTPFetcher{PartialDir: tmpDir.Root()}.Get(ctx, server.URL)
+	if err == nil {
+		t.Fatal("expected error for cancelled download")
+	}
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("expected the context error, got: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(tmpDir.Root()); len(files) != 0 {
+		t.Errorf("partial download file was not cleaned up")
+	}
+}
+
+func TestHTTPFetcher_progress(t *testing.T) {
+	content := bytes.Repeat([]byte("krew"), 1024)
+	tests := []struct {
+		name       string
+		partialDir bool
+	}{
+		{name: "streamed download"},
+		{name: "resumable download", partialDir: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				http.ServeContent(w, req, "archive", time.Time{}, bytes.NewReader(content))
+			})
+			if tt.partialDir {
+				handler = interruptingHandler(content, true)
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			var calls int
+			var downloaded, total int64
+			f := HTTPFetcher{Progress: func(d, t int64) {
+				calls++
+				downloaded, total = d, t
+			}}
+			if tt.partialDir {
+				f.PartialDir = testutil.NewTempDir(t).Root()
+			}
+			body, err := f.Get(context.Background(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ioutil.ReadAll(body); err != nil {
+				t.Fatal(err)
+			}
+			body.Close()
+			if calls == 0 {
+				t.Fatal("progress func was not called")
+			}
+			if want := int64(len(content)); downloaded != want || total != want {
+				t.Errorf("last progress = (%d, %d), want (%d, %d)", downloaded, total, want, want)
+			}
+		})
+	}
+}
+
+func TestFileFetcher_progress(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("archive", []byte("content"))
+
+	var downloaded, total int64
+	body, err := NewFileFetcherWithProgress(tmpDir.Path("archive"), func(d, t int64) {
+		downloaded, total = d, t
+	}).Get(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if _, err := ioutil.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+	if downloaded != 7 || total != 7 {
+		t.Errorf("last progress = (%d, %d), want (7, 7)", downloaded, total)
+	}
+}
+
+type headerRoundTripper struct {
+	key, value string
+}
+
+func (h headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(h.key, h.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewHTTPFetcherWithClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Test") != "custom-client" {
+			http.Error(w, "request not made with custom client", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	f := NewHTTPFetcherWithClient(&http.Client{Transport: headerRoundTripper{"X-Test", "custom-client"}})
+	if err := f.Head(context.Background(), server.URL); err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	body, err := f.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "content" {
+		t.Errorf("Get() returned %q, expected %q", b, "content")
+	}
+
+	if err := (HTTPFetcher{}).Head(context.Background(), server.URL); err == nil {
+		t.Error("expected default client to not set the custom header")
+	}
+}
+
+func TestHTTPFetcher_timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-req.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	start := time.Now()
+	body, err := HTTPFetcher{Timeout: 100 * time.Millisecond}.Get(context.Background(), server.URL)
+	if err == nil {
+		_, err = ioutil.ReadAll(body)
+		body.Close()
+	}
+	if err == nil {
+		t.Fatal("expected the download to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("download was not aborted after the timeout, took %v", elapsed)
+	}
+}
+
+func Test_parseDownloadTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "", want: 0},
+		{in: "90s", want: 90 * time.Second},
+		{in: "2m30s", want: 150 * time.Second},
+		{in: "0", want: 0},
+		{in: "90", want: 0},
+		{in: "-1s", want: 0},
+		{in: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseDownloadTimeout(tt.in); got != tt.want {
+				t.Errorf("parseDownloadTimeout(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcher_userAgent(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = append(got, req.UserAgent())
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (HTTPFetcher{}).Head(context.Background(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	f := HTTPFetcher{Headers: map[string]http.Header{u.Host: {"User-Agent": {"custom"}}}}
+	if err := f.Head(context.Background(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{version.UserAgent(), "custom"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests had user agents %q, expected %q", got, want)
+	}
+}
+
+func TestHTTPFetcher_Size(t *testing.T) {
+	content := []byte("some archive content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	size, err := (HTTPFetcher{}).Size(context.Background(), server.URL+"/archive.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("Size() = %d, expected %d", size, len(content))
+	}
+	if _, err := (HTTPFetcher{}).Size(context.Background(), server.URL+"/missing"); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestHTTPFetcher_hostHeaders(t *testing.T) {
+	var otherHostAuth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		otherHostAuth = req.Header.Get("Authorization")
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer other.Close()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Path == "/redirect" {
+			http.Redirect(w, req, other.URL, http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := HTTPFetcher{Headers: map[string]http.Header{
+		u.Host: {"Authorization": []string{"Bearer token"}},
+	}}
+
+	if err := f.Head(context.Background(), registry.URL); err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	if err := (HTTPFetcher{}).Head(context.Background(), registry.URL); err == nil {
+		t.Error("expected error without the configured headers")
+	}
+
+	body, err := f.Get(context.Background(), registry.URL+"/redirect")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body.Close()
+	if otherHostAuth != "" {
+		t.Errorf("headers were sent to the redirected host: Authorization=%q", otherHostAuth)
+	}
+
+	body, err = f.Get(context.Background(), other.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body.Close()
+	if otherHostAuth != "" {
+		t.Errorf("headers were sent to another host: Authorization=%q", otherHostAuth)
+	}
+}
+
+func TestHTTPFetcher_redirects(t *testing.T) {
+	var otherHostToken string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		otherHostToken = req.Header.Get("Private-Token")
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer other.Close()
+
+	// /hop/N redirects to /hop/N-1, and /hop/0 redirects to the other host
+	var registryTokens []string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		registryTokens = append(registryTokens, req.Header.Get("Private-Token"))
+		n, err := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/hop/"))
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		if n == 0 {
+			http.Redirect(w, req, other.URL, http.StatusFound)
+			return
+		}
+		http.Redirect(w, req, "/hop/"+strconv.Itoa(n-1), http.StatusFound)
+	}))
+	defer registry.Close()
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]http.Header{u.Host: {"Private-Token": []string{"secret"}}}
+
+	tests := []struct {
+		name         string
+		maxRedirects int
+		wantErr      bool
+	}{
+		{name: "default limit", maxRedirects: 0},
+		{name: "within limit", maxRedirects: 3},
+		{name: "exceeds limit", maxRedirects: 2, wantErr: true},
+		{name: "redirects disabled", maxRedirects: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otherHostToken, registryTokens = "", nil
+			f := HTTPFetcher{Headers: headers, MaxRedirects: tt.maxRedirects}
+			// 2 redirects on the registry, and 1 to the other host
+			body, err := f.Get(context.Background(), registry.URL+"/hop/2")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer body.Close()
+			if b, err := ioutil.ReadAll(body); err != nil || string(b) != "content" {
+				t.Errorf("Get() read %q, err=%v", b, err)
+			}
+			for i, token := range registryTokens {
+				if token != "secret" {
+					t.Errorf("request #%d to the registry has Private-Token=%q, want the configured header", i, token)
+				}
+			}
+			if otherHostToken != "" {
+				t.Errorf("headers were sent to the redirected host: Private-Token=%q", otherHostToken)
+			}
+		})
+	}
+}
+
+func Test_matchesHost(t *testing.T) {
+	tests := []struct {
+		key, uri string
+		want     bool
+	}{
+		{key: "example.com", uri: "https://example.com/foo.tar.gz", want: true},
+		{key: "EXAMPLE.com", uri: "https://example.com/foo.tar.gz", want: true},
+		{key: "example.com", uri: "https://example.com:8443/foo.tar.gz", want: true},
+		{key: "example.com:8443", uri: "https://example.com:8443/foo.tar.gz", want: true},
+		{key: "example.com:8443", uri: "https://example.com/foo.tar.gz", want: false},
+		{key: "example.com", uri: "https://evil.example.com/foo.tar.gz", want: false},
+		{key: "example.com", uri: "https://example.com.evil.io/foo.tar.gz", want: false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matchesHost(tt.key, u); got != tt.want {
+			t.Errorf("matchesHost(%q, %q) = %v, want %v", tt.key, tt.uri, got, tt.want)
+		}
+	}
+}
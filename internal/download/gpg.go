@@ -0,0 +1,126 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+)
+
+var _ ContextVerifier = &gpgVerifier{}
+
+// gpgVerifier checks the written content against a detached signature using
+// the gpg command.
+type gpgVerifier struct {
+	keyRing string
+	sigURL  string
+	tempDir string
+	fetcher Fetcher
+
+	data *os.File
+}
+
+// NewGPGVerifier creates a Verifier that checks the content against the
+// detached signature at sigURL, which must be signed by a key in the given
+// public keyring file. It requires the gpg command to be installed. The
+// content and the signature are written to temporary files in tempDir, or in
+// the temp directory of the OS if it is empty. The signature is fetched with
+// fetcher, e.g. with the headers and client used for the archive, and the
+// fetch is aborted if the context passed to VerifyContext is cancelled.
+func NewGPGVerifier(publicKeyRing, sigURL, tempDir string, fetcher Fetcher) ContextVerifier {
+	return &gpgVerifier{
+		keyRing: publicKeyRing,
+		sigURL:  sigURL,
+		tempDir: tempDir,
+		fetcher: fetcher,
+	}
+}
+
+func (v *gpgVerifier) Write(p []byte) (int, error) {
+	if v.data == nil {
+		f, err := ioutil.TempFile(v.tempDir, "krew-gpg-data")
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to create temporary file for signature verification")
+		}
+		v.data = f
+	}
+	return v.data.Write(p)
+}
+
+// Close removes the temporary file of the written content. It is called by
+// Verify, and must be called if Verify is not, e.g. if the download fails.
+func (v *gpgVerifier) Close() error {
+	if v.data == nil {
+		return nil
+	}
+	v.data.Close()
+	err := os.Remove(v.data.Name())
+	v.data = nil
+	return err
+}
+
+func (v *gpgVerifier) Verify() error {
+	return v.VerifyContext(context.Background())
+}
+
+func (v *gpgVerifier) VerifyContext(ctx context.Context) error {
+	if v.data == nil {
+		return errors.New("no content to verify the signature against")
+	}
+	data := v.data.Name()
+	defer v.Close()
+	if err := v.data.Close(); err != nil {
+		return errors.Wrap(err, "failed to write content for signature verification")
+	}
+
+	klog.V(2).Infof("Fetching signature from %q", v.sigURL)
+	sig, err := v.fetcher.Get(ctx, v.sigURL)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch signature")
+	}
+	defer sig.Close()
+	sigFile, err := ioutil.TempFile(v.tempDir, "krew-gpg-sig")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file for signature")
+	}
+	defer os.Remove(sigFile.Name())
+	_, err = io.Copy(sigFile, sig)
+	sigFile.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to read signature")
+	}
+
+	keyRing, err := filepath.Abs(v.keyRing)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the absolute path of keyring %q", v.keyRing)
+	}
+	klog.V(1).Infof("Verify signature using keyring %q", keyRing)
+	cmd := osexec.CommandContext(ctx, "gpg", "--batch", "--no-default-keyring", "--keyring", keyRing,
+		"--verify", sigFile.Name(), data)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "signature verification failed, output=%q", out.String())
+	}
+	return nil
+}
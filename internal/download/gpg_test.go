@@ -0,0 +1,155 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	osexec "os/exec"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/testutil"
+)
+
+func runGPG(t *testing.T, args ...string) {
+	t.Helper()
+	out, err := osexec.Command("gpg", append([]string{"--batch"}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("gpg %v failed: %v, output=%s", args, err, out)
+	}
+}
+
+func TestGPGVerifier(t *testing.T) {
+	if _, err := osexec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	tmpDir := testutil.NewTempDir(t)
+	if err := os.Mkdir(tmpDir.Path("gnupg"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GNUPGHOME", tmpDir.Path("gnupg"))
+	defer func() {
+		_ = osexec.Command("gpgconf", "--kill", "gpg-agent").Run()
+		os.Unsetenv("GNUPGHOME")
+	}()
+
+	content := []byte("plugin archive content")
+	tmpDir.Write("www/archive", content)
+	runGPG(t, "--passphrase", "", "--quick-gen-key", "krew-test@example.com", "ed25519", "sign", "never")
+	runGPG(t, "--output", tmpDir.Path("keyring.gpg"), "--export", "krew-test@example.com")
+	runGPG(t, "--armor", "--output", tmpDir.Path("www/archive.asc"), "--detach-sign", tmpDir.Path("www/archive"))
+
+	files := http.FileServer(http.Dir(tmpDir.Path("www")))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := HTTPFetcher{Headers: map[string]http.Header{
+		serverURL.Host: {"Authorization": []string{"Bearer token"}},
+	}}
+
+	tests := []struct {
+		name    string
+		content []byte
+		sigURL  string
+		noAuth  bool
+		wantErr bool
+	}{
+		{
+			name:    "valid signature",
+			content: content,
+			sigURL:  server.URL + "/archive.asc",
+		},
+		{
+			name:    "tampered content",
+			content: []byte("malicious content"),
+			sigURL:  server.URL + "/archive.asc",
+			wantErr: true,
+		},
+		{
+			name:    "missing signature",
+			content: content,
+			sigURL:  server.URL + "/not-found.asc",
+			wantErr: true,
+		},
+		{
+			name:    "signature fetched without the headers",
+			content: content,
+			sigURL:  server.URL + "/archive.asc",
+			noAuth:  true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := fetcher
+			if tt.noAuth {
+				f = HTTPFetcher{}
+			}
+			v := NewGPGVerifier(tmpDir.Path("keyring.gpg"), tt.sigURL, "", f)
+			_, _ = io.Copy(v, bytes.NewReader(tt.content))
+			if err := v.Verify(); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		v := NewGPGVerifier(tmpDir.Path("keyring.gpg"), server.URL+"/archive.asc", "", fetcher)
+		_, _ = io.Copy(v, bytes.NewReader(content))
+		if err := v.VerifyContext(ctx); err == nil {
+			t.Error("expected the verification to be aborted")
+		}
+	})
+}
+
+func TestGPGVerifier_removesTempFiles(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("archive", []byte("plugin archive content"))
+	if err := os.Mkdir(tmpDir.Path("tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature is not verified if the checksum does not match
+	verifier := NewVerifierChain(
+		NewSha256Verifier("0000000000000000000000000000000000000000000000000000000000000000"),
+		NewGPGVerifier(tmpDir.Path("keyring.gpg"), "http://127.0.0.1:0/archive.asc", tmpDir.Path("tmp"), HTTPFetcher{}))
+	if _, _, err := download(context.Background(), "archive", tmpDir.Path("tmp"), verifier, NewFileFetcher(tmpDir.Path("archive"))); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	files, err := ioutil.ReadDir(tmpDir.Path("tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected the temporary files to be removed, found %d", len(files))
+	}
+}
@@ -16,41 +16,167 @@ package download
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"fmt"
 	"hash"
 	"io"
+	"os"
 
 	"github.com/pkg/errors"
 	"k8s.io/klog"
 )
 
-// Verifier can check a reader against it's correctness.
+// Verifier can check a reader against it's correctness. Verifiers that hold
+// resources like temporary files while the content is written also implement
+// io.Closer to release them, whether Verify was called or not.
 type Verifier interface {
 	io.Writer
 	Verify() error
 }
 
-var _ Verifier = sha256Verifier{}
+// ContextVerifier is a Verifier whose verification can be aborted by
+// cancelling a context, e.g. because it makes network requests.
+type ContextVerifier interface {
+	Verifier
+	VerifyContext(ctx context.Context) error
+}
+
+// verify verifies v, with ctx if it is a ContextVerifier.
+func verify(ctx context.Context, v Verifier) error {
+	if cv, ok := v.(ContextVerifier); ok {
+		return cv.VerifyContext(ctx)
+	}
+	return v.Verify()
+}
+
+// ChecksumMismatchError is returned when the checksum of the verified content
+// does not match the expected value.
+type ChecksumMismatchError struct {
+	Expected, Got string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum does not match, want: %s, got %s", e.Expected, e.Got)
+}
+
+// Is reports whether target is ErrChecksumMismatch.
+func (e *ChecksumMismatchError) Is(target error) bool { return target == ErrChecksumMismatch }
+
+var _ ContextVerifier = verifierChain{}
+
+type verifierChain []Verifier
+
+// NewVerifierChain creates a Verifier that writes the content to all given
+// verifiers and succeeds only if all of them verify successfully.
+func NewVerifierChain(verifiers ...Verifier) Verifier {
+	return verifierChain(verifiers)
+}
+
+func (c verifierChain) Write(p []byte) (int, error) {
+	for _, v := range c {
+		if _, err := v.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c verifierChain) Verify() error {
+	return c.VerifyContext(context.Background())
+}
+
+func (c verifierChain) VerifyContext(ctx context.Context) error {
+	for _, v := range c {
+		if err := verify(ctx, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the verifiers of the chain that implement io.Closer, and
+// returns the first error.
+func (c verifierChain) Close() error {
+	var err error
+	for _, v := range c {
+		if closer, ok := v.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
 
-type sha256Verifier struct {
+// The checksum algorithms supported by NewChecksumVerifier.
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+var _ Verifier = checksumVerifier{}
+
+type checksumVerifier struct {
 	hash.Hash
+	algo       string
 	wantedHash []byte
 }
 
 // NewSha256Verifier creates a Verifier that tests against the given hash.
 func NewSha256Verifier(hashed string) Verifier {
+	return newChecksumVerifier(SHA256, sha256.New(), hashed)
+}
+
+// NewChecksumVerifier creates a Verifier that tests against the given
+// hex-encoded sum computed with the algorithm algo, which is SHA256 or SHA512.
+func NewChecksumVerifier(algo, sum string) (Verifier, error) {
+	switch algo {
+	case SHA256:
+		return newChecksumVerifier(algo, sha256.New(), sum), nil
+	case SHA512:
+		return newChecksumVerifier(algo, sha512.New(), sum), nil
+	default:
+		return nil, errors.Errorf("unsupported checksum algorithm %q", algo)
+	}
+}
+
+func newChecksumVerifier(algo string, h hash.Hash, hashed string) checksumVerifier {
 	raw, _ := hex.DecodeString(hashed)
-	return sha256Verifier{
-		Hash:       sha256.New(),
+	return checksumVerifier{
+		Hash:       h,
+		algo:       algo,
 		wantedHash: raw,
 	}
 }
 
-func (v sha256Verifier) Verify() error {
-	klog.V(1).Infof("Compare sha256 (%s) signed version", hex.EncodeToString(v.wantedHash))
+func (v checksumVerifier) Verify() error {
+	klog.V(1).Infof("Compare %s (%s) signed version", v.algo, hex.EncodeToString(v.wantedHash))
 	if bytes.Equal(v.wantedHash, v.Sum(nil)) {
 		return nil
 	}
-	return errors.Errorf("checksum does not match, want: %x, got %x", v.wantedHash, v.Sum(nil))
+	return &ChecksumMismatchError{
+		Expected: hex.EncodeToString(v.wantedHash),
+		Got:      hex.EncodeToString(v.Sum(nil)),
+	}
+}
+
+// VerifyFile checks the file at path against the given sha256 sum. The file is
+// streamed through the verifier instead of being read into memory. If the file
+// does not exist, the returned error can be checked with os.IsNotExist. If the
+// checksum does not match, the error is a *ChecksumMismatchError.
+func VerifyFile(path, sha256sum string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	v := NewSha256Verifier(sha256sum)
+	if _, err := io.Copy(v, f); err != nil {
+		return errors.Wrapf(err, "failed to read file %q", path)
+	}
+	return v.Verify()
 }
@@ -17,7 +17,11 @@ package download
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"sigs.k8s.io/krew/internal/testutil"
 )
 
 func TestSha256Verifier(t *testing.T) {
@@ -58,3 +62,101 @@ func TestSha256Verifier(t *testing.T) {
 		})
 	}
 }
+
+func TestChecksumVerifier(t *testing.T) {
+	const (
+		helloSha256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+		helloSha512 = "309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f"
+	)
+	tests := []struct {
+		name      string
+		algo      string
+		sum       string
+		write     []byte
+		wantError bool
+	}{
+		{name: "sha256 okay", algo: SHA256, sum: helloSha256, write: []byte("hello world")},
+		{name: "sha256 wrong", algo: SHA256, sum: helloSha256, write: []byte("HELLO WORLD"), wantError: true},
+		{name: "sha512 okay", algo: SHA512, sum: helloSha512, write: []byte("hello world")},
+		{name: "sha512 wrong", algo: SHA512, sum: helloSha512, write: []byte("HELLO WORLD"), wantError: true},
+		{name: "sha512 given a sha256 sum", algo: SHA512, sum: helloSha256, write: []byte("hello world"), wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewChecksumVerifier(tt.algo, tt.sum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(v, bytes.NewReader(tt.write))
+			err = v.Verify()
+			if (err != nil) != tt.wantError {
+				t.Fatalf("NewChecksumVerifier(%s).Write(%x).Verify() = %v, wantError %v", tt.algo, tt.write, err, tt.wantError)
+			}
+			if _, ok := err.(*ChecksumMismatchError); tt.wantError && !ok {
+				t.Errorf("expected a *ChecksumMismatchError, got %T", err)
+			}
+		})
+	}
+
+	if _, err := NewChecksumVerifier("md5", "5eb63bbbe01eeed093cb22bb8f5acdc3"); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+}
+
+func TestVerifierChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifiers []Verifier
+		wantError bool
+	}{
+		{
+			name:      "empty chain",
+			verifiers: nil,
+		},
+		{
+			name:      "all verifiers pass",
+			verifiers: []Verifier{newTrueVerifier(), NewSha256Verifier("b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")},
+		},
+		{
+			name:      "one verifier fails",
+			verifiers: []Verifier{newTrueVerifier(), newFalseVerifier()},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifierChain(tt.verifiers...)
+			_, _ = io.Copy(v, bytes.NewReader([]byte("hello world")))
+			if err := v.Verify(); (err != nil) != tt.wantError {
+				t.Errorf("NewVerifierChain().Verify() = %v, wantErr %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	const helloWorldHash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("good", []byte("hello world"))
+	tmpDir.Write("bad", []byte("HELLO WORLD"))
+
+	if err := VerifyFile(tmpDir.Path("good"), helloWorldHash); err != nil {
+		t.Errorf("VerifyFile() with matching checksum failed: %v", err)
+	}
+
+	err := VerifyFile(tmpDir.Path("bad"), helloWorldHash)
+	mismatch, ok := err.(*ChecksumMismatchError)
+	if !ok {
+		t.Fatalf("VerifyFile() with wrong checksum returned %T (%v), expected *ChecksumMismatchError", err, err)
+	}
+	if mismatch.Expected != helloWorldHash {
+		t.Errorf("expected checksum = %s, want %s", mismatch.Expected, helloWorldHash)
+	}
+	if mismatch.Got == helloWorldHash || mismatch.Got == "" {
+		t.Errorf("unexpected actual checksum %q", mismatch.Got)
+	}
+
+	if err := VerifyFile(filepath.Join(tmpDir.Root(), "not-exists"), helloWorldHash); !os.IsNotExist(err) {
+		t.Errorf("VerifyFile() with missing file returned %v, expected a not-exist error", err)
+	}
+}
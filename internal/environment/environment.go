@@ -47,8 +47,21 @@ func MustGetKrewPaths() Paths {
 	return NewPaths(base)
 }
 
+// NewPaths returns the paths of a krew installation at base. Temporary files
+// are staged in TempDir.
 func NewPaths(base string) Paths {
-	return Paths{base: base, tmp: os.TempDir()}
+	return Paths{base: base, tmp: TempDir()}
+}
+
+// TempDir returns the directory for the temporary files of krew, which is set
+// in the KREW_TMPDIR environment variable, or the temp directory of the OS if
+// it is not set.
+func TempDir() string {
+	if fromEnv := os.Getenv("KREW_TMPDIR"); fromEnv != "" {
+		klog.V(4).Infof("using environment override KREW_TMPDIR=%s", fromEnv)
+		return fromEnv
+	}
+	return os.TempDir()
 }
 
 // BasePath returns krew base directory.
@@ -88,6 +101,26 @@ func (p Paths) BinPath() string { return filepath.Join(p.base, "bin") }
 // e.g. {BasePath}/store
 func (p Paths) InstallPath() string { return filepath.Join(p.base, "store") }
 
+// DownloadCachePath returns the directory where downloaded plugin archives
+// are cached.
+//
+// e.g. {BasePath}/cache/downloads
+func (p Paths) DownloadCachePath() string { return filepath.Join(p.base, "cache", "downloads") }
+
+// StagingPath returns the directory where plugin archives are downloaded and
+// extracted before the files are moved into the installation directory. It
+// can be on a different filesystem than BasePath, e.g. if BasePath is on a
+// slow network filesystem.
+//
+// e.g. $KREW_TMPDIR or the temp directory of the OS
+func (p Paths) StagingPath() string { return p.tmp }
+
+// LockPath returns the path of the file locked by krew processes while they
+// modify the installed plugins.
+//
+// e.g. {BasePath}/krew.lock
+func (p Paths) LockPath() string { return filepath.Join(p.base, "krew.lock") }
+
 // PluginInstallPath returns the path to install the plugin.
 //
 // e.g. {InstallPath}/{version}/{..files..}
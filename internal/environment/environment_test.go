@@ -46,6 +46,32 @@ func TestMustGetKrewPaths_envOverride(t *testing.T) {
 	}
 }
 
+func TestNewPaths_stagingPath(t *testing.T) {
+	if got, expected := NewPaths("/foo").StagingPath(), os.TempDir(); got != expected {
+		t.Errorf("StagingPath()=%s; expected=%s", got, expected)
+	}
+
+	custom := filepath.FromSlash("/custom/tmp")
+	os.Setenv("KREW_TMPDIR", custom)
+	defer os.Unsetenv("KREW_TMPDIR")
+	if got := NewPaths("/foo").StagingPath(); got != custom {
+		t.Errorf("StagingPath()=%s; expected=%s", got, custom)
+	}
+}
+
+func TestTempDir(t *testing.T) {
+	if got, expected := TempDir(), os.TempDir(); got != expected {
+		t.Errorf("TempDir()=%s; expected=%s", got, expected)
+	}
+
+	custom := filepath.FromSlash("/custom/tmp")
+	os.Setenv("KREW_TMPDIR", custom)
+	defer os.Unsetenv("KREW_TMPDIR")
+	if got := TempDir(); got != custom {
+		t.Errorf("TempDir()=%s; expected=%s", got, custom)
+	}
+}
+
 func TestPaths(t *testing.T) {
 	base := filepath.FromSlash("/foo")
 	p := NewPaths(base)
@@ -66,6 +92,12 @@ func TestPaths(t *testing.T) {
 	if got, expected := p.InstallPath(), filepath.FromSlash("/foo/store"); got != expected {
 		t.Errorf("InstallPath()=%s; expected=%s", got, expected)
 	}
+	if got, expected := p.DownloadCachePath(), filepath.FromSlash("/foo/cache/downloads"); got != expected {
+		t.Errorf("DownloadCachePath()=%s; expected=%s", got, expected)
+	}
+	if got, expected := p.LockPath(), filepath.FromSlash("/foo/krew.lock"); got != expected {
+		t.Errorf("LockPath()=%s; expected=%s", got, expected)
+	}
 	if got, expected := p.PluginInstallPath("my-plugin"), filepath.FromSlash("/foo/store/my-plugin"); got != expected {
 		t.Errorf("PluginInstallPath()=%s; expected=%s", got, expected)
 	}
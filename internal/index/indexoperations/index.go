@@ -18,15 +18,22 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 
 	"sigs.k8s.io/krew/internal/environment"
 	"sigs.k8s.io/krew/internal/gitutil"
+	"sigs.k8s.io/krew/internal/pathutil"
+	"sigs.k8s.io/krew/pkg/constants"
 )
 
 var validNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 
+// ErrAmbiguousPlugin indicates that a plugin name without an index is provided
+// by more than one of the configured indexes.
+var ErrAmbiguousPlugin = errors.New("plugin is provided by multiple indexes")
+
 // Index describes the name and URL of a configured index.
 type Index struct {
 	Name string
@@ -82,3 +89,88 @@ func DeleteIndex(paths environment.Paths, name string) error {
 func IsValidIndexName(name string) bool {
 	return validNamePattern.MatchString(name)
 }
+
+// FindPluginIndexes returns the names of the configured indexes that have a
+// manifest for the given plugin name. The name is matched exactly against the
+// manifests listed in the indexes, also on case-insensitive filesystems.
+func FindPluginIndexes(paths environment.Paths, pluginName string) ([]string, error) {
+	dirs, err := ioutil.ReadDir(paths.IndexBase())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to list directory")
+	}
+
+	var out []string
+	for _, dir := range dirs {
+		names, err := pluginManifestNames(paths, dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		if names[pluginName] {
+			out = append(out, dir.Name())
+		}
+	}
+	return out, nil
+}
+
+// pluginManifestNames returns the names of the plugins that have a manifest
+// in the index, as listed in its plugins directory.
+func pluginManifestNames(paths environment.Paths, indexName string) (map[string]bool, error) {
+	dir := paths.IndexPluginsPath(indexName)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to list plugin manifests in %s", dir)
+	}
+	out := make(map[string]bool, len(files))
+	for _, f := range files {
+		if name := f.Name(); strings.HasSuffix(name, constants.ManifestExtension) {
+			out[strings.TrimSuffix(name, constants.ManifestExtension)] = true
+		}
+	}
+	return out, nil
+}
+
+// ResolvePluginName resolves the index and the name of the plugin specified as
+// NAME or INDEX/NAME. A NAME without an index resolves to the default index,
+// unless the plugin is provided by more than one index, in which case it
+// returns an error with the cause ErrAmbiguousPlugin.
+//
+// Surrounding whitespace is ignored, and if there is no manifest for the
+// plugin name, but there is one for the name in lowercase (e.g. "foo" for
+// "Foo"), the lowercase name is returned. Names are matched against the
+// manifests listed in the indexes, also on case-insensitive filesystems.
+func ResolvePluginName(paths environment.Paths, name string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	if strings.Contains(name, "/") {
+		indexName, pluginName := pathutil.CanonicalPluginName(name)
+		names, err := pluginManifestNames(paths, indexName)
+		if err != nil {
+			return "", "", err
+		}
+		if lower := strings.ToLower(pluginName); !names[pluginName] && names[lower] {
+			pluginName = lower
+		}
+		return indexName, pluginName, nil
+	}
+
+	indexes, err := FindPluginIndexes(paths, name)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to find the indexes providing plugin %q", name)
+	}
+	if lower := strings.ToLower(name); len(indexes) == 0 && lower != name {
+		if indexes, err = FindPluginIndexes(paths, lower); err != nil {
+			return "", "", errors.Wrapf(err, "failed to find the indexes providing plugin %q", lower)
+		}
+		if len(indexes) > 0 {
+			name = lower
+		}
+	}
+	if len(indexes) > 1 {
+		return "", "", errors.Wrapf(ErrAmbiguousPlugin, "plugin %q is provided by indexes %s, specify it as INDEX/%s",
+			name, strings.Join(indexes, ", "), name)
+	}
+	return constants.DefaultIndexName, name, nil
+}
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
 
 	"sigs.k8s.io/krew/internal/environment"
 	"sigs.k8s.io/krew/internal/testutil"
@@ -174,3 +175,61 @@ func TestIsValidIndexName(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvePluginName(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	paths := environment.NewPaths(tmpDir.Root())
+	for _, f := range []string{"default/plugins/foo.yaml", "default/plugins/bar.yaml", "default/plugins/Qux.yaml", "custom/plugins/foo.yaml", "custom/plugins/baz.yaml"} {
+		tmpDir.Write(filepath.Join("index", f), nil)
+	}
+
+	tests := []struct {
+		name          string
+		wantIndex     string
+		wantPlugin    string
+		wantAmbiguous bool
+	}{
+		{name: "bar", wantIndex: "default", wantPlugin: "bar"},
+		{name: "baz", wantIndex: "default", wantPlugin: "baz"},
+		{name: "unknown", wantIndex: "default", wantPlugin: "unknown"},
+		{name: "foo", wantAmbiguous: true},
+		{name: "default/foo", wantIndex: "default", wantPlugin: "foo"},
+		{name: "custom/foo", wantIndex: "custom", wantPlugin: "foo"},
+		{name: " bar\t", wantIndex: "default", wantPlugin: "bar"},
+		{name: "Bar", wantIndex: "default", wantPlugin: "bar"},
+		{name: "BAZ", wantIndex: "default", wantPlugin: "baz"},
+		{name: "Qux", wantIndex: "default", wantPlugin: "Qux"},
+		{name: "Unknown", wantIndex: "default", wantPlugin: "Unknown"},
+		{name: "FOO", wantAmbiguous: true},
+		{name: "custom/BAZ", wantIndex: "custom", wantPlugin: "baz"},
+		{name: "custom/Unknown", wantIndex: "custom", wantPlugin: "Unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexName, pluginName, err := ResolvePluginName(paths, tt.name)
+			if tt.wantAmbiguous {
+				if errors.Cause(err) != ErrAmbiguousPlugin {
+					t.Fatalf("expected ErrAmbiguousPlugin, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if indexName != tt.wantIndex || pluginName != tt.wantPlugin {
+				t.Errorf("ResolvePluginName(%q) = (%q, %q), want (%q, %q)", tt.name, indexName, pluginName, tt.wantIndex, tt.wantPlugin)
+			}
+		})
+	}
+}
+
+func TestFindPluginIndexes_noIndexes(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	indexes, err := FindPluginIndexes(environment.NewPaths(tmpDir.Root()), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 0 {
+		t.Errorf("expected no indexes, got %v", indexes)
+	}
+}
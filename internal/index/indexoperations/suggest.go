@@ -0,0 +1,106 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexoperations
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+// maxSuggestions is the maximum number of names SimilarPluginNames returns.
+const maxSuggestions = 3
+
+// SimilarPluginNames returns the names of up to three plugins in the index
+// that are spelled similarly to name, ignoring case, most similar first. It
+// is used to suggest the plugin a user meant when name does not exist.
+func SimilarPluginNames(paths environment.Paths, indexName, name string) ([]string, error) {
+	files, err := ioutil.ReadDir(paths.IndexPluginsPath(indexName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the plugins of index %q", indexName)
+	}
+
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	name = strings.ToLower(strings.TrimSpace(name))
+	maxDistance := len(name) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), constants.ManifestExtension) {
+			continue
+		}
+		candidate := strings.TrimSuffix(f.Name(), constants.ManifestExtension)
+		if d := levenshtein(name, strings.ToLower(candidate)); d <= maxDistance {
+			matches = append(matches, match{name: candidate, distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+	var out []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		out = append(out, matches[i].name)
+	}
+	return out, nil
+}
+
+// levenshtein returns the edit distance of a and b, which is the number of
+// inserted, deleted or substituted characters to change a into b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, n := range v[1:] {
+		if n < m {
+			m = n
+		}
+	}
+	return m
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexoperations
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/testutil"
+)
+
+func TestSimilarPluginNames(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	paths := environment.NewPaths(tmpDir.Root())
+	for _, name := range []string{"ctx", "ns", "view-secret", "view-serviceaccount-kubeconfig", "view-utilization", "who-can"} {
+		tmpDir.Write(filepath.Join("index", "default", "plugins", name+".yaml"), nil)
+	}
+	tmpDir.Write(filepath.Join("index", "default", "plugins", "README.md"), nil)
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "ctx", want: []string{"ctx"}},
+		{name: "CTX", want: []string{"ctx"}},
+		{name: "cxt", want: nil},
+		{name: "cx", want: []string{"ctx"}},
+		{name: "n", want: []string{"ns"}},
+		{name: "view-secrets", want: []string{"view-secret"}},
+		{name: "veiw-secret", want: []string{"view-secret"}},
+		{name: "whocan", want: []string{"who-can"}},
+		{name: "kubectx", want: nil},
+		{name: "readme", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SimilarPluginNames(paths, "default", tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("SimilarPluginNames(%q) mismatch:\n%s", tt.name, diff)
+			}
+		})
+	}
+
+	got, err := SimilarPluginNames(paths, "missing", "ctx")
+	if err != nil || len(got) != 0 {
+		t.Errorf("SimilarPluginNames() for a missing index = %v, %v; expected no names", got, err)
+	}
+}
+
+func Test_levenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"foo", "foo", 0},
+		{"foo", "fo", 1},
+		{"flaw", "lawn", 2},
+		{"über", "uber", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"k8s.io/klog"
@@ -82,21 +83,46 @@ func LoadPluginByName(pluginsDir, pluginName string) (index.Plugin, error) {
 // ReadPluginFromFile loads a file from the FS. When plugin file not found, it
 // returns an error that can be checked with os.IsNotExist.
 func ReadPluginFromFile(path string) (index.Plugin, error) {
-	var plugin index.Plugin
-	err := readFromFile(path, &plugin)
+	f, err := os.Open(path)
 	if err != nil {
-		return plugin, err
+		return index.Plugin{}, err
 	}
-	return plugin, errors.Wrap(validation.ValidatePlugin(plugin.Name, plugin), "plugin manifest validation error")
+	plugin, err := ReadPlugin(f)
+	return plugin, errors.Wrapf(err, "failed to read plugin manifest %q", path)
 }
 
+// ReadPlugin parses and validates the plugin manifest read from f, and closes
+// f.
 func ReadPlugin(f io.ReadCloser) (index.Plugin, error) {
-	var plugin index.Plugin
-	err := decodeFile(f, &plugin)
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return index.Plugin{}, errors.Wrap(err, "failed to read plugin manifest")
+	}
+	plugin, warnings, err := index.ParseAndValidateWithWarnings(b)
 	if err != nil {
-		return plugin, errors.Wrap(err, "failed to decode plugin manifest")
+		return index.Plugin{}, errors.Wrap(err, "failed to decode plugin manifest")
+	}
+	for _, w := range warnings {
+		warnOnce("Plugin manifest " + w)
+	}
+	return *plugin, errors.Wrap(validation.ValidateParsedPlugin(plugin.Name, *plugin), "plugin manifest validation error")
+}
+
+// warned are the warnings about plugin manifests that were logged, so that
+// reading all manifests of an index logs each of them only once.
+var (
+	warnedMu sync.Mutex
+	warned   = make(map[string]bool)
+)
+
+func warnOnce(msg string) {
+	warnedMu.Lock()
+	defer warnedMu.Unlock()
+	if !warned[msg] {
+		warned[msg] = true
+		klog.Warning(msg)
 	}
-	return plugin, errors.Wrap(validation.ValidatePlugin(plugin.Name, plugin), "plugin manifest validation error")
 }
 
 // ReadReceiptFromFile loads a file from the FS. When receipt file not found, it
@@ -16,6 +16,8 @@
 package validation
 
 import (
+	"net/url"
+	"path"
 	"regexp"
 	"strings"
 
@@ -23,22 +25,36 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"sigs.k8s.io/krew/internal/installation/semver"
+	"sigs.k8s.io/krew/internal/pathutil"
 	"sigs.k8s.io/krew/pkg/constants"
 	"sigs.k8s.io/krew/pkg/index"
 )
 
 const (
 	sha256Pattern = `^[a-f0-9]{64}$`
+	sha512Pattern = `^[a-f0-9]{128}$`
 )
 
 var (
 	safePluginRegexp = regexp.MustCompile(`^[\w-]+$`)
 	validSHA256      = regexp.MustCompile(sha256Pattern)
+	validSHA512      = regexp.MustCompile(sha512Pattern)
 
 	// windowsForbidden is taken from  https://docs.microsoft.com/en-us/windows/desktop/FileIO/naming-a-file
 	windowsForbidden = []string{"CON", "PRN", "AUX", "NUL", "COM1", "COM2",
 		"COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "LPT1", "LPT2",
 		"LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9"}
+
+	// builtinKubectlCommands are the top-level kubectl commands. kubectl
+	// does not run a plugin with the same name as a built-in command.
+	builtinKubectlCommands = []string{"alpha", "annotate", "api-resources",
+		"api-versions", "apply", "attach", "auth", "autoscale", "certificate",
+		"cluster-info", "completion", "config", "convert", "cordon", "cp",
+		"create", "debug", "delete", "describe", "diff", "drain", "edit", "exec",
+		"explain", "expose", "get", "help", "kustomize", "label", "logs",
+		"options", "patch", "plugin", "port-forward", "proxy", "replace",
+		"rollout", "run", "scale", "set", "taint", "top", "uncordon", "version",
+		"wait"}
 )
 
 // IsSafePluginName checks if the plugin Name is safe to use.
@@ -54,25 +70,60 @@ func IsSafePluginName(name string) bool {
 	return true
 }
 
+// validateKubectlPluginName checks that kubectl can run a plugin with the
+// name, which is assumed to be safe.
+func validateKubectlPluginName(name string) error {
+	if strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") {
+		return errors.Errorf("the plugin name %q cannot start or end with a dash", name)
+	}
+	for _, cmd := range builtinKubectlCommands {
+		if name == cmd {
+			return errors.Errorf("the plugin name %q conflicts with the built-in kubectl command %q", name, cmd)
+		}
+	}
+	return nil
+}
+
 func isSupportedAPIVersion(apiVersion string) bool {
 	return apiVersion == constants.CurrentAPIVersion
 }
 
 func isValidSHA256(s string) bool { return validSHA256.MatchString(s) }
 
+func isValidSHA512(s string) bool { return validSHA512.MatchString(s) }
+
 // ValidatePlugin checks for structural validity of the Plugin object with given
 // name.
 func ValidatePlugin(name string, p index.Plugin) error {
 	if !isSupportedAPIVersion(p.APIVersion) {
 		return errors.Errorf("plugin manifest has apiVersion=%q, not supported in this version of krew (try updating plugin index or install a newer version of krew)", p.APIVersion)
 	}
+	return validatePlugin(name, p)
+}
+
+// ValidateParsedPlugin is like ValidatePlugin, but also accepts the newer
+// apiVersions that index.ParseAndValidate parses on a best-effort basis. It is
+// used when reading plugin manifests for installation, not for validating the
+// manifests of an index.
+func ValidateParsedPlugin(name string, p index.Plugin) error {
+	if _, err := index.CheckAPIVersion(p.APIVersion); err != nil {
+		return errors.Wrap(err, "plugin manifest has an unsupported apiVersion (try updating plugin index or install a newer version of krew)")
+	}
+	return validatePlugin(name, p)
+}
 
+// validatePlugin checks the Plugin object with given name for structural
+// validity, except for its apiVersion.
+func validatePlugin(name string, p index.Plugin) error {
 	if p.Kind != constants.PluginKind {
 		return errors.Errorf("plugin manifest has kind=%q, but only %q is supported", p.Kind, constants.PluginKind)
 	}
 	if !IsSafePluginName(name) {
 		return errors.Errorf("the plugin name %q is not allowed, must match %q", name, safePluginRegexp.String())
 	}
+	if err := validateKubectlPluginName(name); err != nil {
+		return err
+	}
 	if p.Name != name {
 		return errors.Errorf("plugin should be named %q, not %q", name, p.Name)
 	}
@@ -91,6 +142,9 @@ func ValidatePlugin(name string, p index.Plugin) error {
 	if _, err := semver.Parse(p.Spec.Version); err != nil {
 		return errors.Wrap(err, "failed to parse plugin version")
 	}
+	if err := validateDependencies(name, p.Spec.Dependencies); err != nil {
+		return errors.Wrap(err, "invalid dependencies")
+	}
 	for _, pl := range p.Spec.Platforms {
 		if err := validatePlatform(pl); err != nil {
 			return errors.Wrapf(err, "platform (%+v) is badly constructed", pl)
@@ -99,23 +153,61 @@ func ValidatePlugin(name string, p index.Plugin) error {
 	return nil
 }
 
+// validateDependencies checks that the dependencies of the plugin are valid
+// plugin names, without duplicates or the plugin itself.
+func validateDependencies(name string, deps []string) error {
+	seen := make(map[string]bool, len(deps))
+	for _, dep := range deps {
+		if !IsSafePluginName(dep) {
+			return errors.Errorf("dependency %q is not a valid plugin name", dep)
+		}
+		if dep == name {
+			return errors.New("plugin cannot depend on itself")
+		}
+		if seen[dep] {
+			return errors.Errorf("dependency %q is listed more than once", dep)
+		}
+		seen[dep] = true
+	}
+	return nil
+}
+
 // validatePlatform checks Platform for structural validity.
 func validatePlatform(p index.Platform) error {
 	if p.URI == "" {
 		return errors.New("`uri` has to be set")
 	}
-	if p.Sha256 == "" {
-		return errors.New("`sha256` sum has to be set")
+	for _, m := range p.Mirrors {
+		if m == "" {
+			return errors.New("`mirrors` cannot contain empty URIs")
+		}
+	}
+	if p.Sha256 == "" && p.Sha256URL == "" && p.Sha512 == "" {
+		return errors.New("`sha256` sum, `sha256URL` or `sha512` sum has to be set")
+	}
+	if p.Sha256URL != "" {
+		if u, err := url.Parse(p.Sha256URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.Errorf("`sha256URL` value %q must be an http(s) URL", p.Sha256URL)
+		}
 	}
-	if !isValidSHA256(p.Sha256) {
+	if p.Sha256 != "" && !isValidSHA256(p.Sha256) {
 		return errors.Errorf("`sha256` value %s is not valid, must match pattern %s", p.Sha256, sha256Pattern)
 	}
+	if p.Sha512 != "" && !isValidSHA512(p.Sha512) {
+		return errors.Errorf("`sha512` value %s is not valid, must match pattern %s", p.Sha512, sha512Pattern)
+	}
 	if p.Bin == "" {
 		return errors.New("`bin` has to be set")
 	}
+	if p.StripComponents < 0 {
+		return errors.New("`stripComponents` cannot be negative")
+	}
 	if err := validateFiles(p.Files); err != nil {
 		return errors.Wrap(err, "`files` is invalid")
 	}
+	if err := validateBinIsInstalled(p.Bin, p.Files); err != nil {
+		return errors.Wrap(err, "`bin` is invalid")
+	}
 	if err := validateSelector(p.Selector); err != nil {
 		return errors.Wrap(err, "invalid platform selector")
 	}
@@ -135,10 +227,45 @@ func validateFiles(fops []index.FileOperation) error {
 		} else if op.To == "" {
 			return errors.New("`to` field has to be set")
 		}
+		if _, err := pathutil.ExpandBraces(op.From); err != nil {
+			return errors.Wrap(err, "invalid `from` pattern")
+		}
+		if op.Rename && path.Clean(op.To) == "." {
+			return errors.New("`to` field has to be a file name if `rename` is set")
+		}
+		for _, pattern := range op.Exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "invalid `exclude` pattern %q", pattern)
+			}
+		}
 	}
 	return nil
 }
 
+// validateBinIsInstalled checks that the bin path is among the files installed
+// by the file operations. If any of the file operations copies files matching
+// a glob pattern into a directory, the check is skipped, as the installed files
+// are not known before downloading the archive.
+func validateBinIsInstalled(bin string, fops []index.FileOperation) error {
+	if fops == nil {
+		return nil // defaults to copying all files
+	}
+	bin = path.Clean(bin)
+	for _, op := range fops {
+		if !op.Rename && strings.ContainsAny(op.From, `*?[\{`) {
+			return nil
+		}
+		to := path.Clean(op.To)
+		if to == "." {
+			to = path.Base(op.From)
+		}
+		if bin == to || strings.HasPrefix(bin, to+"/") {
+			return nil
+		}
+	}
+	return errors.Errorf("%q is not installed by any of the file operations", bin)
+}
+
 // validateSelector checks if the platform selector uses supported keys and is not empty or nil.
 func validateSelector(sel *metav1.LabelSelector) error {
 	if sel == nil {
@@ -157,7 +284,7 @@ func validateSelector(sel *metav1.LabelSelector) error {
 		keys = append(keys, expr.Key)
 	}
 	for _, key := range keys {
-		if key != "os" && key != "arch" {
+		if key != "os" && key != "arch" && key != "variant" && key != "libc" {
 			return errors.Errorf("key %q not supported", key)
 		}
 	}
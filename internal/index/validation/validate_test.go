@@ -15,6 +15,7 @@
 package validation
 
 import (
+	"strings"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -60,6 +61,29 @@ func Test_IsSafePluginName(t *testing.T) {
 	}
 }
 
+func Test_validateKubectlPluginName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "foo", wantErr: false},
+		{name: "view-secret", wantErr: false},
+		{name: "config-cleanup", wantErr: false},
+		{name: "get-all", wantErr: false},
+		{name: "get", wantErr: true},
+		{name: "port-forward", wantErr: true},
+		{name: "-foo", wantErr: true},
+		{name: "foo-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateKubectlPluginName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("validateKubectlPluginName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_isSupportedAPIVersion(t *testing.T) {
 	tests := []struct {
 		name string
@@ -121,6 +145,18 @@ func TestValidatePlugin(t *testing.T) {
 				}).V(),
 			wantErr: true,
 		},
+		{
+			name:       "name of a built-in kubectl command",
+			pluginName: "get",
+			plugin:     testutil.NewPlugin().WithName("get").V(),
+			wantErr:    true,
+		},
+		{
+			name:       "name starting with a dash",
+			pluginName: "-foo",
+			plugin:     testutil.NewPlugin().WithName("-foo").V(),
+			wantErr:    true,
+		},
 		{
 			name:       "shortDescription unspecified",
 			pluginName: "foo",
@@ -186,6 +222,35 @@ func TestValidatePlugin(t *testing.T) {
 	}
 }
 
+func TestValidateParsedPlugin(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiVersion string
+		wantErr    bool
+	}{
+		{"current version", constants.CurrentAPIVersion, false},
+		{"newer version", "krew.googlecontainertools.github.com/v1beta1", false},
+		{"newer major version", "krew.googlecontainertools.github.com/v2alpha1", true},
+		{"bad api version", "core/v1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := testutil.NewPlugin().WithName("foo").WithTypeMeta(metav1.TypeMeta{
+				APIVersion: tt.apiVersion,
+				Kind:       constants.PluginKind,
+			}).V()
+			if err := ValidateParsedPlugin("foo", plugin); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParsedPlugin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.apiVersion != constants.CurrentAPIVersion {
+				if err := ValidatePlugin("foo", plugin); err == nil {
+					t.Errorf("ValidatePlugin() accepted apiVersion %q", tt.apiVersion)
+				}
+			}
+		})
+	}
+}
+
 func TestValidatePlatform(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -207,6 +272,31 @@ func TestValidatePlatform(t *testing.T) {
 			platform: testutil.NewPlatform().WithSHA256("").V(),
 			wantErr:  true,
 		},
+		{
+			name:     "sha256URL instead of sha256",
+			platform: testutil.NewPlatform().WithSHA256("").WithSHA256URL("https://example.com/checksums.txt").V(),
+			wantErr:  false,
+		},
+		{
+			name:     "sha512 instead of sha256",
+			platform: testutil.NewPlatform().WithSHA256("").WithSHA512(strings.Repeat("a", 128)).V(),
+			wantErr:  false,
+		},
+		{
+			name:     "sha512 and sha256",
+			platform: testutil.NewPlatform().WithSHA512(strings.Repeat("a", 128)).V(),
+			wantErr:  false,
+		},
+		{
+			name:     "invalid sha512",
+			platform: testutil.NewPlatform().WithSHA512(strings.Repeat("A", 128)).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "sha256URL is not an http url",
+			platform: testutil.NewPlatform().WithSHA256URL("file:///checksums.txt").V(),
+			wantErr:  true,
+		},
 		{
 			name:     "empty file operations",
 			platform: testutil.NewPlatform().WithFiles([]index.FileOperation{}).V(),
@@ -223,6 +313,60 @@ func TestValidatePlatform(t *testing.T) {
 				MatchLabels: map[string]string{"unsupported-field": "orange"}}).V(),
 			wantErr: true,
 		},
+		{
+			name: "bin installed by file operation",
+			platform: testutil.NewPlatform().WithBin("./foo").WithFiles([]index.FileOperation{
+				{From: "LICENSE", To: "."},
+				{From: "bin/foo-linux", To: "foo"}}).V(),
+			wantErr: false,
+		},
+		{
+			name: "bin inside a directory installed by file operation",
+			platform: testutil.NewPlatform().WithBin("bin/foo").WithFiles([]index.FileOperation{
+				{From: "dist/bin", To: "."}}).V(),
+			wantErr: false,
+		},
+		{
+			name: "bin not installed by any file operation",
+			platform: testutil.NewPlatform().WithBin("foo").WithFiles([]index.FileOperation{
+				{From: "LICENSE", To: "."},
+				{From: "bin/foo-linux", To: "bar"}}).V(),
+			wantErr: true,
+		},
+		{
+			name: "bin with glob file operation is not checked",
+			platform: testutil.NewPlatform().WithBin("foo").WithFiles([]index.FileOperation{
+				{From: "LICENSE", To: "."},
+				{From: "*/bar", To: "."}}).V(),
+			wantErr: false,
+		},
+		{
+			name: "bin renamed from glob file operation",
+			platform: testutil.NewPlatform().WithBin("foo").WithFiles([]index.FileOperation{
+				{From: "bin/foo-*", To: "foo", Rename: true}}).V(),
+			wantErr: false,
+		},
+		{
+			name: "bin not renamed from glob file operation",
+			platform: testutil.NewPlatform().WithBin("foo").WithFiles([]index.FileOperation{
+				{From: "bin/foo-*", To: "bar", Rename: true}}).V(),
+			wantErr: true,
+		},
+		{
+			name:     "empty mirror",
+			platform: testutil.NewPlatform().WithMirrors([]string{"https://example.com/foo.tar.gz", ""}).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "negative stripComponents",
+			platform: testutil.NewPlatform().WithStripComponents(-1).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "stripComponents set",
+			platform: testutil.NewPlatform().WithStripComponents(1).V(),
+			wantErr:  false,
+		},
 		// TODO(ahmetb): add test case "bin field outside the plugin installation directory"
 		// by testing .WithBin("foo/../../../malicious-file").
 		// It appears like currently we're allowing this.
@@ -257,6 +401,16 @@ func Test_validateSelector(t *testing.T) {
 			sel:     &metav1.LabelSelector{MatchLabels: map[string]string{"os": "foo", "arch": "bar"}},
 			wantErr: false,
 		},
+		{
+			name:    "valid variant in matchLabels",
+			sel:     &metav1.LabelSelector{MatchLabels: map[string]string{"os": "linux", "arch": "arm", "variant": "v7"}},
+			wantErr: false,
+		},
+		{
+			name:    "valid libc in matchLabels",
+			sel:     &metav1.LabelSelector{MatchLabels: map[string]string{"os": "linux", "libc": "musl"}},
+			wantErr: false,
+		},
 		{
 			name: "valid matchExpressions",
 			sel: &metav1.LabelSelector{
@@ -332,6 +486,36 @@ func Test_validateFiles(t *testing.T) {
 			files:   []index.FileOperation{{From: "", To: "present"}},
 			wantErr: true,
 		},
+		{
+			name:    "valid `exclude` patterns",
+			files:   []index.FileOperation{{From: "*", To: ".", Exclude: []string{"*.md", "LICENSE"}}},
+			wantErr: false,
+		},
+		{
+			name:    "`from` pattern with braces",
+			files:   []index.FileOperation{{From: "{bin,lib/{a,b}}/*", To: "."}},
+			wantErr: false,
+		},
+		{
+			name:    "unbalanced braces in `from` pattern",
+			files:   []index.FileOperation{{From: "{bin,lib/*", To: "."}},
+			wantErr: true,
+		},
+		{
+			name:    "malformed `exclude` pattern",
+			files:   []index.FileOperation{{From: "*", To: ".", Exclude: []string{"[-"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rename to a file name",
+			files:   []index.FileOperation{{From: "bin/foo-*", To: "foo", Rename: true}},
+			wantErr: false,
+		},
+		{
+			name:    "rename without a file name",
+			files:   []index.FileOperation{{From: "bin/foo-*", To: ".", Rename: true}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -341,3 +525,24 @@ func Test_validateFiles(t *testing.T) {
 		})
 	}
 }
+
+func Test_validateDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		deps    []string
+		wantErr bool
+	}{
+		{name: "no dependencies", deps: nil},
+		{name: "valid dependencies", deps: []string{"bar", "baz-qux"}},
+		{name: "unsafe name", deps: []string{"../bar"}, wantErr: true},
+		{name: "depends on itself", deps: []string{"bar", "foo"}, wantErr: true},
+		{name: "duplicate", deps: []string{"bar", "bar"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDependencies("foo", tt.deps); (err != nil) != tt.wantErr {
+				t.Errorf("validateDependencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
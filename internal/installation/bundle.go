@@ -0,0 +1,227 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/index/indexscanner"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// Directories of the plugin manifests and archives in a bundle.
+const (
+	bundlePluginsDir  = "plugins"
+	bundleArchivesDir = "archives"
+)
+
+// InstallFromBundle installs all plugins in the bundle at bundlePath without
+// using the network, e.g. on air-gapped machines.
+//
+// A bundle is a tar file, optionally gzip-compressed, with the layout:
+//
+//	plugins/<name>.yaml   the plugin manifests
+//	archives/<sha256>     the plugin archives, named by their lowercase sha256
+//	                      checksum as specified in the manifests
+//
+// Only the archives for the platforms the bundle is used on are required. The
+// archive of each plugin is verified against the checksum in its manifest, and
+// the plugin is recorded as installed from the "detached" index. Other entries
+// of the bundle are ignored.
+//
+// A failure to install one plugin does not stop the installation of others.
+// The returned slice contains an error for each plugin that failed to install,
+// or a single error if the bundle cannot be read.
+func InstallFromBundle(p environment.Paths, bundlePath string) []error {
+	tmp, err := makeTempDir(p.StagingPath(), "krew-bundle")
+	if err != nil {
+		return []error{err}
+	}
+	defer func() {
+		klog.V(3).Infof("Deleting the bundle directory %s", tmp)
+		if err := os.RemoveAll(tmp); err != nil {
+			klog.Warningf("failed to clean up bundle directory: %s", err)
+		}
+	}()
+	if err := extractBundle(bundlePath, tmp); err != nil {
+		return []error{errors.Wrapf(err, "failed to read bundle %q", bundlePath)}
+	}
+
+	manifests, err := filepath.Glob(filepath.Join(tmp, bundlePluginsDir, "*"+constants.ManifestExtension))
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to list plugin manifests in the bundle")}
+	}
+	sort.Strings(manifests)
+	if len(manifests) == 0 {
+		return []error{errors.Errorf("bundle %q does not contain any plugin manifests", bundlePath)}
+	}
+
+	// plugins of the bundle can be installed before their turn as the
+	// dependency of another plugin
+	installedBefore := make(map[string]bool)
+	for _, manifest := range manifests {
+		name := strings.TrimSuffix(filepath.Base(manifest), constants.ManifestExtension)
+		installedBefore[name] = isPluginInstalled(p, name)
+	}
+
+	var errs []error
+	for _, manifest := range manifests {
+		name := strings.TrimSuffix(filepath.Base(manifest), constants.ManifestExtension)
+		err := installFromBundle(p, tmp, manifest)
+		if errors.Cause(err) == ErrIsAlreadyInstalled && !installedBefore[name] {
+			klog.V(1).Infof("Plugin %s was installed from the bundle as a dependency", name)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to install plugin %q from the bundle", name))
+		}
+	}
+	return errs
+}
+
+// installFromBundle installs the plugin with the manifest at manifestPath from
+// its archive in the extracted bundle at dir. Its missing dependencies are
+// installed from the bundle as well.
+func installFromBundle(p environment.Paths, dir, manifestPath string) error {
+	plugin, archive, err := loadBundlePlugin(dir, manifestPath)
+	if err != nil {
+		return err
+	}
+	klog.V(1).Infof("Installing plugin %s from the bundle", plugin.Name)
+	return Install(p, plugin, constants.DetachedIndexName, InstallOpts{
+		ArchiveFileOverride: archive,
+		dependencies: func(name string) (index.Plugin, string, string, error) {
+			plugin, archive, err := loadBundlePlugin(dir, filepath.Join(dir, bundlePluginsDir, name+constants.ManifestExtension))
+			return plugin, constants.DetachedIndexName, archive, errors.Wrap(err, "from the bundle")
+		},
+	})
+}
+
+// loadBundlePlugin reads the plugin manifest at manifestPath in the extracted
+// bundle at dir, and returns the path of its archive for this platform.
+func loadBundlePlugin(dir, manifestPath string) (index.Plugin, string, error) {
+	plugin, err := indexscanner.ReadPluginFromFile(manifestPath)
+	if err != nil {
+		return index.Plugin{}, "", err
+	}
+	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
+	if err != nil {
+		return index.Plugin{}, "", errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return index.Plugin{}, "", newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	if candidate.Sha256 == "" {
+		return index.Plugin{}, "", errors.Errorf("plugin %q must specify the sha256 sum of its archive in the manifest to be installed from a bundle", plugin.Name)
+	}
+	archive := filepath.Join(dir, bundleArchivesDir, strings.ToLower(candidate.Sha256))
+	if _, err := os.Stat(archive); err != nil {
+		return index.Plugin{}, "", errors.Errorf("bundle does not contain the archive with sha256 %s for this platform", candidate.Sha256)
+	}
+	return plugin, archive, nil
+}
+
+// isPluginInstalled reports whether the plugin has an install receipt.
+func isPluginInstalled(p environment.Paths, name string) bool {
+	_, err := os.Stat(p.PluginInstallReceiptPath(name))
+	return err == nil
+}
+
+// extractBundle extracts the plugin manifests and archives of the bundle at
+// bundlePath into dir.
+func extractBundle(bundlePath, dir string) error {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return errors.Wrap(err, "failed to read gzip-compressed bundle")
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	for _, d := range []string{bundlePluginsDir, bundleArchivesDir} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read tar entry")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		if !isBundleEntry(name) {
+			klog.V(4).Infof("Ignoring bundle entry %q", hdr.Name)
+			continue
+		}
+		if err := writeBundleEntry(filepath.Join(dir, filepath.FromSlash(name)), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// isBundleEntry checks if the slash-separated path in a bundle is a plugin
+// manifest or archive.
+func isBundleEntry(name string) bool {
+	dir, file := path.Split(name)
+	switch dir {
+	case bundlePluginsDir + "/":
+		return path.Ext(file) == constants.ManifestExtension
+	case bundleArchivesDir + "/":
+		b, err := hex.DecodeString(file)
+		return err == nil && len(b) == 32 && file == strings.ToLower(file)
+	}
+	return false
+}
+
+func writeBundleEntry(dst string, r io.Reader) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %q", dst)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrapf(err, "failed to write %q", dst)
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// writeBundle writes a bundle with the files keyed by their paths to path.
+func writeBundle(t *testing.T, path string, files map[string][]byte, compress bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInstallFromBundle(t *testing.T) {
+	archive, err := ioutil.ReadFile(testArchivePath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := func(name string, platforms ...index.Platform) []byte {
+		b, err := yaml.Marshal(testutil.NewPlugin().WithName(name).WithPlatforms(platforms...).V())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	otherSha256 := strings.Repeat("0", 64)
+
+	for _, compress := range []bool{false, true} {
+		tmpDir := testutil.NewTempDir(t)
+		p := newTestPaths(t)
+		writeBundle(t, tmpDir.Path("bundle.tar"), map[string][]byte{
+			"plugins/foo.yaml":                    manifest("foo", newTestArchivePlatform().V()),
+			"./plugins/bar.yaml":                  manifest("bar", newTestArchivePlatform().V()),
+			"plugins/missing.yaml":                manifest("missing", newTestArchivePlatform().WithSHA256(otherSha256).V()),
+			"archives/" + testArchiveSha256:       archive,
+			"archives/../../evil":                 []byte("ignored"),
+			"README.md":                           []byte("ignored"),
+			"archives/" + strings.Repeat("1", 64): []byte("unused"),
+		}, compress)
+
+		errs := InstallFromBundle(p, tmpDir.Path("bundle.tar"))
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), `"missing"`) {
+			t.Errorf("compress=%v: expected only the plugin without its archive to fail, got: %v", compress, errs)
+		}
+		for _, name := range []string{"foo", "bar"} {
+			r, err := receipt.Load(p.PluginInstallReceiptPath(name))
+			if err != nil {
+				t.Errorf("compress=%v: plugin %s was not installed: %v", compress, name, err)
+				continue
+			}
+			if r.Status.Source.Name != constants.DetachedIndexName {
+				t.Errorf("compress=%v: expected plugin from index %q, got %q", compress, constants.DetachedIndexName, r.Status.Source.Name)
+			}
+		}
+	}
+}
+
+func TestInstallFromBundle_dependencies(t *testing.T) {
+	xzArchive, xzSha256 := testXZArchive(t)
+	archive, err := ioutil.ReadFile(testArchivePath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	depArchive, err := ioutil.ReadFile(xzArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := func(plugin index.Plugin) []byte {
+		b, err := yaml.Marshal(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	// the dependency is only in the bundle, with another archive than foo
+	tmpDir := testutil.NewTempDir(t)
+	p := newTestPaths(t)
+	writeBundle(t, tmpDir.Path("bundle.tar"), map[string][]byte{
+		"plugins/foo.yaml": manifest(newTestPlugin("foo", "qux")),
+		"plugins/qux.yaml": manifest(testutil.NewPlugin().WithName("qux").
+			WithPlatforms(newTestArchivePlatform().WithSHA256(xzSha256).V()).V()),
+		"archives/" + testArchiveSha256: archive,
+		"archives/" + xzSha256:          depArchive,
+	}, false)
+
+	if errs := InstallFromBundle(p, tmpDir.Path("bundle.tar")); len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %v", errs)
+	}
+	for _, name := range []string{"foo", "qux"} {
+		if !isInstalled(p, name) {
+			t.Errorf("plugin %s was not installed", name)
+		}
+	}
+}
+
+func TestInstallFromBundle_checksumMismatch(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	p := newTestPaths(t)
+	b, err := yaml.Marshal(testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeBundle(t, tmpDir.Path("bundle.tar"), map[string][]byte{
+		"plugins/foo.yaml":              b,
+		"archives/" + testArchiveSha256: []byte("not the archive"),
+	}, false)
+
+	if errs := InstallFromBundle(p, tmpDir.Path("bundle.tar")); len(errs) != 1 {
+		t.Fatalf("expected an error for archive not matching its checksum, got: %v", errs)
+	}
+	if _, err := os.Stat(p.PluginInstallReceiptPath("foo")); !os.IsNotExist(err) {
+		t.Errorf("plugin was installed from an archive not matching its checksum")
+	}
+}
+
+func TestInstallFromBundle_invalidBundle(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("bundle.tar", []byte("not a tar file"))
+	p := newTestPaths(t)
+
+	if errs := InstallFromBundle(p, tmpDir.Path("bundle.tar")); len(errs) != 1 {
+		t.Errorf("expected an error for invalid bundle, got: %v", errs)
+	}
+	if errs := InstallFromBundle(p, tmpDir.Path("not-exists.tar")); len(errs) != 1 {
+		t.Errorf("expected an error for missing bundle, got: %v", errs)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// InstallResult describes an installed plugin.
+type InstallResult struct {
+	// Caveats is the text of the caveats of the plugin, with the
+	// placeholders expanded. It is empty if the plugin has no caveats.
+	Caveats string
+
+	// InstallPath is the directory the plugin is installed into.
+	InstallPath string
+
+	// Executable is the path of the plugin executable in the bin directory,
+	// or in the installation directory if the plugin is installed with
+	// InstallOpts.SkipLink.
+	Executable string
+}
+
+// InstallWithResult is like InstallContext, but it also returns the details of
+// the installed plugin, so that callers can display the caveats of the plugin
+// separately from the log messages. The result is nil if the installation
+// fails or opts.DryRun is set.
+func InstallWithResult(ctx context.Context, p environment.Paths, plugin index.Plugin, indexName string, opts InstallOpts) (*InstallResult, error) {
+	if err := InstallContext(ctx, p, plugin, indexName, opts); err != nil || opts.DryRun {
+		return nil, err
+	}
+	return newInstallResult(p, plugin, opts.SkipLink), nil
+}
+
+func newInstallResult(p environment.Paths, plugin index.Plugin, skipLink bool) *InstallResult {
+	r := &InstallResult{
+		InstallPath: p.PluginVersionInstallPath(plugin.Name, plugin.Spec.Version),
+		Executable:  filepath.Join(p.BinPath(), BinaryNameForPlugin(plugin.Name)),
+	}
+	if skipLink {
+		if platform, ok, err := GetMatchingPlatform(plugin.Spec.Platforms); err == nil && ok {
+			r.Executable = filepath.Join(r.InstallPath, filepath.FromSlash(platform.Bin))
+		}
+	}
+	r.Caveats = expandCaveats(plugin.Spec.Caveats, plugin, r)
+	return r
+}
+
+// expandCaveats replaces the placeholders the caveats of a plugin can contain:
+//
+//	{{InstallPath}}  the directory the plugin is installed into
+//	{{Executable}}   the path of the plugin executable in the bin directory
+//	{{Version}}      the installed version of the plugin
+//
+// Other text, including Go templates used in kubectl commands, is unchanged.
+func expandCaveats(caveats string, plugin index.Plugin, r *InstallResult) string {
+	return strings.NewReplacer(
+		"{{InstallPath}}", r.InstallPath,
+		"{{Executable}}", r.Executable,
+		"{{Version}}", plugin.Spec.Version,
+	).Replace(caveats)
+}
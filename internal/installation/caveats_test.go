@@ -0,0 +1,71 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+func TestInstallWithResult(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").
+		WithPlatforms(newTestArchivePlatform().V()).V()
+	plugin.Spec.Caveats = "Installed {{Version}} into {{InstallPath}}, run {{Executable}}.\n" +
+		"kubectl get pods -o go-template='{{.metadata.name}}'"
+
+	r, err := InstallWithResult(context.Background(), p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	installPath := p.PluginVersionInstallPath("foo", "v1.0.0")
+	executable := filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	if r.InstallPath != installPath {
+		t.Errorf("InstallPath = %q, want %q", r.InstallPath, installPath)
+	}
+	if r.Executable != executable {
+		t.Errorf("Executable = %q, want %q", r.Executable, executable)
+	}
+	want := "Installed v1.0.0 into " + installPath + ", run " + executable + ".\n" +
+		"kubectl get pods -o go-template='{{.metadata.name}}'"
+	if r.Caveats != want {
+		t.Errorf("Caveats = %q, want %q", r.Caveats, want)
+	}
+
+	r, err = InstallWithResult(context.Background(), p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if err != ErrIsAlreadyInstalled {
+		t.Errorf("expected ErrIsAlreadyInstalled, got %v", err)
+	}
+	if r != nil {
+		t.Errorf("expected no result for a failed installation, got %+v", r)
+	}
+}
+
+func TestInstallWithResult_noCaveats(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	r, err := InstallWithResult(context.Background(), p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Caveats != "" {
+		t.Errorf("expected empty caveats, got %q", r.Caveats)
+	}
+}
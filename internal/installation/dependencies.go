@@ -0,0 +1,140 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/index/indexscanner"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// maxDependencyDepth is the maximum length of a chain of plugins depending on
+// each other.
+const maxDependencyDepth = 8
+
+// dependencySource loads the manifest of the dependency with the given name.
+// It returns the index the dependency is recorded as installed from, and the
+// archive file to install it from, or "" if its archive is downloaded.
+type dependencySource func(name string) (plugin index.Plugin, indexName, archive string, err error)
+
+// indexDependencySource returns a dependencySource loading the dependencies
+// from the index with the given name.
+func indexDependencySource(p environment.Paths, indexName string) dependencySource {
+	return func(name string) (index.Plugin, string, string, error) {
+		plugin, err := indexscanner.LoadPluginByName(p.IndexPluginsPath(indexName), name)
+		return plugin, indexName, "", errors.Wrapf(err, "from index %q", indexName)
+	}
+}
+
+// installDependencies installs the missing dependencies of the plugin, and
+// their dependencies first, from the index the plugin is installed from.
+// Dependencies of plugins that are not from an index are installed from the
+// default index, unless opts specifies where to load them from. Already
+// installed dependencies are not upgraded.
+func installDependencies(ctx context.Context, p environment.Paths, plugin index.Plugin, indexName string, opts InstallOpts) error {
+	src := opts.dependencies
+	if src == nil {
+		if indexName == constants.DetachedIndexName {
+			indexName = constants.DefaultIndexName
+		}
+		src = indexDependencySource(p, indexName)
+	}
+	return installDependenciesOf(ctx, p, plugin, src, opts.forDependency(), []string{plugin.Name})
+}
+
+// forDependency returns the options to install the dependencies of a plugin
+// installed with o. The options that only apply to the plugin itself, like
+// its archive file or the sum of its manifest, are cleared.
+func (o InstallOpts) forDependency() InstallOpts {
+	o.ArchiveFileOverride = ""
+	o.ManifestSHA256 = ""
+	o.SkipLink = false
+	o.VersionedAlias = false
+	o.staged = nil
+	return o
+}
+
+// installDependenciesOf installs the dependencies of plugin loaded from src
+// with opts, where chain is the list of plugins depending on each other that
+// led to plugin, ending with plugin itself.
+func installDependenciesOf(ctx context.Context, p environment.Paths, plugin index.Plugin, src dependencySource, opts InstallOpts, chain []string) error {
+	if len(plugin.Spec.Dependencies) == 0 {
+		return nil
+	}
+	if len(chain) > maxDependencyDepth {
+		return errors.Errorf("dependencies are nested deeper than %d plugins: %s", maxDependencyDepth, strings.Join(chain, " -> "))
+	}
+	log := opts.logger()
+	for _, name := range plugin.Spec.Dependencies {
+		for _, c := range chain {
+			if c == name {
+				return errors.Errorf("dependency cycle: %s -> %s", strings.Join(chain, " -> "), name)
+			}
+		}
+		if _, err := receipt.Load(p.PluginInstallReceiptPath(name)); err == nil {
+			log.Debugf("Dependency %s of plugin %s is already installed", name, plugin.Name)
+			continue
+		} else if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to look up the receipt of dependency %q", name)
+		}
+
+		if err := checkInstallPolicy(name); err != nil {
+			return errors.Wrapf(err, "cannot install dependency %q of plugin %q", name, plugin.Name)
+		}
+		dep, indexName, archive, err := src(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load dependency %q of plugin %q", name, plugin.Name)
+		}
+		if err := installDependenciesOf(ctx, p, dep, src, opts, append(chain[:len(chain):len(chain)], name)); err != nil {
+			return err
+		}
+		log.Infof("Installing plugin %s, a dependency of %s", name, plugin.Name)
+		depOpts := opts
+		depOpts.ArchiveFileOverride = archive
+		if err := installContext(ctx, p, dep, indexName, depOpts); err != nil {
+			return errors.Wrapf(err, "failed to install dependency %q of plugin %q", name, plugin.Name)
+		}
+	}
+	return nil
+}
+
+// dependentPlugins returns the names of the installed plugins that depend on
+// the plugin, according to the manifests recorded in their receipts.
+func dependentPlugins(p environment.Paths, name string) ([]string, error) {
+	receipts, err := GetInstalledPluginReceipts(p.InstallReceiptsPath())
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, r := range receipts {
+		for _, dep := range r.Spec.Dependencies {
+			if dep == name {
+				out = append(out, r.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
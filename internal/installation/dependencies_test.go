@@ -0,0 +1,214 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// newTestPlugin returns a plugin installable from the test archive.
+func newTestPlugin(name string, deps ...string) index.Plugin {
+	return testutil.NewPlugin().WithName(name).WithDependencies(deps...).
+		WithPlatforms(newTestArchivePlatform().V()).V()
+}
+
+// servedBy returns the plugins with their test archive downloaded from the
+// server of the directory of testArchivePath, as the archive of a plugin is
+// not used for its dependencies.
+func servedBy(server *httptest.Server, plugins ...index.Plugin) []index.Plugin {
+	out := make([]index.Plugin, len(plugins))
+	for i, plugin := range plugins {
+		plugin.Spec.Platforms = append([]index.Platform(nil), plugin.Spec.Platforms...)
+		plugin.Spec.Platforms[0].URI = server.URL + "/test-without-directory.tar.gz"
+		out[i] = plugin
+	}
+	return out
+}
+
+// newTestArchiveServer returns a server of the directory of testArchivePath.
+func newTestArchiveServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(testArchivePath(t)))))
+}
+
+// writeIndexPlugins writes the manifests of the plugins to the default index.
+func writeIndexPlugins(t *testing.T, p environment.Paths, plugins ...index.Plugin) {
+	t.Helper()
+	dir := p.IndexPluginsPath(constants.DefaultIndexName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, plugin := range plugins {
+		b, err := yaml.Marshal(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, plugin.Name+constants.ManifestExtension), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func isInstalled(p environment.Paths, name string) bool {
+	_, err := receipt.Load(p.PluginInstallReceiptPath(name))
+	return err == nil
+}
+
+func TestInstall_dependencies(t *testing.T) {
+	server := newTestArchiveServer(t)
+	defer server.Close()
+	p := newTestPaths(t)
+	writeIndexPlugins(t, p, servedBy(server, newTestPlugin("bar", "baz"), newTestPlugin("baz"))...)
+	plugin := newTestPlugin("foo", "bar")
+
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo", "bar", "baz"} {
+		if !isInstalled(p, name) {
+			t.Errorf("expected plugin %q to be installed", name)
+		}
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Spec.Dependencies, []string{"bar"}) {
+		t.Errorf("expected the dependencies to be recorded in the receipt, got %v", r.Spec.Dependencies)
+	}
+
+	dependents, err := dependentPlugins(p, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dependents, []string{"foo"}) {
+		t.Errorf("dependentPlugins() = %v, expected [foo]", dependents)
+	}
+	if err := Uninstall(p, "bar", nil); err != nil {
+		t.Fatalf("uninstalling a dependency should only warn: %v", err)
+	}
+}
+
+func TestInstall_dependencyOwnOptions(t *testing.T) {
+	xzArchive, xzSha256 := testXZArchive(t)
+	server := newTestArchiveServer(t)
+	defer server.Close()
+
+	p := newTestPaths(t)
+	dep := testutil.NewPlugin().WithName("bar").WithPlatforms(newTestArchivePlatform().
+		WithURI(server.URL + "/" + filepath.Base(xzArchive)).WithSHA256(xzSha256).V()).V()
+	writeIndexPlugins(t, p, dep)
+	plugin := newTestPlugin("foo", "bar")
+	plugin.ManifestSHA256 = strings.Repeat("a", 64)
+
+	// the archive, the manifest sum and the link options are only for foo
+	opts := InstallOpts{
+		ArchiveFileOverride: testArchivePath(t),
+		ManifestSHA256:      plugin.ManifestSHA256,
+		SkipLink:            true,
+		VersionedAlias:      true,
+	}
+	if err := Install(p, plugin, constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("bar"))
+	if err != nil {
+		t.Fatalf("dependency was not installed: %v", err)
+	}
+	if want := server.URL + "/" + filepath.Base(xzArchive); r.Status.Install.URI != want {
+		t.Errorf("dependency was installed from %q, expected %q", r.Status.Install.URI, want)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), BinaryNameForPlugin("bar"))); err != nil {
+		t.Errorf("expected the dependency to be linked: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), VersionedBinaryNameForPlugin("bar", dep.Spec.Version))); !os.IsNotExist(err) {
+		t.Errorf("expected no versioned alias of the dependency, got err=%v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); !os.IsNotExist(err) {
+		t.Errorf("expected the plugin not to be linked, got err=%v", err)
+	}
+}
+
+func TestInstall_dependencyAlreadyInstalled(t *testing.T) {
+	p := newTestPaths(t)
+	// the index has no manifest of bar, so it must not be loaded
+	if err := Install(p, newTestPlugin("bar"), constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(p, newTestPlugin("foo", "bar"), constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstall_dependencyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   []index.Plugin
+		plugin  index.Plugin
+		wantErr string
+	}{
+		{
+			name:    "cycle",
+			index:   []index.Plugin{newTestPlugin("bar", "baz"), newTestPlugin("baz", "foo")},
+			plugin:  newTestPlugin("foo", "bar"),
+			wantErr: "dependency cycle: foo -> bar -> baz -> foo",
+		},
+		{
+			name: "too deep",
+			index: []index.Plugin{newTestPlugin("d1", "d2"), newTestPlugin("d2", "d3"), newTestPlugin("d3", "d4"),
+				newTestPlugin("d4", "d5"), newTestPlugin("d5", "d6"), newTestPlugin("d6", "d7"), newTestPlugin("d7", "d8"),
+				newTestPlugin("d8", "d9"), newTestPlugin("d9")},
+			plugin:  newTestPlugin("foo", "d1"),
+			wantErr: "nested deeper than",
+		},
+		{
+			name:    "missing from index",
+			plugin:  newTestPlugin("foo", "bar"),
+			wantErr: `failed to load dependency "bar"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			writeIndexPlugins(t, p, tt.index...)
+
+			err := Install(p, tt.plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			receipts, err := GetInstalledPluginReceipts(p.InstallReceiptsPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(receipts) != 0 {
+				t.Errorf("expected no plugins to be installed, got %d", len(receipts))
+			}
+		})
+	}
+}
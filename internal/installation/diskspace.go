@@ -0,0 +1,105 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/download"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// ErrInsufficientDiskSpace is returned when there is not enough free disk
+// space to download and extract a plugin archive.
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// DefaultExtractionMultiplier is the assumed ratio of the size of the
+// extracted files to the size of the plugin archive.
+const DefaultExtractionMultiplier = 3.0
+
+// errUnknownDiskSpace is returned by availableDiskSpace on systems where the
+// available disk space cannot be determined.
+var errUnknownDiskSpace = errors.New("available disk space is unknown on this system")
+
+func (o InstallOpts) extractionMultiplier() float64 {
+	if o.ExtractionMultiplier > 0 {
+		return o.ExtractionMultiplier
+	}
+	return DefaultExtractionMultiplier
+}
+
+// checkDiskSpace estimates the disk space needed to download the archive of
+// the platform into stagingDir and to extract it there, and returns
+// ErrInsufficientDiskSpace if less space is available. If installDir is on
+// another filesystem, the extracted files are copied there instead of being
+// renamed, so the space for them is checked there as well. The check is
+// skipped if the size of the archive or the available space is unknown.
+func checkDiskSpace(ctx context.Context, stagingDir, installDir string, platform index.Platform, opts InstallOpts) error {
+	log := opts.logger()
+	sizer, ok := newFetcher(opts, "").(download.Sizer)
+	if !ok {
+		return nil
+	}
+	size, err := sizer.Size(ctx, platform.URI)
+	if err != nil || size < 0 {
+		log.Debugf("Skipping the disk space check, the size of the archive is unknown: %v", err)
+		return nil
+	}
+	extracted := int64(float64(size) * opts.extractionMultiplier())
+
+	stagingDir, installDir = existingAncestor(stagingDir), existingAncestor(installDir)
+	if err := checkAvailableDiskSpace(stagingDir, size+extracted, log); err != nil {
+		return err
+	}
+	if sameFilesystem(stagingDir, installDir) {
+		return nil
+	}
+	return checkAvailableDiskSpace(installDir, extracted, log)
+}
+
+// checkAvailableDiskSpace returns ErrInsufficientDiskSpace if less than
+// required bytes are available on the filesystem of dir. The check is skipped
+// if the available space is unknown.
+func checkAvailableDiskSpace(dir string, required int64, log Logger) error {
+	available, err := availableDiskSpace(dir)
+	if err != nil {
+		log.Debugf("Skipping the disk space check of %q: %v", dir, err)
+		return nil
+	}
+	log.Debugf("Disk space of %q: %d bytes required, %d bytes available", dir, required, available)
+	if uint64(required) > available {
+		return errors.Wrapf(ErrInsufficientDiskSpace, "%d bytes required on the filesystem of %q, but only %d bytes are available",
+			required, dir, available)
+	}
+	return nil
+}
+
+// existingAncestor returns path, or its closest parent directory that exists.
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
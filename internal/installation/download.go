@@ -0,0 +1,115 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/download"
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// DownloadOnly downloads the archive of the plugin for this platform into
+// destDir and verifies it like Install does, without extracting it or
+// changing the krew installation, e.g. for mirroring plugins or creating
+// bundles. If the download from the platform URI fails, the mirrors are tried
+// in order. It returns the path of the archive, which is named like the last
+// element of the URI path, or like its checksum if the URI has no file name.
+// The archive is written only if it is verified successfully. Temporary files
+// are created in opts.TempDir, or in environment.TempDir if it is empty.
+func DownloadOnly(plugin index.Plugin, destDir string, opts InstallOpts) (string, error) {
+	ctx := context.Background()
+	log := opts.logger()
+	if opts.TempDir == "" {
+		opts.TempDir = environment.TempDir()
+	}
+	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
+	if err != nil {
+		return "", errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return "", newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	if err := resolveSha256(ctx, &candidate, opts); err != nil {
+		return "", err
+	}
+
+	tmp, err := makeTempDir(opts.TempDir, "krew-download")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			log.Warningf("failed to clean up download directory: %s", err)
+		}
+	}()
+
+	uris := append([]string{candidate.URI}, candidate.Mirrors...)
+	for i, uri := range uris {
+		var dst string
+		if dst, err = downloadOnlyFrom(ctx, destDir, tmp, uri, candidate, opts); err == nil {
+			log.Debugf("Downloaded plugin archive from %s to %s", uri, dst)
+			return dst, nil
+		}
+		if i < len(uris)-1 {
+			log.Warningf("Failed to download plugin archive from %s, trying the next mirror: %v", uri, err)
+		}
+	}
+	return "", errors.Wrapf(err, "failed to download the archive of plugin %q", plugin.Name)
+}
+
+// downloadOnlyFrom downloads and verifies the archive of the platform from uri
+// into destDir, resuming interrupted downloads from a partial file in
+// partialDir.
+func downloadOnlyFrom(ctx context.Context, destDir, partialDir, uri string, platform index.Platform, opts InstallOpts) (string, error) {
+	verifier, err := newArchiveVerifier(platform, opts)
+	if err != nil {
+		return "", err
+	}
+	d := download.NewDownloader(verifier, newFetcher(opts, partialDir))
+	d.TempDir = opts.TempDir
+	if opts.ArchiveFileOverride == "" {
+		d.CacheDir, d.SHA256 = opts.DownloadCacheDir, platform.Sha256
+	}
+	sum := platform.Sha256
+	if sum == "" {
+		sum = platform.Sha512
+	}
+	dst := filepath.Join(destDir, archiveFileName(uri, sum))
+	if err := d.SaveContext(ctx, uri, dst); err != nil {
+		return "", errors.Wrapf(err, "failed to download the plugin archive from %q", uri)
+	}
+	return dst, nil
+}
+
+// archiveFileName returns the last element of the path of uri, or the
+// checksum of the archive if it has none.
+func archiveFileName(uri, sum string) string {
+	if u, err := url.Parse(uri); err == nil {
+		name := path.Base(u.Path)
+		if name != "." && name != ".." && name != "/" && !strings.Contains(name, `\`) {
+			return name
+		}
+	}
+	return strings.ToLower(sum)
+}
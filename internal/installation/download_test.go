@@ -0,0 +1,114 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/testutil"
+)
+
+func TestDownloadOnly(t *testing.T) {
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+	archive, err := ioutil.ReadFile(testArchivePath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := server.URL + "/test-without-directory.tar.gz"
+	tests := []struct {
+		name     string
+		uri      string
+		mirrors  []string
+		sha256   string
+		wantFile string
+		wantErr  bool
+	}{
+		{name: "download", uri: good, sha256: testArchiveSha256, wantFile: "test-without-directory.tar.gz"},
+		{name: "from mirror", uri: server.URL + "/not-found.tar.gz", mirrors: []string{good}, sha256: testArchiveSha256, wantFile: "test-without-directory.tar.gz"},
+		{name: "checksum mismatch", uri: good, sha256: strings.Repeat("0", 64), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(
+				newTestArchivePlatform().WithURI(tt.uri).WithMirrors(tt.mirrors).WithSHA256(tt.sha256).V()).V()
+
+			got, err := DownloadOnly(plugin, tmpDir.Root(), InstallOpts{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if files, _ := ioutil.ReadDir(tmpDir.Root()); len(files) != 0 {
+					t.Errorf("destination directory has %d files after a failed download", len(files))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tmpDir.Path(tt.wantFile); got != want {
+				t.Errorf("DownloadOnly() = %q, expected %q", got, want)
+			}
+			b, err := ioutil.ReadFile(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, archive) {
+				t.Errorf("downloaded archive differs from the served archive")
+			}
+		})
+	}
+}
+
+func TestDownloadOnly_noMatchingPlatform(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(
+		testutil.NewPlatform().WithOSArch("none", "none").V()).V()
+
+	if _, err := DownloadOnly(plugin, tmpDir.Root(), InstallOpts{}); err == nil {
+		t.Fatal("expected error for plugin without a platform for this machine")
+	}
+}
+
+func Test_archiveFileName(t *testing.T) {
+	const sum = "ABCDEF"
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "https://example.com/foo/bar.tar.gz", want: "bar.tar.gz"},
+		{uri: "https://example.com/foo/bar.zip?raw=true", want: "bar.zip"},
+		{uri: "https://example.com/download/bar%20linux.tar.gz", want: "bar linux.tar.gz"},
+		{uri: "https://example.com", want: "abcdef"},
+		{uri: "https://example.com/", want: "abcdef"},
+		{uri: "https://example.com/foo/..", want: "abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := archiveFileName(tt.uri, sum); got != tt.want {
+				t.Errorf("archiveFileName(%q) = %q, expected %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import "sigs.k8s.io/krew/internal/download"
+
+// InstallPhase is a phase of installing a plugin.
+type InstallPhase string
+
+// Phases of installing a plugin, in the order they happen.
+const (
+	InstallStarted     InstallPhase = "start"
+	InstallDownloading InstallPhase = "downloading"
+	InstallVerifying   InstallPhase = "verifying"
+	InstallExtracting  InstallPhase = "extracting"
+	InstallLinking     InstallPhase = "linking"
+	InstallDone        InstallPhase = "done"
+)
+
+// InstallEvent is sent to InstallOpts.Events when the installation of a
+// plugin enters a phase. The downloading, verifying and extracting phases
+// repeat if the archive is downloaded from a mirror after a failure. A failed
+// installation skips to the done phase.
+type InstallEvent struct {
+	// Plugin is the name of the plugin.
+	Plugin string
+
+	// Phase is the phase the installation entered.
+	Phase InstallPhase
+
+	// Err is the error of the installation in the done phase, or nil if it
+	// succeeded.
+	Err error
+}
+
+// emit sends an event to opts.Events, if set.
+func (o InstallOpts) emit(plugin string, phase InstallPhase, err error) {
+	if o.Events != nil {
+		o.Events <- InstallEvent{Plugin: plugin, Phase: phase, Err: err}
+	}
+}
+
+var _ download.Verifier = phaseVerifier(nil)
+
+// phaseVerifier is a Verifier that calls the function when the content is
+// verified, to report the phases of a download.
+type phaseVerifier func()
+
+func (phaseVerifier) Write(p []byte) (int, error) { return len(p), nil }
+
+func (f phaseVerifier) Verify() error {
+	f()
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// PluginInfo describes a plugin that is available in an index, installed, or
+// both.
+type PluginInfo struct {
+	Name string
+
+	// Version is the version of the plugin in the index. It is empty if the
+	// plugin manifest from the index is not known.
+	Version string
+
+	// InstalledVersion is the installed version of the plugin. It is empty if
+	// the plugin is not installed.
+	InstalledVersion string
+
+	// Homepage, Caveats and Platforms are taken from the manifest in the
+	// index, or from the installed manifest if the plugin is not in the index.
+	Homepage string
+	Caveats  string
+	// Platforms lists the supported platforms like "linux/amd64".
+	Platforms []string
+
+	// Source is the name of the index the plugin is installed from. It is
+	// empty if the plugin is not installed.
+	Source string
+}
+
+// Info combines the manifest of the plugin from an index, which is nil if the
+// plugin is not in the index, with the receipt of the plugin if it is
+// installed. It returns an error with the cause ErrIsNotInstalled if the
+// plugin is neither in the index nor installed.
+func Info(p environment.Paths, plugin *index.Plugin, name string) (PluginInfo, error) {
+	if plugin != nil && plugin.Name != name {
+		return PluginInfo{}, errors.Errorf("plugin manifest is for plugin %q, not %q", plugin.Name, name)
+	}
+	info := PluginInfo{Name: name}
+
+	r, err := receipt.Load(p.PluginInstallReceiptPath(name))
+	switch {
+	case err == nil:
+		info.InstalledVersion = r.Spec.Version
+		info.Source = r.Status.Source.Name
+	case !os.IsNotExist(err):
+		return PluginInfo{}, errors.Wrapf(err, "failed to look up install receipt for plugin %q", name)
+	case plugin == nil:
+		return PluginInfo{}, errors.Wrapf(ErrIsNotInstalled, "plugin %q is not in the index", name)
+	}
+
+	manifest := r.Plugin
+	if plugin != nil {
+		manifest = *plugin
+		info.Version = plugin.Spec.Version
+	}
+	info.Homepage = manifest.Spec.Homepage
+	info.Caveats = manifest.Spec.Caveats
+	info.Platforms = supportedPlatforms(manifest.Spec.Platforms)
+	return info, nil
+}
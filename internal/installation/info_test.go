@@ -0,0 +1,92 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func TestInfo(t *testing.T) {
+	indexed := testutil.NewPlugin().WithName("foo").WithVersion("v2.0.0").
+		WithPlatforms(testutil.NewPlatform().WithOSArch("linux", "amd64").V()).V()
+	indexed.Spec.Homepage = "https://example.com/foo"
+	indexed.Spec.Caveats = "new caveats"
+	installed := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").
+		WithPlatforms(testutil.NewPlatform().WithOSArch("darwin", "amd64").V()).V()
+	installed.Spec.Caveats = "old caveats"
+
+	tests := []struct {
+		name      string
+		plugin    *index.Plugin
+		installed bool
+		want      PluginInfo
+	}{
+		{
+			name:   "only in index",
+			plugin: &indexed,
+			want: PluginInfo{Name: "foo", Version: "v2.0.0", Homepage: "https://example.com/foo",
+				Caveats: "new caveats", Platforms: []string{"linux/amd64"}},
+		},
+		{
+			name:      "only installed",
+			installed: true,
+			want: PluginInfo{Name: "foo", InstalledVersion: "v1.0.0", Caveats: "old caveats",
+				Platforms: []string{"darwin/amd64"}, Source: "custom"},
+		},
+		{
+			name:      "installed and in index",
+			plugin:    &indexed,
+			installed: true,
+			want: PluginInfo{Name: "foo", Version: "v2.0.0", InstalledVersion: "v1.0.0", Homepage: "https://example.com/foo",
+				Caveats: "new caveats", Platforms: []string{"linux/amd64"}, Source: "custom"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			if tt.installed {
+				r := receipt.New(installed, "custom")
+				if err := receipt.Store(r, p.PluginInstallReceiptPath("foo")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := Info(p, tt.plugin, "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Info() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInfo_errors(t *testing.T) {
+	p := newTestPaths(t)
+	if _, err := Info(p, nil, "foo"); errors.Cause(err) != ErrIsNotInstalled {
+		t.Errorf("expected ErrIsNotInstalled for an unknown plugin, got: %v", err)
+	}
+	other := testutil.NewPlugin().WithName("bar").V()
+	if _, err := Info(p, &other, "foo"); err == nil {
+		t.Error("expected error for a manifest of another plugin")
+	}
+}
@@ -15,17 +15,27 @@
 package installation
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
-	"k8s.io/klog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"sigs.k8s.io/krew/internal/download"
 	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/index/indexscanner"
 	"sigs.k8s.io/krew/internal/installation/receipt"
 	"sigs.k8s.io/krew/internal/pathutil"
 	"sigs.k8s.io/krew/pkg/constants"
@@ -35,14 +45,151 @@ import (
 // InstallOpts specifies options for plugin installation operation.
 type InstallOpts struct {
 	ArchiveFileOverride string
+
+	// KeyRing is the path to a GPG public keyring used to verify the
+	// signature of plugin archives that specify one. If empty, the path in
+	// the KREW_GPG_KEYRING environment variable is used. Plugins with a
+	// signature cannot be installed without a keyring.
+	KeyRing string
+
+	// DryRun only checks that the plugin can be installed on this platform
+	// and its archive is reachable, without changing anything on disk.
+	DryRun bool
+
+	// HTTPClient, if set, is used to download plugin archives, e.g. to go
+	// through a proxy or trust custom certificate authorities.
+	HTTPClient *http.Client
+
+	// Headers are added to the requests downloading plugin archives from the
+	// host they are keyed by (a host name or host:port), e.g. to authenticate
+	// to a private artifact registry. They are never sent to other hosts.
+	Headers map[string]http.Header
+
+	// MaxUncompressedBytes limits the total size of the files extracted from
+	// the plugin archive. If zero, download.DefaultMaxUncompressedBytes is used.
+	MaxUncompressedBytes int64
+
+	// PreserveModes keeps the permission bits of the files in the plugin
+	// archive, e.g. of helper scripts, instead of applying the umask of the
+	// process when extracting them. Files are not made writable by group or
+	// others, and the plugin executable is made executable regardless.
+	// Upgrades of a plugin installed with PreserveModes keep the modes as
+	// well.
+	PreserveModes bool
+
+	// Logger receives the log messages of the installation. If nil, the
+	// messages are written to klog.
+	Logger Logger
+
+	// Progress, if set, is called as the plugin archive is downloaded, or
+	// read from ArchiveFileOverride.
+	Progress download.ProgressFunc
+
+	// TempDir is the directory where temporary files, like the downloaded
+	// plugin archive, are created. If empty, the staging directory of the
+	// krew paths (see environment.Paths.StagingPath) is used by the functions
+	// installing into them, environment.TempDir by DownloadOnly, and the temp
+	// directory of the OS by the others.
+	TempDir string
+
+	// DownloadCacheDir, if set, is a directory where downloaded plugin
+	// archives are cached by their sha256 checksum, so that an archive used
+	// by multiple plugins or reinstalls is downloaded only once.
+	DownloadCacheDir string
+
+	// ForceReplace replaces a file in the bin directory that has the name of
+	// the plugin executable but is not a symlink created by krew, e.g. a
+	// plugin installed without krew. The file is backed up with a ".bak"
+	// suffix. Otherwise the installation fails if there is such a file.
+	//
+	// It also replaces the link of another installed plugin with the same
+	// executable name (see ErrBinaryConflict), which is then recorded as
+	// installed without a link, so that uninstalling it keeps the link.
+	ForceReplace bool
+
+	// ExtractionMultiplier is the assumed ratio of the size of the extracted
+	// files to the size of the plugin archive, used to check that there is
+	// enough disk space before downloading the archive. If zero,
+	// DefaultExtractionMultiplier is used. Archives with a higher compression
+	// ratio need a higher value.
+	ExtractionMultiplier float64
+
+	// SkipLink installs the plugin without linking its executable into the
+	// bin directory, for environments that manage their own PATH or
+	// wrappers. The executable is at the Bin path of the platform in the
+	// installation directory of the plugin version, which InstallWithResult
+	// returns as InstallResult.Executable. Upgrades of such plugins are not
+	// linked either.
+	SkipLink bool
+
+	// RelativeLink creates the symbolic link in the bin directory with a path
+	// relative to the bin directory, so that the links keep working if the
+	// krew root directory is moved. Upgrades and rollbacks of a plugin
+	// installed with a relative link create relative links as well.
+	RelativeLink bool
+
+	// VersionedAlias also links the plugin executable into the bin directory
+	// with a name suffixed with the plugin version, like kubectl-foo@1.2.3
+	// (see VersionedBinaryNameForPlugin), which keeps pointing at that version
+	// after upgrades for as long as it is on disk. Upgrades of a plugin
+	// installed with an alias create an alias for the new version as well.
+	// It has no effect with SkipLink.
+	VersionedAlias bool
+
+	// ManifestSHA256, if set, is the expected sha256 sum of the manifest file
+	// of the plugin. The installation fails with ErrManifestMismatch unless
+	// the plugin was parsed from a manifest with this sum, for installing
+	// exactly the manifest that was reviewed. It is not checked for the
+	// dependencies of the plugin.
+	ManifestSHA256 string
+
+	// Events, if set, receives an InstallEvent for each phase of the
+	// installation. Sending blocks, so the channel must be received from
+	// until the installation returns. The channel is not closed.
+	Events chan<- InstallEvent
+
+	// eventPlugin is the name of the plugin in the events sent while
+	// downloading its archive.
+	eventPlugin string
+
+	// dependencies, if set, loads the dependencies of the plugin instead of
+	// the index it is installed from.
+	dependencies dependencySource
+
+	// archiveFile, if set, is called with the slash-separated path of each
+	// regular file of the plugin archive, including the files that are not
+	// extracted because they are not needed.
+	archiveFile func(name string)
+
+	// staged, if set, is the archive of the plugin that was already
+	// downloaded and extracted, which is installed instead of downloading it
+	// again.
+	staged *stagedArchive
 }
 
+func (o InstallOpts) logger() Logger {
+	return loggerOrDefault(o.Logger)
+}
+
+// installWorkers is the maximum number of plugins InstallMany installs
+// concurrently.
+const installWorkers = 4
+
 type installOperation struct {
 	pluginName string
 	platform   index.Platform
 
 	installDir string
 	binDir     string
+	version    string
+
+	// stagingDir is where the archive is downloaded and extracted. If empty,
+	// the temp directory of the OS is used.
+	stagingDir string
+
+	// prevLinkType is the link type of the installed version being upgraded,
+	// or of the link of another plugin replaced with ForceReplace.
+	prevLinkType string
 }
 
 // Plugin lifecycle errors
@@ -50,18 +197,183 @@ var (
 	ErrIsAlreadyInstalled = errors.New("can't install, the newest version is already installed")
 	ErrIsNotInstalled     = errors.New("plugin is not installed")
 	ErrIsAlreadyUpgraded  = errors.New("can't upgrade, the newest version is already installed")
+	ErrManifestMismatch   = errors.New("plugin manifest does not match the expected sha256 sum")
 )
 
 // Install will download and install a plugin. The operation tries
 // to not get the plugin dir in a bad state if it fails during the process.
+// If the plugin archive cannot be downloaded, verified or extracted, the
+// error wraps download.ErrNetwork, download.ErrNotFound,
+// download.ErrChecksumMismatch or download.ErrExtraction, which can be
+// checked with errors.Is.
 func Install(p environment.Paths, plugin index.Plugin, indexName string, opts InstallOpts) error {
-	klog.V(2).Infof("Looking for installed versions")
+	return InstallContext(context.Background(), p, plugin, indexName, opts)
+}
+
+// InstallContext is like Install, but cancelling ctx aborts the download of
+// the plugin archive and cleans up the downloaded files.
+//
+// Everything is written under the base directory of p, which is created if it
+// does not exist, so a plugin can be installed into an isolated directory
+// without affecting the krew installation of the user.
+func InstallContext(ctx context.Context, p environment.Paths, plugin index.Plugin, indexName string, opts InstallOpts) error {
+	opts.emit(plugin.Name, InstallStarted, nil)
+	err := lockedInstall(ctx, p, plugin, indexName, opts)
+	opts.emit(plugin.Name, InstallDone, err)
+	return err
+}
+
+// lockedInstall installs the plugin and its missing dependencies while
+// holding the lock of the krew installation, unless it is a dry-run. Nothing
+// is installed if the install policy does not allow the plugin, or if its
+// manifest does not have the expected sha256 sum.
+func lockedInstall(ctx context.Context, p environment.Paths, plugin index.Plugin, indexName string, opts InstallOpts) error {
+	if err := checkAllowed(plugin, opts); err != nil {
+		return err
+	}
+	if !opts.DryRun {
+		unlock, err := acquireLock(ctx, p, opts.logger())
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if _, err := receipt.Load(p.PluginInstallReceiptPath(plugin.Name)); os.IsNotExist(err) {
+			if err := installDependencies(ctx, p, plugin, indexName, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return installContext(ctx, p, plugin, indexName, opts)
+}
+
+// checkAllowed checks that the install policy allows the plugin, and that it
+// was parsed from a manifest with the sha256 sum in opts, if it is set. It is
+// checked before installing, reinstalling or upgrading a plugin.
+func checkAllowed(plugin index.Plugin, opts InstallOpts) error {
+	if err := checkInstallPolicy(plugin.Name); err != nil {
+		return err
+	}
+	return checkManifestSHA256(plugin, opts.ManifestSHA256)
+}
+
+// checkManifestSHA256 checks that the plugin was parsed from a manifest with
+// the sha256 sum want, if it is set.
+func checkManifestSHA256(plugin index.Plugin, want string) error {
+	if want == "" {
+		return nil
+	}
+	if plugin.ManifestSHA256 == "" {
+		return errors.Wrapf(ErrManifestMismatch, "the sha256 sum of the manifest of plugin %q is not known", plugin.Name)
+	}
+	if !strings.EqualFold(plugin.ManifestSHA256, want) {
+		return errors.Wrapf(ErrManifestMismatch, "the manifest of plugin %q has sha256 sum %s, expected %s", plugin.Name, plugin.ManifestSHA256, want)
+	}
+	return nil
+}
+
+// ErrBinaryConflict is returned if the executable of a plugin would replace
+// the link of another installed plugin in the bin directory. Plugin names that
+// differ only in dashes and underscores have the same executable name.
+type ErrBinaryConflict struct {
+	// Plugin is the name of the plugin being installed.
+	Plugin string
+
+	// Installed is the name of the installed plugin linked as Binary.
+	Installed string
+
+	// Binary is the name of the executable in the bin directory.
+	Binary string
+}
+
+func (e *ErrBinaryConflict) Error() string {
+	return fmt.Sprintf("plugin %q would replace %q of the installed plugin %q, uninstall it "+
+		"or retry with the option to force replacing it (e.g. --force-replace)", e.Plugin, e.Binary, e.Installed)
+}
+
+// checkBinaryConflict returns an *ErrBinaryConflict if the bin directory has
+// the executable of the plugin, linked for another installed plugin.
+func checkBinaryConflict(p environment.Paths, name string) error {
+	others, err := otherLinkedPlugins(p, name)
+	if err != nil || len(others) == 0 {
+		return err
+	}
+	return &ErrBinaryConflict{Plugin: name, Installed: others[0], Binary: BinaryNameForPlugin(name)}
+}
+
+// otherLinkedPlugins returns the names of the installed plugins other than
+// the plugin name that are linked as its executable in the bin directory.
+func otherLinkedPlugins(p environment.Paths, name string) ([]string, error) {
+	bin := BinaryNameForPlugin(name)
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), bin)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	installed, err := FindByBinary(p, bin)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up the plugins linked as %q", bin)
+	}
+	var others []string
+	for _, other := range installed {
+		if other != name {
+			others = append(others, other)
+		}
+	}
+	return others, nil
+}
+
+// unlinkReplacedPlugins records the installed plugins whose link in the bin
+// directory was replaced with ForceReplace as installed without a link.
+// Failures are only logged, as the plugin was installed.
+func unlinkReplacedPlugins(p environment.Paths, names []string, log Logger) {
+	for _, name := range names {
+		log.Warningf("Replaced the executable of plugin %s, which is no longer linked in the bin directory", name)
+		path := p.PluginInstallReceiptPath(name)
+		r, err := receipt.Load(path)
+		if err != nil {
+			log.Warningf("failed to read the receipt of plugin %s: %v", name, err)
+			continue
+		}
+		if r.Status.Install == nil {
+			r.Status.Install = &index.InstallStatus{}
+		}
+		r.Status.Install.LinkType = linkTypeNone
+		if err := receipt.Store(r, path); err != nil {
+			log.Warningf("failed to update the receipt of plugin %s: %v", name, err)
+		}
+	}
+}
+
+func installContext(ctx context.Context, p environment.Paths, plugin index.Plugin, indexName string, opts InstallOpts) error {
+	log := opts.logger()
+	if opts.DryRun {
+		log.Debugf("Dry-run install of plugin %s", plugin.Name)
+		return dryRunInstall(ctx, plugin, opts)
+	}
+
+	log.Debugf("Looking for installed versions")
 	_, err := receipt.Load(p.PluginInstallReceiptPath(plugin.Name))
 	if err == nil {
 		return ErrIsAlreadyInstalled
 	} else if !os.IsNotExist(err) {
 		return errors.Wrap(err, "failed to look up plugin receipt")
 	}
+	var replaced []string
+	replacedLinkType := ""
+	if !opts.SkipLink && !opts.ForceReplace {
+		if err := checkBinaryConflict(p, plugin.Name); err != nil {
+			return err
+		}
+	} else if !opts.SkipLink {
+		if replaced, err = otherLinkedPlugins(p, plugin.Name); err != nil {
+			return err
+		}
+		for _, name := range replaced {
+			if r, err := receipt.Load(p.PluginInstallReceiptPath(name)); err == nil && isLinkedByKrew(installedLinkType(r)) {
+				// a hard link or copy created by krew is replaced without a backup
+				replacedLinkType = installedLinkType(r)
+			}
+		}
+	}
 
 	// Find available installation candidate
 	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
@@ -69,148 +381,924 @@ func Install(p environment.Paths, plugin index.Plugin, indexName string, opts In
 		return errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
 	}
 	if !ok {
-		return errors.Errorf("plugin %q does not offer installation for this platform", plugin.Name)
+		return newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	if opts.staged != nil {
+		// the sha256 sum was resolved before the archive was staged
+		candidate = opts.staged.platform
+	} else if err := resolveSha256(ctx, &candidate, opts); err != nil {
+		return err
+	}
+
+	for _, dir := range []string{p.BinPath(), p.InstallReceiptsPath()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create directory %q", dir)
+		}
 	}
 
 	// The actual install should be the last action so that a failure during receipt
-	// saving does not result in an installed plugin without receipt.
-	klog.V(3).Infof("Install plugin %s at version=%s", plugin.Name, plugin.Spec.Version)
-	if err := install(installOperation{
+	// saving does not result in an installed plugin without receipt. If storing the
+	// receipt fails anyway, the installation is rolled back.
+	log.Debugf("Install plugin %s at version=%s", plugin.Name, plugin.Spec.Version)
+	op := installOperation{
 		pluginName: plugin.Name,
 		platform:   candidate,
 
 		binDir:     p.BinPath(),
 		installDir: p.PluginVersionInstallPath(plugin.Name, plugin.Spec.Version),
-	}, opts); err != nil {
+		version:    plugin.Spec.Version,
+		stagingDir: p.StagingPath(),
+
+		prevLinkType: replacedLinkType,
+	}
+	// a backup that does not exist before install is created by it
+	link := filepath.Join(op.binDir, BinaryNameForPlugin(op.pluginName))
+	_, err = os.Lstat(link + ".bak")
+	hadBackup := err == nil
+	status, err := install(ctx, op, opts)
+	if err != nil {
 		return errors.Wrap(err, "install failed")
 	}
-	klog.V(3).Infof("Storing install receipt for plugin %s", plugin.Name)
-	err = receipt.Store(receipt.New(plugin, indexName), p.PluginInstallReceiptPath(plugin.Name))
-	return errors.Wrap(err, "installation receipt could not be stored, uninstall may fail")
+	log.Debugf("Storing install receipt for plugin %s", plugin.Name)
+	r := receipt.New(plugin, indexName)
+	r.Status.Install = status
+	if err := storeReceipt(r, p.PluginInstallReceiptPath(plugin.Name)); err != nil {
+		rollbackInstall(op, status, log)
+		if _, statErr := os.Lstat(link + ".bak"); opts.ForceReplace && !hadBackup && statErr == nil {
+			restoreBackup(link, linkTypeNone, log)
+		}
+		return errors.Wrap(err, "installation receipt could not be stored, rolled back the installation")
+	}
+	unlinkReplacedPlugins(p, replaced, log)
+	return nil
 }
 
-func install(op installOperation, opts InstallOpts) error {
-	// Download and extract
-	klog.V(3).Infof("Creating download staging directory")
-	downloadStagingDir, err := ioutil.TempDir("", "krew-downloads")
+// storeReceipt stores the install receipt of a plugin, overridable in tests.
+var storeReceipt = receipt.Store
+
+// rollbackInstall removes the links and the installation directory created by
+// install with the given status. Failures are only logged, as the installation
+// already failed.
+func rollbackInstall(op installOperation, status *index.InstallStatus, log Logger) {
+	log.Infof("Rolling back the installation of plugin %s", op.pluginName)
+	if err := removeInstalledLink(filepath.Join(op.binDir, BinaryNameForPlugin(op.pluginName)), status.LinkType, log); err != nil {
+		log.Warningf("failed to remove the symlink of plugin %s: %v", op.pluginName, err)
+	}
+	if err := removeVersionedAlias(op.binDir, op.pluginName, op.version, status, log); err != nil {
+		log.Warningf("failed to remove the versioned alias of plugin %s: %v", op.pluginName, err)
+	}
+	if err := os.RemoveAll(op.installDir); err != nil {
+		log.Warningf("failed to remove the installation directory %q: %v", op.installDir, err)
+	}
+}
+
+// InstallFromManifest reads and validates the plugin manifest file at
+// manifestPath and installs the plugin. As the plugin is not from an index, it
+// is recorded as installed from the "detached" index.
+func InstallFromManifest(p environment.Paths, manifestPath string, opts InstallOpts) error {
+	plugin, err := indexscanner.ReadPluginFromFile(manifestPath)
 	if err != nil {
-		return errors.Wrapf(err, "could not create staging dir %q", downloadStagingDir)
+		return errors.Wrapf(err, "failed to load plugin manifest from file %q", manifestPath)
+	}
+	return Install(p, plugin, constants.DetachedIndexName, opts)
+}
+
+// InstallVersion installs the plugin manifest among plugins whose version is
+// the specified version. If the plugin is already installed at another
+// version, that version is replaced like by Upgrade, even if it is newer. It
+// returns an error listing the available versions if none of the manifests
+// match.
+func InstallVersion(p environment.Paths, plugins []index.Plugin, version, indexName string, opts InstallOpts) error {
+	log := opts.logger()
+	var available []string
+	for _, plugin := range plugins {
+		if plugin.Spec.Version == version {
+			log.Debugf("Found manifest of plugin %s at version %s", plugin.Name, version)
+			if r, err := receipt.Load(p.PluginInstallReceiptPath(plugin.Name)); err == nil && r.Spec.Version != version {
+				log.Infof("Replacing version %s of plugin %s with version %s", r.Spec.Version, plugin.Name, version)
+				return Upgrade(p, plugin, indexName, UpgradeOpts{InstallOpts: opts, AllowDowngrade: true})
+			}
+			return Install(p, plugin, indexName, opts)
+		}
+		available = append(available, plugin.Spec.Version)
+	}
+	return errors.Errorf("version %q not found, available versions: [%s]", version, strings.Join(available, ", "))
+}
+
+// dryRunInstall validates that the plugin offers an installation candidate for
+// this platform with a well-formed checksum, and that its archive can be
+// reached.
+func dryRunInstall(ctx context.Context, plugin index.Plugin, opts InstallOpts) error {
+	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
+	if err != nil {
+		return errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	if err := resolveSha256(ctx, &candidate, opts); err != nil {
+		return err
+	}
+	if _, err := checksumVerifiers(candidate); err != nil {
+		return errors.Wrapf(err, "plugin %q has an invalid checksum", plugin.Name)
+	}
+	err = newFetcher(opts, "").Head(ctx, candidate.URI)
+	return errors.Wrapf(err, "archive of plugin %q is not reachable", plugin.Name)
+}
+
+// InstallMany installs the given plugins concurrently using a bounded number
+// of workers. A failure to install one plugin does not stop the installation
+// of others. The returned slice contains the error (or nil) for each plugin at
+// the same position as in the plugins argument.
+func InstallMany(p environment.Paths, plugins []index.Plugin, indexName string, opts InstallOpts) []error {
+	errs := make([]error, len(plugins))
+
+	// Installations of the same plugin are serialized, so that duplicates in
+	// the list fail with ErrIsAlreadyInstalled instead of racing each other.
+	locks := make(map[string]*sync.Mutex)
+	for _, plugin := range plugins {
+		if _, ok := locks[plugin.Name]; !ok {
+			locks[plugin.Name] = &sync.Mutex{}
+		}
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < installWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				plugin := plugins[j]
+				mu := locks[plugin.Name]
+				mu.Lock()
+				opts.logger().Debugf("Installing plugin %s (%d/%d)", plugin.Name, j+1, len(plugins))
+				errs[j] = Install(p, plugin, indexName, opts)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range plugins {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+func install(ctx context.Context, op installOperation, opts InstallOpts) (*index.InstallStatus, error) {
+	log := opts.logger()
+
+	// Download and extract
+	staged := opts.staged
+	if staged == nil {
+		var err error
+		if staged, err = stageArchive(ctx, op, opts); err != nil {
+			return nil, err
+		}
 	}
-	klog.V(3).Infof("Successfully created download staging directory %q", downloadStagingDir)
+	downloadStagingDir, status := staged.dir, staged.status
 	defer func() {
-		klog.V(3).Infof("Deleting the download staging directory %s", downloadStagingDir)
+		log.Debugf("Deleting the download staging directory %s", downloadStagingDir)
 		if err := os.RemoveAll(downloadStagingDir); err != nil {
-			klog.Warningf("failed to clean up download staging directory: %s", err)
+			log.Warningf("failed to clean up download staging directory: %s", err)
 		}
 	}()
-	if err := downloadAndExtract(downloadStagingDir, op.platform.URI, op.platform.Sha256, opts.ArchiveFileOverride); err != nil {
-		return errors.Wrap(err, "failed to unpack into staging dir")
-	}
 
-	applyDefaults(&op.platform)
-	if err := moveToInstallDir(downloadStagingDir, op.installDir, op.platform.Files); err != nil {
-		return errors.Wrap(err, "failed while moving files to the installation directory")
+	applyDefaults(&op.platform, log)
+	if err := moveToInstallDir(downloadStagingDir, op.installDir, op.stagingDir, op.platform.StripComponents, op.platform.Files); err != nil {
+		return nil, errors.Wrap(err, "failed while moving files to the installation directory")
 	}
 
 	subPathAbs, err := filepath.Abs(op.installDir)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get the absolute fullPath of %q", op.installDir)
+		return nil, errors.Wrapf(err, "failed to get the absolute fullPath of %q", op.installDir)
 	}
 	fullPath := filepath.Join(op.installDir, filepath.FromSlash(op.platform.Bin))
 	pathAbs, err := filepath.Abs(fullPath)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get the absolute fullPath of %q", fullPath)
+		return nil, errors.Wrapf(err, "failed to get the absolute fullPath of %q", fullPath)
 	}
 	if _, ok := pathutil.IsSubPath(subPathAbs, pathAbs); !ok {
-		return errors.Wrapf(err, "the fullPath %q does not extend the sub-fullPath %q", fullPath, op.installDir)
+		return nil, errors.Wrapf(err, "the fullPath %q does not extend the sub-fullPath %q", fullPath, op.installDir)
+	}
+	if _, err := os.Lstat(fullPath); os.IsNotExist(err) {
+		installed, err := listFiles(op.installDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list the installed files")
+		}
+		return nil, missingBinError(op.platform.Bin, staged.binFiles, installed)
+	}
+	if err := checkPluginExecutable(fullPath, op.platform.Bin); err != nil {
+		return nil, err
+	}
+	if !IsWindows() {
+		if err := ensureExecutable(fullPath, log); err != nil {
+			return nil, err
+		}
+	}
+	if status.Files, err = hashInstalledFiles(op.installDir); err != nil {
+		return nil, errors.Wrap(err, "failed to compute checksums of installed files")
+	}
+	opts.emit(op.pluginName, InstallLinking, nil)
+	if opts.SkipLink {
+		log.Debugf("Not linking plugin %s, its executable is %q", op.pluginName, fullPath)
+		if err := removeInstalledLink(filepath.Join(op.binDir, BinaryNameForPlugin(op.pluginName)), op.prevLinkType, log); err != nil {
+			return nil, errors.Wrap(err, "failed to remove old symlink")
+		}
+		status.LinkType = linkTypeNone
+		return status, nil
+	}
+	link := filepath.Join(op.binDir, BinaryNameForPlugin(op.pluginName))
+	backedUp := false
+	if opts.ForceReplace && !isLinkedByKrew(op.prevLinkType) {
+		if backedUp, err = backupNonLink(link, log); err != nil {
+			return nil, err
+		}
+	}
+	relative := opts.RelativeLink || op.prevLinkType == linkTypeRelative
+	if status.LinkType, err = createOrUpdateLink(op.binDir, fullPath, op.pluginName, op.prevLinkType, relative, log); err != nil {
+		if backedUp {
+			restoreBackup(link, status.LinkType, log)
+		}
+		return nil, errors.Wrap(err, "failed to link installed plugin")
+	}
+	if opts.VersionedAlias {
+		alias := versionedAliasName(op.pluginName, op.version)
+		log.Debugf("Linking plugin %s as %s", op.pluginName, BinaryNameForPlugin(alias))
+		if _, err := createOrUpdateLink(op.binDir, fullPath, alias, status.LinkType, relative, log); err != nil {
+			if backedUp {
+				restoreBackup(link, status.LinkType, log)
+			}
+			return nil, errors.Wrap(err, "failed to create the versioned alias of installed plugin")
+		}
+		status.VersionedAlias = true
+	}
+	return status, nil
+}
+
+// stagedArchive is the archive of a plugin downloaded and extracted into a
+// directory in the staging directory, before it is installed.
+type stagedArchive struct {
+	dir      string
+	platform index.Platform
+	status   *index.InstallStatus
+
+	// binFiles are the paths of the files in the archive named like the
+	// plugin executable, for the error if it is not installed.
+	binFiles []string
+}
+
+// stageArchive downloads the archive of the platform of op and extracts it into
+// a new directory in the staging directory of op, which the caller must remove.
+func stageArchive(ctx context.Context, op installOperation, opts InstallOpts) (*stagedArchive, error) {
+	log := opts.logger()
+	log.Debugf("Creating download staging directory")
+	if opts.TempDir == "" {
+		opts.TempDir = op.stagingDir
+	}
+	dir, err := makeTempDir(op.stagingDir, "krew-downloads")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Successfully created download staging directory %q", dir)
+	opts.eventPlugin = op.pluginName
+	binName := path.Base(path.Clean(filepath.ToSlash(op.platform.Bin)))
+	binFiles := make(map[string]bool)
+	opts.archiveFile = func(name string) {
+		if name = path.Clean(name); path.Base(name) == binName {
+			binFiles[name] = true
+		}
+	}
+	status, err := func() (*index.InstallStatus, error) {
+		if err := checkDiskSpace(ctx, dir, op.installDir, op.platform, opts); err != nil {
+			return nil, err
+		}
+		status, err := downloadAndExtract(ctx, dir, op.platform, opts)
+		return status, errors.Wrap(err, "failed to unpack into staging dir")
+	}()
+	if err != nil {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warningf("failed to clean up download staging directory: %s", err)
+		}
+		return nil, err
+	}
+	staged := &stagedArchive{dir: dir, platform: op.platform, status: status}
+	for name := range binFiles {
+		staged.binFiles = append(staged.binFiles, name)
+	}
+	sort.Strings(staged.binFiles)
+	return staged, nil
+}
+
+// checkPluginExecutable checks that the plugin executable at path, installed
+// from the bin path of the platform, is a regular file. A bin path pointing
+// to a directory or a symbolic link in the archive is a mistake in the plugin
+// manifest that would otherwise result in a broken plugin.
+func checkPluginExecutable(path, bin string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return errors.Errorf("plugin executable %q (bin: %q) cannot be found in extracted archive", path, bin)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to stat plugin executable %q", path)
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return errors.Errorf("plugin executable %q (bin: %q) is a symbolic link, bin must point to a regular file in the archive", path, bin)
+	case fi.IsDir():
+		return errors.Errorf("plugin executable %q (bin: %q) is a directory, bin must point to a regular file in the archive", path, bin)
+	case !fi.Mode().IsRegular():
+		return errors.Errorf("plugin executable %q (bin: %q) is not a regular file (mode=%s)", path, bin, fi.Mode())
 	}
-	err = createOrUpdateLink(op.binDir, fullPath, op.pluginName)
-	return errors.Wrap(err, "failed to link installed plugin")
+	return nil
 }
 
-func applyDefaults(platform *index.Platform) {
+// maxListedFiles is the maximum number of installed files listed in the error
+// about a missing plugin executable.
+const maxListedFiles = 20
+
+// missingBinError returns the error for a bin path that is not among the
+// installed files. It tells whether the archive has no such file, or the file
+// operations did not install it, given the files in the archive.
+func missingBinError(bin string, archiveFiles, installed []string) error {
+	listed := "none"
+	if len(installed) > maxListedFiles {
+		listed = fmt.Sprintf("%s, and %d more", strings.Join(installed[:maxListedFiles], ", "), len(installed)-maxListedFiles)
+	} else if len(installed) > 0 {
+		listed = strings.Join(installed, ", ")
+	}
+
+	name := path.Base(path.Clean(bin))
+	var candidates []string
+	for _, f := range archiveFiles {
+		if path.Base(f) == name {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return errors.Errorf("plugin executable %q (bin) is not in the plugin archive, which has no file named %q (installed files: %s)", bin, name, listed)
+	}
+	return errors.Errorf("plugin executable %q (bin) was not installed by the file operations, although the archive has %s (installed files: %s)",
+		bin, strings.Join(candidates, ", "), listed)
+}
+
+// ensureExecutable adds the executable bits to the file at path if they are
+// missing, as some archive formats (like zip) do not preserve permissions.
+func ensureExecutable(path string, log Logger) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return errors.Wrapf(err, "plugin executable %q cannot be found in extracted archive", path)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to stat plugin executable %q", path)
+	}
+	if fi.IsDir() {
+		return errors.Errorf("plugin executable %q is a directory", path)
+	}
+	if fi.Mode()&0111 == 0111 {
+		return nil
+	}
+	log.Debugf("Adding executable permissions to %q (mode was %v)", path, fi.Mode())
+	err = os.Chmod(path, fi.Mode()|0111)
+	return errors.Wrapf(err, "failed to make plugin executable %q executable", path)
+}
+
+func applyDefaults(platform *index.Platform, log Logger) {
 	if platform.Files == nil {
 		platform.Files = []index.FileOperation{{From: "*", To: "."}}
-		klog.V(4).Infof("file operation not specified, assuming %v", platform.Files)
+		log.Debugf("file operation not specified, assuming %v", platform.Files)
+	}
+}
+
+// resolveSha256 sets the sha256 sum of the platform from the checksums file
+// at its Sha256URL, unless the sum is specified in the manifest. The checksums
+// file is not downloaded for an ArchiveFileOverride, which is installed without
+// network access, so its manifest must specify a sum.
+func resolveSha256(ctx context.Context, platform *index.Platform, opts InstallOpts) error {
+	if platform.Sha256 != "" || platform.Sha256URL == "" {
+		return nil
+	}
+	if opts.ArchiveFileOverride != "" {
+		if platform.Sha512 != "" {
+			return nil
+		}
+		return errors.Errorf("the manifest must specify the sha256 or sha512 sum of %q to install it from an archive file, sha256URL is not looked up", platform.URI)
+	}
+	opts.logger().Debugf("Looking up the sha256 sum of %s in %s", platform.URI, platform.Sha256URL)
+	sum, err := download.FetchSha256(ctx, newHTTPFetcher(opts), platform.Sha256URL, platform.URI)
+	if err != nil {
+		return errors.Wrapf(err, "failed to look up the sha256 sum of %q", platform.URI)
+	}
+	platform.Sha256 = sum
+	return nil
+}
+
+// downloadAndExtract downloads the archive of the platform (or uses the provided ArchiveFileOverride, if a non-empty
+// value) while validating its checksum and signature (if specified), and extracts its contents to extractDir that
+// must be created. If the download from the platform URI fails, the mirrors are tried in order. It returns details
+// about the downloaded archive.
+func downloadAndExtract(ctx context.Context, extractDir string, platform index.Platform, opts InstallOpts) (*index.InstallStatus, error) {
+	log := opts.logger()
+	uris := append([]string{platform.URI}, platform.Mirrors...)
+	var err error
+	for i, uri := range uris {
+		var status *index.InstallStatus
+		if status, err = downloadAndExtractFrom(ctx, extractDir, uri, platform, opts); err == nil {
+			log.Debugf("Downloaded plugin archive from %s", uri)
+			return status, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(uris)-1 {
+			log.Warningf("Failed to download plugin archive from %s, trying the next mirror: %v", uri, err)
+		}
+	}
+	return nil, err
+}
+
+// downloadAndExtractFrom downloads the archive of the platform from uri and
+// extracts it to extractDir.
+func downloadAndExtractFrom(ctx context.Context, extractDir, uri string, platform index.Platform, opts InstallOpts) (*index.InstallStatus, error) {
+	archiveVerifier, err := newArchiveVerifier(platform, opts)
+	if err != nil {
+		return nil, err
+	}
+	size := &byteCounter{}
+	// the archive is extracted right after it is verified successfully
+	verifier := download.NewVerifierChain(phaseVerifier(func() { opts.emit(opts.eventPlugin, InstallVerifying, nil) }),
+		size, archiveVerifier, phaseVerifier(func() { opts.emit(opts.eventPlugin, InstallExtracting, nil) }))
+	opts.emit(opts.eventPlugin, InstallDownloading, nil)
+	start := time.Now()
+	d := download.NewDownloader(verifier, newFetcher(opts, extractDir))
+	d.MaxUncompressedBytes = opts.MaxUncompressedBytes
+	d.Include = archiveEntryFilter(platform)
+	if opts.archiveFile != nil {
+		include := d.Include
+		d.Include = func(entry string) bool {
+			opts.archiveFile(entry)
+			return include == nil || include(entry)
+		}
+	}
+	d.PreserveModes = opts.PreserveModes
+	d.TempDir = opts.TempDir
+	if opts.ArchiveFileOverride == "" {
+		d.CacheDir, d.SHA256 = opts.DownloadCacheDir, platform.Sha256
+	}
+	if err := d.GetContext(ctx, uri, extractDir); err != nil {
+		return nil, errors.Wrapf(err, "failed to unpack the plugin archive from %q", uri)
+	}
+	return &index.InstallStatus{
+		URI:              uri,
+		Size:             size.n,
+		DownloadDuration: metav1.Duration{Duration: time.Since(start)},
+		PreserveModes:    opts.PreserveModes,
+	}, nil
+}
+
+// keyRingEnv is the environment variable with the path of the GPG public
+// keyring used if InstallOpts.KeyRing is not set.
+const keyRingEnv = "KREW_GPG_KEYRING"
+
+// newArchiveVerifier returns a verifier of the checksums of the archive of the
+// platform, and of its signature if it has one. It fails for a platform with
+// a signature if no keyring is configured to verify it. The signature is
+// fetched like the archive, with opts.HTTPClient and opts.Headers.
+func newArchiveVerifier(platform index.Platform, opts InstallOpts) (download.Verifier, error) {
+	checksums, err := checksumVerifiers(platform)
+	if err != nil {
+		return nil, err
 	}
+	verifier := download.NewVerifierChain(checksums...)
+	if platform.Signature != "" {
+		keyRing := opts.KeyRing
+		if keyRing == "" {
+			keyRing = os.Getenv(keyRingEnv)
+		}
+		if keyRing == "" {
+			return nil, errors.Errorf("plugin archive has a signature, but no keyring is configured to verify it (set %s)", keyRingEnv)
+		}
+		verifier = download.NewVerifierChain(verifier, download.NewGPGVerifier(keyRing, platform.Signature, opts.TempDir, newHTTPFetcher(opts)))
+	}
+	return verifier, nil
 }
 
-// downloadAndExtract downloads the specified archive uri (or uses the provided overrideFile, if a non-empty value)
-// while validating its checksum with the provided sha256sum, and extracts its contents to extractDir that must be.
-// created.
-func downloadAndExtract(extractDir, uri, sha256sum, overrideFile string) error {
-	var fetcher download.Fetcher = download.HTTPFetcher{}
-	if overrideFile != "" {
-		fetcher = download.NewFileFetcher(overrideFile)
+// checksumVerifiers returns the verifiers of the checksums specified for the
+// archive of the platform. All of the specified checksums are verified.
+func checksumVerifiers(platform index.Platform) ([]download.Verifier, error) {
+	sums := []struct {
+		algo, sum string
+		size      int
+	}{
+		{algo: download.SHA256, sum: platform.Sha256, size: sha256.Size},
+		{algo: download.SHA512, sum: platform.Sha512, size: sha512.Size},
+	}
+	var out []download.Verifier
+	for _, s := range sums {
+		if s.sum == "" {
+			continue
+		}
+		if b, err := hex.DecodeString(s.sum); err != nil || len(b) != s.size {
+			return nil, errors.Errorf("invalid %s sum %q, must be %d hex characters", s.algo, s.sum, s.size*2)
+		}
+		v, err := download.NewChecksumVerifier(s.algo, s.sum)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
 	}
+	if len(out) == 0 {
+		return nil, errors.New("no sha256 or sha512 sum is specified for the archive")
+	}
+	return out, nil
+}
+
+// byteCounter is a Verifier that counts the bytes written to it.
+type byteCounter struct{ n int64 }
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
 
-	verifier := download.NewSha256Verifier(sha256sum)
-	err := download.NewDownloader(verifier, fetcher).Get(uri, extractDir)
-	return errors.Wrap(err, "failed to unpack the plugin archive")
+func (c *byteCounter) Verify() error { return nil }
+
+// newFetcher returns a Fetcher reading from opts.ArchiveFileOverride, if a
+// non-empty value, or from the network using opts.HTTPClient otherwise.
+// Interrupted downloads are resumed from a partial file in partialDir, if
+// specified.
+func newFetcher(opts InstallOpts, partialDir string) download.Fetcher {
+	if opts.ArchiveFileOverride != "" {
+		return download.NewFileFetcherWithProgress(opts.ArchiveFileOverride, opts.Progress)
+	}
+	f := newHTTPFetcher(opts)
+	f.PartialDir = partialDir
+	f.Progress = opts.Progress
+	return f
 }
 
-// Uninstall will uninstall a plugin.
-func Uninstall(p environment.Paths, name string) error {
+// newHTTPFetcher returns a Fetcher reading from the network using
+// opts.HTTPClient and adding opts.Headers to the requests. It is used for
+// the files other than the archive, like its checksum or signature, that
+// are fetched from the network even for an ArchiveFileOverride.
+func newHTTPFetcher(opts InstallOpts) download.HTTPFetcher {
+	f := download.NewHTTPFetcherWithClient(opts.HTTPClient)
+	f.Headers = opts.Headers
+	return f
+}
+
+// UninstallResult describes what was removed when uninstalling a plugin. If
+// uninstalling fails, it describes the state the plugin was left in.
+type UninstallResult struct {
+	// Version is the uninstalled version of the plugin, read from its receipt.
+	Version string
+
+	// LinkPath is the path of the plugin executable in the bin directory. It
+	// is empty if the plugin was installed without a link.
+	LinkPath string
+	// LinkRemoved reports whether LinkPath was removed.
+	LinkRemoved bool
+
+	// InstallPath is the directory the versions of the plugin are installed in.
+	InstallPath string
+	// InstallPathRemoved reports whether InstallPath was removed.
+	InstallPathRemoved bool
+
+	// ReceiptPath is the path of the install receipt of the plugin.
+	ReceiptPath string
+	// ReceiptRemoved reports whether ReceiptPath was removed.
+	ReceiptRemoved bool
+}
+
+// removeAll removes the installation directory of a plugin, overridable in
+// tests.
+var removeAll = os.RemoveAll
+
+// Uninstall will uninstall a plugin. The log messages are written to log, or
+// to klog if it is nil.
+func Uninstall(p environment.Paths, name string, log Logger) error {
+	_, err := UninstallWithResult(p, name, log)
+	return err
+}
+
+// UninstallWithResult is like Uninstall, but it also returns what was removed.
+// The result is nil if the plugin is not installed or its receipt cannot be
+// read. Otherwise, it is returned even if uninstalling fails, and reports the
+// paths that were removed before the failure.
+func UninstallWithResult(p environment.Paths, name string, log Logger) (*UninstallResult, error) {
+	log = loggerOrDefault(log)
 	if name == constants.KrewPluginName {
-		klog.Errorf("Removing krew through krew is not supported.")
+		log.Warningf("Removing krew through krew is not supported.")
 		if !IsWindows() { // assume POSIX-like
-			klog.Errorf("If you’d like to uninstall krew altogether, run:\n\trm -rf -- %q", p.BasePath())
+			log.Warningf("If you’d like to uninstall krew altogether, run:\n\trm -rf -- %q", p.BasePath())
 		}
-		return errors.New("self-uninstall not allowed")
+		return nil, errors.New("self-uninstall not allowed")
 	}
-	klog.V(3).Infof("Finding installed version to delete")
+	unlock, err := acquireLock(context.Background(), p, log)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	log.Debugf("Finding installed version to delete")
 
-	if _, err := receipt.Load(p.PluginInstallReceiptPath(name)); err != nil {
+	r, err := receipt.Load(p.PluginInstallReceiptPath(name))
+	if err != nil {
 		if os.IsNotExist(err) {
-			return ErrIsNotInstalled
+			return nil, ErrIsNotInstalled
 		}
-		return errors.Wrapf(err, "failed to look up install receipt for plugin %q", name)
+		return nil, errors.Wrapf(err, "failed to look up install receipt for plugin %q", name)
 	}
 
-	klog.V(1).Infof("Deleting plugin %s", name)
+	if dependents, err := dependentPlugins(p, name); err != nil {
+		log.Warningf("Failed to look up the plugins depending on %s: %v", name, err)
+	} else if len(dependents) > 0 {
+		log.Warningf("Installed plugins depend on plugin %s and may stop working: %s", name, strings.Join(dependents, ", "))
+	}
+
+	log.Infof("Deleting plugin %s", name)
+	res := &UninstallResult{
+		Version:     r.Spec.Version,
+		InstallPath: p.PluginInstallPath(name),
+		ReceiptPath: p.PluginInstallReceiptPath(name),
+	}
+
+	if linkType := installedLinkType(r); linkType != linkTypeNone {
+		res.LinkPath = filepath.Join(p.BinPath(), BinaryNameForPlugin(name))
+		log.Debugf("Unlink %q", res.LinkPath)
+		if err := removeInstalledLink(res.LinkPath, linkType, log); err != nil {
+			return res, errors.Wrap(err, "could not uninstall symlink of plugin")
+		}
+		res.LinkRemoved = true
+	}
+
+	versions, err := InstalledVersions(p, name)
+	if err != nil {
+		return res, err
+	}
+	versions = append(versions, r.Spec.Version)
+	for _, v := range r.Status.RetainedVersions {
+		versions = append(versions, v.Spec.Version)
+	}
+	for _, v := range versions {
+		if err := removeVersionedAlias(p.BinPath(), name, v, installStatusOf(r, v), log); err != nil {
+			return res, errors.Wrapf(err, "could not remove the versioned alias of plugin %q", name)
+		}
+	}
 
-	symlinkPath := filepath.Join(p.BinPath(), pluginNameToBin(name, IsWindows()))
-	klog.V(3).Infof("Unlink %q", symlinkPath)
-	if err := removeLink(symlinkPath); err != nil {
-		return errors.Wrap(err, "could not uninstall symlink of plugin")
+	log.Debugf("Deleting path %q", res.InstallPath)
+	if err := removeAll(res.InstallPath); err != nil {
+		return res, errors.Wrapf(err, "could not remove plugin directory %q", res.InstallPath)
 	}
+	res.InstallPathRemoved = true
 
-	pluginInstallPath := p.PluginInstallPath(name)
-	klog.V(3).Infof("Deleting path %q", pluginInstallPath)
-	if err := os.RemoveAll(pluginInstallPath); err != nil {
-		return errors.Wrapf(err, "could not remove plugin directory %q", pluginInstallPath)
+	log.Debugf("Deleting plugin receipt %q", res.ReceiptPath)
+	if err := os.Remove(res.ReceiptPath); err != nil {
+		return res, errors.Wrapf(err, "could not remove plugin receipt %q", res.ReceiptPath)
 	}
-	pluginReceiptPath := p.PluginInstallReceiptPath(name)
-	klog.V(3).Infof("Deleting plugin receipt %q", pluginReceiptPath)
-	err := os.Remove(pluginReceiptPath)
-	return errors.Wrapf(err, "could not remove plugin receipt %q", pluginReceiptPath)
+	res.ReceiptRemoved = true
+	return res, nil
 }
 
-func createOrUpdateLink(binDir, binary, plugin string) error {
-	dst := filepath.Join(binDir, pluginNameToBin(plugin, IsWindows()))
+// Link types recorded in index.InstallStatus when a symbolic link to the
+// plugin executable cannot be created.
+const (
+	linkTypeHardlink = "hardlink"
+	linkTypeCopy     = "copy"
+	// linkTypeNone is recorded if the plugin is installed with SkipLink.
+	linkTypeNone = "none"
+	// linkTypeRelative is recorded for a symbolic link with a relative path,
+	// created if the plugin is installed with RelativeLink.
+	linkTypeRelative = "relative"
+)
+
+// symlink and hardlink create links, and removeFile removes a hard link or a
+// copy, they are replaced in tests.
+var (
+	symlink    = os.Symlink
+	hardlink   = os.Link
+	removeFile = os.Remove
+)
 
-	if err := removeLink(dst); err != nil {
-		return errors.Wrap(err, "failed to remove old symlink")
+// staleLinkSuffix is appended to the name of a hard link or a copy in the bin
+// directory that cannot be removed on Windows because it is running, like
+// krew during its own upgrade, so that it is out of the way of the new link.
+// Such files are removed by CleanupStaleLinks.
+const staleLinkSuffix = ".krew-stale"
+
+// createOrUpdateLink makes the plugin executable available in binDir, and
+// returns the type of the created link. It creates a symbolic link, but falls
+// back to a hard link or a copy of the executable on Windows, where creating
+// symbolic links requires a privilege. prevLinkType is the type of the link of
+// the installed version, which is replaced. If relative is set, the symbolic
+// link points to the executable with a path relative to binDir. binDir is
+// created if it does not exist.
+func createOrUpdateLink(binDir, binary, plugin, prevLinkType string, relative bool, log Logger) (string, error) {
+	if err := os.MkdirAll(binDir, 0755); os.IsPermission(err) {
+		return "", errors.Wrapf(err, "no permission to create the bin directory %q, create it or make its parent directory writable", binDir)
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed to create the bin directory %q", binDir)
 	}
-	if _, err := os.Stat(binary); os.IsNotExist(err) {
-		return errors.Wrapf(err, "can't create symbolic link, source binary (%q) cannot be found in extracted archive", binary)
+	dst := filepath.Join(binDir, BinaryNameForPlugin(plugin))
+
+	if fi, err := os.Lstat(dst); err == nil && fi.Mode()&os.ModeSymlink == 0 && !isLinkedByKrew(prevLinkType) {
+		return "", errors.Errorf("%q already exists and is not a symlink created by krew (it might be a plugin installed without krew), "+
+			"remove it or retry with the option to force replacing it (e.g. --force-replace), which backs it up to %q", dst, dst+".bak")
+	}
+	if err := removeInstalledLink(dst, prevLinkType, log); err != nil {
+		return "", errors.Wrap(err, "failed to remove old symlink")
+	}
+	fi, err := os.Stat(binary)
+	if os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "can't create symbolic link, source binary (%q) cannot be found in extracted archive", binary)
 	}
 
 	// Create new
-	klog.V(2).Infof("Creating symlink to %q at %q", binary, dst)
-	if err := os.Symlink(binary, dst); err != nil {
-		return errors.Wrapf(err, "failed to create a symlink from %q to %q", binary, dst)
+	target, linkType := binary, ""
+	if relative {
+		if target, err = relativeLinkTarget(binDir, binary); err != nil {
+			return "", err
+		}
+		linkType = linkTypeRelative
+	}
+	log.Debugf("Creating symlink to %q at %q", target, dst)
+	err = symlink(target, dst)
+	if err == nil {
+		log.Debugf("Created symlink at %q", dst)
+		return linkType, nil
+	}
+	if !IsWindows() {
+		return "", errors.Wrapf(err, "failed to create a symlink from %q to %q", binary, dst)
+	}
+	log.Infof("Failed to create a symlink from %q to %q, creating a hard link instead: %v", binary, dst, err)
+	err = hardlink(binary, dst)
+	if err == nil {
+		return linkTypeHardlink, nil
+	}
+	log.Infof("Failed to create a hard link from %q to %q, copying the file instead: %v", binary, dst, err)
+	if err := copyFile(binary, dst, fi.Mode()); err != nil {
+		os.Remove(dst)
+		return "", errors.Wrapf(err, "failed to copy %q to %q", binary, dst)
+	}
+	return linkTypeCopy, nil
+}
+
+// relativeLinkTarget returns the path of binary relative to binDir.
+func relativeLinkTarget(binDir, binary string) (string, error) {
+	absBinDir, err := filepath.Abs(binDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the absolute path of %q", binDir)
+	}
+	absBinary, err := filepath.Abs(binary)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the absolute path of %q", binary)
+	}
+	rel, err := filepath.Rel(absBinDir, absBinary)
+	return rel, errors.Wrapf(err, "failed to get the path of %q relative to %q", binary, binDir)
+}
+
+// installedLinkType returns the type of the link of the installed plugin.
+func installedLinkType(r index.Receipt) string {
+	if r.Status.Install == nil {
+		return ""
+	}
+	return r.Status.Install.LinkType
+}
+
+// isLinkedByKrew reports whether the file in the bin directory is a hard link
+// or a copy of the executable created by krew, given the link type of the
+// installed plugin.
+func isLinkedByKrew(linkType string) bool {
+	return linkType == linkTypeHardlink || linkType == linkTypeCopy
+}
+
+// removeInstalledLink removes the link of the given type, created by
+// createOrUpdateLink, if it exists. Nothing is removed for plugins installed
+// without a link.
+func removeInstalledLink(path, linkType string, log Logger) error {
+	if linkType == linkTypeNone {
+		return nil
+	}
+	if linkType == "" || linkType == linkTypeRelative {
+		return removeLink(path, log)
+	}
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to read %q", path)
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.Errorf("file %q is not a regular file (mode=%s)", path, fi.Mode())
 	}
-	klog.V(2).Infof("Created symlink at %q", dst)
+	err = removeFile(path)
+	if err == nil || !IsWindows() {
+		return errors.Wrapf(err, "failed to remove %q", path)
+	}
+	// a running executable cannot be removed on Windows, but it can be renamed
+	stale := fmt.Sprintf("%s.%d%s", path, time.Now().UnixNano(), staleLinkSuffix)
+	if renameErr := rename(path, stale); renameErr != nil {
+		return errors.Wrapf(err, "failed to remove %q", path)
+	}
+	log.Infof("Cannot remove %q, moved it to %q to be removed later: %v", path, stale, err)
+	return nil
+}
 
+// CleanupStaleLinks removes the hard links and copies in binDir that could not
+// be removed when they were replaced, because they were running on Windows.
+// The log messages are written to log, or to klog if it is nil.
+func CleanupStaleLinks(binDir string, log Logger) error {
+	log = loggerOrDefault(log)
+	stale, err := filepath.Glob(filepath.Join(binDir, "*"+staleLinkSuffix))
+	if err != nil {
+		return errors.Wrap(err, "failed to list stale links")
+	}
+	for _, path := range stale {
+		log.Infof("Deleting stale link %q", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove stale link %q", path)
+		}
+	}
 	return nil
 }
 
+// removeVersionedAlias removes the versioned alias of the given version of
+// the plugin from binDir, if it exists. status is the recorded installation
+// of the version, if any. An alias recorded as a hard link or a copy is
+// removed, but otherwise only a symbolic link is, as a regular file with the
+// name of the alias was not created by krew.
+func removeVersionedAlias(binDir, name, version string, status *index.InstallStatus, log Logger) error {
+	path := filepath.Join(binDir, VersionedBinaryNameForPlugin(name, version))
+	if status != nil && status.VersionedAlias && isLinkedByKrew(status.LinkType) {
+		return removeInstalledLink(path, status.LinkType, log)
+	}
+	if fi, err := os.Lstat(path); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return removeLink(path, log)
+}
+
+// installStatusOf returns the recorded installation of the given version of
+// the plugin in its receipt, which is either the installed version or one of
+// the retained versions. It is nil if the version is not in the receipt.
+func installStatusOf(r index.Receipt, version string) *index.InstallStatus {
+	if r.Spec.Version == version {
+		return r.Status.Install
+	}
+	for _, v := range r.Status.RetainedVersions {
+		if v.Spec.Version == version {
+			return v.Install
+		}
+	}
+	return nil
+}
+
+// backupNonLink moves the file at path to path+".bak" if it exists and is not
+// a symlink, so that a symlink can be created in its place. It reports
+// whether the file was backed up. An existing backup is never overwritten.
+func backupNonLink(path string, log Logger) (bool, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "failed to read %q", path)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return false, nil
+	}
+	if fi.IsDir() {
+		return false, errors.Errorf("%q is a directory, refusing to replace it", path)
+	}
+	backup := path + ".bak"
+	if _, err := os.Lstat(backup); err == nil {
+		return false, errors.Errorf("cannot back up %q, the backup %q already exists, remove it or move it away", path, backup)
+	} else if !os.IsNotExist(err) {
+		return false, errors.Wrapf(err, "failed to read %q", backup)
+	}
+	log.Warningf("Replacing %q, which was not created by krew. The original file is moved to %q.", path, backup)
+	if err := os.Rename(path, backup); err != nil {
+		return false, errors.Wrapf(err, "failed to back up %q", path)
+	}
+	return true, nil
+}
+
+// restoreBackup moves the backup created by backupNonLink back to path,
+// after removing the link of the given type that replaced it, if any.
+// Failures are only logged, as the installation already failed.
+func restoreBackup(path, linkType string, log Logger) {
+	if err := removeInstalledLink(path, linkType, log); err != nil {
+		log.Warningf("failed to remove %q to restore its backup: %v", path, err)
+		return
+	}
+	log.Infof("Restoring %q from its backup", path)
+	if err := os.Rename(path+".bak", path); err != nil {
+		log.Warningf("failed to restore %q from its backup: %v", path, err)
+	}
+}
+
 // removeLink removes a symlink reference if exists.
-func removeLink(path string) error {
+func removeLink(path string, log Logger) error {
 	fi, err := os.Lstat(path)
 	if os.IsNotExist(err) {
-		klog.V(3).Infof("No file found at %q", path)
+		log.Debugf("No file found at %q", path)
 		return nil
 	} else if err != nil {
 		return errors.Wrapf(err, "failed to read the symlink in %q", path)
@@ -222,17 +1310,38 @@ func removeLink(path string) error {
 	if err := os.Remove(path); err != nil {
 		return errors.Wrapf(err, "failed to remove the symlink in %q", path)
 	}
-	klog.V(3).Infof("Removed symlink from %q", path)
+	log.Debugf("Removed symlink from %q", path)
 	return nil
 }
 
-// IsWindows sees if KREW_OS or runtime.GOOS to find out if current execution mode is win32.
+// IsWindows checks if the OS returned by OSArch, which can be overridden with
+// KREW_OS, is windows.
 func IsWindows() bool {
-	goos := runtime.GOOS
-	if env := os.Getenv("KREW_OS"); env != "" {
-		goos = env
-	}
-	return goos == "windows"
+	return OSArch().OS == "windows"
+}
+
+// BinaryNameForPlugin returns the name of the file krew creates in the bin
+// directory for the plugin name, for the OS returned by OSArch, which can be
+// overridden with KREW_OS.
+func BinaryNameForPlugin(name string) string {
+	return pluginNameToBin(name, IsWindows())
+}
+
+// VersionedBinaryNameForPlugin returns the name of the versioned alias of the
+// executable of the given version of the plugin, created with
+// InstallOpts.VersionedAlias. It is the executable name of the plugin name
+// suffixed with "@" and the version without its "v" prefix, so that version
+// v1.2.3 of plugin foo is available as "kubectl foo@1.2.3". Like in the
+// executable name, dashes are converted to underscores, e.g. version
+// v1.2.3-rc.1 of plugin view-logs is linked as kubectl-view_logs@1.2.3_rc.1.
+func VersionedBinaryNameForPlugin(name, version string) string {
+	return BinaryNameForPlugin(versionedAliasName(name, version))
+}
+
+// versionedAliasName returns the plugin name that the versioned alias of the
+// given version of the plugin is linked as.
+func versionedAliasName(name, version string) string {
+	return name + "@" + strings.TrimPrefix(version, "v")
 }
 
 // pluginNameToBin creates the name of the symlink file for the plugin name.
@@ -247,21 +1356,23 @@ func pluginNameToBin(name string, isWindows bool) string {
 }
 
 // CleanupStaleKrewInstallations removes the versions that aren't the current version.
-func CleanupStaleKrewInstallations(dir, currentVersion string) error {
+// The log messages are written to log, or to klog if it is nil.
+func CleanupStaleKrewInstallations(dir, currentVersion string, log Logger) error {
+	log = loggerOrDefault(log)
 	ls, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return errors.Wrap(err, "failed to read krew store directory")
 	}
-	klog.V(2).Infof("Found %d entries in krew store directory", len(ls))
+	log.Debugf("Found %d entries in krew store directory", len(ls))
 	for _, d := range ls {
-		klog.V(2).Infof("Found a krew installation: %s (%s)", d.Name(), d.Mode())
+		log.Debugf("Found a krew installation: %s (%s)", d.Name(), d.Mode())
 		if d.IsDir() && d.Name() != currentVersion {
-			klog.V(1).Infof("Deleting stale krew install directory: %s", d.Name())
+			log.Infof("Deleting stale krew install directory: %s", d.Name())
 			p := filepath.Join(dir, d.Name())
 			if err := os.RemoveAll(p); err != nil {
 				return errors.Wrapf(err, "failed to remove stale krew version at path '%s'", p)
 			}
-			klog.V(1).Infof("Stale installation directory removed")
+			log.Infof("Stale installation directory removed")
 		}
 	}
 	return nil
@@ -15,6 +15,14 @@
 package installation
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -23,12 +31,19 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
 
+	"sigs.k8s.io/krew/internal/download"
 	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
 	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
 	"sigs.k8s.io/krew/pkg/index"
 )
 
@@ -108,151 +123,1791 @@ func Test_createOrUpdateLink(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tmpDir := testutil.NewTempDir(t)
 
-			if err := createOrUpdateLink(tmpDir.Root(), tt.binary, tt.pluginName); (err != nil) != tt.wantErr {
+			if _, err := createOrUpdateLink(tmpDir.Root(), tt.binary, tt.pluginName, "", false, klogLogger{}); (err != nil) != tt.wantErr {
 				t.Errorf("createOrUpdateLink() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func Test_createOrUpdateLink_createsBinDir(t *testing.T) {
+	binDir := filepath.Join(testutil.NewTempDir(t).Root(), "nested", "bin")
+
+	if _, err := createOrUpdateLink(binDir, filepath.Join(testdataPath(t), "plugin-foo", "kubectl-foo"), "foo", "", false, klogLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(binDir, BinaryNameForPlugin("foo"))); err != nil {
+		t.Errorf("expected the link to be created in the missing bin directory: %v", err)
+	}
+}
+
+func Test_createOrUpdateLink_binDirNotWritable(t *testing.T) {
+	if IsWindows() || os.Getuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	tmpDir := testutil.NewTempDir(t)
+	if err := os.Chmod(tmpDir.Root(), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(tmpDir.Root(), 0755)
+
+	_, err := createOrUpdateLink(tmpDir.Path("bin"), filepath.Join(testdataPath(t), "plugin-foo", "kubectl-foo"), "foo", "", false, klogLogger{})
+	if err == nil || !strings.Contains(err.Error(), "no permission to create the bin directory") {
+		t.Fatalf("expected permission error, got: %v", err)
+	}
+}
+
+func Test_createOrUpdateLink_regularFileExists(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("kubectl-foo", []byte("not a symlink"))
+
+	_, err := createOrUpdateLink(tmpDir.Root(), filepath.Join(testdataPath(t), "plugin-foo", "kubectl-foo"), "foo", "", false, klogLogger{})
+	if err == nil || !strings.Contains(err.Error(), "not a symlink created by krew") {
+		t.Fatalf("expected error for regular file at the link destination, got: %v", err)
+	}
+}
+
+func Test_createOrUpdateLink_windowsFallback(t *testing.T) {
+	defer os.Unsetenv("KREW_OS")
+	os.Setenv("KREW_OS", "windows")
+	defer func() { symlink, hardlink = os.Symlink, os.Link }()
+	symlink = func(string, string) error { return errors.New("symlinks not permitted") }
+
+	tmpDir := testutil.NewTempDir(t)
+	binary := filepath.Join(testdataPath(t), "plugin-foo", "kubectl-foo")
+	dst := tmpDir.Path("kubectl-foo.exe")
+
+	linkType, err := createOrUpdateLink(tmpDir.Root(), binary, "foo", "", false, klogLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkType != linkTypeHardlink {
+		t.Errorf("expected link type %q, got %q", linkTypeHardlink, linkType)
+	}
+
+	hardlink = func(string, string) error { return errors.New("hard links not supported") }
+	linkType, err = createOrUpdateLink(tmpDir.Root(), binary, "foo", linkType, false, klogLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkType != linkTypeCopy {
+		t.Errorf("expected link type %q, got %q", linkTypeCopy, linkType)
+	}
+	want, _ := ioutil.ReadFile(binary)
+	if got, err := ioutil.ReadFile(dst); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("expected a copy of the binary at %q, err=%v", dst, err)
+	}
+
+	if err := removeInstalledLink(dst, linkType, klogLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be removed, err=%v", dst, err)
+	}
+}
+
+func Test_removeInstalledLink_windowsInUse(t *testing.T) {
+	defer os.Unsetenv("KREW_OS")
+	os.Setenv("KREW_OS", "windows")
+	defer func() { removeFile = os.Remove }()
+	// a running executable cannot be removed on windows
+	removeFile = func(string) error { return errors.New("the file is in use") }
+
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("bin/kubectl-krew.exe", []byte("running krew"))
+	dst := tmpDir.Path("bin/kubectl-krew.exe")
+	if err := removeInstalledLink(dst, linkTypeCopy, klogLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be moved out of the way, err=%v", dst, err)
+	}
+	stale, _ := filepath.Glob(dst + ".*" + staleLinkSuffix)
+	if len(stale) != 1 {
+		t.Fatalf("expected the replaced executable to be kept until it is cleaned up, found %v", stale)
+	}
+
+	if err := CleanupStaleLinks(tmpDir.Path("bin"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(stale[0]); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be cleaned up, err=%v", stale[0], err)
+	}
+}
+
+func TestInstall_windowsCopyFallback(t *testing.T) {
+	defer os.Unsetenv("KREW_OS")
+	os.Setenv("KREW_OS", "windows")
+	defer func() { symlink, hardlink = os.Symlink, os.Link }()
+	symlink = func(string, string) error { return errors.New("symlinks not permitted") }
+	hardlink = func(string, string) error { return errors.New("hard links not supported") }
+
+	p := newTestPaths(t)
+	platform := testutil.NewPlatform().WithOSArch("windows", runtime.GOARCH).
+		WithSHA256(testArchiveSha256).WithFiles(nil).WithBin("foo").V()
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installedLinkType(r); got != linkTypeCopy {
+		t.Errorf("expected link type %q in the receipt, got %q", linkTypeCopy, got)
+	}
+	bin := filepath.Join(p.BinPath(), "kubectl-foo.exe")
+	if fi, err := os.Lstat(bin); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("expected a regular file at %q, err=%v", bin, err)
+	}
+
+	if err := Uninstall(p, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(bin); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be removed, err=%v", bin, err)
+	}
+}
+
+func TestInstall_forceReplace(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		p := newTestPaths(t)
+		bin := filepath.Join(p.BinPath(), pluginNameToBin("foo", IsWindows()))
+		if err := ioutil.WriteFile(bin, []byte("manually installed"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+		err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), ForceReplace: force})
+		if !force {
+			if err == nil {
+				t.Error("expected error without ForceReplace")
+			}
+			if b, _ := ioutil.ReadFile(bin); string(b) != "manually installed" {
+				t.Error("file was replaced without ForceReplace")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi, err := os.Lstat(bin); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("expected symlink at %q, err=%v", bin, err)
+		}
+		if b, err := ioutil.ReadFile(bin + ".bak"); err != nil || string(b) != "manually installed" {
+			t.Errorf("expected the original file to be backed up, got %q err=%v", b, err)
+		}
+	}
+}
+
+func TestInstall_forceReplaceExistingBackup(t *testing.T) {
+	p := newTestPaths(t)
+	bin := filepath.Join(p.BinPath(), pluginNameToBin("foo", IsWindows()))
+	for file, content := range map[string]string{bin: "manually installed", bin + ".bak": "earlier backup"} {
+		if err := ioutil.WriteFile(file, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), ForceReplace: true})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected error for the existing backup, got: %v", err)
+	}
+	for file, want := range map[string]string{bin: "manually installed", bin + ".bak": "earlier backup"} {
+		if b, _ := ioutil.ReadFile(file); string(b) != want {
+			t.Errorf("expected %q to be kept, got %q", file, b)
+		}
+	}
+}
+
+func TestInstall_forceReplaceRestoresBackup(t *testing.T) {
+	defer func() { symlink = os.Symlink }()
+	symlink = func(string, string) error { return errors.New("symlinks not permitted") }
+
+	p := newTestPaths(t)
+	bin := filepath.Join(p.BinPath(), pluginNameToBin("foo", IsWindows()))
+	if err := ioutil.WriteFile(bin, []byte("manually installed"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), ForceReplace: true}); err == nil {
+		t.Fatal("expected error when the link cannot be created")
+	}
+	if b, err := ioutil.ReadFile(bin); err != nil || string(b) != "manually installed" {
+		t.Errorf("expected the original file to be restored, got %q err=%v", b, err)
+	}
+	if _, err := os.Lstat(bin + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("expected no backup after restoring it, got err=%v", err)
+	}
+}
+
+func TestInstall_binaryConflict(t *testing.T) {
+	tests := []struct {
+		name          string
+		installed     string
+		installedOpts InstallOpts
+		opts          InstallOpts
+		wantErr       bool
+	}{
+		{name: "dash and underscore", installed: "view-logs", wantErr: true},
+		{name: "underscore and dash", installed: "view_logs", wantErr: true},
+		{name: "force replace", installed: "view-logs", opts: InstallOpts{ForceReplace: true}},
+		{name: "skip link", installed: "view-logs", opts: InstallOpts{SkipLink: true}},
+		{name: "installed without link", installed: "view-logs", installedOpts: InstallOpts{SkipLink: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			installed := testutil.NewPlugin().WithName(tt.installed).WithPlatforms(newTestArchivePlatform().V()).V()
+			tt.installedOpts.ArchiveFileOverride = testArchivePath(t)
+			if err := Install(p, installed, constants.DefaultIndexName, tt.installedOpts); err != nil {
+				t.Fatal(err)
+			}
+
+			name := strings.NewReplacer("-", "_", "_", "-").Replace(tt.installed)
+			plugin := testutil.NewPlugin().WithName(name).WithPlatforms(newTestArchivePlatform().V()).V()
+			tt.opts.ArchiveFileOverride = testArchivePath(t)
+			err := Install(p, plugin, constants.DefaultIndexName, tt.opts)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Install() error = %v", err)
+				}
+				if tt.opts.ForceReplace {
+					target, err := os.Readlink(filepath.Join(p.BinPath(), BinaryNameForPlugin(name)))
+					if err != nil || !strings.HasPrefix(target, p.PluginInstallPath(name)) {
+						t.Errorf("expected the executable to be linked to plugin %q, got %q err=%v", name, target, err)
+					}
+				}
+				return
+			}
+			var conflict *ErrBinaryConflict
+			if !errors.As(err, &conflict) {
+				t.Fatalf("expected ErrBinaryConflict, got %v", err)
+			}
+			if conflict.Installed != tt.installed || conflict.Binary != BinaryNameForPlugin(name) {
+				t.Errorf("unexpected conflict: %+v", conflict)
+			}
+			if isInstalled(p, name) {
+				t.Errorf("plugin %q was installed despite the conflict", name)
+			}
+		})
+	}
+}
+
+func TestInstall_forceReplaceInstalledPlugin(t *testing.T) {
+	for _, copyLink := range []bool{false, true} {
+		t.Run(fmt.Sprintf("copy=%v", copyLink), func(t *testing.T) {
+			platform := newTestArchivePlatform().V()
+			if copyLink {
+				defer os.Unsetenv("KREW_OS")
+				os.Setenv("KREW_OS", "windows")
+				defer func() { symlink, hardlink = os.Symlink, os.Link }()
+				symlink = func(string, string) error { return errors.New("symlinks not permitted") }
+				hardlink = func(string, string) error { return errors.New("hard links not supported") }
+				platform = testutil.NewPlatform().WithOSArch("windows", runtime.GOARCH).
+					WithSHA256(testArchiveSha256).WithFiles(nil).WithBin("foo").V()
+			}
+			p := newTestPaths(t)
+			opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+			if err := Install(p, testutil.NewPlugin().WithName("view-logs").WithPlatforms(platform).V(), constants.DefaultIndexName, opts); err != nil {
+				t.Fatal(err)
+			}
+			opts.ForceReplace = true
+			if err := Install(p, testutil.NewPlugin().WithName("view_logs").WithPlatforms(platform).V(), constants.DefaultIndexName, opts); err != nil {
+				t.Fatal(err)
+			}
+			bin := filepath.Join(p.BinPath(), BinaryNameForPlugin("view_logs"))
+			if _, err := os.Lstat(bin + ".bak"); !os.IsNotExist(err) {
+				t.Errorf("expected the link of the replaced plugin not to be backed up, got err=%v", err)
+			}
+			if got, err := FindByBinary(p, BinaryNameForPlugin("view_logs")); err != nil || !reflect.DeepEqual(got, []string{"view_logs"}) {
+				t.Errorf("FindByBinary() = %v, %v, expected only the replacing plugin", got, err)
+			}
+
+			if err := Uninstall(p, "view-logs", nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Lstat(bin); err != nil {
+				t.Errorf("expected the executable of plugin view_logs to be kept: %v", err)
+			}
+		})
+	}
+}
+
 func Test_pluginNameToBin(t *testing.T) {
 	tests := []struct {
-		name      string
-		isWindows bool
-		want      string
+		name      string
+		isWindows bool
+		want      string
+	}{
+		{"foo", false, "kubectl-foo"},
+		{"foo-bar", false, "kubectl-foo_bar"},
+		{"foo", true, "kubectl-foo.exe"},
+		{"foo-bar", true, "kubectl-foo_bar.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pluginNameToBin(tt.name, tt.isWindows); got != tt.want {
+				t.Errorf("pluginNameToBin(%v, %v) = %v; want %v", tt.name, tt.isWindows, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryNameForPlugin(t *testing.T) {
+	defer os.Unsetenv("KREW_OS")
+	tests := []struct {
+		name   string
+		goos   string
+		plugin string
+		want   string
+	}{
+		{"single dash", "linux", "foo-bar", "kubectl-foo_bar"},
+		{"multiple dashes", "darwin", "foo-bar-baz", "kubectl-foo_bar_baz"},
+		{"no dashes on windows", "windows", "foo", "kubectl-foo.exe"},
+		{"multiple dashes on windows", "windows", "foo-bar-baz", "kubectl-foo_bar_baz.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("KREW_OS", tt.goos)
+			if got := BinaryNameForPlugin(tt.plugin); got != tt.want {
+				t.Errorf("BinaryNameForPlugin(%q) with KREW_OS=%s = %q; want %q", tt.plugin, tt.goos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionedBinaryNameForPlugin(t *testing.T) {
+	defer os.Unsetenv("KREW_OS")
+	tests := []struct {
+		name    string
+		goos    string
+		plugin  string
+		version string
+		want    string
+	}{
+		{"strips v prefix", "linux", "foo", "v1.2.3", "kubectl-foo@1.2.3"},
+		{"no v prefix", "linux", "foo", "1.2.3", "kubectl-foo@1.2.3"},
+		{"dashes in name and version", "darwin", "view-logs", "v1.2.3-rc.1", "kubectl-view_logs@1.2.3_rc.1"},
+		{"windows", "windows", "foo", "v1.2.3", "kubectl-foo@1.2.3.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("KREW_OS", tt.goos)
+			if got := VersionedBinaryNameForPlugin(tt.plugin, tt.version); got != tt.want {
+				t.Errorf("VersionedBinaryNameForPlugin(%q, %q) with KREW_OS=%s = %q; want %q", tt.plugin, tt.version, tt.goos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstall_versionedAlias(t *testing.T) {
+	if IsWindows() {
+		t.Skip("symbolic links are not created on windows")
+	}
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.2.3").WithPlatforms(newTestArchivePlatform().V()).V()
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t), VersionedAlias: true}
+	if err := Install(p, plugin, constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	alias := filepath.Join(p.BinPath(), "kubectl-foo@1.2.3")
+	target, err := os.Readlink(alias)
+	if err != nil {
+		t.Fatalf("versioned alias was not created: %v", err)
+	}
+	if want := filepath.Join(p.PluginVersionInstallPath("foo", "v1.2.3"), "foo"); target != want {
+		t.Errorf("versioned alias points to %q, expected %q", target, want)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); err != nil {
+		t.Errorf("expected the plugin to be linked as well: %v", err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Status.Install.VersionedAlias {
+		t.Error("expected the versioned alias to be recorded in the receipt")
+	}
+
+	if err := Uninstall(p, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(alias); !os.IsNotExist(err) {
+		t.Errorf("expected versioned alias to be removed, got err=%v", err)
+	}
+}
+
+func Test_removeVersionedAlias_regularFile(t *testing.T) {
+	binDir := testutil.NewTempDir(t).Root()
+	alias := filepath.Join(binDir, VersionedBinaryNameForPlugin("foo", "v1.0.0"))
+	if err := ioutil.WriteFile(alias, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeVersionedAlias(binDir, "foo", "v1.0.0", &index.InstallStatus{LinkType: linkTypeHardlink}, klogLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(alias); err != nil {
+		t.Errorf("expected file not recorded as an alias to be kept, got err=%v", err)
+	}
+	if err := removeVersionedAlias(binDir, "foo", "v1.0.0", &index.InstallStatus{LinkType: linkTypeHardlink, VersionedAlias: true}, klogLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(alias); !os.IsNotExist(err) {
+		t.Errorf("expected alias recorded as a hard link to be removed, got err=%v", err)
+	}
+}
+
+func Test_removeLink_notExists(t *testing.T) {
+	if err := removeLink("/non/existing/path", klogLogger{}); err != nil {
+		t.Fatalf("removeLink failed with non-existing path: %+v", err)
+	}
+}
+
+func TestUninstall_cantUninstallItself(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	envPath := environment.NewPaths(tempDir.Root())
+	expectedErrorMessagePart := "not allowed"
+	if err := Uninstall(envPath, "krew", nil); !strings.Contains(err.Error(), expectedErrorMessagePart) {
+		t.Fatalf("wrong error message for 'uninstall krew' action, expected message contains %q; got %q",
+			expectedErrorMessagePart, err.Error())
+	}
+}
+
+func TestUninstallWithResult(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.2.3").WithPlatforms(newTestArchivePlatform().V()).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := UninstallWithResult(p, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UninstallResult{
+		Version:            "v1.2.3",
+		LinkPath:           filepath.Join(p.BinPath(), BinaryNameForPlugin("foo")),
+		LinkRemoved:        true,
+		InstallPath:        p.PluginInstallPath("foo"),
+		InstallPathRemoved: true,
+		ReceiptPath:        p.PluginInstallReceiptPath("foo"),
+		ReceiptRemoved:     true,
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("UninstallWithResult() result mismatch (-want +got):\n%s", diff)
+	}
+	for _, path := range []string{want.LinkPath, want.InstallPath, want.ReceiptPath} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be removed, got err=%v", path, err)
+		}
+	}
+
+	if res, err := UninstallWithResult(p, "foo", nil); err != ErrIsNotInstalled || res != nil {
+		t.Errorf("expected ErrIsNotInstalled and no result, got err=%v result=%+v", err, res)
+	}
+}
+
+func TestInstall_checksums(t *testing.T) {
+	const testArchiveSha512 = "3088deeded990e27e39505fb3651d97512505a547ffcc36e601ed5ec63b77c7ee5b96d2a7343410334564129dabeb56cdf4dc170bf09d5f146e93119bf66b5c2"
+	wrongSha256, wrongSha512 := strings.Repeat("0", 64), strings.Repeat("0", 128)
+
+	tests := []struct {
+		name     string
+		platform index.Platform
+		wantErr  bool
+	}{
+		{
+			name:     "sha512 only",
+			platform: newTestArchivePlatform().WithSHA256("").WithSHA512(testArchiveSha512).V(),
+		},
+		{
+			name:     "wrong sha512 only",
+			platform: newTestArchivePlatform().WithSHA256("").WithSHA512(wrongSha512).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "both present and correct",
+			platform: newTestArchivePlatform().WithSHA512(testArchiveSha512).V(),
+		},
+		{
+			name:     "both present, sha512 wrong",
+			platform: newTestArchivePlatform().WithSHA512(wrongSha512).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "both present, sha256 wrong",
+			platform: newTestArchivePlatform().WithSHA256(wrongSha256).WithSHA512(testArchiveSha512).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "malformed sha512",
+			platform: newTestArchivePlatform().WithSHA256("").WithSHA512("abc").V(),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(tt.platform).V()
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Install() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if installed := isInstalled(p, "foo"); installed == tt.wantErr {
+				t.Errorf("plugin installed = %v, want %v", installed, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstall_skipLink(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t), SkipLink: true}
+	res, err := InstallWithResult(context.Background(), p, plugin, constants.DefaultIndexName, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(p.PluginVersionInstallPath("foo", plugin.Spec.Version), "foo"); res.Executable != want {
+		t.Errorf("expected executable %q, got %q", want, res.Executable)
+	}
+	if _, err := os.Stat(res.Executable); err != nil {
+		t.Errorf("expected executable to be installed: %v", err)
+	}
+	link := filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("expected no link at %q, got err=%v", link, err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installedLinkType(r); got != linkTypeNone {
+		t.Errorf("expected link type %q in receipt, got %q", linkTypeNone, got)
+	}
+
+	// a file with the name of the link is not created by krew
+	if err := ioutil.WriteFile(link, []byte("other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	un, err := UninstallWithResult(p, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if un.LinkPath != "" || un.LinkRemoved || !un.InstallPathRemoved || !un.ReceiptRemoved {
+		t.Errorf("unexpected uninstall result: %+v", un)
+	}
+	if _, err := os.Stat(link); err != nil {
+		t.Errorf("expected the file in the bin directory to be left: %v", err)
+	}
+}
+
+func TestInstall_relativeLink(t *testing.T) {
+	if IsWindows() {
+		t.Skip("symbolic links are not created on windows")
+	}
+	tmpDir := testutil.NewTempDir(t)
+	p := environment.NewPaths(tmpDir.Path("old-root"))
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t), RelativeLink: true}
+	if err := Install(p, plugin, constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.IsAbs(target) {
+		t.Errorf("expected a relative symlink, got target %q", target)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installedLinkType(r); got != linkTypeRelative {
+		t.Errorf("expected link type %q in receipt, got %q", linkTypeRelative, got)
+	}
+
+	// relocate the krew root
+	if err := os.Rename(tmpDir.Path("old-root"), tmpDir.Path("new-root")); err != nil {
+		t.Fatal(err)
+	}
+	p = environment.NewPaths(tmpDir.Path("new-root"))
+	link = filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		t.Fatalf("link does not resolve after moving the krew root: %v", err)
+	}
+	want, err := filepath.EvalSymlinks(filepath.Join(p.PluginVersionInstallPath("foo", plugin.Spec.Version), "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != want {
+		t.Errorf("link resolves to %q, expected %q", resolved, want)
+	}
+
+	if err := Uninstall(p, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("expected link to be removed, got err=%v", err)
+	}
+}
+
+func TestUninstallWithResult_partialFailure(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { removeAll = os.RemoveAll }()
+	removeAll = func(string) error { return errors.New("directory busy") }
+
+	res, err := UninstallWithResult(p, "foo", nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if res == nil || !res.LinkRemoved || res.InstallPathRemoved || res.ReceiptRemoved {
+		t.Fatalf("result does not describe the partial uninstall: %+v", res)
+	}
+	if _, err := os.Stat(res.InstallPath); err != nil {
+		t.Errorf("expected install directory to be left, got err=%v", err)
+	}
+	if !isInstalled(p, "foo") {
+		t.Error("expected receipt to be left")
+	}
+}
+
+func Test_removeLink_linkExists(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+
+	link := filepath.Join(tmpDir.Root(), "some-symlink")
+	if err := os.Symlink(os.TempDir(), link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeLink(link, klogLogger{}); err != nil {
+		t.Fatalf("removeLink(%s) failed: %+v", link, err)
+	}
+}
+
+func Test_removeLink_fails(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+
+	// create an unreadable directory and trigger "permission denied" error
+	unreadableDir := filepath.Join(tmpDir.Root(), "unreadable")
+	if err := os.MkdirAll(unreadableDir, 0); err != nil {
+		t.Fatal(err)
+	}
+	unreadableFile := tmpDir.Path("unreadable/mysterious-file")
+
+	if err := removeLink(unreadableFile, klogLogger{}); err == nil {
+		t.Fatalf("removeLink(%s) with unreadable file returned err==nil", unreadableFile)
+	}
+}
+
+func Test_removeLink_regularFileExists(t *testing.T) {
+	f, err := ioutil.TempFile("", "some-regular-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	if err := removeLink(path, klogLogger{}); err == nil {
+		t.Fatalf("removeLink(%s) with regular file was expected to fail; got: err=nil", path)
+	}
+}
+
+func Test_ensureExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on windows")
+	}
+	tests := []struct {
+		name     string
+		mode     os.FileMode
+		wantMode os.FileMode
+	}{
+		{name: "not executable", mode: 0644, wantMode: 0755},
+		{name: "executable by owner only", mode: 0700, wantMode: 0711},
+		{name: "already executable", mode: 0755, wantMode: 0755},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			path := tmpDir.Path("foo")
+			if err := ioutil.WriteFile(path, nil, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ensureExecutable(path, klogLogger{}); err != nil {
+				t.Fatalf("ensureExecutable() error = %v", err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode() != tt.wantMode {
+				t.Errorf("ensureExecutable() mode = %v, expected %v", fi.Mode(), tt.wantMode)
+			}
+		})
+	}
+}
+
+func Test_ensureExecutable_fails(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	if err := ensureExecutable(tmpDir.Path("not-exists"), klogLogger{}); err == nil {
+		t.Error("expected error for missing file")
+	}
+	if err := ensureExecutable(tmpDir.Root(), klogLogger{}); err == nil {
+		t.Error("expected error for directory")
+	}
+}
+
+func Test_checkPluginExecutable(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("file", []byte("#!/bin/sh"))
+	tmpDir.Write("dir/file", nil)
+	symlinkOK := os.Symlink(tmpDir.Path("file"), tmpDir.Path("link")) == nil
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "regular file", path: "file"},
+		{name: "missing", path: "missing", wantErr: "cannot be found"},
+		{name: "directory", path: "dir", wantErr: "is a directory"},
+		{name: "symlink", path: "link", wantErr: "is a symbolic link"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.path == "link" && !symlinkOK {
+				t.Skip("cannot create symlinks")
+			}
+			err := checkPluginExecutable(tmpDir.Path(tt.path), tt.path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkPluginExecutable() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestInstall_binIsDirectory(t *testing.T) {
+	p := newTestPaths(t)
+	archive := filepath.Join(testdataPath(t), "..", "..", "download", "testdata", "test-with-nesting-with-directory-entries.tar.gz")
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().WithBin("test").
+		WithSHA256("6d3b60906b880130e33e30f4246ab8bbab1c1debb8c7e3ef82c67c3946c0e5b4").V()).V()
+
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: archive})
+	if err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Fatalf("expected error for a bin pointing to a directory, got: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); !os.IsNotExist(err) {
+		t.Errorf("expected no link to be created, got err=%v", err)
+	}
+}
+
+func TestInstall_zipBackslashSeparators(t *testing.T) {
+	// zip archives created by some Windows tools use backslash separators
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{`foo-v1.0.0\bin\foo`, `foo-v1.0.0\LICENSE`} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("#!/bin/sh")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("foo.zip", buf.Bytes())
+	sum := sha256.Sum256(buf.Bytes())
+
+	p := newTestPaths(t)
+	platform := newTestArchivePlatform().WithSHA256(hex.EncodeToString(sum[:])).WithBin("bin/foo").
+		WithFiles([]index.FileOperation{{From: "*/bin/*", To: "bin"}, {From: "*/LICENSE", To: "."}}).V()
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(platform).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: tmpDir.Path("foo.zip")}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	installDir := p.PluginVersionInstallPath("foo", "v1.0.0")
+	for _, f := range []string{filepath.Join("bin", "foo"), "LICENSE"} {
+		if _, err := os.Stat(filepath.Join(installDir, f)); err != nil {
+			t.Errorf("file %s was not installed: %v", f, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); err != nil {
+		t.Errorf("plugin executable was not linked: %v", err)
+	}
+}
+
+func TestInstall_preserveModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on windows")
+	}
+	tmpDir := testutil.NewTempDir(t)
+	modes := map[string]int64{"foo": 0644, "lib/helper.sh": 0755, "lib/config": 0600, "lib/shared": 0666}
+	sum := writeTestTarGz(t, tmpDir.Path("foo.tar.gz"), "x", modes)
+
+	p := newTestPaths(t)
+	platform := newTestArchivePlatform().WithSHA256(sum).V()
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(platform).V()
+	opts := InstallOpts{ArchiveFileOverride: tmpDir.Path("foo.tar.gz"), PreserveModes: true}
+	if err := Install(p, plugin, constants.DefaultIndexName, opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	assertPreservedModes(t, p.PluginVersionInstallPath("foo", "v1.0.0"))
+
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status.Install == nil || !r.Status.Install.PreserveModes {
+		t.Errorf("expected PreserveModes in the receipt, got %+v", r.Status.Install)
+	}
+
+	// upgrades keep the modes without PreserveModes
+	sum = writeTestTarGz(t, tmpDir.Path("foo-v2.tar.gz"), "y", modes)
+	platform = newTestArchivePlatform().WithSHA256(sum).V()
+	plugin = testutil.NewPlugin().WithName("foo").WithVersion("v2.0.0").WithPlatforms(platform).V()
+	upgradeOpts := UpgradeOpts{InstallOpts: InstallOpts{ArchiveFileOverride: tmpDir.Path("foo-v2.tar.gz")}}
+	if err := Upgrade(p, plugin, constants.DefaultIndexName, upgradeOpts); err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	assertPreservedModes(t, p.PluginVersionInstallPath("foo", "v2.0.0"))
+}
+
+// assertPreservedModes checks the modes of the files of the archive written
+// in TestInstall_preserveModes, installed with PreserveModes into installDir.
+func assertPreservedModes(t *testing.T, installDir string) {
+	t.Helper()
+	for file, want := range map[string]os.FileMode{
+		"lib/helper.sh": 0755,
+		"lib/config":    0600,
+		"lib/shared":    0644, // not writable by group or others
+		"foo":           0755, // the plugin executable is made executable
+	} {
+		fi, err := os.Stat(filepath.Join(installDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != want {
+			t.Errorf("mode of %s = %v, want %v", file, fi.Mode(), want)
+		}
+	}
+}
+
+// writeTestTarGz writes a tar.gz archive to path with files of the given modes,
+// which all have the given content. It returns the sha256 sum of the archive.
+func writeTestTarGz(t *testing.T, path, content string, modes map[string]int64) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, mode := range modes {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstall_missingBin(t *testing.T) {
+	tests := []struct {
+		name    string
+		bin     string
+		files   []index.FileOperation
+		wantErr string
+	}{
+		{
+			name:    "not in archive",
+			bin:     "bar",
+			wantErr: `"bar" (bin) is not in the plugin archive, which has no file named "bar" (installed files: foo)`,
+		},
+		{
+			name:    "not installed by file operations",
+			bin:     "foo",
+			files:   []index.FileOperation{{From: "foo", To: "bin/foo"}},
+			wantErr: `"foo" (bin) was not installed by the file operations, although the archive has foo (installed files: bin/foo)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			platform := newTestArchivePlatform().WithBin(tt.bin).WithFiles(tt.files).V()
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V()
+
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestInstall_missingBinNotExtracted(t *testing.T) {
+	p := newTestPaths(t)
+	tmpDir := testutil.NewTempDir(t)
+	archive := tmpDir.Path("foo.tar.gz")
+	sum := writeTestTarGz(t, archive, "x", map[string]int64{"foo": 0755, "dir/bar": 0755})
+
+	// foo is not extracted, as it is removed by the stripped path components
+	platform := testutil.NewPlatform().WithOSArch(runtime.GOOS, runtime.GOARCH).WithSHA256(sum).
+		WithBin("foo").WithStripComponents(1).WithFiles([]index.FileOperation{{From: "*", To: "."}}).V()
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V()
+
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: archive})
+	want := `"foo" (bin) was not installed by the file operations, although the archive has foo (installed files: bar)`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected error containing %q, got: %v", want, err)
+	}
+}
+
+func Test_missingBinError_truncatesList(t *testing.T) {
+	var installed []string
+	for i := 0; i < maxListedFiles+5; i++ {
+		installed = append(installed, fmt.Sprintf("f%02d", i))
+	}
+	err := missingBinError("foo", nil, installed)
+	if !strings.Contains(err.Error(), "f19, and 5 more)") || strings.Contains(err.Error(), "f20") {
+		t.Errorf("expected the list of installed files to be truncated, got: %v", err)
+	}
+}
+
+func TestIsWindows(t *testing.T) {
+	expected := runtime.GOOS == "windows"
+	got := IsWindows()
+	if expected != got {
+		t.Fatalf("IsWindows()=%v; expected=%v (on %s)", got, expected, runtime.GOOS)
+	}
+}
+
+func TestIsWindows_envOverride(t *testing.T) {
+	defer os.Unsetenv("KREW_OS")
+
+	os.Setenv("KREW_OS", "windows")
+	if !IsWindows() {
+		t.Fatalf("IsWindows()=false when KREW_OS=windows")
+	}
+
+	os.Setenv("KREW_OS", "not-windows")
+	if IsWindows() {
+		t.Fatalf("IsWindows()=true when KREW_OS != windows")
+	}
+}
+
+func Test_downloadAndExtract(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+
+	// start a local http server to serve the test archive from pkg/download/testdata
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+
+	url := server.URL + "/test-without-directory.tar.gz"
+	platform := testutil.NewPlatform().WithURI(url).WithSHA256(testArchiveSha256).
+		WithFiles([]index.FileOperation{{From: "foo", To: "."}}).V()
+
+	status, err := downloadAndExtract(context.Background(), tmpDir.Root(), platform, InstallOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.Stat(filepath.Join(testdataDir, "test-without-directory.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.URI != url || status.Size != archive.Size() {
+		t.Errorf("unexpected install status: uri=%q size=%d, expected uri=%q size=%d", status.URI, status.Size, url, archive.Size())
+	}
+	files, err := ioutil.ReadDir(tmpDir.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no files found in the extract output directory")
+	}
+}
+
+func Test_newArchiveVerifier_signature(t *testing.T) {
+	platform := newTestArchivePlatform().V()
+	platform.Signature = "https://example.com/foo.tar.gz.asc"
+	tests := []struct {
+		name    string
+		keyRing string
+		env     string
+		wantErr bool
+	}{
+		{name: "no keyring", wantErr: true},
+		{name: "keyring option", keyRing: "keyring.gpg"},
+		{name: "keyring from environment", env: "keyring.gpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(keyRingEnv, tt.env)
+			defer os.Unsetenv(keyRingEnv)
+			_, err := newArchiveVerifier(platform, InstallOpts{KeyRing: tt.keyRing})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newArchiveVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstall_insufficientDiskSpace(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	// no filesystem has space for an archive extracting to a trillion times its size
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), ExtractionMultiplier: 1e12})
+	if errors.Cause(err) != ErrInsufficientDiskSpace {
+		t.Fatalf("expected ErrInsufficientDiskSpace, got %v", err)
+	}
+	if _, err := os.Stat(p.PluginInstallPath("foo")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be installed, err=%v", err)
+	}
+
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatalf("install with the default multiplier failed: %v", err)
+	}
+}
+
+func Test_existingAncestor(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	if got := existingAncestor(tmpDir.Path("a/b/c")); got != tmpDir.Root() {
+		t.Errorf("existingAncestor() = %q, expected %q", got, tmpDir.Root())
+	}
+	if got := existingAncestor(tmpDir.Root()); got != tmpDir.Root() {
+		t.Errorf("existingAncestor() = %q, expected %q", got, tmpDir.Root())
+	}
+}
+
+func TestInstall_sha256URL(t *testing.T) {
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	files := http.FileServer(http.Dir(testdataDir))
+	wrongSum := strings.Repeat("0", 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/checksums.txt":
+			fmt.Fprintf(w, "%s  test-with-directory.zip\n%s  test-without-directory.tar.gz\n", wrongSum, testArchiveSha256)
+		case "/wrong-checksums.txt":
+			fmt.Fprintf(w, "%s  test-without-directory.tar.gz\n", wrongSum)
+		default:
+			files.ServeHTTP(w, req)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		sha256    string
+		sha256URL string
+		wantErr   bool
+	}{
+		{name: "sum from checksums file", sha256URL: server.URL + "/checksums.txt"},
+		{name: "inline sum takes precedence", sha256: testArchiveSha256, sha256URL: server.URL + "/wrong-checksums.txt"},
+		{name: "wrong sum in checksums file", sha256URL: server.URL + "/wrong-checksums.txt", wantErr: true},
+		{name: "missing checksums file", sha256URL: server.URL + "/missing.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			platform := newTestArchivePlatform().WithURI(server.URL + "/test-without-directory.tar.gz").
+				WithSHA256(tt.sha256).WithSHA256URL(tt.sha256URL).V()
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V()
+
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Install() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstall_sha256URLWithArchiveFile(t *testing.T) {
+	const testArchiveSha512 = "3088deeded990e27e39505fb3651d97512505a547ffcc36e601ed5ec63b77c7ee5b96d2a7343410334564129dabeb56cdf4dc170bf09d5f146e93119bf66b5c2"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprintf(w, "%s  foo.tar.gz\n", testArchiveSha256)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		sha512  string
+		wantErr bool
+	}{
+		{name: "no inline sum", wantErr: true},
+		{name: "inline sha512 sum", sha512: testArchiveSha512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			platform := newTestArchivePlatform().WithURI("https://example.com/foo.tar.gz").WithSHA256("").
+				WithSHA512(tt.sha512).WithSHA256URL(server.URL + "/checksums.txt").V()
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V()
+
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Install() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if requests != 0 {
+		t.Errorf("the checksums file was requested %d times, expected no requests for an archive file", requests)
+	}
+}
+
+func Test_downloadAndExtract_mirrors(t *testing.T) {
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+
+	missing := server.URL + "/not-found.tar.gz"
+	wrongChecksum := server.URL + "/test-with-directory.zip"
+	good := server.URL + "/test-without-directory.tar.gz"
+
+	tests := []struct {
+		name    string
+		uri     string
+		mirrors []string
+		wantURI string
+		wantErr error
 	}{
-		{"foo", false, "kubectl-foo"},
-		{"foo-bar", false, "kubectl-foo_bar"},
-		{"foo", true, "kubectl-foo.exe"},
-		{"foo-bar", true, "kubectl-foo_bar.exe"},
+		{name: "primary succeeds", uri: good, mirrors: []string{missing}, wantURI: good},
+		{name: "missing primary", uri: missing, mirrors: []string{good}, wantURI: good},
+		{name: "checksum mismatch moves to next mirror", uri: missing, mirrors: []string{wrongChecksum, good}, wantURI: good},
+		{name: "all fail", uri: missing, mirrors: []string{wrongChecksum}, wantErr: download.ErrChecksumMismatch},
+		{name: "all missing", uri: missing, mirrors: []string{missing}, wantErr: download.ErrNotFound},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := pluginNameToBin(tt.name, tt.isWindows); got != tt.want {
-				t.Errorf("pluginNameToBin(%v, %v) = %v; want %v", tt.name, tt.isWindows, got, tt.want)
+			tmpDir := testutil.NewTempDir(t)
+			platform := testutil.NewPlatform().WithURI(tt.uri).WithMirrors(tt.mirrors).WithSHA256(testArchiveSha256).V()
+
+			status, err := downloadAndExtract(context.Background(), tmpDir.Root(), platform, InstallOpts{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("downloadAndExtract() error = %v, expected %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.URI != tt.wantURI {
+				t.Errorf("archive downloaded from %q, expected %q", status.URI, tt.wantURI)
 			}
 		})
 	}
 }
 
-func Test_removeLink_notExists(t *testing.T) {
-	if err := removeLink("/non/existing/path"); err != nil {
-		t.Fatalf("removeLink failed with non-existing path: %+v", err)
+func Test_downloadAndExtract_fileOverride(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+
+	platform := testutil.NewPlatform().WithURI("").WithSHA256(testArchiveSha256).
+		WithFiles([]index.FileOperation{{From: "foo", To: "."}}).V()
+
+	if _, err := downloadAndExtract(context.Background(), tmpDir.Root(), platform, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(tmpDir.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no files found in the extract output directory")
 	}
 }
 
-func TestUninstall_cantUninstallItself(t *testing.T) {
-	tempDir := testutil.NewTempDir(t)
-	envPath := environment.NewPaths(tempDir.Root())
-	expectedErrorMessagePart := "not allowed"
-	if err := Uninstall(envPath, "krew"); !strings.Contains(err.Error(), expectedErrorMessagePart) {
-		t.Fatalf("wrong error message for 'uninstall krew' action, expected message contains %q; got %q",
-			expectedErrorMessagePart, err.Error())
+// testArchiveSha256 is the checksum of the archive at testArchivePath, which
+// contains a single file named "foo".
+const testArchiveSha256 = "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e"
+
+func testArchivePath(t *testing.T) string {
+	return filepath.Join(testdataPath(t), "..", "..", "download", "testdata", "test-without-directory.tar.gz")
+}
+
+// testXZArchive returns the path and the sha256 sum of a tar.xz archive with
+// a single file named "foo", which is different from the archive at
+// testArchivePath.
+func testXZArchive(t *testing.T) (string, string) {
+	t.Helper()
+	path := filepath.Join(testdataPath(t), "..", "..", "download", "testdata", "test-without-directory.tar.xz")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
 	}
+	sum := sha256.Sum256(b)
+	return path, hex.EncodeToString(sum[:])
 }
 
-func Test_removeLink_linkExists(t *testing.T) {
+// newTestArchivePlatform returns a platform matching the current host that
+// installs the test archive.
+func newTestArchivePlatform() *testutil.R {
+	return testutil.NewPlatform().WithOSArch(runtime.GOOS, runtime.GOARCH).
+		WithSHA256(testArchiveSha256).WithFiles(nil).WithBin("foo")
+}
+
+// newTestPaths returns krew paths in a temporary directory with the
+// directories created by krew on startup.
+func newTestPaths(t *testing.T) environment.Paths {
 	tmpDir := testutil.NewTempDir(t)
+	p := environment.NewPaths(tmpDir.Root())
+	for _, dir := range []string{p.BinPath(), p.InstallReceiptsPath()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
 
-	link := filepath.Join(tmpDir.Root(), "some-symlink")
-	if err := os.Symlink(os.TempDir(), link); err != nil {
-		t.Fatal(err)
+func TestInstallMany(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	p := environment.NewPaths(tmpDir.Root())
+	for _, dir := range []string{p.BinPath(), p.InstallReceiptsPath()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	if err := removeLink(link); err != nil {
-		t.Fatalf("removeLink(%s) failed: %+v", link, err)
+	archive := filepath.Join(testdataPath(t), "..", "..", "download", "testdata", "test-without-directory.tar.gz")
+	checksum := "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e"
+	platform := testutil.NewPlatform().WithOSArch(runtime.GOOS, runtime.GOARCH).
+		WithSHA256(checksum).WithFiles(nil).WithBin("foo").V()
+	otherPlatform := testutil.NewPlatform().WithOSArch("none", "none").V()
+
+	plugins := []index.Plugin{
+		testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V(),
+		testutil.NewPlugin().WithName("bar").WithPlatforms(otherPlatform).V(),
+		testutil.NewPlugin().WithName("baz").WithPlatforms(platform).V(),
+		testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V(),
+	}
+	errs := InstallMany(p, plugins, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: archive})
+	if len(errs) != len(plugins) {
+		t.Fatalf("expected %d errors, got %d", len(plugins), len(errs))
+	}
+	if errs[0] != nil && errs[3] != nil {
+		t.Fatalf("expected one of the duplicate installs to succeed: %v, %v", errs[0], errs[3])
+	}
+	if errs[0] != ErrIsAlreadyInstalled && errs[3] != ErrIsAlreadyInstalled {
+		t.Fatalf("expected one of the duplicate installs to fail with ErrIsAlreadyInstalled: %v, %v", errs[0], errs[3])
+	}
+	if _, ok := errs[1].(*ErrNoMatchingPlatform); !ok {
+		t.Errorf("expected ErrNoMatchingPlatform for plugin without a matching platform, got: %v", errs[1])
+	}
+	if errs[2] != nil {
+		t.Errorf("failed to install plugin: %v", errs[2])
+	}
+	for _, name := range []string{"foo", "baz"} {
+		if _, err := os.Stat(p.PluginInstallReceiptPath(name)); err != nil {
+			t.Errorf("receipt for %q not found: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(p.PluginInstallReceiptPath("bar")); !os.IsNotExist(err) {
+		t.Errorf("expected no receipt for failed plugin, got err=%v", err)
 	}
 }
 
-func Test_removeLink_fails(t *testing.T) {
-	tmpDir := testutil.NewTempDir(t)
+func TestInstallContext_cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer server.Close()
 
-	// create an unreadable directory and trigger "permission denied" error
-	unreadableDir := filepath.Join(tmpDir.Root(), "unreadable")
-	if err := os.MkdirAll(unreadableDir, 0); err != nil {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithPlatforms(newTestArchivePlatform().WithURI(server.URL).V()).V()
+
+	// staging directories are created in the system temp dir
+	tmpDir := testutil.NewTempDir(t)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmpDir.Path("tmp"))
+	if err := os.MkdirAll(tmpDir.Path("tmp"), 0755); err != nil {
 		t.Fatal(err)
 	}
-	unreadableFile := tmpDir.Path("unreadable/mysterious-file")
 
-	if err := removeLink(unreadableFile); err == nil {
-		t.Fatalf("removeLink(%s) with unreadable file returned err==nil", unreadableFile)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := InstallContext(ctx, p, plugin, constants.DefaultIndexName, InstallOpts{}); err == nil {
+		t.Fatal("expected error for cancelled installation")
+	}
+	if files, _ := ioutil.ReadDir(tmpDir.Path("tmp")); len(files) != 0 {
+		t.Errorf("staging dir was not cleaned up, found %d files", len(files))
+	}
+	if _, err := os.Stat(p.PluginInstallReceiptPath(plugin.Name)); !os.IsNotExist(err) {
+		t.Errorf("expected no receipt for cancelled installation, got err=%v", err)
 	}
 }
 
-func Test_removeLink_regularFileExists(t *testing.T) {
-	f, err := ioutil.TempFile("", "some-regular-file")
-	if err != nil {
+func TestInstall_dryRun(t *testing.T) {
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+
+	checksum := "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e"
+	newPlatform := func() *testutil.R {
+		return testutil.NewPlatform().WithOSArch(runtime.GOOS, runtime.GOARCH).
+			WithURI(server.URL + "/test-without-directory.tar.gz").WithSHA256(checksum)
+	}
+	tests := []struct {
+		name     string
+		platform index.Platform
+		wantErr  bool
+	}{
+		{
+			name:     "reachable archive",
+			platform: newPlatform().V(),
+		},
+		{
+			name:     "unreachable archive",
+			platform: newPlatform().WithURI(server.URL + "/not-found.tar.gz").V(),
+			wantErr:  true,
+		},
+		{
+			name:     "short sha256",
+			platform: newPlatform().WithSHA256(checksum[1:]).V(),
+			wantErr:  true,
+		},
+		{
+			name:     "no matching platform",
+			platform: newPlatform().WithOSArch("none", "none").V(),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutil.NewTempDir(t)
+			p := environment.NewPaths(tmpDir.Root())
+			plugin := testutil.NewPlugin().WithPlatforms(tt.platform).V()
+
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{DryRun: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Install() with dry-run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if files, _ := ioutil.ReadDir(tmpDir.Root()); len(files) != 0 {
+				t.Errorf("dry-run install has written %d files to krew root", len(files))
+			}
+		})
+	}
+}
+
+func TestInstallVersion(t *testing.T) {
+	p := newTestPaths(t)
+	archive := testArchivePath(t)
+	platform := newTestArchivePlatform().V()
+	plugins := []index.Plugin{
+		testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(platform).V(),
+		testutil.NewPlugin().WithName("foo").WithVersion("v2.0.0").WithPlatforms(platform).V(),
+	}
+	opts := InstallOpts{ArchiveFileOverride: archive}
+
+	err := InstallVersion(p, plugins, "v3.0.0", constants.DefaultIndexName, opts)
+	if err == nil || !strings.Contains(err.Error(), "v1.0.0, v2.0.0") {
+		t.Fatalf("expected error listing available versions, got: %v", err)
+	}
+
+	if err := InstallVersion(p, plugins, "v1.0.0", constants.DefaultIndexName, opts); err != nil {
 		t.Fatal(err)
 	}
-	path := f.Name()
-	f.Close()
-	defer os.Remove(path)
+	if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", "v1.0.0"), "foo")); err != nil {
+		t.Errorf("plugin was not installed at the requested version: %v", err)
+	}
+	if err := InstallVersion(p, plugins, "v1.0.0", constants.DefaultIndexName, opts); err != ErrIsAlreadyInstalled {
+		t.Errorf("expected ErrIsAlreadyInstalled for the installed version, got: %v", err)
+	}
 
-	if err := removeLink(path); err == nil {
-		t.Fatalf("removeLink(%s) with regular file was expected to fail; got: err=nil", path)
+	// the installed version is replaced with the requested one, also with an
+	// older version
+	for _, version := range []string{"v2.0.0", "v1.0.0"} {
+		if err := InstallVersion(p, plugins, version, constants.DefaultIndexName, opts); err != nil {
+			t.Fatalf("failed to install version %s: %v", version, err)
+		}
+		r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Spec.Version != version {
+			t.Errorf("installed version = %s, want %s", r.Spec.Version, version)
+		}
+		if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", version), "foo")); err != nil {
+			t.Errorf("plugin was not installed at version %s: %v", version, err)
+		}
 	}
 }
 
-func TestIsWindows(t *testing.T) {
-	expected := runtime.GOOS == "windows"
-	got := IsWindows()
-	if expected != got {
-		t.Fatalf("IsWindows()=%v; expected=%v (on %s)", got, expected, runtime.GOOS)
+func TestInstall_rollsBackOnReceiptFailure(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	defer func(f func(index.Receipt, string) error) { storeReceipt = f }(storeReceipt)
+	storeReceipt = func(index.Receipt, string) error { return errors.New("cannot store receipt") }
+
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if err == nil {
+		t.Fatal("expected error when the receipt cannot be stored")
+	}
+	link := filepath.Join(p.BinPath(), pluginNameToBin("foo", IsWindows()))
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("expected symlink %q to be removed, got err=%v", link, err)
+	}
+	installDir := p.PluginVersionInstallPath("foo", plugin.Spec.Version)
+	if _, err := os.Stat(installDir); !os.IsNotExist(err) {
+		t.Errorf("expected installation directory %q to be removed, got err=%v", installDir, err)
 	}
 }
 
-func TestIsWindows_envOverride(t *testing.T) {
-	defer os.Unsetenv("KREW_OS")
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
 
-	os.Setenv("KREW_OS", "windows")
-	if !IsWindows() {
-		t.Fatalf("IsWindows()=false when KREW_OS=windows")
+func (l *recordingLogger) record(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{})   { l.record(format, args...) }
+func (l *recordingLogger) Infof(format string, args ...interface{})    { l.record(format, args...) }
+func (l *recordingLogger) Warningf(format string, args ...interface{}) { l.record(format, args...) }
+
+func TestInstall_customLogger(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	log := &recordingLogger{}
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), Logger: log}); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.messages) == 0 {
+		t.Fatal("expected the installation to log to the custom logger")
 	}
+	want := "Storing install receipt for plugin foo"
+	for _, m := range log.messages {
+		if m == want {
+			return
+		}
+	}
+	t.Errorf("expected message %q to be logged, got %q", want, log.messages)
+}
 
-	os.Setenv("KREW_OS", "not-windows")
-	if IsWindows() {
-		t.Fatalf("IsWindows()=true when KREW_OS != windows")
+func TestUninstall_customLogger(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	log := &recordingLogger{}
+	if err := Uninstall(p, "foo", log); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	for _, want := range []string{"Deleting plugin foo", fmt.Sprintf("Removed symlink from %q", link)} {
+		found := false
+		for _, m := range log.messages {
+			found = found || m == want
+		}
+		if !found {
+			t.Errorf("expected message %q to be logged, got %q", want, log.messages)
+		}
 	}
 }
 
-func Test_downloadAndExtract(t *testing.T) {
+func TestInstallFromManifest(t *testing.T) {
+	p := newTestPaths(t)
 	tmpDir := testutil.NewTempDir(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	tmpDir.WriteYAML("foo.yaml", plugin)
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
 
-	// start a local http server to serve the test archive from pkg/download/testdata
-	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
-	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
-	defer server.Close()
+	if err := InstallFromManifest(p, tmpDir.Path("foo.yaml"), opts); err != nil {
+		t.Fatal(err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatalf("receipt was not stored: %v", err)
+	}
+	if r.Status.Source.Name != constants.DetachedIndexName {
+		t.Errorf("expected plugin from index %q, got %q", constants.DetachedIndexName, r.Status.Source.Name)
+	}
+	if r.Status.Install == nil || r.Status.Install.Size == 0 {
+		t.Errorf("expected install details in receipt, got %+v", r.Status.Install)
+	}
 
-	url := server.URL + "/test-without-directory.tar.gz"
-	checksum := "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e"
+	invalid := testutil.NewPlugin().WithName("bar").WithShortDescription("").V()
+	tmpDir.WriteYAML("bar.yaml", invalid)
+	if err := InstallFromManifest(p, tmpDir.Path("bar.yaml"), opts); err == nil {
+		t.Error("expected error for invalid plugin manifest")
+	}
+	if err := InstallFromManifest(p, tmpDir.Path("not-exists.yaml"), opts); err == nil {
+		t.Error("expected error for missing plugin manifest")
+	}
+}
+
+func TestInstall_events(t *testing.T) {
+	tests := []struct {
+		name       string
+		sha256     string
+		wantPhases []InstallPhase
+		wantErr    bool
+	}{
+		{
+			name:       "successful install",
+			sha256:     testArchiveSha256,
+			wantPhases: []InstallPhase{InstallStarted, InstallDownloading, InstallVerifying, InstallExtracting, InstallLinking, InstallDone},
+		},
+		{
+			name:       "checksum mismatch",
+			sha256:     strings.Repeat("0", 64),
+			wantPhases: []InstallPhase{InstallStarted, InstallDownloading, InstallVerifying, InstallDone},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().WithSHA256(tt.sha256).V()).V()
+			events := make(chan InstallEvent, 10)
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), Events: events})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Install() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			close(events)
+
+			var phases []InstallPhase
+			var last InstallEvent
+			for e := range events {
+				if e.Plugin != "foo" {
+					t.Errorf("event for plugin %q, want %q", e.Plugin, "foo")
+				}
+				phases = append(phases, e.Phase)
+				last = e
+			}
+			if diff := cmp.Diff(tt.wantPhases, phases); diff != "" {
+				t.Errorf("phases mismatch:\n%s", diff)
+			}
+			if last.Err != err {
+				t.Errorf("done event error = %v, want %v", last.Err, err)
+			}
+		})
+	}
+}
+
+func TestInstall_checksumMismatchError(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().WithSHA256(strings.Repeat("0", 64)).V()).V()
+
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if !errors.Is(err, download.ErrChecksumMismatch) {
+		t.Fatalf("Install() error = %v, expected %v", err, download.ErrChecksumMismatch)
+	}
+	if errors.Is(err, download.ErrNetwork) || errors.Is(err, download.ErrExtraction) {
+		t.Errorf("Install() error = %v is of more than one kind", err)
+	}
+}
 
-	if err := downloadAndExtract(tmpDir.Root(), url, checksum, ""); err != nil {
+func TestInstall_isolatedPaths(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	home := tmpDir.Path("home")
+	if err := os.MkdirAll(home, 0755); err != nil {
 		t.Fatal(err)
 	}
-	files, err := ioutil.ReadDir(tmpDir.Root())
-	if err != nil {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	if root, ok := os.LookupEnv("KREW_ROOT"); ok {
+		defer os.Setenv("KREW_ROOT", root)
+		os.Unsetenv("KREW_ROOT")
+	}
+
+	p := environment.NewPaths(tmpDir.Path("isolated"))
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(newTestArchivePlatform().V()).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
 		t.Fatal(err)
 	}
-	if len(files) == 0 {
-		t.Fatal("no files found in the extract output directory")
+
+	if _, err := receipt.Load(p.PluginInstallReceiptPath("foo")); err != nil {
+		t.Errorf("receipt was not stored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", "v1.0.0"), "foo")); err != nil {
+		t.Errorf("plugin was not installed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), pluginNameToBin("foo", IsWindows()))); err != nil {
+		t.Errorf("plugin was not linked: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(home); len(files) != 0 {
+		t.Errorf("install wrote to the default krew location %q", environment.MustGetKrewPaths().BasePath())
 	}
 }
 
-func Test_downloadAndExtract_fileOverride(t *testing.T) {
-	tmpDir := testutil.NewTempDir(t)
+func TestInstall_manifestSHA256(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		name        string
+		manifestSum string
+		wantSum     string
+		wantErr     bool
+	}{
+		{name: "not pinned", manifestSum: sum},
+		{name: "not pinned, not parsed"},
+		{name: "matching sum", manifestSum: sum, wantSum: sum},
+		{name: "matching sum in uppercase", manifestSum: sum, wantSum: strings.ToUpper(sum)},
+		{name: "different sum", manifestSum: sum, wantSum: strings.Repeat("cd", 32), wantErr: true},
+		{name: "sum of manifest not known", wantSum: sum, wantErr: true},
+	}
+	server := newTestArchiveServer(t)
+	defer server.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			// the dependency is installed without checking its manifest
+			writeIndexPlugins(t, p, servedBy(server, newTestPlugin("bar"))...)
+			plugin := newTestPlugin("foo", "bar")
+			plugin.ManifestSHA256 = tt.manifestSum
 
-	testFile := filepath.Join(testdataPath(t), "..", "..", "download", "testdata", "test-without-directory.tar.gz")
-	checksum := "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e"
+			err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), ManifestSHA256: tt.wantSum})
+			if tt.wantErr {
+				if errors.Cause(err) != ErrManifestMismatch {
+					t.Fatalf("Install() error = %v, expected %v", err, ErrManifestMismatch)
+				}
+				if isInstalled(p, "foo") {
+					t.Error("plugin was installed with a mismatching manifest")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isInstalled(p, "bar") {
+				t.Error("dependency was not installed")
+			}
+		})
+	}
+}
+
+func TestInstall_stagingDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		rename func(string, string) error
+	}{
+		{name: "same filesystem", rename: os.Rename},
+		{name: "different filesystem", rename: crossDeviceRename},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(f func(string, string) error) { rename = f }(rename)
+			rename = tt.rename
+			tmpDir := testutil.NewTempDir(t)
+			staging := tmpDir.Path("staging")
+			os.Setenv("KREW_TMPDIR", staging)
+			defer os.Unsetenv("KREW_TMPDIR")
+
+			p := environment.NewPaths(tmpDir.Path("root"))
+			plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(newTestArchivePlatform().V()).V()
+			if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", "v1.0.0"), "foo")); err != nil {
+				t.Errorf("plugin was not installed: %v", err)
+			}
+			if !isInstalled(p, "foo") {
+				t.Error("plugin is not installed")
+			}
+			files, err := ioutil.ReadDir(staging)
+			if err != nil {
+				t.Fatalf("staging directory was not created: %v", err)
+			}
+			if len(files) != 0 {
+				t.Errorf("staging directory was not cleaned up, found %d files", len(files))
+			}
+		})
+	}
+}
 
-	if err := downloadAndExtract(tmpDir.Root(), "", checksum, testFile); err != nil {
+func TestInstall_tempFilesInStagingDir(t *testing.T) {
+	server := newTestArchiveServer(t)
+	defer server.Close()
+	tmpDir := testutil.NewTempDir(t)
+	bundle, err := ioutil.ReadFile(testArchivePath(t))
+	if err != nil {
 		t.Fatal(err)
 	}
-	files, err := ioutil.ReadDir(tmpDir.Root())
+	manifest, err := yaml.Marshal(testutil.NewPlugin().WithName("bundled").WithPlatforms(newTestArchivePlatform().V()).V())
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(files) == 0 {
-		t.Fatal("no files found in the extract output directory")
+	writeBundle(t, tmpDir.Path("bundle.tar"), map[string][]byte{
+		"plugins/bundled.yaml":          manifest,
+		"archives/" + testArchiveSha256: bundle,
+	}, false)
+
+	// temporary files cannot be created in the temp directory of the OS, as
+	// it does not exist
+	osTemp, staging := tmpDir.Path("os-tmp"), tmpDir.Path("staging")
+	for _, env := range []string{"TMPDIR", "TMP", "TEMP"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, osTemp)
+	}
+	os.Setenv("KREW_TMPDIR", staging)
+	defer os.Unsetenv("KREW_TMPDIR")
+	p := environment.NewPaths(tmpDir.Path("root"))
+
+	plugin := servedBy(server, testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V())[0]
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Preview(plugin, InstallOpts{TempDir: p.StagingPath()}); err != nil {
+		t.Fatal(err)
+	}
+	// DownloadOnly uses KREW_TMPDIR by default
+	if _, err := DownloadOnly(plugin, tmpDir.Path("downloads"), InstallOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if errs := InstallFromBundle(p, tmpDir.Path("bundle.tar")); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if _, err := os.Stat(osTemp); !os.IsNotExist(err) {
+		t.Errorf("expected no files in the temp directory of the OS, got err=%v", err)
+	}
+	if files, _ := ioutil.ReadDir(staging); len(files) != 0 {
+		t.Errorf("staging directory was not cleaned up, found %d files", len(files))
 	}
 }
 
@@ -286,7 +1941,7 @@ func Test_applyDefaults(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			applyDefaults(&test.platform)
+			applyDefaults(&test.platform, klogLogger{})
 			if diff := cmp.Diff(test.platform, test.expected); diff != "" {
 				t.Error(diff)
 			}
@@ -308,7 +1963,7 @@ func TestCleanupStaleKrewInstallations(t *testing.T) {
 		dir.Write(filepath.FromSlash(tf), nil)
 	}
 
-	err := CleanupStaleKrewInstallations(dir.Root(), "dir2")
+	err := CleanupStaleKrewInstallations(dir.Root(), "dir2", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,69 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// ValidateManifestInstallable checks that the archives of all platforms of the
+// plugin can be downloaded by sending a HEAD request to their URIs. If
+// download is set, the archives are also downloaded and extracted into
+// tempDir, or the temp directory of the OS if it is empty, to verify their
+// checksums. The problems of all platforms are reported together.
+func ValidateManifestInstallable(plugin index.Plugin, download bool, tempDir string) error {
+	var problems []string
+	for i, p := range plugin.Spec.Platforms {
+		klog.V(2).Infof("Checking spec.platforms[%d] of plugin %s", i, plugin.Name)
+		if err := checkPlatformInstallable(p, download, tempDir); err != nil {
+			problems = append(problems, fmt.Sprintf("spec.platforms[%d] (%s): %v",
+				i, strings.Join(supportedPlatforms([]index.Platform{p}), ", "), err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("%d of %d platforms of plugin %q are not installable:\n\t%s",
+			len(problems), len(plugin.Spec.Platforms), plugin.Name, strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+func checkPlatformInstallable(p index.Platform, download bool, tempDir string) error {
+	ctx := context.Background()
+	if err := newFetcher(InstallOpts{}, "").Head(ctx, p.URI); err != nil {
+		return err
+	}
+	if !download {
+		return nil
+	}
+	tmp, err := makeTempDir(tempDir, "krew-validate")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	opts := InstallOpts{TempDir: tempDir}
+	if err := resolveSha256(ctx, &p, opts); err != nil {
+		return err
+	}
+	_, err = downloadAndExtractFrom(ctx, tmp, p.URI, p, opts)
+	return err
+}
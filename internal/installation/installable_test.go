@@ -0,0 +1,84 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/testutil"
+)
+
+func TestValidateManifestInstallable(t *testing.T) {
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+
+	good := testutil.NewPlatform().WithOSArch("linux", "amd64").
+		WithURI(server.URL + "/test-without-directory.tar.gz").WithSHA256(testArchiveSha256).V()
+	missing := testutil.NewPlatform().WithOSArch("darwin", "amd64").
+		WithURI(server.URL + "/not-found.tar.gz").WithSHA256(testArchiveSha256).V()
+	wrongChecksum := testutil.NewPlatform().WithOSArch("windows", "amd64").
+		WithURI(server.URL + "/test-with-directory.zip").WithSHA256(testArchiveSha256).V()
+
+	tests := []struct {
+		name         string
+		download     bool
+		wantProblems []string
+	}{
+		{
+			name:     "all platforms installable",
+			download: true,
+		},
+		{
+			name:         "broken links are reported for all platforms",
+			wantProblems: []string{"spec.platforms[1] (darwin/amd64)"},
+		},
+		{
+			name:         "checksum is only verified with download",
+			download:     true,
+			wantProblems: []string{"spec.platforms[1] (darwin/amd64)", "spec.platforms[2] (windows/amd64)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := testutil.NewPlugin().WithPlatforms(good).V()
+			if len(tt.wantProblems) > 0 {
+				plugin = testutil.NewPlugin().WithPlatforms(good, missing, wrongChecksum).V()
+			}
+			err := ValidateManifestInstallable(plugin, tt.download, "")
+			if len(tt.wantProblems) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateManifestInstallable() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if got := strings.Count(err.Error(), "spec.platforms["); got != len(tt.wantProblems) {
+				t.Errorf("expected %d problems, got error: %v", len(tt.wantProblems), err)
+			}
+			for _, want := range tt.wantProblems {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+}
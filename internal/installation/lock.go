@@ -0,0 +1,125 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+)
+
+// ErrLocked is returned when the krew installation stays locked by another
+// krew process for longer than the lock timeout.
+var ErrLocked = errors.New("another krew process is running, try again after it finishes")
+
+// lockTimeout is how long an operation waits for other krew processes to
+// release the lock before failing with ErrLocked.
+var lockTimeout = 30 * time.Second
+
+// lockRetryInterval is how often the lock is tried while it is held by
+// another process.
+const lockRetryInterval = 100 * time.Millisecond
+
+// errLockHeld is returned by tryLockFile if another process holds the lock.
+var errLockHeld = errors.New("file is locked")
+
+// heldLock is a lock held by this process, shared by its concurrent operations
+// (like the installations of InstallMany).
+type heldLock struct {
+	f    *os.File
+	refs int
+}
+
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = map[string]*heldLock{}
+)
+
+// acquireLock locks the krew installation at p so that other krew processes
+// can't modify it at the same time, and returns a function releasing the lock.
+// Operations of this process share the lock. If another process holds the
+// lock, it waits for at most lockTimeout or until ctx is cancelled.
+func acquireLock(ctx context.Context, p environment.Paths, log Logger) (func(), error) {
+	path := p.LockPath()
+
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+	l, ok := heldLocks[path]
+	if !ok {
+		f, err := lockFile(ctx, path, log)
+		if err != nil {
+			return nil, err
+		}
+		l = &heldLock{f: f}
+		heldLocks[path] = l
+	}
+	l.refs++
+
+	return func() {
+		heldLocksMu.Lock()
+		defer heldLocksMu.Unlock()
+		if l.refs--; l.refs > 0 {
+			return
+		}
+		delete(heldLocks, path)
+		if err := unlockFile(l.f); err != nil {
+			log.Warningf("failed to unlock %q: %v", path, err)
+		}
+		l.f.Close()
+	}, nil
+}
+
+// lockFile opens and exclusively locks the file at path, creating it and its
+// directory if necessary.
+func lockFile(ctx context.Context, path string, log Logger) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create the directory of %q", path)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open lock file %q", path)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for waiting := false; ; waiting = true {
+		err := tryLockFile(f)
+		if err == nil {
+			return f, nil
+		}
+		if err != errLockHeld {
+			f.Close()
+			return nil, errors.Wrapf(err, "failed to lock %q", path)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, errors.Wrapf(ErrLocked, "timed out after %v waiting for the lock %q", lockTimeout, path)
+		}
+		if !waiting {
+			log.Infof("Waiting for another krew process to finish")
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, errors.Wrap(ctx.Err(), "cancelled while waiting for another krew process")
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
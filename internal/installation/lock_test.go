@@ -0,0 +1,139 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+// lockFromOtherProcess locks the krew installation at p like another krew
+// process would, and returns a function releasing the lock.
+func lockFromOtherProcess(t *testing.T, p environment.Paths) func() {
+	t.Helper()
+	f, err := os.OpenFile(p.LockPath(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tryLockFile(f); err != nil {
+		t.Fatalf("failed to lock: %v", err)
+	}
+	return func() {
+		if err := unlockFile(f); err != nil {
+			t.Error(err)
+		}
+		f.Close()
+	}
+}
+
+func withLockTimeout(d time.Duration) func() {
+	prev := lockTimeout
+	lockTimeout = d
+	return func() { lockTimeout = prev }
+}
+
+func TestInstall_lockedByOtherProcess(t *testing.T) {
+	defer withLockTimeout(300 * time.Millisecond)()
+	p := newTestPaths(t)
+	unlock := lockFromOtherProcess(t, p)
+	defer unlock()
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if errors.Cause(err) != ErrLocked {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if _, err := os.Stat(p.PluginInstallReceiptPath("foo")); !os.IsNotExist(err) {
+		t.Errorf("expected no receipt to be written, err=%v", err)
+	}
+	if err := Uninstall(p, "foo", nil); errors.Cause(err) != ErrLocked {
+		t.Errorf("expected ErrLocked from Uninstall, got %v", err)
+	}
+	if err := Upgrade(p, plugin, constants.DefaultIndexName, UpgradeOpts{}); errors.Cause(err) != ErrLocked {
+		t.Errorf("expected ErrLocked from Upgrade, got %v", err)
+	}
+
+	// dry-runs don't modify the installation, so they don't need the lock
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t), DryRun: true}); err != nil {
+		t.Errorf("dry-run install failed: %v", err)
+	}
+}
+
+func TestInstall_waitsForOtherProcess(t *testing.T) {
+	defer withLockTimeout(10 * time.Second)()
+	p := newTestPaths(t)
+	unlock := lockFromOtherProcess(t, p)
+	time.AfterFunc(300*time.Millisecond, unlock)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p.PluginInstallReceiptPath("foo")); err != nil {
+		t.Errorf("expected a receipt after the lock was released, err=%v", err)
+	}
+}
+
+func TestInstallContext_cancelledWhileLocked(t *testing.T) {
+	defer withLockTimeout(10 * time.Second)()
+	p := newTestPaths(t)
+	unlock := lockFromOtherProcess(t, p)
+	defer unlock()
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := InstallContext(ctx, p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("expected the install to be cancelled, got %v", err)
+	}
+}
+
+func Test_acquireLock_sharedInProcess(t *testing.T) {
+	p := newTestPaths(t)
+	release1, err := acquireLock(context.Background(), p, klogLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, err := acquireLock(context.Background(), p, klogLogger{})
+	if err != nil {
+		t.Fatalf("the lock should be shared within the process: %v", err)
+	}
+
+	release1()
+	f, err := os.OpenFile(p.LockPath(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := tryLockFile(f); err != errLockHeld {
+		t.Fatalf("expected the lock to be held until released by all operations, got %v", err)
+	}
+	release2()
+	if err := tryLockFile(f); err != nil {
+		t.Fatalf("expected the lock to be released, got %v", err)
+	}
+	if err := unlockFile(f); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/index/indexscanner"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// Lockfile describes the installed plugins at exact versions and archives, for
+// reproducing the installation on other machines. It is written as YAML by
+// ExportLock and applied with ApplyLock:
+//
+//	plugins:
+//	- name: foo
+//	  index: default
+//	  version: v1.2.3
+//	  archives:
+//	  - uri: https://example.com/foo-linux.tar.gz
+//	    sha256: 29c9c411af879ab85049344b81b8e8a9fbc1d657d493694e2783a2d0db240775
+//	  - uri: https://example.com/foo-darwin.tar.gz
+//	    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e
+type Lockfile struct {
+	Plugins []LockfilePlugin `json:"plugins"`
+}
+
+// LockfilePlugin is a plugin in a Lockfile.
+type LockfilePlugin struct {
+	Name    string `json:"name"`
+	Index   string `json:"index"`
+	Version string `json:"version"`
+
+	// Archives are the archives of all platforms of the plugin manifest, so
+	// that the lock can be applied on any platform. The archive of the plugin
+	// for the platform the lock is applied on must be one of them.
+	Archives []LockfileArchive `json:"archives"`
+}
+
+// LockfileArchive is the archive of a platform of a LockfilePlugin.
+type LockfileArchive struct {
+	URI    string `json:"uri"`
+	SHA256 string `json:"sha256"`
+}
+
+// LockfileResolver returns the manifest of the plugin in the given index at the
+// given version.
+type LockfileResolver func(name, indexName, version string) (index.Plugin, error)
+
+// IndexLockfileResolver returns a LockfileResolver reading the plugin manifests from
+// the local copies of the indexes. It fails if the version of the plugin in
+// the index is not the requested version.
+func IndexLockfileResolver(p environment.Paths) LockfileResolver {
+	return func(name, indexName, version string) (index.Plugin, error) {
+		plugin, err := indexscanner.LoadPluginByName(p.IndexPluginsPath(indexName), name)
+		if err != nil {
+			return index.Plugin{}, errors.Wrapf(err, "failed to load plugin %q from index %q", name, indexName)
+		}
+		if plugin.Spec.Version != version {
+			return index.Plugin{}, errors.Errorf("index %q has version %s of plugin %q, not %s", indexName, plugin.Spec.Version, name, version)
+		}
+		return plugin, nil
+	}
+}
+
+// ExportLock returns the YAML Lockfile of the installed plugins, from their
+// install receipts. It fails if a platform of a plugin does not specify the
+// sha256 sum of its archive in the manifest, e.g. if it only has a sha256URL,
+// as the archive could not be locked.
+func ExportLock(p environment.Paths) ([]byte, error) {
+	receipts, err := GetInstalledPluginReceipts(p.InstallReceiptsPath())
+	if err != nil {
+		return nil, err
+	}
+	lock := Lockfile{Plugins: make([]LockfilePlugin, 0, len(receipts))}
+	for _, r := range receipts {
+		locked := LockfilePlugin{
+			Name:    r.Name,
+			Index:   r.Status.Source.Name,
+			Version: r.Spec.Version,
+		}
+		for _, platform := range r.Spec.Platforms {
+			if platform.Sha256 == "" {
+				return nil, errors.Errorf("cannot lock plugin %q, its archive %q has no sha256 sum in the manifest", r.Name, platform.URI)
+			}
+			archive := LockfileArchive{URI: platform.URI, SHA256: strings.ToLower(platform.Sha256)}
+			if !hasLockfileArchive(locked.Archives, archive) {
+				locked.Archives = append(locked.Archives, archive)
+			}
+		}
+		lock.Plugins = append(lock.Plugins, locked)
+	}
+	b, err := yaml.Marshal(lock)
+	return b, errors.Wrap(err, "failed to marshal the lock")
+}
+
+// ApplyLock installs, upgrades, downgrades and uninstalls plugins so that the
+// installed plugins match the YAML Lockfile. The manifests of the locked
+// plugins are looked up with resolve, and their archive for this platform
+// must be one of the archives in the lock. Plugins that are already installed
+// at the locked version from the locked index are left as is, unless they
+// were installed from an archive that is not in the lock. Other installed
+// plugins are uninstalled, except krew itself.
+//
+// A failure to apply the lock for one plugin does not stop applying it for
+// others. The returned slice contains an error for each plugin that failed,
+// or a single error if the lock cannot be parsed.
+//
+// The log messages are written to log, or to klog if it is nil.
+func ApplyLock(p environment.Paths, lock []byte, resolve LockfileResolver, log Logger) []error {
+	log = loggerOrDefault(log)
+	var l Lockfile
+	if err := yaml.UnmarshalStrict(lock, &l); err != nil {
+		return []error{errors.Wrap(err, "failed to parse the lock")}
+	}
+	if err := validateLock(l); err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	locked := make(map[string]bool)
+	for _, entry := range l.Plugins {
+		locked[entry.Name] = true
+		if err := applyLockedPlugin(p, entry, resolve, log); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to apply the lock of plugin %q", entry.Name))
+		}
+	}
+
+	receipts, err := GetInstalledPluginReceipts(p.InstallReceiptsPath())
+	if err != nil {
+		return append(errs, err)
+	}
+	for _, r := range receipts {
+		if locked[r.Name] || r.Name == constants.KrewPluginName {
+			continue
+		}
+		log.Infof("Uninstalling plugin %s, it is not in the lock", r.Name)
+		if err := Uninstall(p, r.Name, log); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to uninstall plugin %q, which is not in the lock", r.Name))
+		}
+	}
+	return errs
+}
+
+// validateLock checks that the plugins of the lock have names, indexes,
+// versions and archives with sha256 sums, and are not listed more than once.
+func validateLock(l Lockfile) error {
+	seen := make(map[string]bool)
+	for i, entry := range l.Plugins {
+		if entry.Name == "" || entry.Index == "" || entry.Version == "" {
+			return errors.Errorf("plugin #%d of the lock must have a name, an index and a version", i+1)
+		}
+		if seen[entry.Name] {
+			return errors.Errorf("plugin %q is listed more than once in the lock", entry.Name)
+		}
+		seen[entry.Name] = true
+		if len(entry.Archives) == 0 {
+			return errors.Errorf("plugin %q of the lock has no archives", entry.Name)
+		}
+		for _, a := range entry.Archives {
+			if b, err := hex.DecodeString(a.SHA256); err != nil || len(b) != sha256.Size {
+				return errors.Errorf("archive %q of plugin %q in the lock has an invalid sha256 sum %q", a.URI, entry.Name, a.SHA256)
+			}
+		}
+	}
+	return nil
+}
+
+// applyLockedPlugin installs the locked plugin, or replaces the installed
+// version if it is not the locked one.
+func applyLockedPlugin(p environment.Paths, entry LockfilePlugin, resolve LockfileResolver, log Logger) error {
+	r, err := receipt.Load(p.PluginInstallReceiptPath(entry.Name))
+	installed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to look up plugin receipt")
+	}
+	atLockedVersion := installed && r.Spec.Version == entry.Version && r.Status.Source.Name == entry.Index
+	if atLockedVersion {
+		err := checkLockedArchive(r.Plugin, entry)
+		if err == nil {
+			log.Debugf("Plugin %s is installed at the locked version %s", entry.Name, entry.Version)
+			return nil
+		}
+		log.Infof("Installed plugin %s does not match the lock: %v", entry.Name, err)
+	}
+
+	plugin, err := resolve(entry.Name, entry.Index, entry.Version)
+	if err != nil {
+		return err
+	}
+	if plugin.Name != entry.Name || plugin.Spec.Version != entry.Version {
+		return errors.Errorf("resolved plugin %q at version %s, expected version %s", plugin.Name, plugin.Spec.Version, entry.Version)
+	}
+	if err := checkLockedArchive(plugin, entry); err != nil {
+		return err
+	}
+
+	if atLockedVersion {
+		log.Infof("Reinstalling plugin %s %s from the locked archive", entry.Name, entry.Version)
+		return Reinstall(p, plugin, InstallOpts{Logger: log})
+	}
+
+	if installed && r.Status.Source.Name != entry.Index {
+		log.Infof("Uninstalling plugin %s installed from index %q to install it from index %q", entry.Name, r.Status.Source.Name, entry.Index)
+		if err := Uninstall(p, entry.Name, log); err != nil {
+			return err
+		}
+		installed = false
+	}
+	if !installed {
+		log.Infof("Installing plugin %s %s from the lock", entry.Name, entry.Version)
+		return Install(p, plugin, entry.Index, InstallOpts{Logger: log})
+	}
+	log.Infof("Replacing plugin %s %s with the locked version %s", entry.Name, r.Spec.Version, entry.Version)
+	return Upgrade(p, plugin, entry.Index, UpgradeOpts{InstallOpts: InstallOpts{Logger: log}, AllowDowngrade: true})
+}
+
+// checkLockedArchive checks that the archive of the plugin for this platform
+// is one of the archives of the locked plugin.
+func checkLockedArchive(plugin index.Plugin, entry LockfilePlugin) error {
+	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
+	if err != nil {
+		return errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	for _, a := range entry.Archives {
+		if candidate.Sha256 != "" && strings.EqualFold(a.SHA256, candidate.Sha256) {
+			return nil
+		}
+	}
+	return errors.Errorf("the archive of plugin %q for this platform (%s) with sha256 %q is not in the lock", plugin.Name, candidate.URI, candidate.Sha256)
+}
+
+func hasLockfileArchive(archives []LockfileArchive, a LockfileArchive) bool {
+	for _, v := range archives {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func TestExportLock(t *testing.T) {
+	p := newTestPaths(t)
+	platforms := []index.Platform{
+		newTestArchivePlatform().WithURI("https://example.com/foo.tar.gz").WithSHA256("433B9E0B6CB9F064548F451150799DAADCC70A3496953490C5148C8E550D2F4E").V(),
+		testutil.NewPlatform().WithOSArch("none", "none").WithURI("https://example.com/foo-none.tar.gz").WithSHA256(testArchiveSha256).V(),
+		testutil.NewPlatform().WithOSArch("other", "none").WithURI("https://example.com/foo-none.tar.gz").WithSHA256(testArchiveSha256).V(),
+	}
+	foo := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(platforms...).V()
+	bar := testutil.NewPlugin().WithName("bar").WithVersion("v2.0.0").WithPlatforms(newTestArchivePlatform().WithURI("https://example.com/bar.tar.gz").V()).V()
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	if err := Install(p, foo, "custom", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := receipt.Store(receipt.New(bar, constants.DefaultIndexName), p.PluginInstallReceiptPath("bar")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ExportLock(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Lockfile
+	if err := yaml.UnmarshalStrict(b, &got); err != nil {
+		t.Fatalf("failed to parse exported lock: %v\n%s", err, b)
+	}
+	want := Lockfile{Plugins: []LockfilePlugin{
+		{Name: "bar", Index: constants.DefaultIndexName, Version: "v2.0.0", Archives: []LockfileArchive{
+			{URI: "https://example.com/bar.tar.gz", SHA256: testArchiveSha256},
+		}},
+		{Name: "foo", Index: "custom", Version: "v1.0.0", Archives: []LockfileArchive{
+			{URI: "https://example.com/foo.tar.gz", SHA256: testArchiveSha256},
+			{URI: "https://example.com/foo-none.tar.gz", SHA256: testArchiveSha256},
+		}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ExportLock() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExportLock_withoutSha256(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform index.Platform
+	}{
+		{name: "sha256URL", platform: testutil.NewPlatform().WithSHA256("").WithSHA256URL("https://example.com/sums.txt").V()},
+		{name: "sha512", platform: testutil.NewPlatform().WithSHA256("").WithSHA512(strings.Repeat("ab", 64)).V()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V(), tt.platform).V()
+			if err := receipt.Store(receipt.New(plugin, constants.DefaultIndexName), p.PluginInstallReceiptPath("foo")); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := ExportLock(p); err == nil {
+				t.Errorf("expected an error for a platform without sha256 sum, got lock:\n%s", b)
+			}
+		})
+	}
+}
+
+func TestApplyLock(t *testing.T) {
+	testdataDir := filepath.Join(testdataPath(t), "..", "..", "download", "testdata")
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+	b, err := ioutil.ReadFile(filepath.Join(testdataDir, "test-without-directory.tar.xz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	xzSha256 := hex.EncodeToString(sum[:])
+
+	newPlugin := func(name, version, archive, sha256 string) index.Plugin {
+		platform := newTestArchivePlatform().WithURI(server.URL + "/" + archive).WithSHA256(sha256).V()
+		return testutil.NewPlugin().WithName(name).WithVersion(version).WithPlatforms(platform).V()
+	}
+	available := map[string]index.Plugin{
+		"foo@v1.0.0": newPlugin("foo", "v1.0.0", "test-without-directory.tar.gz", testArchiveSha256),
+		"foo@v2.0.0": newPlugin("foo", "v2.0.0", "test-without-directory.tar.xz", xzSha256),
+		"bar@v1.0.0": newPlugin("bar", "v1.0.0", "test-without-directory.tar.gz", testArchiveSha256),
+		"baz@v1.0.0": newPlugin("baz", "v1.0.0", "test-without-directory.tar.gz", testArchiveSha256),
+		"qux@v1.0.0": newPlugin("qux", "v1.0.0", "test-without-directory.tar.gz", testArchiveSha256),
+	}
+	resolve := func(name, indexName, version string) (index.Plugin, error) {
+		if plugin, ok := available[name+"@"+version]; ok {
+			return plugin, nil
+		}
+		return index.Plugin{}, errors.Errorf("plugin %q not found at version %s", name, version)
+	}
+
+	p := newTestPaths(t)
+	for _, plugin := range []index.Plugin{available["foo@v1.0.0"], available["bar@v1.0.0"]} {
+		if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lock := `plugins:
+- name: foo
+  index: default
+  version: v2.0.0
+  archives:
+  - uri: https://example.com/foo-other.tar.gz
+    sha256: ` + testArchiveSha256 + `
+  - uri: https://example.com/foo.tar.xz
+    sha256: ` + xzSha256 + `
+- name: baz
+  index: default
+  version: v1.0.0
+  archives:
+  - uri: https://example.com/baz.tar.gz
+    sha256: ` + testArchiveSha256 + `
+- name: qux
+  index: default
+  version: v1.0.0
+  archives:
+  - uri: https://example.com/qux.tar.gz
+    sha256: ` + xzSha256 + `
+`
+	errs := ApplyLock(p, []byte(lock), resolve, nil)
+	if len(errs) != 1 {
+		t.Fatalf("expected one error for the archive of qux not in the lock, got %v", errs)
+	}
+	t.Logf("expected error: %v", errs[0])
+
+	versions := make(map[string]string)
+	installed, err := ListInstalled(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range installed {
+		versions[v.Name] = v.Version
+	}
+	if want := map[string]string{"foo": "v2.0.0", "baz": "v1.0.0"}; !cmp.Equal(want, versions) {
+		t.Errorf("installed plugins = %v, want %v", versions, want)
+	}
+
+	// applying the lock again only fails for qux
+	if errs := ApplyLock(p, []byte(lock), resolve, nil); len(errs) != 1 {
+		t.Errorf("expected one error applying the lock again, got %v", errs)
+	}
+}
+
+func TestApplyLock_installedArchive(t *testing.T) {
+	xzArchive, xzSha256 := testXZArchive(t)
+	server := newTestArchiveServer(t)
+	defer server.Close()
+	xzPlugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(newTestArchivePlatform().
+		WithURI(server.URL + "/" + filepath.Base(xzArchive)).WithSHA256(xzSha256).V()).V()
+	gzPlugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(newTestArchivePlatform().
+		WithURI(server.URL + "/test-without-directory.tar.gz").V()).V()
+	lock := `plugins:
+- name: foo
+  index: default
+  version: v1.0.0
+  archives:
+  - uri: https://example.com/foo.tar.xz
+    sha256: ` + xzSha256 + `
+`
+	tests := []struct {
+		name     string
+		resolved index.Plugin
+		wantErr  bool
+	}{
+		{name: "version re-released with the locked archive", resolved: xzPlugin},
+		{name: "locked archive not available", resolved: gzPlugin, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			// the same version was installed from another archive
+			if err := Install(p, gzPlugin, constants.DefaultIndexName, InstallOpts{}); err != nil {
+				t.Fatal(err)
+			}
+			resolve := func(name, indexName, version string) (index.Plugin, error) { return tt.resolved, nil }
+
+			errs := ApplyLock(p, []byte(lock), resolve, nil)
+			if tt.wantErr {
+				if len(errs) != 1 {
+					t.Fatalf("expected an error for the installed archive not in the lock, got %v", errs)
+				}
+				return
+			}
+			if len(errs) != 0 {
+				t.Fatalf("ApplyLock() errors = %v", errs)
+			}
+			r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := xzPlugin.Spec.Platforms[0].URI; r.Status.Install.URI != want {
+				t.Errorf("plugin is installed from %q, expected the locked archive %q", r.Status.Install.URI, want)
+			}
+		})
+	}
+}
+
+func TestApplyLock_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		lock string
+	}{
+		{name: "not yaml", lock: "plugins: [foo"},
+		{name: "unknown field", lock: "plugins:\n- name: foo\n  index: default\n  version: v1.0.0\n  sha: abc\n"},
+		{name: "missing version", lock: "plugins:\n- name: foo\n  index: default\n"},
+		{name: "duplicate plugin", lock: "plugins:\n- {name: foo, index: default, version: v1.0.0, archives: [{uri: a, sha256: " + testArchiveSha256 + "}]}\n" +
+			"- {name: foo, index: default, version: v2.0.0, archives: [{uri: a, sha256: " + testArchiveSha256 + "}]}\n"},
+		{name: "no archives", lock: "plugins:\n- {name: foo, index: default, version: v1.0.0}\n"},
+		{name: "empty sha256", lock: "plugins:\n- {name: foo, index: default, version: v1.0.0, archives: [{uri: a}]}\n"},
+		{name: "invalid sha256", lock: "plugins:\n- {name: foo, index: default, version: v1.0.0, archives: [{uri: a, sha256: abc}]}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			resolve := func(name, indexName, version string) (index.Plugin, error) {
+				t.Errorf("unexpected resolve of plugin %q", name)
+				return index.Plugin{}, errors.New("not found")
+			}
+			if errs := ApplyLock(p, []byte(tt.lock), resolve, nil); len(errs) != 1 {
+				t.Errorf("expected a single error, got %v", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"fmt"
+
+	"k8s.io/klog"
+)
+
+// Logger receives the log messages of installation operations. It allows
+// programs using this package to route the messages to their own logger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+// loggerOrDefault returns log, or the default Logger writing to klog if log is
+// nil.
+func loggerOrDefault(log Logger) Logger {
+	if log != nil {
+		return log
+	}
+	return klogLogger{}
+}
+
+// klogLogger is the default Logger, which writes to klog. Debug messages are
+// logged at verbosity level 2, informational messages at level 1.
+type klogLogger struct{}
+
+func (klogLogger) Debugf(format string, args ...interface{}) {
+	if klog.V(2) {
+		klog.InfoDepth(1, fmt.Sprintf(format, args...))
+	}
+}
+
+func (klogLogger) Infof(format string, args ...interface{}) {
+	if klog.V(1) {
+		klog.InfoDepth(1, fmt.Sprintf(format, args...))
+	}
+}
+
+func (klogLogger) Warningf(format string, args ...interface{}) {
+	klog.WarningDepth(1, fmt.Sprintf(format, args...))
+}
@@ -18,7 +18,10 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/pkg/errors"
@@ -55,13 +58,16 @@ func findMoveTargets(fromDir, toDir string, fo index.FileOperation) ([]move, err
 		return nil, errors.Wrap(err, "could not get the relative path for the move dst")
 	}
 
-	gl, err := filepath.Glob(filepath.Join(filepath.FromSlash(fromDir), filepath.FromSlash(fo.From)))
+	gl, err := globPattern(fromDir, fo.From)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not get files using a glob string")
+		return nil, err
 	}
 	if len(gl) == 0 {
 		return nil, errors.Errorf("no files in the plugin archive matched the glob pattern=%s", fo.From)
 	}
+	if fo.Rename {
+		return renameMoveTarget(fromDir, toDir, newDir, gl, fo)
+	}
 
 	moves := make([]move, 0, len(gl))
 	for _, v := range gl {
@@ -76,6 +82,59 @@ func findMoveTargets(fromDir, toDir string, fo index.FileOperation) ([]move, err
 	return moves, nil
 }
 
+// renameMoveTarget returns the move of the single file matching the glob
+// pattern of fo to the file path newPath.
+func renameMoveTarget(fromDir, toDir, newPath string, matches []string, fo index.FileOperation) ([]move, error) {
+	if len(matches) > 1 {
+		names := make([]string, 0, len(matches))
+		for _, v := range matches {
+			rel, err := filepath.Rel(fromDir, v)
+			if err != nil {
+				return nil, errors.Wrap(err, "could not get the relative path of the matched file")
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil, errors.Errorf("the glob pattern=%s matched %d files (%s), but only one file can be renamed to %q",
+			fo.From, len(matches), strings.Join(names, ", "), fo.To)
+	}
+	m := move{from: matches[0], to: newPath}
+	if !isMoveAllowed(fromDir, toDir, m) {
+		return nil, errors.Errorf("can't move, move target %v is not a subpath from=%q, to=%q", m, fromDir, toDir)
+	}
+	klog.V(3).Infof("Renaming the single file matching the glob pattern=%s to %q", fo.From, fo.To)
+	return []move{m}, nil
+}
+
+// globPattern returns the files in dir matching the glob pattern, after
+// expanding the alternatives in braces like "{bin,lib}/*". A file matching
+// more than one of the alternatives is returned once.
+func globPattern(dir, pattern string) ([]string, error) {
+	patterns, err := pathutil.ExpandBraces(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid glob pattern")
+	}
+	if len(patterns) == 1 {
+		gl, err := filepath.Glob(filepath.Join(filepath.FromSlash(dir), filepath.FromSlash(patterns[0])))
+		return gl, errors.Wrap(err, "could not get files using a glob string")
+	}
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		gl, err := filepath.Glob(filepath.Join(filepath.FromSlash(dir), filepath.FromSlash(p)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get files using the glob string %q", p)
+		}
+		for _, f := range gl {
+			if !seen[f] {
+				seen[f] = true
+				out = append(out, f)
+			}
+		}
+	}
+	return out, nil
+}
+
 func getDirectMove(fromDir, toDir string, fo index.FileOperation) (move, bool, error) {
 	var m move
 	fromDir, err := filepath.Abs(fromDir)
@@ -121,6 +180,10 @@ func isMoveAllowed(fromBase, toBase string, m move) bool {
 	return okFrom && okTo
 }
 
+// moveWorkers is the maximum number of files moveFiles moves concurrently,
+// overridable in benchmarks.
+var moveWorkers = 8
+
 func moveFiles(fromDir, toDir string, fo index.FileOperation) error {
 	klog.V(4).Infof("Finding move targets from %q to %q with file operation=%#v", fromDir, toDir, fo)
 	moves, err := findMoveTargets(fromDir, toDir, fo)
@@ -128,20 +191,209 @@ func moveFiles(fromDir, toDir string, fo index.FileOperation) error {
 		return errors.Wrap(err, "could not find move targets")
 	}
 
-	for _, m := range moves {
-		klog.V(2).Infof("Move file from %q to %q", m.from, m.to)
+	excluded := make([]bool, len(moves))
+	if len(fo.Exclude) > 0 {
+		err := forEachMove(moves, func(i int, m move) error {
+			var err error
+			if excluded[i], err = removeExcluded(fromDir, m.from, fo.Exclude); err != nil {
+				return errors.Wrapf(err, "could not apply exclusions to %q", m.from)
+			}
+			if excluded[i] {
+				klog.V(2).Infof("Skipping excluded file %q", m.from)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The target directories are created before moving the files
+	// concurrently, so that no move depends on the directory created by
+	// another.
+	for i, m := range moves {
+		if excluded[i] {
+			continue
+		}
 		if err := os.MkdirAll(filepath.Dir(m.to), 0755); err != nil {
 			return errors.Wrapf(err, "failed to create move path %q", filepath.Dir(m.to))
 		}
+	}
 
-		if err = renameOrCopy(m.from, m.to); err != nil {
-			return errors.Wrapf(err, "could not rename/copy file from %q to %q", m.from, m.to)
+	err = forEachMove(moves, func(i int, m move) error {
+		if excluded[i] {
+			return nil
 		}
+		klog.V(2).Infof("Move file from %q to %q", m.from, m.to)
+		return errors.Wrapf(renameOrCopy(m.from, m.to), "could not rename/copy file from %q to %q", m.from, m.to)
+	})
+	if err != nil {
+		return err
 	}
 	klog.V(4).Infoln("Move operations are complete")
 	return nil
 }
 
+// forEachMove calls fn for the moves with up to moveWorkers calls running
+// concurrently. Moves to the same destination are made by a single worker in
+// slice order, so that the last of them wins like when moving serially. All
+// moves are processed, and the error of the first move in the slice that
+// failed is returned, regardless of the order the calls finished in.
+func forEachMove(moves []move, fn func(int, move) error) error {
+	var groups [][]int
+	groupOf := make(map[string]int)
+	for i, m := range moves {
+		g, ok := groupOf[m.to]
+		if !ok {
+			g = len(groups)
+			groupOf[m.to] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	errs := make([]error, len(moves))
+	queue := make(chan []int)
+	var wg sync.WaitGroup
+	for i := 0; i < moveWorkers && i < len(groups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				for _, j := range group {
+					errs[j] = fn(j, moves[j])
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		queue <- group
+	}
+	close(queue)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listFiles returns the slash-separated paths of the files under dir,
+// relative to dir, in lexical order.
+func listFiles(dir string) ([]string, error) {
+	var out []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return errors.Wrapf(err, "could not get the relative path of %q", p)
+		}
+		out = append(out, filepath.ToSlash(rel))
+		return nil
+	})
+	return out, err
+}
+
+// archiveEntryFilter returns a function reporting whether a file of the
+// archive of the platform, given its slash-separated path in the archive, can
+// be needed to install the plugin, so that the other files of large archives
+// are not extracted. A file is needed if, after stripping the leading path
+// components, a From pattern of the file operations matches its path or the
+// path of one of its parent directories. Files named like the Bin executable
+// are always needed, to report where it is if the file operations miss it.
+// Patterns are matched case-insensitively, as the file system may be.
+//
+// It returns nil, which extracts all files, if the platform has no file
+// operations or one of them extracts the whole archive.
+func archiveEntryFilter(platform index.Platform) func(string) bool {
+	if len(platform.Files) == 0 {
+		return nil
+	}
+	var patterns []string
+	for _, fo := range platform.Files {
+		expanded, err := pathutil.ExpandBraces(fo.From)
+		if err != nil {
+			return nil
+		}
+		for _, p := range expanded {
+			p = path.Clean(strings.ToLower(filepath.ToSlash(p)))
+			if _, err := path.Match(p, ""); err != nil || p == "." {
+				return nil
+			}
+			patterns = append(patterns, p)
+		}
+	}
+	binName := path.Base(strings.ToLower(filepath.ToSlash(platform.Bin)))
+	return func(entry string) bool {
+		parts := strings.Split(path.Clean(strings.ToLower(filepath.ToSlash(entry))), "/")
+		if len(parts) <= platform.StripComponents {
+			return false
+		}
+		parts = parts[platform.StripComponents:]
+		if parts[len(parts)-1] == binName {
+			return true
+		}
+		for _, p := range patterns {
+			if n := strings.Count(p, "/") + 1; n <= len(parts) {
+				if ok, _ := path.Match(p, strings.Join(parts[:n], "/")); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// removeExcluded deletes the files and directories under src that match any
+// of the exclude patterns, and reports whether src itself is excluded.
+// Patterns are matched against the slash-separated path relative to baseDir.
+func removeExcluded(baseDir, src string, patterns []string) (bool, error) {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get the absolute path of the move src")
+	}
+	if excluded, err := isExcluded(baseDir, src, patterns); err != nil || excluded {
+		return excluded, err
+	}
+	err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == src {
+			return err
+		}
+		excluded, err := isExcluded(baseDir, p, patterns)
+		if err != nil || !excluded {
+			return err
+		}
+		klog.V(3).Infof("Removing excluded file %q", p)
+		if err := os.RemoveAll(p); err != nil {
+			return errors.Wrapf(err, "failed to remove excluded file %q", p)
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return false, err
+}
+
+func isExcluded(baseDir, p string, patterns []string) (bool, error) {
+	rel, err := filepath.Rel(baseDir, p)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not get the relative path of %q", p)
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, rel); err != nil {
+			return false, errors.Wrapf(err, "invalid exclude pattern %q", pattern)
+		} else if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func moveAllFiles(fromDir, toDir string, fos []index.FileOperation) error {
 	for _, fo := range fos {
 		if err := moveFiles(fromDir, toDir, fo); err != nil {
@@ -151,21 +403,36 @@ func moveAllFiles(fromDir, toDir string, fos []index.FileOperation) error {
 	return nil
 }
 
-// moveToInstallDir moves plugins from srcDir to dstDir (created in this method) with given FileOperation.
-func moveToInstallDir(srcDir, installDir string, fos []index.FileOperation) error {
+// moveToInstallDir moves plugins from srcDir to dstDir (created in this method) with given FileOperation,
+// after removing stripComponents leading path components from the files in srcDir. The files are prepared
+// in temporary directories in tmpDir, or the temp directory of the OS if empty, before they are moved to
+// installDir.
+func moveToInstallDir(srcDir, installDir, tmpDir string, stripComponents int, fos []index.FileOperation) error {
 	installationDir := filepath.Dir(installDir)
 	klog.V(4).Infof("Creating directory %q", installationDir)
 	if err := os.MkdirAll(installationDir, 0755); err != nil {
 		return errors.Wrapf(err, "error creating directory at %q", installationDir)
 	}
 
-	tmp, err := ioutil.TempDir("", "krew-temp-move")
+	tmp, err := ioutil.TempDir(tmpDir, "krew-temp-move")
 	klog.V(4).Infof("Creating temp plugin move operations dir %q", tmp)
 	if err != nil {
 		return errors.Wrap(err, "failed to find a temporary director")
 	}
 	defer os.RemoveAll(tmp)
 
+	if stripComponents > 0 {
+		stripped, err := ioutil.TempDir(tmpDir, "krew-strip-components")
+		if err != nil {
+			return errors.Wrap(err, "failed to create a temporary directory")
+		}
+		defer os.RemoveAll(stripped)
+		if err := stripPathComponents(srcDir, stripped, stripComponents); err != nil {
+			return errors.Wrapf(err, "failed to strip %d leading path components", stripComponents)
+		}
+		srcDir = stripped
+	}
+
 	if err = moveAllFiles(srcDir, tmp, fos); err != nil {
 		return errors.Wrap(err, "failed to move files")
 	}
@@ -181,8 +448,43 @@ func moveToInstallDir(srcDir, installDir string, fos []index.FileOperation) erro
 	return nil
 }
 
-// renameOrCopy will try to rename a dir or file. If rename is not supported, a manual copy will be performed.
-// Existing files at "to" will be deleted.
+// stripPathComponents moves the files in srcDir to dstDir after removing n
+// leading components from their paths relative to srcDir. Files with at most n
+// path components are skipped.
+func stripPathComponents(srcDir, dstDir string, n int) error {
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get relative path of %q", path)
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) <= n {
+			klog.V(4).Infof("Skipping %q, it has fewer than %d leading path components", rel, n+1)
+			return nil
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(strings.Join(parts[n:], "/")))
+		if _, err := os.Lstat(dst); err == nil {
+			return errors.Errorf("stripping the path of %q conflicts with another file at %q", rel, dst)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return errors.Wrapf(err, "failed to create directory for %q", dst)
+		}
+		klog.V(4).Infof("Move %q to %q", path, dst)
+		return errors.Wrapf(os.Rename(path, dst), "failed to move %q", path)
+	})
+}
+
+// rename is os.Rename, overridable in tests.
+var rename = os.Rename
+
+// renameOrCopy will try to rename a dir or file. If rename is not supported, a manual copy will be performed
+// and "from" is removed afterwards. Existing files at "to" will be deleted.
 func renameOrCopy(from, to string) error {
 	// Try atomic rename (does not work cross partition).
 	fi, err := os.Stat(to)
@@ -197,11 +499,14 @@ func renameOrCopy(from, to string) error {
 		klog.V(4).Infof("Move target directory %q cleaned up", to)
 	}
 
-	err = os.Rename(from, to)
+	err = rename(from, to)
 	// Fallback for invalid cross-device link (errno:18).
 	if isCrossDeviceRenameErr(err) {
 		klog.V(2).Infof("Cross-device link error while copying, fallback to manual copy")
-		return errors.Wrap(copyTree(from, to), "failed to copy directory tree as a fallback")
+		if err := copyTree(from, to); err != nil {
+			return errors.Wrap(err, "failed to copy directory tree as a fallback")
+		}
+		return errors.Wrapf(os.RemoveAll(from), "failed to remove %q after copying it", from)
 	}
 	return err
 }
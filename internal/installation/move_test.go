@@ -17,10 +17,15 @@ package installation
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/pkg/errors"
+
 	"sigs.k8s.io/krew/internal/testutil"
 	"sigs.k8s.io/krew/pkg/index"
 )
@@ -71,6 +76,49 @@ func Test_findMoveTargets(t *testing.T) {
 			}},
 			wantErr: false,
 		},
+		{
+			name: "rename single glob match",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From:   "not*",
+					To:     "bin/foo",
+					Rename: true,
+				},
+			},
+			want: []move{{
+				from: filepath.Join(testdataPath(t), "testdir_A", "notsecret"),
+				to:   filepath.Join(testdataPath(t), "testdir_B", "bin", "foo"),
+			}},
+			wantErr: false,
+		},
+		{
+			name: "rename multiple glob matches",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From:   "*",
+					To:     "foo",
+					Rename: true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "rename out of the install dir",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From:   "not*",
+					To:     "../foo",
+					Rename: true,
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "glob not matching any files",
 			args: args{
@@ -185,6 +233,330 @@ func Test_getDirectMove(t *testing.T) {
 	}
 }
 
+func Test_moveFiles_exclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "no exclusions",
+			want: []string{"LICENSE", "README.md", "bin/foo", "docs/guide.md", "docs/index.html"},
+		},
+		{
+			name:    "exclude top-level files",
+			exclude: []string{"*.md", "LICENSE"},
+			want:    []string{"bin/foo", "docs/guide.md", "docs/index.html"},
+		},
+		{
+			name:    "exclude files in a moved directory",
+			exclude: []string{"docs/*.md"},
+			want:    []string{"LICENSE", "README.md", "bin/foo", "docs/index.html"},
+		},
+		{
+			name:    "exclude a directory",
+			exclude: []string{"docs"},
+			want:    []string{"LICENSE", "README.md", "bin/foo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := testutil.NewTempDir(t)
+			for _, f := range []string{"LICENSE", "README.md", "bin/foo", "docs/guide.md", "docs/index.html"} {
+				srcDir.Write(f, nil)
+			}
+			dstDir := testutil.NewTempDir(t)
+
+			fo := index.FileOperation{From: "*", To: ".", Exclude: tt.exclude}
+			if err := moveFiles(srcDir.Root(), dstDir.Root(), fo); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			err := filepath.Walk(dstDir.Root(), func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dstDir.Root(), path)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("moveFiles() moved %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_moveFiles_rename(t *testing.T) {
+	srcDir := testutil.NewTempDir(t)
+	srcDir.Write("bin/foo-linux-amd64", []byte("foo"))
+	srcDir.Write("LICENSE", nil)
+	dstDir := testutil.NewTempDir(t)
+
+	fo := index.FileOperation{From: "bin/foo-*", To: "foo", Rename: true}
+	if err := moveFiles(srcDir.Root(), dstDir.Root(), fo); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(dstDir.Path("foo"))
+	if err != nil {
+		t.Fatalf("renamed file is not installed: %v", err)
+	}
+	if string(b) != "foo" {
+		t.Errorf("renamed file has content %q, want %q", b, "foo")
+	}
+}
+
+func Test_findMoveTargets_braces(t *testing.T) {
+	srcDir := testutil.NewTempDir(t)
+	for _, f := range []string{"bin/foo", "lib/a.so", "lib/b.so", "docs/README.md"} {
+		srcDir.Write(f, nil)
+	}
+	dstDir := testutil.NewTempDir(t)
+
+	tests := []struct {
+		from    string
+		want    []string
+		wantErr bool
+	}{
+		{from: "lib/*", want: []string{"lib/a.so", "lib/b.so"}},
+		{from: "{bin,lib}/*", want: []string{"bin/foo", "lib/a.so", "lib/b.so"}},
+		{from: "{lib/a.so,lib/*}", want: []string{"lib/a.so", "lib/b.so"}},
+		{from: "{bin,{lib,docs}}/*", want: []string{"bin/foo", "lib/a.so", "lib/b.so", "docs/README.md"}},
+		{from: "{bin,lib/*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			moves, err := findMoveTargets(srcDir.Root(), dstDir.Root(), index.FileOperation{From: tt.from, To: "."})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findMoveTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, m := range moves {
+				rel, err := filepath.Rel(srcDir.Root(), m.from)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findMoveTargets() moves %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_moveFiles_manyFiles(t *testing.T) {
+	srcDir := testutil.NewTempDir(t)
+	var want []string
+	for i := 0; i < 200; i++ {
+		f := fmt.Sprintf("lib/pkg%03d/file.txt", i)
+		srcDir.Write(f, []byte(f))
+		want = append(want, f)
+	}
+	dstDir := testutil.NewTempDir(t)
+
+	fo := index.FileOperation{From: "lib/*", To: "lib"}
+	if err := moveFiles(srcDir.Root(), dstDir.Root(), fo); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range want {
+		b, err := ioutil.ReadFile(dstDir.Path(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != f {
+			t.Errorf("file %q has content %q", f, b)
+		}
+	}
+}
+
+func Test_moveFiles_sameDestination(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 20; i++ {
+		dirs = append(dirs, fmt.Sprintf("dir%02d", i))
+	}
+	for n := 0; n < 10; n++ {
+		srcDir := testutil.NewTempDir(t)
+		for _, d := range dirs {
+			srcDir.Write(d+"/foo", []byte(d))
+		}
+		dstDir := testutil.NewTempDir(t)
+
+		fo := index.FileOperation{From: "{" + strings.Join(dirs, ",") + "}/foo", To: "."}
+		if err := moveFiles(srcDir.Root(), dstDir.Root(), fo); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(dstDir.Path("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := dirs[len(dirs)-1]; string(b) != want {
+			t.Fatalf("expected the last move to the same destination to win with content %q, got %q", want, b)
+		}
+	}
+}
+
+func Test_forEachMove_firstError(t *testing.T) {
+	moves := make([]move, 50)
+	for i := range moves {
+		moves[i] = move{from: fmt.Sprint(i)}
+	}
+	for n := 0; n < 10; n++ {
+		err := forEachMove(moves, func(i int, m move) error {
+			if i%10 == 7 {
+				return errors.Errorf("move %s failed", m.from)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "move 7 failed" {
+			t.Fatalf("expected the error of the first failed move, got: %v", err)
+		}
+	}
+}
+
+func Test_stripPathComponents(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		n       int
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "strip top-level directory",
+			files: []string{"foo-1.2.3/LICENSE", "foo-1.2.3/bin/foo"},
+			n:     1,
+			want:  []string{"LICENSE", "bin/foo"},
+		},
+		{
+			name:  "files with too few components are dropped",
+			files: []string{"README.md", "foo-1.2.3/LICENSE", "foo-1.2.3/bin/foo"},
+			n:     2,
+			want:  []string{"foo"},
+		},
+		{
+			name:    "conflicting stripped paths",
+			files:   []string{"a/foo", "b/foo"},
+			n:       1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := testutil.NewTempDir(t)
+			for _, f := range tt.files {
+				srcDir.Write(f, nil)
+			}
+			dstDir := testutil.NewTempDir(t)
+
+			err := stripPathComponents(srcDir.Root(), dstDir.Root(), tt.n)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			err = filepath.Walk(dstDir.Root(), func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dstDir.Root(), path)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stripPathComponents() moved %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_archiveEntryFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		platform    index.Platform
+		wantAll     bool
+		included    []string
+		notIncluded []string
+	}{
+		{
+			name:     "no file operations",
+			platform: index.Platform{Bin: "foo"},
+			wantAll:  true,
+		},
+		{
+			name:     "whole archive",
+			platform: index.Platform{Bin: "foo", Files: []index.FileOperation{{From: "./", To: "."}}},
+			wantAll:  true,
+		},
+		{
+			name:     "invalid pattern",
+			platform: index.Platform{Bin: "foo", Files: []index.FileOperation{{From: "[", To: "."}}},
+			wantAll:  true,
+		},
+		{
+			name:        "single file",
+			platform:    index.Platform{Bin: "foo", Files: []index.FileOperation{{From: "./bin/foo", To: "."}, {From: "LICENSE", To: "."}}},
+			included:    []string{"bin/foo", "./bin/foo", "LICENSE", "license"},
+			notIncluded: []string{"bin/bar", "docs/index.html", "foo-LICENSE"},
+		},
+		{
+			name:        "glob",
+			platform:    index.Platform{Bin: "foo", Files: []index.FileOperation{{From: "*/*.sh", To: "."}}},
+			included:    []string{"a/run.sh", "b/lib.sh"},
+			notIncluded: []string{"run.sh", "a/b/run.sh", "a/run.bat"},
+		},
+		{
+			name:        "directory",
+			platform:    index.Platform{Bin: "foo", Files: []index.FileOperation{{From: "{bin,lib}", To: "."}}},
+			included:    []string{"bin/foo", "lib/x86/libfoo.so"},
+			notIncluded: []string{"docs/index.html", "binaries/bar"},
+		},
+		{
+			name:        "executable",
+			platform:    index.Platform{Bin: "./bin/foo", Files: []index.FileOperation{{From: "LICENSE", To: "."}}},
+			included:    []string{"foo", "dist/linux/foo", "LICENSE"},
+			notIncluded: []string{"dist/linux/bar"},
+		},
+		{
+			name:        "stripped components",
+			platform:    index.Platform{Bin: "foo", StripComponents: 1, Files: []index.FileOperation{{From: "bin/*", To: "."}}},
+			included:    []string{"foo-v1.0.0/bin/foo", "foo-v1.0.0/bin/bar"},
+			notIncluded: []string{"bin/bar", "foo-v1.0.0/docs/index.html", "LICENSE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			include := archiveEntryFilter(tt.platform)
+			if (include == nil) != tt.wantAll {
+				t.Fatalf("archiveEntryFilter() returned nil=%v, want extracting all files=%v", include == nil, tt.wantAll)
+			}
+			for _, entry := range tt.included {
+				if !include(entry) {
+					t.Errorf("expected %q to be extracted", entry)
+				}
+			}
+			for _, entry := range tt.notIncluded {
+				if include(entry) {
+					t.Errorf("expected %q not to be extracted", entry)
+				}
+			}
+		})
+	}
+}
+
 func Test_moveOrCopyDir_canMoveToNonExistingDir(t *testing.T) {
 	srcDir := testutil.NewTempDir(t)
 
@@ -237,3 +609,73 @@ func Test_moveOrCopyDir_removesExistingTarget(t *testing.T) {
 	}
 
 }
+
+// crossDeviceRename fails like os.Rename between different filesystems.
+func crossDeviceRename(from, to string) error {
+	errno := syscall.Errno(18) // syscall.EXDEV
+	if IsWindows() {
+		errno = syscall.Errno(17) // syscall.ERROR_NOT_SAME_DEVICE
+	}
+	return &os.LinkError{Op: "rename", Old: from, New: to, Err: errno}
+}
+
+func Test_moveOrCopyDir_crossDevice(t *testing.T) {
+	defer func(f func(string, string) error) { rename = f }(rename)
+	rename = crossDeviceRename
+
+	srcDir := testutil.NewTempDir(t)
+	srcDir.Write(filepath.Join("sub", "some-file"), []byte("content"))
+	dstDir := testutil.NewTempDir(t)
+	dst := dstDir.Path("target")
+
+	if err := renameOrCopy(srcDir.Root(), dst); err != nil {
+		t.Fatalf("move failed: %+v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dst, "sub", "some-file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "content" {
+		t.Errorf("copied file has content %q, expected %q", b, "content")
+	}
+	if _, err := os.Stat(srcDir.Root()); !os.IsNotExist(err) {
+		t.Errorf("source directory was not removed after copying, err=%v", err)
+	}
+}
+
+// BenchmarkMoveToInstallDir moves the files of a synthetic archive with many
+// files in many directories, with and without moving them concurrently.
+func BenchmarkMoveToInstallDir(b *testing.B) {
+	for _, workers := range []int{1, moveWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			defer func(n int) { moveWorkers = n }(moveWorkers)
+			moveWorkers = workers
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				root, err := ioutil.TempDir("", "krew-bench")
+				if err != nil {
+					b.Fatal(err)
+				}
+				src := filepath.Join(root, "src")
+				for j := 0; j < 500; j++ {
+					dir := filepath.Join(src, fmt.Sprintf("pkg%03d", j))
+					if err := os.MkdirAll(dir, 0755); err != nil {
+						b.Fatal(err)
+					}
+					if err := ioutil.WriteFile(filepath.Join(dir, "data"), []byte(strings.Repeat("x", 4096)), 0644); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StartTimer()
+
+				err = moveToInstallDir(src, filepath.Join(root, "install", "v1"), "", 0, []index.FileOperation{{From: "*", To: "."}})
+				b.StopTimer()
+				if err != nil {
+					b.Fatal(err)
+				}
+				os.RemoveAll(root)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// UpgradeCandidate describes how an installed plugin compares to its manifest
+// in the plugin index.
+type UpgradeCandidate struct {
+	// Name is the name of the installed plugin.
+	Name string
+
+	// Index is the name of the index the plugin was installed from.
+	Index string
+
+	// InstalledVersion is the version of the installed plugin.
+	InstalledVersion string
+
+	// LatestVersion is the version of the plugin in the index. It is empty
+	// if the plugin is orphaned.
+	LatestVersion string
+
+	// NeedsUpgrade reports whether upgrading the plugin installs
+	// LatestVersion, which is the case if it is a newer semantic version than
+	// the installed version, or differs from it if either is not a semantic
+	// version.
+	NeedsUpgrade bool
+
+	// Orphaned is set if the plugin is no longer in the index it was
+	// installed from.
+	Orphaned bool
+}
+
+// UpgradeCandidates compares the installed plugins to the available plugin
+// manifests, without changing anything. The available plugins are keyed by
+// their name if they are in the default index, and INDEX/NAME otherwise.
+// Plugins installed from a manifest file or an archive URL are not in any
+// index, and they are left out of the result.
+func UpgradeCandidates(p environment.Paths, available map[string]index.Plugin) ([]UpgradeCandidate, error) {
+	receipts, err := GetInstalledPluginReceipts(p.InstallReceiptsPath())
+	if err != nil {
+		return nil, err
+	}
+	var out []UpgradeCandidate
+	for _, r := range receipts {
+		indexName := r.Status.Source.Name
+		if indexName == "" {
+			indexName = constants.DefaultIndexName
+		}
+		if indexName == constants.DetachedIndexName || indexName == constants.URLIndexName {
+			continue
+		}
+		c := UpgradeCandidate{
+			Name:             r.Name,
+			Index:            indexName,
+			InstalledVersion: r.Spec.Version,
+		}
+		plugin, ok := available[indexName+"/"+r.Name]
+		if !ok && indexName == constants.DefaultIndexName {
+			plugin, ok = available[r.Name]
+		}
+		if ok {
+			c.LatestVersion = plugin.Spec.Version
+			c.NeedsUpgrade = needsUpgrade(c.InstalledVersion, c.LatestVersion, false, klogLogger{})
+		} else {
+			c.Orphaned = true
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func TestUpgradeCandidates(t *testing.T) {
+	p := newTestPaths(t)
+	installed := []struct {
+		name, version, indexName string
+	}{
+		{"current", "v1.0.0", constants.DefaultIndexName},
+		{"detached", "v1.0.0", constants.DetachedIndexName},
+		{"newer", "v1.0.0", constants.DefaultIndexName},
+		{"older", "v2.0.0", constants.DefaultIndexName},
+		{"orphaned", "v1.0.0", constants.DefaultIndexName},
+		{"other-index", "v1.0.0", "custom"},
+		{"semver-newer", "v1.9.0", constants.DefaultIndexName},
+	}
+	for _, i := range installed {
+		plugin := testutil.NewPlugin().WithName(i.name).WithVersion(i.version).V()
+		if err := receipt.Store(receipt.New(plugin, i.indexName), p.PluginInstallReceiptPath(i.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newPlugin := func(name, version string) index.Plugin {
+		return testutil.NewPlugin().WithName(name).WithVersion(version).V()
+	}
+	available := map[string]index.Plugin{
+		"current":            newPlugin("current", "v1.0.0"),
+		"detached":           newPlugin("detached", "v2.0.0"),
+		"default/newer":      newPlugin("newer", "v1.1.0"),
+		"older":              newPlugin("older", "v1.0.0"),
+		"other-index":        newPlugin("other-index", "v2.0.0"),
+		"custom/other-index": newPlugin("other-index", "v1.2.0"),
+		"semver-newer":       newPlugin("semver-newer", "v1.10.0"),
+	}
+
+	got, err := UpgradeCandidates(p, available)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UpgradeCandidate{
+		{Name: "current", Index: "default", InstalledVersion: "v1.0.0", LatestVersion: "v1.0.0"},
+		{Name: "newer", Index: "default", InstalledVersion: "v1.0.0", LatestVersion: "v1.1.0", NeedsUpgrade: true},
+		{Name: "older", Index: "default", InstalledVersion: "v2.0.0", LatestVersion: "v1.0.0"},
+		{Name: "orphaned", Index: "default", InstalledVersion: "v1.0.0", Orphaned: true},
+		{Name: "other-index", Index: "custom", InstalledVersion: "v1.0.0", LatestVersion: "v1.2.0", NeedsUpgrade: true},
+		{Name: "semver-newer", Index: "default", InstalledVersion: "v1.9.0", LatestVersion: "v1.10.0", NeedsUpgrade: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("UpgradeCandidates() differs: %s", diff)
+	}
+}
+
+func TestUpgradeCandidates_noPlugins(t *testing.T) {
+	got, err := UpgradeCandidates(newTestPaths(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no candidates, got %+v", got)
+	}
+}
@@ -15,9 +15,14 @@
 package installation
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -28,50 +33,272 @@ import (
 )
 
 // GetMatchingPlatform finds the platform spec in the specified plugin that
-// matches the os/arch of the current machine (can be overridden via KREW_OS
-// and/or KREW_ARCH).
+// matches the os/arch of the current machine (can be overridden via KREW_OS,
+// KREW_ARCH, KREW_ARCH_VARIANT and/or KREW_LIBC).
 func GetMatchingPlatform(platforms []index.Platform) (index.Platform, bool, error) {
-	return matchPlatform(platforms, OSArch())
+	return MatchPlatformForPair(platforms, OSArch())
 }
 
-// matchPlatform returns the first matching platform to given os/arch.
-func matchPlatform(platforms []index.Platform, env OSArchPair) (index.Platform, bool, error) {
-	envLabels := labels.Set{
-		"os":   env.OS,
-		"arch": env.Arch,
-	}
+// MatchPlatformFor finds the platform spec that matches the given os/arch
+// instead of the current machine, without reading the KREW_* environment
+// variables. It does not match the architecture variant and the libc, so
+// platforms requiring them are not matched, use MatchPlatformForPair to
+// specify them.
+func MatchPlatformFor(platforms []index.Platform, goos, goarch string) (index.Platform, bool, error) {
+	return MatchPlatformForPair(platforms, OSArchPair{OS: goos, Arch: goarch})
+}
+
+// specificSelectorKeys are the optional selector keys that make a platform
+// more specific than one that matches only on os and arch.
+var specificSelectorKeys = []string{"variant", "libc"}
+
+// MatchPlatformForPair returns the first platform spec matching the given
+// os/arch, architecture variant and libc, without reading the KREW_*
+// environment variables. A platform whose selector constrains more of the
+// architecture variant and the libc is preferred over an earlier match that
+// constrains fewer of them, so that a specific build (like arm v7 or musl) is
+// chosen over a generic one.
+func MatchPlatformForPair(platforms []index.Platform, env OSArchPair) (index.Platform, bool, error) {
+	envLabels := env.labels()
 	klog.V(2).Infof("Matching platform for labels(%v)", envLabels)
 
+	match, matchScore := -1, -1
 	for i, platform := range platforms {
 		sel, err := metav1.LabelSelectorAsSelector(platform.Selector)
 		if err != nil {
 			return index.Platform{}, false, errors.Wrap(err, "failed to compile label selector")
 		}
-		if sel.Matches(envLabels) {
-			klog.V(2).Infof("Found matching platform with index (%d)", i)
-			return platform, true, nil
+		if !sel.Matches(envLabels) {
+			continue
+		}
+		if score := SelectorSpecificity(platform.Selector); score > matchScore {
+			match, matchScore = i, score
+		}
+	}
+	if match < 0 {
+		return index.Platform{}, false, nil
+	}
+	klog.V(2).Infof("Found matching platform with index (%d)", match)
+	return platforms[match], true, nil
+}
+
+// SelectorSpecificity returns how many of the architecture variant and the
+// libc the platform selector constrains. Of the platforms matching a system,
+// the first one with the highest specificity is installed.
+func SelectorSpecificity(sel *metav1.LabelSelector) int {
+	var score int
+	for _, key := range specificSelectorKeys {
+		if hasSelectorKey(sel, key) {
+			score++
+		}
+	}
+	return score
+}
+
+// hasSelectorKey reports whether the label selector constrains the key.
+func hasSelectorKey(sel *metav1.LabelSelector, key string) bool {
+	if sel == nil {
+		return false
+	}
+	if _, ok := sel.MatchLabels[key]; ok {
+		return true
+	}
+	for _, expr := range sel.MatchExpressions {
+		if expr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoMatchingPlatform is returned when a plugin does not offer installation
+// for the os/arch of the current system.
+type ErrNoMatchingPlatform struct {
+	// Plugin is the name of the plugin.
+	Plugin string
+
+	// OSArch is the os/arch of the current system.
+	OSArch OSArchPair
+
+	// Supported describes the platforms the plugin offers, as "os/arch"
+	// strings where "*" stands for any value.
+	Supported []string
+}
+
+func newNoMatchingPlatformError(plugin string, platforms []index.Platform) *ErrNoMatchingPlatform {
+	return &ErrNoMatchingPlatform{
+		Plugin:    plugin,
+		OSArch:    OSArch(),
+		Supported: supportedPlatforms(platforms),
+	}
+}
+
+func (e *ErrNoMatchingPlatform) Error() string {
+	msg := fmt.Sprintf("plugin %q does not offer installation for this platform (%s)", e.Plugin, e.OSArch)
+	if len(e.Supported) > 0 {
+		msg += fmt.Sprintf(", it supports: %s", strings.Join(e.Supported, ", "))
+	}
+	return msg
+}
+
+// supportedPlatforms describes the os/arch combinations the platforms are
+// selected for, based on the "os" and "arch" values of their selectors. The
+// architecture variant is appended if the selector constrains it.
+func supportedPlatforms(platforms []index.Platform) []string {
+	var out []string
+	for _, p := range platforms {
+		oses, arches := selectorValues(p.Selector, "os"), selectorValues(p.Selector, "arch")
+		variants := []string{""}
+		if hasSelectorKey(p.Selector, "variant") {
+			variants = selectorValues(p.Selector, "variant")
+		}
+		for _, goos := range oses {
+			for _, arch := range arches {
+				for _, variant := range variants {
+					out = append(out, OSArchPair{OS: goos, Arch: arch, Variant: variant}.String())
+				}
+			}
 		}
 	}
-	return index.Platform{}, false, nil
+	return out
+}
+
+// selectorValues returns the values the label selector accepts for the key in
+// matchLabels or "In" expressions, or "*" if the selector does not restrict it.
+func selectorValues(sel *metav1.LabelSelector, key string) []string {
+	if sel == nil {
+		return []string{"*"}
+	}
+	var out []string
+	if v, ok := sel.MatchLabels[key]; ok {
+		out = append(out, v)
+	}
+	for _, expr := range sel.MatchExpressions {
+		if expr.Key == key && expr.Operator == metav1.LabelSelectorOpIn {
+			out = append(out, expr.Values...)
+		}
+	}
+	if len(out) == 0 {
+		return []string{"*"}
+	}
+	return out
 }
 
 // OSArchPair is wrapper around operating system and architecture
 type OSArchPair struct {
 	OS, Arch string
+
+	// Variant is the architecture variant, like "v6" or "v7" for arm. It is
+	// empty if the variant is not known or the architecture has no variants.
+	Variant string
+
+	// Libc is the C library of the system, "glibc" or "musl" on Linux. It is
+	// empty if it is not known.
+	Libc string
 }
 
 // String converts environment into a string
 func (p OSArchPair) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Arch, p.Variant)
+	}
 	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
 }
 
+// labels returns the labels the platform selectors are matched against.
+func (p OSArchPair) labels() labels.Set {
+	l := labels.Set{
+		"os":   p.OS,
+		"arch": p.Arch,
+	}
+	if p.Variant != "" {
+		l["variant"] = p.Variant
+	}
+	if p.Libc != "" {
+		l["libc"] = p.Libc
+	}
+	return l
+}
+
 // OSArch returns the OS/arch combination to be used on the current system. It
-// can be overridden by setting KREW_OS and/or KREW_ARCH environment variables.
+// can be overridden by setting KREW_OS, KREW_ARCH, KREW_ARCH_VARIANT and/or
+// KREW_LIBC environment variables.
 func OSArch() OSArchPair {
-	return OSArchPair{
+	p := OSArchPair{
 		OS:   getEnvOrDefault("KREW_OS", runtime.GOOS),
 		Arch: getEnvOrDefault("KREW_ARCH", runtime.GOARCH),
 	}
+	if v := os.Getenv("KREW_ARCH_VARIANT"); v != "" {
+		p.Variant = v
+	} else if p.OS == runtime.GOOS && p.Arch == runtime.GOARCH {
+		p.Variant = archVariant()
+	}
+	if v := os.Getenv("KREW_LIBC"); v != "" {
+		p.Libc = v
+	} else if p.OS == runtime.GOOS {
+		p.Libc = detectLibc()
+	}
+	return p
+}
+
+// muslIndicators are the files whose presence indicates that the system uses
+// the musl libc.
+var muslIndicators = []string{"/etc/alpine-release", "/lib/ld-musl-*.so.1"}
+
+// detectLibc detects the C library of the current system on a best-effort
+// basis. It returns "musl" if any of the musl indicator files exist and
+// "glibc" otherwise on Linux, and an empty string on other systems.
+func detectLibc() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	for _, pattern := range muslIndicators {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			klog.V(4).Infof("Detected musl libc from %s", matches[0])
+			return "musl"
+		}
+	}
+	return "glibc"
+}
+
+// archVariant detects the variant of the architecture of the current system.
+// Only the arm variants are detected on Linux, from the CPU architecture
+// reported in /proc/cpuinfo. Newer CPUs can run arm v7 binaries, so the
+// variant is at most "v7".
+func archVariant() string {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "arm" {
+		return ""
+	}
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		klog.V(4).Infof("Cannot detect arm variant: %v", err)
+		return ""
+	}
+	defer f.Close()
+	return parseARMVariant(f)
+}
+
+// parseARMVariant returns the arm variant from the "CPU architecture" field of
+// the contents of /proc/cpuinfo.
+func parseARMVariant(r io.Reader) string {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "CPU architecture" {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		n, err := strconv.Atoi(v)
+		switch {
+		case v == "AArch64" || err == nil && n >= 7:
+			return "v7"
+		case err == nil && n >= 5:
+			return "v" + v
+		default:
+			return ""
+		}
+	}
+	return ""
 }
 
 func getEnvOrDefault(env, absent string) string {
@@ -17,16 +17,18 @@ package installation
 import (
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"sigs.k8s.io/krew/internal/testutil"
 	"sigs.k8s.io/krew/pkg/index"
 )
 
 func Test_osArch(t *testing.T) {
-	in := OSArchPair{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	in := OSArchPair{OS: runtime.GOOS, Arch: runtime.GOARCH, Variant: archVariant(), Libc: detectLibc()}
 
 	if diff := cmp.Diff(in, OSArch()); diff != "" {
 		t.Errorf("os/arch got a different result:\n%s", diff)
@@ -47,13 +49,13 @@ func Test_osArch_override(t *testing.T) {
 	}
 }
 
-func Test_matchPlatform(t *testing.T) {
+func TestMatchPlatformForPair(t *testing.T) {
 	target := OSArchPair{OS: "foo", Arch: "amd64"}
 	matchingPlatform := testutil.NewPlatform().WithOSArch(target.OS, target.Arch).V()
 	differentOS := testutil.NewPlatform().WithOSArch("other", target.Arch).V()
 	differentArch := testutil.NewPlatform().WithOSArch(target.OS, "other").V()
 
-	p, ok, err := matchPlatform([]index.Platform{differentOS, differentArch, matchingPlatform}, target)
+	p, ok, err := MatchPlatformForPair([]index.Platform{differentOS, differentArch, matchingPlatform}, target)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -64,7 +66,7 @@ func Test_matchPlatform(t *testing.T) {
 		t.Fatalf("got a different object from the matching platform:\n%s", diff)
 	}
 
-	_, ok, err = matchPlatform([]index.Platform{differentOS, differentArch}, target)
+	_, ok, err = MatchPlatformForPair([]index.Platform{differentOS, differentArch}, target)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -72,3 +74,237 @@ func Test_matchPlatform(t *testing.T) {
 		t.Fatal("got a matching platform, but was not expecting")
 	}
 }
+
+func TestMatchPlatformFor(t *testing.T) {
+	linuxAMD64 := testutil.NewPlatform().WithOSArch("linux", "amd64").V()
+	linuxARM64 := testutil.NewPlatform().WithOSArch("linux", "arm64").V()
+	darwin := testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"os": "darwin"}}).V()
+	windowsAMD64 := testutil.NewPlatform().WithOSArch("windows", "amd64").V()
+	linuxARMv7 := testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"os": "linux", "arch": "arm", "variant": "v7"}}).V()
+	platforms := []index.Platform{linuxAMD64, linuxARM64, darwin, windowsAMD64, linuxARMv7}
+
+	tests := []struct {
+		os, arch string
+		want     *index.Platform
+	}{
+		{"linux", "amd64", &linuxAMD64},
+		{"linux", "arm64", &linuxARM64},
+		{"linux", "arm", nil},
+		{"linux", "386", nil},
+		{"darwin", "amd64", &darwin},
+		{"darwin", "arm64", &darwin},
+		{"windows", "amd64", &windowsAMD64},
+		{"windows", "386", nil},
+		{"freebsd", "amd64", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.os+"/"+tt.arch, func(t *testing.T) {
+			got, ok, err := MatchPlatformFor(platforms, tt.os, tt.arch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (tt.want != nil) {
+				t.Fatalf("MatchPlatformFor() matched=%v, expected match=%v", ok, tt.want != nil)
+			}
+			if tt.want != nil {
+				if diff := cmp.Diff(*tt.want, got); diff != "" {
+					t.Errorf("MatchPlatformFor() returned a different platform:\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchPlatformForPair_variantAndLibc(t *testing.T) {
+	linuxARMv6 := testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"os": "linux", "arch": "arm", "variant": "v6"}}).V()
+	linuxARMv7 := testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"os": "linux", "arch": "arm", "variant": "v7"}}).V()
+	linuxMusl := testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"os": "linux", "arch": "amd64", "libc": "musl"}}).V()
+	platforms := []index.Platform{linuxARMv6, linuxARMv7, linuxMusl}
+
+	tests := []struct {
+		env  OSArchPair
+		want *index.Platform
+	}{
+		{OSArchPair{OS: "linux", Arch: "arm", Variant: "v6"}, &linuxARMv6},
+		{OSArchPair{OS: "linux", Arch: "arm", Variant: "v7"}, &linuxARMv7},
+		{OSArchPair{OS: "linux", Arch: "arm"}, nil},
+		{OSArchPair{OS: "linux", Arch: "amd64", Libc: "musl"}, &linuxMusl},
+		{OSArchPair{OS: "linux", Arch: "amd64", Libc: "glibc"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env.String()+"/"+tt.env.Libc, func(t *testing.T) {
+			got, ok, err := MatchPlatformForPair(platforms, tt.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (tt.want != nil) {
+				t.Fatalf("MatchPlatformForPair() matched=%v, expected match=%v", ok, tt.want != nil)
+			}
+			if tt.want != nil {
+				if diff := cmp.Diff(*tt.want, got); diff != "" {
+					t.Errorf("MatchPlatformForPair() returned a different platform:\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchPlatformFor_ignoresEnvironment(t *testing.T) {
+	os.Setenv("KREW_OS", "windows")
+	defer os.Unsetenv("KREW_OS")
+	linux := testutil.NewPlatform().WithOSArch("linux", "amd64").V()
+
+	if _, ok, err := MatchPlatformFor([]index.Platform{linux}, "linux", "amd64"); err != nil || !ok {
+		t.Errorf("expected a match regardless of KREW_OS, ok=%v err=%v", ok, err)
+	}
+}
+
+func Test_osArch_variantOverride(t *testing.T) {
+	os.Setenv("KREW_ARCH_VARIANT", "v6")
+	defer os.Unsetenv("KREW_ARCH_VARIANT")
+
+	if got := OSArch().Variant; got != "v6" {
+		t.Errorf("variant override = %q, want %q", got, "v6")
+	}
+}
+
+func Test_matchPlatform_variant(t *testing.T) {
+	withVariant := func(variant string) index.Platform {
+		return testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{"os": "linux", "arch": "arm", "variant": variant},
+		}).V()
+	}
+	generic := testutil.NewPlatform().WithOSArch("linux", "arm").V()
+	armv6, armv7 := withVariant("v6"), withVariant("v7")
+
+	tests := []struct {
+		name      string
+		platforms []index.Platform
+		variant   string
+		want      index.Platform
+	}{
+		{name: "variant is preferred over earlier generic", platforms: []index.Platform{generic, armv6, armv7}, variant: "v7", want: armv7},
+		{name: "falls back to generic", platforms: []index.Platform{armv6, generic}, variant: "v7", want: generic},
+		{name: "unknown variant matches generic", platforms: []index.Platform{armv6, armv7, generic}, variant: "", want: generic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := MatchPlatformForPair(tt.platforms, OSArchPair{OS: "linux", Arch: "arm", Variant: tt.variant})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("failed to find a match")
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("got a different platform:\n%s", diff)
+			}
+		})
+	}
+
+	if _, ok, _ := MatchPlatformForPair([]index.Platform{armv6}, OSArchPair{OS: "linux", Arch: "arm", Variant: "v7"}); ok {
+		t.Error("got a matching platform for a different variant")
+	}
+}
+
+func Test_osArch_libcOverride(t *testing.T) {
+	os.Setenv("KREW_LIBC", "musl")
+	defer os.Unsetenv("KREW_LIBC")
+
+	if got := OSArch().Libc; got != "musl" {
+		t.Errorf("libc override = %q, want %q", got, "musl")
+	}
+}
+
+func Test_matchPlatform_libc(t *testing.T) {
+	withLibc := func(libc string) index.Platform {
+		return testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{"os": "linux", "libc": libc},
+		}).V()
+	}
+	generic := testutil.NewPlatform().WithOSArch("linux", "amd64").V()
+	glibc, musl := withLibc("glibc"), withLibc("musl")
+
+	tests := []struct {
+		name      string
+		platforms []index.Platform
+		libc      string
+		want      index.Platform
+	}{
+		{name: "libc is preferred over earlier generic", platforms: []index.Platform{generic, glibc, musl}, libc: "musl", want: musl},
+		{name: "falls back to generic", platforms: []index.Platform{glibc, generic}, libc: "musl", want: generic},
+		{name: "no constraint is unchanged", platforms: []index.Platform{generic}, libc: "glibc", want: generic},
+		{name: "unknown libc matches generic", platforms: []index.Platform{glibc, musl, generic}, libc: "", want: generic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := MatchPlatformForPair(tt.platforms, OSArchPair{OS: "linux", Arch: "amd64", Libc: tt.libc})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("failed to find a match")
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("got a different platform:\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseARMVariant(t *testing.T) {
+	tests := []struct {
+		cpuinfo string
+		want    string
+	}{
+		{cpuinfo: "processor\t: 0\nCPU architecture: 7\nCPU variant\t: 0x0\n", want: "v7"},
+		{cpuinfo: "CPU architecture: 6\n", want: "v6"},
+		{cpuinfo: "CPU architecture: 8\n", want: "v7"},
+		{cpuinfo: "CPU architecture: AArch64\n", want: "v7"},
+		{cpuinfo: "CPU architecture: 4\n", want: ""},
+		{cpuinfo: "processor\t: 0\n", want: ""},
+	}
+	for _, tt := range tests {
+		if got := parseARMVariant(strings.NewReader(tt.cpuinfo)); got != tt.want {
+			t.Errorf("parseARMVariant(%q) = %q, want %q", tt.cpuinfo, got, tt.want)
+		}
+	}
+}
+
+func Test_supportedPlatforms(t *testing.T) {
+	platforms := []index.Platform{
+		testutil.NewPlatform().WithOSArch("linux", "amd64").V(),
+		testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "os",
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   []string{"darwin", "windows"},
+			}},
+		}).V(),
+		testutil.NewPlatform().WithSelector(nil).V(),
+		testutil.NewPlatform().WithSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{"os": "linux", "arch": "arm", "variant": "v7"},
+		}).V(),
+	}
+	want := []string{"linux/amd64", "darwin/*", "windows/*", "*/*", "linux/arm/v7"}
+	if diff := cmp.Diff(want, supportedPlatforms(platforms)); diff != "" {
+		t.Errorf("supportedPlatforms() mismatch:\n%s", diff)
+	}
+}
+
+func TestErrNoMatchingPlatform_Error(t *testing.T) {
+	err := &ErrNoMatchingPlatform{
+		Plugin:    "foo",
+		OSArch:    OSArchPair{OS: "darwin", Arch: "arm64"},
+		Supported: []string{"linux/amd64", "windows/amd64"},
+	}
+	want := `plugin "foo" does not offer installation for this platform (darwin/arm64), it supports: linux/amd64, windows/amd64`
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
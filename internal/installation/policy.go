@@ -0,0 +1,119 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrPluginDenied is returned when the install policy does not allow
+// installing a plugin.
+var ErrPluginDenied = errors.New("plugin is not allowed by the install policy")
+
+// policyFileEnv is the environment variable with the path of the install
+// policy file.
+const policyFileEnv = "KREW_POLICY_FILE"
+
+// Policy restricts which plugins can be installed, e.g. by the administrators
+// of a managed environment. It is read from the YAML file at the path in the
+// KREW_POLICY_FILE environment variable:
+//
+//	allow:
+//	- ctx
+//	- "view-*"
+//	deny:
+//	- view-secret
+//
+// The rules are patterns matched against plugin names, with the syntax of
+// path.Match. A plugin matching a deny rule cannot be installed. If there are
+// allow rules, only the plugins matching one of them and no deny rule can be
+// installed.
+type Policy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// LoadPolicy reads the install policy from the file at the path in the
+// KREW_POLICY_FILE environment variable. It returns nil, which allows
+// installing any plugin, if the variable is not set or the file does not
+// exist.
+func LoadPolicy() (*Policy, error) {
+	file := os.Getenv(policyFileEnv)
+	if file == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		klog.V(1).Infof("Install policy file %q does not exist, not restricting the plugins to install", file)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read install policy file %q", file)
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(b, &policy); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse install policy file %q", file)
+	}
+	for _, pattern := range append(policy.Allow, policy.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %q in install policy file %q", pattern, file)
+		}
+	}
+	return &policy, nil
+}
+
+// Check returns an error wrapping ErrPluginDenied, naming the rule that
+// denies it, if the policy does not allow installing the plugin. Deny rules
+// take precedence over allow rules.
+func (p *Policy) Check(name string) error {
+	if p == nil {
+		return nil
+	}
+	if rule, ok := matchRule(p.Deny, name); ok {
+		return errors.Wrapf(ErrPluginDenied, "plugin %q matches deny rule %q", name, rule)
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	if _, ok := matchRule(p.Allow, name); !ok {
+		return errors.Wrapf(ErrPluginDenied, "plugin %q does not match any allow rule", name)
+	}
+	return nil
+}
+
+// matchRule returns the first of the rules that matches the plugin name.
+func matchRule(rules []string, name string) (string, bool) {
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule, name); ok {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+// checkInstallPolicy checks that the install policy allows installing the
+// plugin.
+func checkInstallPolicy(name string) error {
+	policy, err := LoadPolicy()
+	if err != nil {
+		return err
+	}
+	return policy.Check(name)
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *Policy
+		plugin    string
+		wantAllow bool
+		wantRule  string
+	}{
+		{name: "no policy", policy: nil, plugin: "foo", wantAllow: true},
+		{name: "empty policy", policy: &Policy{}, plugin: "foo", wantAllow: true},
+		{name: "allowed by name", policy: &Policy{Allow: []string{"bar", "foo"}}, plugin: "foo", wantAllow: true},
+		{name: "allowed by pattern", policy: &Policy{Allow: []string{"view-*"}}, plugin: "view-secret", wantAllow: true},
+		{name: "not in allowlist", policy: &Policy{Allow: []string{"view-*"}}, plugin: "foo", wantAllow: false},
+		{name: "denied by name", policy: &Policy{Deny: []string{"foo"}}, plugin: "foo", wantAllow: false, wantRule: `"foo"`},
+		{name: "denied by pattern", policy: &Policy{Deny: []string{"f*"}}, plugin: "foo", wantAllow: false, wantRule: `"f*"`},
+		{name: "not in denylist", policy: &Policy{Deny: []string{"bar"}}, plugin: "foo", wantAllow: true},
+		{name: "deny takes precedence", policy: &Policy{Allow: []string{"view-*"}, Deny: []string{"view-secret"}}, plugin: "view-secret", wantAllow: false, wantRule: `"view-secret"`},
+		{name: "allowed next to denied", policy: &Policy{Allow: []string{"view-*"}, Deny: []string{"view-secret"}}, plugin: "view-utilization", wantAllow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.plugin)
+			if (err == nil) != tt.wantAllow {
+				t.Fatalf("Check(%q) error = %v, want allowed=%v", tt.plugin, err, tt.wantAllow)
+			}
+			if err == nil {
+				return
+			}
+			if errors.Cause(err) != ErrPluginDenied {
+				t.Errorf("Check(%q) error = %v, want it to wrap ErrPluginDenied", tt.plugin, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantRule) {
+				t.Errorf("Check(%q) error = %v, want it to name the rule %s", tt.plugin, err, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	defer os.Unsetenv(policyFileEnv)
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("policy.yaml", []byte("allow:\n- foo\ndeny:\n- \"b*\"\n"))
+	tmpDir.Write("invalid-rule.yaml", []byte("deny:\n- \"[\"\n"))
+	tmpDir.Write("unknown-field.yaml", []byte("allowed:\n- foo\n"))
+
+	tests := []struct {
+		name       string
+		file       string
+		wantPolicy *Policy
+		wantErr    bool
+	}{
+		{name: "not configured", file: ""},
+		{name: "file does not exist", file: tmpDir.Path("missing.yaml")},
+		{name: "valid", file: tmpDir.Path("policy.yaml"), wantPolicy: &Policy{Allow: []string{"foo"}, Deny: []string{"b*"}}},
+		{name: "invalid rule", file: tmpDir.Path("invalid-rule.yaml"), wantErr: true},
+		{name: "unknown field", file: tmpDir.Path("unknown-field.yaml"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(policyFileEnv, tt.file)
+			policy, err := LoadPolicy()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantPolicy, policy); diff != "" {
+				t.Errorf("LoadPolicy() differs: %s", diff)
+			}
+		})
+	}
+}
+
+func TestInstall_policy(t *testing.T) {
+	defer os.Unsetenv(policyFileEnv)
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("policy.yaml", []byte("allow:\n- foo\n- bar\ndeny:\n- bar\n"))
+	os.Setenv(policyFileEnv, tmpDir.Path("policy.yaml"))
+
+	p := newTestPaths(t)
+	writeIndexPlugins(t, p, newTestPlugin("bar"))
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	for _, name := range []string{"baz", "bar"} {
+		if err := Install(p, newTestPlugin(name), constants.DefaultIndexName, opts); errors.Cause(err) != ErrPluginDenied {
+			t.Errorf("Install(%s) error = %v, want ErrPluginDenied", name, err)
+		}
+		if isInstalled(p, name) {
+			t.Errorf("expected denied plugin %q not to be installed", name)
+		}
+	}
+	if err := Install(p, newTestPlugin("foo", "bar"), constants.DefaultIndexName, opts); errors.Cause(err) != ErrPluginDenied {
+		t.Errorf("Install() of a plugin with a denied dependency error = %v, want ErrPluginDenied", err)
+	}
+	if err := Install(p, newTestPlugin("foo"), constants.DefaultIndexName, opts); err != nil {
+		t.Errorf("Install() of an allowed plugin failed: %v", err)
+	}
+}
+
+func TestReinstallAndUpgrade_policy(t *testing.T) {
+	defer os.Unsetenv(policyFileEnv)
+	tmpDir := testutil.NewTempDir(t)
+	tmpDir.Write("policy.yaml", []byte("deny:\n- foo\n"))
+
+	p := newTestPaths(t)
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	installed := newTestPlugin("foo")
+	if err := Install(p, installed, constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(policyFileEnv, tmpDir.Path("policy.yaml"))
+
+	newVersion := newTestPlugin("foo")
+	newVersion.Spec.Version = "v2.0.0"
+	if err := Upgrade(p, newVersion, constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); errors.Cause(err) != ErrPluginDenied {
+		t.Errorf("Upgrade() error = %v, want ErrPluginDenied", err)
+	}
+	if err := Reinstall(p, installed, opts); errors.Cause(err) != ErrPluginDenied {
+		t.Errorf("Reinstall() error = %v, want ErrPluginDenied", err)
+	}
+	if err := Reinstall(p, newTestPlugin("bar"), opts); err != nil {
+		t.Errorf("Reinstall() of an allowed plugin failed: %v", err)
+	}
+	tmpDir.Write("policy.yaml", []byte("deny:\n- bar\n"))
+	if err := Uninstall(p, "bar", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reinstall(p, newTestPlugin("bar"), opts); errors.Cause(err) != ErrPluginDenied {
+		t.Errorf("Reinstall() of a denied plugin that is not installed error = %v, want ErrPluginDenied", err)
+	}
+	if isInstalled(p, "bar") {
+		t.Error("denied plugin was installed by Reinstall()")
+	}
+
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatalf("denied plugin was removed: %v", err)
+	}
+	if r.Spec.Version != installed.Spec.Version {
+		t.Errorf("denied plugin was upgraded to version %s", r.Spec.Version)
+	}
+}
+
+func TestReinstallAndUpgrade_manifestSHA256(t *testing.T) {
+	p := newTestPaths(t)
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	plugin := newTestPlugin("foo")
+	if err := Install(p, plugin, constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.ManifestSHA256 = strings.Repeat("ab", 32)
+	plugin.ManifestSHA256 = strings.Repeat("cd", 32)
+	if err := Reinstall(p, plugin, opts); errors.Cause(err) != ErrManifestMismatch {
+		t.Errorf("Reinstall() error = %v, want ErrManifestMismatch", err)
+	}
+	plugin.Spec.Version = "v2.0.0"
+	if err := Upgrade(p, plugin, constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); errors.Cause(err) != ErrManifestMismatch {
+		t.Errorf("Upgrade() error = %v, want ErrManifestMismatch", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// Preview downloads the plugin archive for this platform into a temporary
+// directory and applies the file operations of the plugin without installing
+// it. It returns the slash-separated paths of the files that would be
+// installed, relative to the installation directory, and the path of the
+// plugin executable among them.
+func Preview(plugin index.Plugin, opts InstallOpts) ([]string, string, error) {
+	log := opts.logger()
+	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return nil, "", newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	if err := resolveSha256(context.Background(), &candidate, opts); err != nil {
+		return nil, "", err
+	}
+
+	tmp, err := makeTempDir(opts.TempDir, "krew-preview")
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		log.Debugf("Deleting the preview directory %s", tmp)
+		if err := os.RemoveAll(tmp); err != nil {
+			log.Warningf("failed to clean up preview directory: %s", err)
+		}
+	}()
+
+	extractDir := filepath.Join(tmp, "download")
+	if err := os.Mkdir(extractDir, 0755); err != nil {
+		return nil, "", errors.Wrap(err, "failed to create the download directory")
+	}
+	if _, err := downloadAndExtract(context.Background(), extractDir, candidate, opts); err != nil {
+		return nil, "", errors.Wrap(err, "failed to unpack into staging dir")
+	}
+	applyDefaults(&candidate, log)
+	installDir := filepath.Join(tmp, "install")
+	if err := moveToInstallDir(extractDir, installDir, tmp, candidate.StripComponents, candidate.Files); err != nil {
+		return nil, "", errors.Wrap(err, "failed while moving files to the installation directory")
+	}
+
+	var files []string
+	err = filepath.Walk(installDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(installDir, path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get relative path of %q", path)
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to list the files to install")
+	}
+
+	bin := filepath.ToSlash(filepath.Clean(filepath.FromSlash(candidate.Bin)))
+	for _, f := range files {
+		if f == bin {
+			return files, bin, nil
+		}
+	}
+	return nil, "", errors.Errorf("plugin executable %q cannot be found in the files to install", candidate.Bin)
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func TestPreview(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+
+	files, bin, err := Preview(plugin, InstallOpts{ArchiveFileOverride: testArchivePath(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"foo"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Preview() files = %v, want %v", files, want)
+	}
+	if bin != "foo" {
+		t.Errorf("Preview() bin = %q, want %q", bin, "foo")
+	}
+	if plugins, err := GetInstalledPluginReceipts(p.InstallReceiptsPath()); err != nil || len(plugins) != 0 {
+		t.Errorf("expected no plugins to be installed, got %v (err=%v)", plugins, err)
+	}
+}
+
+func TestPreview_binNotInstalled(t *testing.T) {
+	platform := newTestArchivePlatform().WithFiles([]index.FileOperation{{From: "foo", To: "bar"}}).V()
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(platform).V()
+	if _, _, err := Preview(plugin, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err == nil {
+		t.Error("expected error when the plugin executable is not installed")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/pathutil"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// PruneVersions removes the versions of the plugin on disk except for the
+// currently linked version and the keep most recent other versions, along with
+// their versioned aliases in the bin directory. The removed versions are no
+// longer retained for rolling back. It returns the removed versions, from the
+// newest to the oldest. The log messages are written to log, or to klog if it
+// is nil.
+func PruneVersions(p environment.Paths, name string, keep int, log Logger) ([]string, error) {
+	if keep < 0 {
+		return nil, errors.Errorf("the number of versions to keep cannot be negative, got %d", keep)
+	}
+	log = loggerOrDefault(log)
+	unlock, err := acquireLock(context.Background(), p, log)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	versions, err := InstalledVersions(p, name)
+	if err != nil {
+		return nil, err
+	}
+	var r *index.Receipt
+	if installed, err := receipt.Load(p.PluginInstallReceiptPath(name)); err == nil {
+		r = &installed
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to look up the current version of plugin %q", name)
+	}
+	current, err := currentVersions(p, name, r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up the current version of plugin %q", name)
+	}
+
+	var pruned []string
+	for _, v := range versions {
+		if current[v] {
+			log.Debugf("Keeping current version %s of plugin %s", v, name)
+			continue
+		}
+		if keep > 0 {
+			log.Debugf("Keeping previous version %s of plugin %s", v, name)
+			keep--
+			continue
+		}
+		pruned = append(pruned, v)
+	}
+	if r != nil {
+		if err := dropRetainedVersions(p, *r, pruned, log); err != nil {
+			return nil, err
+		}
+	}
+
+	var removed []string
+	for _, v := range pruned {
+		path := p.PluginVersionInstallPath(name, v)
+		log.Infof("Deleting version %s of plugin %s at %q", v, name, path)
+		if err := removeAll(path); err != nil {
+			return removed, errors.Wrapf(err, "could not remove version %s of plugin %q", v, name)
+		}
+		var status *index.InstallStatus
+		if r != nil {
+			status = installStatusOf(*r, v)
+		}
+		if err := removeVersionedAlias(p.BinPath(), name, v, status, log); err != nil {
+			return removed, errors.Wrapf(err, "could not remove the versioned alias of version %s of plugin %q", v, name)
+		}
+		removed = append(removed, v)
+	}
+	return removed, nil
+}
+
+// dropRetainedVersions stores the receipt r without the given versions in its
+// retained versions, so that they are not rolled back to after they are
+// removed from disk.
+func dropRetainedVersions(p environment.Paths, r index.Receipt, versions []string, log Logger) error {
+	drop := make(map[string]bool)
+	for _, v := range versions {
+		drop[v] = true
+	}
+	var retained []index.RetainedVersion
+	for _, v := range r.Status.RetainedVersions {
+		if drop[v.Spec.Version] {
+			log.Debugf("Version %s of plugin %s is no longer retained", v.Spec.Version, r.Name)
+			continue
+		}
+		retained = append(retained, v)
+	}
+	if len(retained) == len(r.Status.RetainedVersions) {
+		return nil
+	}
+	r.Status.RetainedVersions = retained
+	return errors.Wrapf(receipt.Store(r, p.PluginInstallReceiptPath(r.Name)),
+		"failed to update the retained versions of plugin %q", r.Name)
+}
+
+// currentVersions returns the versions of the plugin that are in use, which
+// are the version in its install receipt and the version directory its
+// symbolic link points into. r is the install receipt of the plugin, or nil
+// if it is not installed.
+func currentVersions(p environment.Paths, name string, r *index.Receipt) (map[string]bool, error) {
+	out := make(map[string]bool)
+	if r != nil {
+		out[r.Spec.Version] = true
+	}
+
+	link := filepath.Join(p.BinPath(), BinaryNameForPlugin(name))
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return out, nil
+	}
+	target, err := os.Readlink(link)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read link %q", link)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(p.BinPath(), target)
+	}
+	if rel, ok := pathutil.IsSubPath(p.PluginInstallPath(name), filepath.Clean(target)); ok && rel != "." {
+		out[strings.SplitN(rel, string(filepath.Separator), 2)[0]] = true
+	}
+	return out, nil
+}
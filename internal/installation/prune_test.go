@@ -0,0 +1,219 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func TestPruneVersions(t *testing.T) {
+	versions := []string{"v0.1.0", "v0.2.0", "v0.3.0", "v0.4.0", "v0.5.0"}
+	tests := []struct {
+		name           string
+		keep           int
+		receiptVersion string
+		linkVersion    string
+		relativeLink   bool
+		wantRemoved    []string
+		wantErr        bool
+	}{
+		{
+			name:           "keeps receipt version only",
+			keep:           0,
+			receiptVersion: "v0.3.0",
+			wantRemoved:    []string{"v0.5.0", "v0.4.0", "v0.2.0", "v0.1.0"},
+		},
+		{
+			name:           "keeps receipt version and the most recent other",
+			keep:           1,
+			receiptVersion: "v0.3.0",
+			wantRemoved:    []string{"v0.4.0", "v0.2.0", "v0.1.0"},
+		},
+		{
+			name:           "keeps linked version",
+			keep:           1,
+			receiptVersion: "v0.3.0",
+			linkVersion:    "v0.1.0",
+			wantRemoved:    []string{"v0.4.0", "v0.2.0"},
+		},
+		{
+			name:         "keeps relatively linked version without receipt",
+			keep:         0,
+			linkVersion:  "v0.2.0",
+			relativeLink: true,
+			wantRemoved:  []string{"v0.5.0", "v0.4.0", "v0.3.0", "v0.1.0"},
+		},
+		{
+			name:           "keep exceeds the versions",
+			keep:           10,
+			receiptVersion: "v0.5.0",
+		},
+		{
+			name:    "negative keep",
+			keep:    -1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			for _, v := range versions {
+				if err := os.MkdirAll(p.PluginVersionInstallPath("foo", v), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.receiptVersion != "" {
+				plugin := testutil.NewPlugin().WithName("foo").WithVersion(tt.receiptVersion).V()
+				if err := receipt.Store(receipt.New(plugin, constants.DefaultIndexName), p.PluginInstallReceiptPath("foo")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.linkVersion != "" {
+				createTestVersionLink(t, p, "foo", tt.linkVersion, tt.relativeLink)
+			}
+
+			removed, err := PruneVersions(p, "foo", tt.keep, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PruneVersions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantRemoved, removed); diff != "" {
+				t.Errorf("removed versions differ: %s", diff)
+			}
+			for _, v := range versions {
+				_, err := os.Stat(p.PluginVersionInstallPath("foo", v))
+				wasRemoved := false
+				for _, r := range removed {
+					wasRemoved = wasRemoved || r == v
+				}
+				if wasRemoved != os.IsNotExist(err) {
+					t.Errorf("version %s: removed=%v, but stat error is %v", v, wasRemoved, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneVersions_notInstalled(t *testing.T) {
+	removed, err := PruneVersions(newTestPaths(t), "foo", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("expected no removed versions, got %v", removed)
+	}
+}
+
+func TestPruneVersions_versionedAlias(t *testing.T) {
+	p := newTestPaths(t)
+	for _, v := range []string{"v0.1.0", "v0.2.0"} {
+		if err := os.MkdirAll(p.PluginVersionInstallPath("foo", v), 0755); err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(p.PluginVersionInstallPath("foo", v), "foo")
+		if err := os.Symlink(target, filepath.Join(p.BinPath(), VersionedBinaryNameForPlugin("foo", v))); err != nil {
+			t.Skipf("cannot create symbolic links: %v", err)
+		}
+	}
+	plugin := testutil.NewPlugin().WithName("foo").WithVersion("v0.2.0").V()
+	if err := receipt.Store(receipt.New(plugin, constants.DefaultIndexName), p.PluginInstallReceiptPath("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PruneVersions(p, "foo", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), VersionedBinaryNameForPlugin("foo", "v0.1.0"))); !os.IsNotExist(err) {
+		t.Errorf("expected the alias of the pruned version to be removed, got err=%v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), VersionedBinaryNameForPlugin("foo", "v0.2.0"))); err != nil {
+		t.Errorf("expected the alias of the current version to be kept, got err=%v", err)
+	}
+}
+
+func TestPruneVersions_retainedVersions(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	if err := Install(p, newPlugin("v1.0.0"), constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v2.0.0", "v3.0.0"} {
+		if err := Upgrade(p, newPlugin(version), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts, RetainVersions: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	retainedVersions := func() []string {
+		t.Helper()
+		r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, v := range r.Status.RetainedVersions {
+			out = append(out, v.Spec.Version)
+		}
+		return out
+	}
+
+	removed, err := PruneVersions(p, "foo", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"v1.0.0"}, removed); diff != "" {
+		t.Errorf("removed versions differ: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"v2.0.0"}, retainedVersions()); diff != "" {
+		t.Errorf("retained versions after pruning differ: %s", diff)
+	}
+
+	if err := Rollback(p, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := retainedVersions(); len(got) != 0 {
+		t.Errorf("expected no retained versions after rolling back, got %v", got)
+	}
+	if err := Rollback(p, "foo", nil); err == nil || !strings.Contains(err.Error(), "no previous version") {
+		t.Errorf("expected error that there is no previous version, got: %v", err)
+	}
+}
+
+// createTestVersionLink links the executable of the plugin to the given
+// version directory.
+func createTestVersionLink(t *testing.T, p environment.Paths, name, version string, relative bool) {
+	t.Helper()
+	target := filepath.Join(p.PluginVersionInstallPath(name, version), name)
+	if relative {
+		var err error
+		if target, err = filepath.Rel(p.BinPath(), target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(target, filepath.Join(p.BinPath(), BinaryNameForPlugin(name))); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+}
@@ -16,6 +16,8 @@ package receipt
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
@@ -26,14 +28,34 @@ import (
 
 // Store saves the given receipt at the destination.
 // The caller has to ensure that the destination directory exists.
+// The receipt is written to a temporary file that is renamed to the
+// destination, so an interrupted write never leaves a truncated receipt.
 func Store(receipt index.Receipt, dest string) error {
 	yamlBytes, err := yaml.Marshal(receipt)
 	if err != nil {
 		return errors.Wrapf(err, "convert to yaml")
 	}
 
-	err = ioutil.WriteFile(dest, yamlBytes, 0644)
-	return errors.Wrapf(err, "write plugin receipt %q", dest)
+	// The temporary file must not have the receipt extension, so that it is
+	// not picked up as a receipt if it is left behind.
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "create temporary file for plugin receipt %q", dest)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	_, err = f.Write(yamlBytes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "write plugin receipt %q", tmp)
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return errors.Wrapf(err, "set permissions of plugin receipt %q", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, dest), "write plugin receipt %q", dest)
 }
 
 // Load reads the plugin receipt at the specified destination.
@@ -15,14 +15,19 @@
 package receipt
 
 import (
+	"io/ioutil"
 	"os"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"sigs.k8s.io/krew/internal/index/indexscanner"
 	"sigs.k8s.io/krew/internal/testutil"
 	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
 )
 
 func TestStore(t *testing.T) {
@@ -30,6 +35,11 @@ func TestStore(t *testing.T) {
 
 	testPlugin := testutil.NewPlugin().WithName("some-plugin").WithPlatforms(testutil.NewPlatform().V()).V()
 	testReceipt := testutil.NewReceipt().WithPlugin(testPlugin).V()
+	testReceipt.Status.Install = &index.InstallStatus{
+		URI:              "https://example.com/foo.tar.gz",
+		Size:             1024,
+		DownloadDuration: metav1.Duration{Duration: 1500 * time.Millisecond},
+	}
 	dest := tmpDir.Path("some-plugin.yaml")
 
 	if err := Store(testReceipt, dest); err != nil {
@@ -46,6 +56,52 @@ func TestStore(t *testing.T) {
 	}
 }
 
+func TestStore_interruptedWrite(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	dest := tmpDir.Path("foo.yaml")
+
+	old := testutil.NewReceipt().WithPlugin(testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").V()).V()
+	if err := Store(old, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a Store that was interrupted after writing part of the new
+	// receipt to the temporary file, before renaming it
+	tmpDir.Write(".foo.yaml.123.tmp", []byte("apiVersion: krew.googlecontainertools.github.com/v1alpha2\nkind: Plu"))
+
+	actual, err := Load(dest)
+	if err != nil {
+		t.Fatalf("receipt could not be loaded after an interrupted write: %v", err)
+	}
+	if actual.Spec.Version != "v1.0.0" {
+		t.Errorf("expected the previous receipt, got version %s", actual.Spec.Version)
+	}
+
+	updated := testutil.NewReceipt().WithPlugin(testutil.NewPlugin().WithName("foo").WithVersion("v2.0.0").V()).V()
+	if err := Store(updated, dest); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err = Load(dest); err != nil {
+		t.Fatal(err)
+	} else if actual.Spec.Version != "v2.0.0" {
+		t.Errorf("expected the updated receipt, got version %s", actual.Spec.Version)
+	}
+	fi, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0644 {
+		t.Errorf("receipt has mode %v, expected %v", fi.Mode().Perm(), os.FileMode(0644))
+	}
+	files, err := ioutil.ReadDir(tmpDir.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected only the receipt and the simulated leftover temporary file, got %d files", len(files))
+	}
+}
+
 func TestLoad(t *testing.T) {
 	tmpDir := testutil.NewTempDir(t)
 
@@ -64,6 +120,20 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoad_withoutInstallStatus(t *testing.T) {
+	tmpDir := testutil.NewTempDir(t)
+	testPlugin := testutil.NewPlugin().WithName("foo").WithPlatforms(testutil.NewPlatform().V()).V()
+	tmpDir.WriteYAML("foo.yaml", testutil.NewReceipt().WithPlugin(testPlugin).V())
+
+	got, err := Load(tmpDir.Path("foo.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Install != nil {
+		t.Fatalf("expected no install status, got %+v", got.Status.Install)
+	}
+}
+
 func TestLoad_preservesNonExistsError(t *testing.T) {
 	_, err := Load("non-existing.yaml")
 	if !os.IsNotExist(err) {
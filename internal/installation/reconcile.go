@@ -0,0 +1,95 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+)
+
+// RepairKind describes how Reconcile handled a dangling symlink.
+type RepairKind string
+
+const (
+	// RepairRemovedLink means the symlink did not belong to an installed
+	// plugin and was removed.
+	RepairRemovedLink RepairKind = "RemovedLink"
+
+	// RepairReinstallPlugin means the plugin has an install receipt, but its
+	// installation directory is missing. The plugin needs to be reinstalled.
+	RepairReinstallPlugin RepairKind = "ReinstallPlugin"
+)
+
+// RepairAction is a problem found (and possibly fixed) by Reconcile.
+type RepairAction struct {
+	Kind   RepairKind
+	Plugin string
+	Link   string
+}
+
+// Reconcile finds the plugin symlinks in the bin directory whose targets no
+// longer exist. Symlinks of plugins without an install receipt are removed,
+// while plugins with a receipt are reported to be reinstalled.
+func Reconcile(p environment.Paths) ([]RepairAction, error) {
+	entries, err := ioutil.ReadDir(p.BinPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read bin directory %q", p.BinPath())
+	}
+
+	var actions []RepairAction
+	for _, e := range entries {
+		if e.Mode()&os.ModeSymlink == 0 || !strings.HasPrefix(e.Name(), "kubectl-") {
+			continue
+		}
+		link := filepath.Join(p.BinPath(), e.Name())
+		if _, err := os.Stat(link); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return actions, errors.Wrapf(err, "failed to resolve symlink %q", link)
+		}
+
+		name := binToPluginName(e.Name())
+		klog.V(2).Infof("Found dangling symlink %q of plugin %s", link, name)
+		_, err := receipt.Load(p.PluginInstallReceiptPath(name))
+		if err == nil {
+			actions = append(actions, RepairAction{Kind: RepairReinstallPlugin, Plugin: name, Link: link})
+			continue
+		} else if !os.IsNotExist(err) {
+			return actions, errors.Wrapf(err, "failed to look up receipt of plugin %q", name)
+		}
+		if err := removeLink(link, klogLogger{}); err != nil {
+			return actions, errors.Wrapf(err, "failed to remove orphan symlink of plugin %q", name)
+		}
+		actions = append(actions, RepairAction{Kind: RepairRemovedLink, Plugin: name, Link: link})
+	}
+	return actions, nil
+}
+
+// binToPluginName is the inverse of pluginNameToBin.
+func binToPluginName(bin string) string {
+	name := strings.TrimPrefix(bin, "kubectl-")
+	name = strings.TrimSuffix(name, ".exe")
+	return strings.ReplaceAll(name, "_", "-")
+}
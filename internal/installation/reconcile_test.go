@@ -0,0 +1,99 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+)
+
+func TestReconcile(t *testing.T) {
+	p := newTestPaths(t)
+	link := func(target, name string) string {
+		path := filepath.Join(p.BinPath(), name)
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	missing := filepath.Join(p.InstallPath(), "missing")
+
+	installed := filepath.Join(p.BasePath(), "installed")
+	if err := ioutil.WriteFile(installed, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	healthyLink := link(installed, "kubectl-healthy")
+	reinstallLink := link(missing, "kubectl-foo")
+	orphanLink := link(missing, "kubectl-bar_baz")
+	otherLink := link(missing, "not-a-plugin")
+
+	if err := receipt.Store(testutil.NewReceipt().WithPlugin(testutil.NewPlugin().WithName("foo").V()).V(),
+		p.PluginInstallReceiptPath("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	actions, err := Reconcile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RepairAction{
+		{Kind: RepairRemovedLink, Plugin: "bar-baz", Link: orphanLink},
+		{Kind: RepairReinstallPlugin, Plugin: "foo", Link: reinstallLink},
+	}
+	if diff := cmp.Diff(expected, actions); diff != "" {
+		t.Fatalf("Reconcile() returned unexpected actions (-want +got):\n%s", diff)
+	}
+
+	for _, path := range []string{healthyLink, reinstallLink, otherLink} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("expected symlink %q to be kept, got err=%v", path, err)
+		}
+	}
+	if _, err := os.Lstat(orphanLink); !os.IsNotExist(err) {
+		t.Errorf("expected orphan symlink %q to be removed, got err=%v", orphanLink, err)
+	}
+}
+
+func TestReconcile_noBinDir(t *testing.T) {
+	p := newTestPaths(t)
+	if err := os.RemoveAll(p.BinPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	actions, err := Reconcile(p)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("expected no actions, got %v", actions)
+	}
+}
+
+func Test_binToPluginName(t *testing.T) {
+	for _, name := range []string{"foo", "foo-bar"} {
+		for _, isWindows := range []bool{false, true} {
+			if got := binToPluginName(pluginNameToBin(name, isWindows)); got != name {
+				t.Errorf("binToPluginName(pluginNameToBin(%q, %v)) = %q", name, isWindows, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// Reinstall removes the installation of the plugin, including its link in the
+// bin directory and its receipt, and installs the plugin again. It repairs an
+// installation whose files are corrupted or partially removed, and can be
+// called repeatedly. The plugin is recorded as installed from the index in the
+// existing receipt, or from the default index if there is no readable receipt.
+// Like with Install, nothing is changed if the install policy does not allow
+// the plugin, or if its manifest does not have the expected sha256 sum. The
+// archive of the plugin is downloaded and extracted before the installation is
+// removed, so that it is left as is if the archive cannot be downloaded.
+func Reinstall(p environment.Paths, plugin index.Plugin, opts InstallOpts) error {
+	ctx := context.Background()
+	log := opts.logger()
+	if err := checkAllowed(plugin, opts); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		log.Debugf("Dry-run reinstall of plugin %s", plugin.Name)
+		return dryRunInstall(ctx, plugin, opts)
+	}
+	unlock, err := acquireLock(ctx, p, log)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	opts.emit(plugin.Name, InstallStarted, nil)
+	err = reinstall(ctx, p, plugin, opts)
+	opts.emit(plugin.Name, InstallDone, err)
+	return err
+}
+
+// reinstall stages the archive of the plugin, and then replaces the
+// installation of the plugin with it.
+func reinstall(ctx context.Context, p environment.Paths, plugin index.Plugin, opts InstallOpts) error {
+	log := opts.logger()
+	candidate, ok, err := GetMatchingPlatform(plugin.Spec.Platforms)
+	if err != nil {
+		return errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
+	}
+	if err := resolveSha256(ctx, &candidate, opts); err != nil {
+		return err
+	}
+	staged, err := stageArchive(ctx, installOperation{
+		pluginName: plugin.Name,
+		platform:   candidate,
+		installDir: p.PluginVersionInstallPath(plugin.Name, plugin.Spec.Version),
+		stagingDir: p.StagingPath(),
+	}, opts)
+	if err != nil {
+		return errors.Wrap(err, "install failed")
+	}
+	// the staged archive is removed by the installation, unless it fails
+	// before using it
+	defer os.RemoveAll(staged.dir)
+	opts.staged = staged
+
+	indexName := constants.DefaultIndexName
+	receiptPath := p.PluginInstallReceiptPath(plugin.Name)
+	r, err := receipt.Load(receiptPath)
+	switch {
+	case err == nil:
+		indexName = r.Status.Source.Name
+		link := filepath.Join(p.BinPath(), BinaryNameForPlugin(plugin.Name))
+		log.Debugf("Removing the link of plugin %s at %q", plugin.Name, link)
+		if err := removeInstalledLink(link, installedLinkType(r), log); err != nil {
+			return errors.Wrapf(err, "failed to remove the link of plugin %q", plugin.Name)
+		}
+	case os.IsNotExist(err):
+		log.Debugf("Plugin %s has no receipt, installing it from index %s", plugin.Name, indexName)
+	default:
+		log.Warningf("Ignoring the unreadable receipt of plugin %s: %v", plugin.Name, err)
+	}
+
+	installPath := p.PluginInstallPath(plugin.Name)
+	log.Debugf("Removing the installation directory %q", installPath)
+	if err := removeAll(installPath); err != nil {
+		return errors.Wrapf(err, "could not remove plugin directory %q", installPath)
+	}
+	if err := os.Remove(receiptPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "could not remove plugin receipt %q", receiptPath)
+	}
+	return installContext(ctx, p, plugin, indexName, opts)
+}
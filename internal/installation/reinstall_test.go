@@ -0,0 +1,116 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+func TestReinstall(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed bool
+		breakIt   func(t *testing.T, dir string)
+	}{
+		{
+			name:      "intact installation",
+			installed: true,
+			breakIt:   func(*testing.T, string) {},
+		},
+		{
+			name:      "removed executable",
+			installed: true,
+			breakIt: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "foo")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:      "removed installation directory",
+			installed: true,
+			breakIt: func(t *testing.T, dir string) {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:    "not installed",
+			breakIt: func(*testing.T, string) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			plugin := newTestPlugin("foo")
+			opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+			indexName := constants.DefaultIndexName
+			if tt.installed {
+				indexName = "custom"
+				if err := Install(p, plugin, indexName, opts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.breakIt(t, p.PluginVersionInstallPath("foo", plugin.Spec.Version))
+
+			for i := 0; i < 2; i++ {
+				if err := Reinstall(p, plugin, opts); err != nil {
+					t.Fatalf("Reinstall() #%d error = %v", i+1, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", plugin.Spec.Version), "foo")); err != nil {
+				t.Errorf("expected plugin executable to be installed: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); err != nil {
+				t.Errorf("expected plugin link to be installed: %v", err)
+			}
+			r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Status.Source.Name != indexName {
+				t.Errorf("expected plugin from index %q, got %q", indexName, r.Status.Source.Name)
+			}
+		})
+	}
+}
+
+func TestReinstall_keepsInstallationOnDownloadFailure(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := newTestPlugin("foo")
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := InstallOpts{ArchiveFileOverride: filepath.Join(p.BasePath(), "does-not-exist.tar.gz")}
+	if err := Reinstall(p, plugin, opts); err == nil {
+		t.Fatal("expected error when the archive cannot be read")
+	}
+	if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", plugin.Spec.Version), "foo")); err != nil {
+		t.Errorf("expected plugin executable to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); err != nil {
+		t.Errorf("expected plugin link to be kept: %v", err)
+	}
+	if _, err := receipt.Load(p.PluginInstallReceiptPath("foo")); err != nil {
+		t.Errorf("expected plugin receipt to be kept: %v", err)
+	}
+}
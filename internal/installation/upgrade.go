@@ -15,10 +15,13 @@
 package installation
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/pkg/errors"
-	"k8s.io/klog"
 
 	"sigs.k8s.io/krew/internal/environment"
 	"sigs.k8s.io/krew/internal/installation/receipt"
@@ -27,18 +30,56 @@ import (
 	"sigs.k8s.io/krew/pkg/index"
 )
 
+// UpgradeOpts specifies options for plugin upgrade operation.
+type UpgradeOpts struct {
+	InstallOpts
+
+	// AllowDowngrade allows replacing the installed version with a lower
+	// version.
+	AllowDowngrade bool
+
+	// RetainVersions is the number of previously installed versions kept on
+	// disk, so that the plugin can be rolled back with Rollback.
+	RetainVersions int
+}
+
 // Upgrade will reinstall and delete the old plugin. The operation tries
 // to not get the plugin dir in a bad state if it fails during the process.
-func Upgrade(p environment.Paths, plugin index.Plugin, indexName string) error {
+// If the new version installs the same archive and files as the installed
+// one, and no versions are retained, the installed files are moved to the new
+// version instead of downloading the archive again.
+func Upgrade(p environment.Paths, plugin index.Plugin, indexName string, opts UpgradeOpts) error {
+	opts.emit(plugin.Name, InstallStarted, nil)
+	err := lockedUpgrade(p, plugin, indexName, opts)
+	opts.emit(plugin.Name, InstallDone, err)
+	return err
+}
+
+// lockedUpgrade upgrades the plugin while holding the lock of the krew
+// installation, unless it is a dry-run. Nothing is upgraded if the install
+// policy does not allow the plugin, or if its manifest does not have the
+// expected sha256 sum.
+func lockedUpgrade(p environment.Paths, plugin index.Plugin, indexName string, opts UpgradeOpts) error {
+	if err := checkAllowed(plugin, opts.InstallOpts); err != nil {
+		return err
+	}
+	if !opts.DryRun {
+		unlock, err := acquireLock(context.Background(), p, opts.logger())
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	return upgrade(p, plugin, indexName, opts)
+}
+
+func upgrade(p environment.Paths, plugin index.Plugin, indexName string, opts UpgradeOpts) error {
 	installReceipt, err := receipt.Load(p.PluginInstallReceiptPath(plugin.Name))
 	if err != nil {
 		return errors.Wrapf(err, "failed to load install receipt for plugin %q", plugin.Name)
 	}
-
-	curVersion := installReceipt.Spec.Version
-	curv, err := semver.Parse(curVersion)
-	if err != nil {
-		return errors.Wrapf(err, "failed to parse installed plugin version (%q) as a semver value", curVersion)
+	if src := installReceipt.Status.Source.Name; src != indexName {
+		return errors.Errorf("plugin %q was installed from index %q, cannot upgrade it from index %q", plugin.Name, src, indexName)
 	}
 
 	// Find available installation candidate
@@ -47,44 +88,256 @@ func Upgrade(p environment.Paths, plugin index.Plugin, indexName string) error {
 		return errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
 	}
 	if !ok {
-		return errors.Errorf("plugin %q does not offer installation for this platform (%s)",
-			plugin.Name, OSArch())
-	}
-
-	newVersion := plugin.Spec.Version
-	newv, err := semver.Parse(newVersion)
-	if err != nil {
-		return errors.Wrapf(err, "failed to parse candidate version spec (%q)", newVersion)
+		return newNoMatchingPlatformError(plugin.Name, plugin.Spec.Platforms)
 	}
-	klog.V(2).Infof("Comparing versions: current=%s target=%s", curv, newv)
 
-	// See if it's a newer version
-	if !semver.Less(curv, newv) {
-		klog.V(3).Infof("Plugin does not need upgrade (%s ≥ %s)", curv, newv)
+	log := opts.logger()
+	curVersion, newVersion := installReceipt.Spec.Version, plugin.Spec.Version
+	if !needsUpgrade(curVersion, newVersion, opts.AllowDowngrade, log) {
 		return ErrIsAlreadyUpgraded
 	}
-	klog.V(1).Infof("Plugin needs upgrade (%s < %s)", curv, newv)
+	if err := resolveSha256(context.Background(), &candidate, opts.InstallOpts); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		log.Debugf("Dry-run upgrade of plugin %s", plugin.Name)
+		return dryRunInstall(context.Background(), plugin, opts.InstallOpts)
+	}
+	if err := installDependencies(context.Background(), p, plugin, indexName, opts.InstallOpts); err != nil {
+		return err
+	}
 
 	// Re-Install
-	klog.V(1).Infof("Installing new version %s", newVersion)
-	if err := install(installOperation{
-		pluginName: plugin.Name,
-		platform:   candidate,
+	if installReceipt.Status.Install != nil && installReceipt.Status.Install.VersionedAlias {
+		opts.VersionedAlias = true
+	}
+	if installReceipt.Status.Install != nil && installReceipt.Status.Install.PreserveModes {
+		opts.PreserveModes = true
+	}
+	if installedLinkType(installReceipt) == linkTypeNone {
+		opts.SkipLink = true
+	}
+	var status *index.InstallStatus
+	moved := false
+	if installed, ok, err := GetMatchingPlatform(installReceipt.Spec.Platforms); err == nil && ok && opts.RetainVersions == 0 && sameInstallation(installed, candidate, log) {
+		log.Infof("Version %s installs the same archive and files as version %s, moving the installed files", newVersion, curVersion)
+		if status, moved, err = moveInstalledVersion(p, installReceipt, newVersion, candidate, opts.InstallOpts); err != nil {
+			return errors.Wrap(err, "failed to move the installed version")
+		}
+	}
+	if !moved {
+		log.Infof("Installing new version %s", newVersion)
+		status, err = install(context.Background(), installOperation{
+			pluginName: plugin.Name,
+			platform:   candidate,
 
-		installDir: p.PluginVersionInstallPath(plugin.Name, newVersion),
-		binDir:     p.BinPath(),
-	}, InstallOpts{}); err != nil {
-		return errors.Wrap(err, "failed to install new version")
+			installDir:   p.PluginVersionInstallPath(plugin.Name, newVersion),
+			binDir:       p.BinPath(),
+			version:      newVersion,
+			stagingDir:   p.StagingPath(),
+			prevLinkType: installedLinkType(installReceipt),
+		}, opts.InstallOpts)
+		if err != nil {
+			return errors.Wrap(err, "failed to install new version")
+		}
 	}
 
-	klog.V(2).Infof("Upgrading install receipt for plugin %s", plugin.Name)
-	if err = receipt.Store(receipt.New(plugin, indexName), p.PluginInstallReceiptPath(plugin.Name)); err != nil {
+	log.Debugf("Upgrading install receipt for plugin %s", plugin.Name)
+	r := receipt.New(plugin, indexName)
+	r.Status.Install = status
+	retained, removed := retainVersions(installReceipt, newVersion, opts.RetainVersions)
+	r.Status.RetainedVersions = retained
+	if err = receipt.Store(r, p.PluginInstallReceiptPath(plugin.Name)); err != nil {
 		return errors.Wrap(err, "installation receipt could not be stored, uninstall may fail")
 	}
 
 	// Clean old installations
-	klog.V(2).Infof("Starting old version cleanup")
-	return cleanupInstallation(p, plugin, curVersion)
+	log.Debugf("Starting old version cleanup")
+	for _, version := range removed {
+		if err := cleanupInstallation(p, plugin, version, log); err != nil {
+			return err
+		}
+		if err := removeVersionedAlias(p.BinPath(), plugin.Name, version, installStatusOf(installReceipt, version), log); err != nil {
+			return errors.Wrapf(err, "failed to remove the versioned alias of version %s", version)
+		}
+	}
+	return nil
+}
+
+// moveInstalledVersion moves the files of the installed version of the plugin
+// with receipt r to the directory of newVersion and links them like install
+// does, for upgrading to a version with the same archive and files. It
+// returns false if the installed files cannot be moved, e.g. if they are in
+// use on Windows, so that newVersion is installed from its archive instead.
+func moveInstalledVersion(p environment.Paths, r index.Receipt, newVersion string, platform index.Platform, opts InstallOpts) (*index.InstallStatus, bool, error) {
+	log := opts.logger()
+	oldDir, newDir := p.PluginVersionInstallPath(r.Name, r.Spec.Version), p.PluginVersionInstallPath(r.Name, newVersion)
+	if err := os.Rename(oldDir, newDir); err != nil {
+		log.Debugf("Cannot move version %s of plugin %s, installing version %s from its archive: %v", r.Spec.Version, r.Name, newVersion, err)
+		return nil, false, nil
+	}
+	status := &index.InstallStatus{}
+	if r.Status.Install != nil {
+		*status = *r.Status.Install
+	}
+	if opts.SkipLink {
+		return status, true, nil
+	}
+
+	fullPath := filepath.Join(newDir, filepath.FromSlash(platform.Bin))
+	prevLinkType := installedLinkType(r)
+	relative := opts.RelativeLink || prevLinkType == linkTypeRelative
+	var err error
+	if status.LinkType, err = createOrUpdateLink(p.BinPath(), fullPath, r.Name, prevLinkType, relative, log); err != nil {
+		if err := os.Rename(newDir, oldDir); err != nil {
+			log.Warningf("failed to move the files of plugin %s back to version %s: %s", r.Name, r.Spec.Version, err)
+		}
+		return nil, true, errors.Wrap(err, "failed to link the moved plugin")
+	}
+	status.VersionedAlias = false
+	if opts.VersionedAlias {
+		alias := versionedAliasName(r.Name, newVersion)
+		log.Debugf("Linking plugin %s as %s", r.Name, BinaryNameForPlugin(alias))
+		if _, err := createOrUpdateLink(p.BinPath(), fullPath, alias, status.LinkType, relative, log); err != nil {
+			return nil, true, errors.Wrap(err, "failed to create the versioned alias of the moved plugin")
+		}
+		status.VersionedAlias = true
+	}
+	return status, true, nil
+}
+
+// retainVersions returns the at most n most recent versions of the plugin to
+// keep on disk after upgrading from the installed receipt to newVersion, and
+// the versions to remove.
+func retainVersions(installed index.Receipt, newVersion string, n int) ([]index.RetainedVersion, []string) {
+	versions := append([]index.RetainedVersion{{
+		Spec:    installed.Spec,
+		Source:  installed.Status.Source,
+		Install: installed.Status.Install,
+	}}, installed.Status.RetainedVersions...)
+
+	var retained []index.RetainedVersion
+	var removed []string
+	for _, v := range versions {
+		switch {
+		case v.Spec.Version == newVersion:
+			// reinstalled, it is not a previous version anymore
+		case len(retained) < n:
+			retained = append(retained, v)
+		default:
+			removed = append(removed, v.Spec.Version)
+		}
+	}
+	return retained, removed
+}
+
+// Rollback replaces the installed version of a plugin with the most recent
+// version retained by Upgrade, without downloading it again. The version that
+// is rolled back from is removed. The log messages are written to log, or to
+// klog if it is nil.
+func Rollback(p environment.Paths, name string, log Logger) error {
+	log = loggerOrDefault(log)
+	unlock, err := acquireLock(context.Background(), p, log)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	r, err := receipt.Load(p.PluginInstallReceiptPath(name))
+	if os.IsNotExist(err) {
+		return ErrIsNotInstalled
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to load install receipt for plugin %q", name)
+	}
+	if len(r.Status.RetainedVersions) == 0 {
+		return errors.Errorf("plugin %q has no previous version to roll back to", name)
+	}
+	prev := r.Status.RetainedVersions[0]
+
+	candidate, ok, err := GetMatchingPlatform(prev.Spec.Platforms)
+	if err != nil {
+		return errors.Wrap(err, "failed trying to find a matching platform in plugin spec")
+	}
+	if !ok {
+		return errors.Wrapf(newNoMatchingPlatformError(name, prev.Spec.Platforms),
+			"cannot roll back to version %s", prev.Spec.Version)
+	}
+	fullPath := filepath.Join(p.PluginVersionInstallPath(name, prev.Spec.Version), filepath.FromSlash(candidate.Bin))
+	if _, err := os.Stat(fullPath); err != nil {
+		return errors.Wrapf(err, "previous version %s of plugin %q is not available", prev.Spec.Version, name)
+	}
+
+	log.Infof("Rolling back plugin %s from version %s to %s", name, r.Spec.Version, prev.Spec.Version)
+	linkType := installedLinkType(r)
+	if linkType != linkTypeNone {
+		if linkType, err = createOrUpdateLink(p.BinPath(), fullPath, name, linkType, linkType == linkTypeRelative, log); err != nil {
+			return errors.Wrap(err, "failed to link the previous version of the plugin")
+		}
+	}
+	install := prev.Install
+	if install != nil || linkType != "" {
+		install = &index.InstallStatus{}
+		if prev.Install != nil {
+			*install = *prev.Install
+		}
+		install.LinkType = linkType
+	}
+	rolledBack := r
+	rolledBack.Spec = prev.Spec
+	rolledBack.Status = index.ReceiptStatus{
+		Source:           prev.Source,
+		Install:          install,
+		RetainedVersions: r.Status.RetainedVersions[1:],
+	}
+	if err := receipt.Store(rolledBack, p.PluginInstallReceiptPath(name)); err != nil {
+		return errors.Wrap(err, "installation receipt could not be stored, uninstall may fail")
+	}
+	if err := cleanupInstallation(p, r.Plugin, r.Spec.Version, log); err != nil {
+		return err
+	}
+	return errors.Wrapf(removeVersionedAlias(p.BinPath(), name, r.Spec.Version, r.Status.Install, log),
+		"failed to remove the versioned alias of version %s", r.Spec.Version)
+}
+
+// needsUpgrade reports whether the installed version should be replaced with
+// the candidate version. Versions are compared as semantic versions, or as
+// strings if either of them is not a valid semantic version.
+func needsUpgrade(curVersion, newVersion string, allowDowngrade bool, log Logger) bool {
+	curv, curErr := semver.Parse(curVersion)
+	newv, newErr := semver.Parse(newVersion)
+	if curErr != nil || newErr != nil {
+		log.Warningf("Cannot compare versions %q and %q as semantic versions, upgrading if they differ", curVersion, newVersion)
+		return curVersion != newVersion
+	}
+	log.Debugf("Comparing versions: current=%s target=%s", curv, newv)
+
+	if semver.Less(curv, newv) {
+		log.Infof("Plugin needs upgrade (%s < %s)", curv, newv)
+		return true
+	}
+	if !semver.Less(newv, curv) {
+		log.Debugf("Plugin does not need upgrade (%s = %s)", curv, newv)
+		return false
+	}
+	if allowDowngrade {
+		log.Infof("Plugin will be downgraded (%s > %s)", curv, newv)
+		return true
+	}
+	log.Infof("Refusing to downgrade plugin (%s > %s)", curv, newv)
+	return false
+}
+
+// sameInstallation reports whether installing the candidate platform would
+// result in the same files as the installed platform, because it has the same
+// archive checksum and installs the same files from it.
+func sameInstallation(installed, candidate index.Platform, log Logger) bool {
+	if !strings.EqualFold(installed.Sha256, candidate.Sha256) || !strings.EqualFold(installed.Sha512, candidate.Sha512) {
+		return false
+	}
+	applyDefaults(&installed, log)
+	applyDefaults(&candidate, log)
+	return installed.Bin == candidate.Bin &&
+		installed.StripComponents == candidate.StripComponents &&
+		reflect.DeepEqual(installed.Files, candidate.Files)
 }
 
 // cleanupInstallation will remove a plugin directly if it not krew.
@@ -92,12 +345,12 @@ func Upgrade(p environment.Paths, plugin index.Plugin, indexName string) error {
 // Krew on Windows needs special care because active directories can't be
 // deleted. This method will mark old krew versions and during next run clean
 // the directory.
-func cleanupInstallation(p environment.Paths, plugin index.Plugin, oldVersion string) error {
+func cleanupInstallation(p environment.Paths, plugin index.Plugin, oldVersion string, log Logger) error {
 	if plugin.Name == constants.KrewPluginName && IsWindows() {
-		klog.V(1).Infof("not removing old version of krew during upgrade on windows (should be cleaned up on the next run)")
+		log.Infof("not removing old version of krew during upgrade on windows (should be cleaned up on the next run)")
 		return nil
 	}
 
-	klog.V(1).Infof("Remove old plugin installation under %q", p.PluginVersionInstallPath(plugin.Name, oldVersion))
+	log.Infof("Remove old plugin installation under %q", p.PluginVersionInstallPath(plugin.Name, oldVersion))
 	return os.RemoveAll(p.PluginVersionInstallPath(plugin.Name, oldVersion))
 }
@@ -0,0 +1,315 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func Test_needsUpgrade(t *testing.T) {
+	tests := []struct {
+		name           string
+		cur, new       string
+		allowDowngrade bool
+		want           bool
+	}{
+		{name: "newer version", cur: "v1.0.0", new: "v1.0.1", want: true},
+		{name: "same version", cur: "v1.0.0", new: "v1.0.0", want: false},
+		{name: "older version", cur: "v1.1.0", new: "v1.0.0", want: false},
+		{name: "older version with downgrade allowed", cur: "v1.1.0", new: "v1.0.0", allowDowngrade: true, want: true},
+		{name: "semver is not compared as string", cur: "v1.9.0", new: "v1.10.0", want: true},
+		{name: "different non-semver versions", cur: "1.0", new: "2020-10-01", want: true},
+		{name: "same non-semver versions", cur: "1.0", new: "1.0", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsUpgrade(tt.cur, tt.new, tt.allowDowngrade, klogLogger{}); got != tt.want {
+				t.Errorf("needsUpgrade(%q, %q, %v) = %v, want %v", tt.cur, tt.new, tt.allowDowngrade, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) *testutil.P {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V())
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	if err := Install(p, newPlugin("v1.0.0").V(), constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		version        string
+		allowDowngrade bool
+		wantErr        error
+		wantVersion    string
+	}{
+		{version: "v2.0.0", wantVersion: "v2.0.0"},
+		{version: "v2.0.0", wantErr: ErrIsAlreadyUpgraded, wantVersion: "v2.0.0"},
+		{version: "v1.0.0", wantErr: ErrIsAlreadyUpgraded, wantVersion: "v2.0.0"},
+		{version: "v1.0.0", allowDowngrade: true, wantVersion: "v1.0.0"},
+	}
+	for _, s := range steps {
+		err := Upgrade(p, newPlugin(s.version).V(), constants.DefaultIndexName, UpgradeOpts{
+			InstallOpts:    opts,
+			AllowDowngrade: s.allowDowngrade,
+		})
+		if err != s.wantErr {
+			t.Fatalf("Upgrade(%s, allowDowngrade=%v) error = %v, want %v", s.version, s.allowDowngrade, err, s.wantErr)
+		}
+		r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Spec.Version != s.wantVersion {
+			t.Fatalf("after Upgrade(%s), installed version = %s, want %s", s.version, r.Spec.Version, s.wantVersion)
+		}
+	}
+}
+
+func TestUpgrade_sameArchive(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	if err := Install(p, newPlugin("v1.0.0"), constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive is not needed to upgrade to the same archive
+	opts := InstallOpts{ArchiveFileOverride: filepath.Join(p.BasePath(), "does-not-exist.tar.gz")}
+	if err := Upgrade(p, newPlugin("v1.0.1"), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Spec.Version != "v1.0.1" {
+		t.Errorf("installed version = %s, want v1.0.1", r.Spec.Version)
+	}
+	if len(r.Status.Install.Files) == 0 {
+		t.Error("expected the installed files in the receipt")
+	}
+	if _, err := os.Stat(p.PluginVersionInstallPath("foo", "v1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("expected the files of the old version to be moved, got err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); err != nil {
+		t.Errorf("expected the link to the moved executable: %v", err)
+	}
+	if err := Upgrade(p, newPlugin("v1.0.1"), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); err != ErrIsAlreadyUpgraded {
+		t.Errorf("Upgrade() to the installed version error = %v, want %v", err, ErrIsAlreadyUpgraded)
+	}
+}
+
+func Test_sameInstallation(t *testing.T) {
+	base := testutil.NewPlatform().WithSHA256(testArchiveSha256).WithFiles(nil).WithBin("foo")
+	tests := []struct {
+		name      string
+		candidate index.Platform
+		want      bool
+	}{
+		{name: "same platform", candidate: base.V(), want: true},
+		{name: "checksum case differs", candidate: testutil.NewPlatform().WithSHA256(strings.ToUpper(testArchiveSha256)).WithFiles(nil).WithBin("foo").V(), want: true},
+		{name: "default files spelled out", candidate: testutil.NewPlatform().WithSHA256(testArchiveSha256).WithFiles([]index.FileOperation{{From: "*", To: "."}}).WithBin("foo").V(), want: true},
+		{name: "different checksum", candidate: testutil.NewPlatform().WithSHA256(strings.Repeat("0", 64)).WithFiles(nil).WithBin("foo").V(), want: false},
+		{name: "different bin", candidate: testutil.NewPlatform().WithSHA256(testArchiveSha256).WithFiles(nil).WithBin("bar").V(), want: false},
+		{name: "different files", candidate: testutil.NewPlatform().WithSHA256(testArchiveSha256).WithFiles([]index.FileOperation{{From: "foo", To: "."}}).WithBin("foo").V(), want: false},
+		{name: "different stripComponents", candidate: testutil.NewPlatform().WithSHA256(testArchiveSha256).WithFiles(nil).WithBin("foo").WithStripComponents(1).V(), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameInstallation(base.V(), tt.candidate, klogLogger{}); got != tt.want {
+				t.Errorf("sameInstallation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade_fromOtherIndex(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	if err := Install(p, newPlugin("v1.0.0"), "myorg", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Upgrade(p, newPlugin("v2.0.0"), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); err == nil {
+		t.Fatal("expected error upgrading from a different index")
+	}
+	if err := Upgrade(p, newPlugin("v2.0.0"), "myorg", UpgradeOpts{InstallOpts: opts}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status.Source.Name != "myorg" {
+		t.Errorf("receipt index = %q, want %q", r.Status.Source.Name, "myorg")
+	}
+}
+
+func TestUpgrade_retainVersionsAndRollback(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	if err := Install(p, newPlugin("v1.0.0"), constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v2.0.0", "v3.0.0"} {
+		if err := Upgrade(p, newPlugin(version), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts, RetainVersions: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertInstalled := func(version string, want bool) {
+		t.Helper()
+		_, err := os.Stat(p.PluginVersionInstallPath("foo", version))
+		if got := err == nil; got != want {
+			t.Errorf("version %s installed=%v, want %v (err=%v)", version, got, want, err)
+		}
+	}
+	assertInstalled("v1.0.0", false)
+	assertInstalled("v2.0.0", true)
+	assertInstalled("v3.0.0", true)
+
+	if err := Rollback(p, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Spec.Version != "v2.0.0" {
+		t.Errorf("after rollback, installed version = %s, want v2.0.0", r.Spec.Version)
+	}
+	link, err := os.Readlink(filepath.Join(p.BinPath(), pluginNameToBin("foo", IsWindows())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(p.PluginVersionInstallPath("foo", "v2.0.0"), "foo"); link != want {
+		t.Errorf("after rollback, symlink points to %q, want %q", link, want)
+	}
+	assertInstalled("v3.0.0", false)
+
+	if err := Rollback(p, "foo", nil); err == nil {
+		t.Error("expected error when there is no previous version to roll back to")
+	}
+	if err := Rollback(p, "bar", nil); err != ErrIsNotInstalled {
+		t.Errorf("Rollback() of plugin not installed error = %v, want %v", err, ErrIsNotInstalled)
+	}
+}
+
+func TestUpgrade_versionedAlias(t *testing.T) {
+	if IsWindows() {
+		t.Skip("symbolic links are not created on windows")
+	}
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	installOpts := opts
+	installOpts.VersionedAlias = true
+	if err := Install(p, newPlugin("v1.0.0"), constants.DefaultIndexName, installOpts); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v2.0.0", "v3.0.0"} {
+		if err := Upgrade(p, newPlugin(version), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts, RetainVersions: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertAlias := func(version string, want bool) {
+		t.Helper()
+		target, err := os.Readlink(filepath.Join(p.BinPath(), VersionedBinaryNameForPlugin("foo", version)))
+		if got := err == nil; got != want {
+			t.Fatalf("version %s has alias=%v, want %v (err=%v)", version, got, want, err)
+		}
+		if want := filepath.Join(p.PluginVersionInstallPath("foo", version), "foo"); err == nil && target != want {
+			t.Errorf("alias of version %s points to %q, want %q", version, target, want)
+		}
+	}
+	assertAlias("v1.0.0", false)
+	assertAlias("v2.0.0", true)
+	assertAlias("v3.0.0", true)
+
+	if err := Rollback(p, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	assertAlias("v2.0.0", true)
+	assertAlias("v3.0.0", false)
+}
+
+func TestUpgrade_skipLink(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	installOpts := opts
+	installOpts.SkipLink = true
+	if err := Install(p, newPlugin("v1.0.0"), constants.DefaultIndexName, installOpts); err != nil {
+		t.Fatal(err)
+	}
+	if err := Upgrade(p, newPlugin("v2.0.0"), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("expected no link at %q after upgrade, got err=%v", link, err)
+	}
+	r, err := receipt.Load(p.PluginInstallReceiptPath("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installedLinkType(r); got != linkTypeNone {
+		t.Errorf("expected link type %q in receipt after upgrade, got %q", linkTypeNone, got)
+	}
+}
+
+func TestUpgrade_missingBinDir(t *testing.T) {
+	p := newTestPaths(t)
+	newPlugin := func(version string) index.Plugin {
+		return testutil.NewPlugin().WithName("foo").WithVersion(version).WithPlatforms(newTestArchivePlatform().V()).V()
+	}
+	opts := InstallOpts{ArchiveFileOverride: testArchivePath(t)}
+	if err := Install(p, newPlugin("v1.0.0"), constants.DefaultIndexName, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(p.BinPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Upgrade(p, newPlugin("v2.0.0"), constants.DefaultIndexName, UpgradeOpts{InstallOpts: opts}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))); err != nil {
+		t.Errorf("expected the bin directory to be created with the link: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/index/indexoperations"
+	"sigs.k8s.io/krew/internal/index/validation"
+	"sigs.k8s.io/krew/internal/installation/semver"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// urlPluginVersion is the version recorded for plugins installed from a URL
+// that does not point to a release with a semantic version.
+const urlPluginVersion = "v0.0.0"
+
+// InstallFromURL installs the plugin archive at uri for the current platform
+// without a plugin manifest. The archive is verified against the sha256 sum,
+// and binName is the path of the plugin executable in the archive. The plugin
+// is recorded as installed from the "url" index, so it is not upgraded. To not
+// shadow a plugin from an index, names provided by a configured index are
+// refused.
+func InstallFromURL(p environment.Paths, name, uri, sha256, binName string) error {
+	plugin, err := pluginFromURL(name, uri, sha256, binName)
+	if err != nil {
+		return err
+	}
+	indexes, err := indexoperations.FindPluginIndexes(p, name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the indexes providing plugin %q", name)
+	}
+	if len(indexes) > 0 {
+		return errors.Errorf("plugin %q is provided by index %s, install it from the index instead", name, strings.Join(indexes, ", "))
+	}
+	return Install(p, plugin, constants.URLIndexName, InstallOpts{})
+}
+
+// pluginFromURL returns a manifest of the plugin with a single platform for
+// the current system that installs the archive at uri.
+func pluginFromURL(name, uri, sha256, binName string) (index.Plugin, error) {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return index.Plugin{}, errors.Errorf("plugin archive URL %q must be an http(s) URL", uri)
+	}
+	env := OSArch()
+	plugin := index.Plugin{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: constants.CurrentAPIVersion,
+			Kind:       constants.PluginKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: index.PluginSpec{
+			Version:          releaseVersion(u),
+			ShortDescription: "Installed from " + uri,
+			Platforms: []index.Platform{{
+				URI:    uri,
+				Sha256: sha256,
+				Bin:    binName,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"os": env.OS, "arch": env.Arch},
+				},
+			}},
+		},
+	}
+	if err := validation.ValidatePlugin(name, plugin); err != nil {
+		return index.Plugin{}, errors.Wrapf(err, "cannot install plugin %q from URL", name)
+	}
+	return plugin, nil
+}
+
+// releaseVersion returns the tag of a GitHub release download URL like
+// https://github.com/ORG/REPO/releases/download/TAG/FILE if it is a semantic
+// version, and urlPluginVersion otherwise.
+func releaseVersion(u *url.URL) string {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+3 < len(parts); i++ {
+		if parts[i] == "releases" && parts[i+1] == "download" {
+			if _, err := semver.Parse(parts[i+2]); err == nil {
+				return parts[i+2]
+			}
+		}
+	}
+	return urlPluginVersion
+}
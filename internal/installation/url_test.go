@@ -0,0 +1,105 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+func TestInstallFromURL(t *testing.T) {
+	archive := testArchivePath(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, archive)
+	}))
+	defer server.Close()
+	releaseURL := server.URL + "/org/foo/releases/download/v1.2.3/foo.tar.gz"
+
+	tests := []struct {
+		name        string
+		plugin      string
+		uri         string
+		sha256      string
+		bin         string
+		wantErr     bool
+		wantVersion string
+	}{
+		{name: "release url", plugin: "foo", uri: releaseURL, sha256: testArchiveSha256, bin: "foo", wantVersion: "v1.2.3"},
+		{name: "plain url", plugin: "foo", uri: server.URL + "/foo.tar.gz", sha256: testArchiveSha256, bin: "foo", wantVersion: urlPluginVersion},
+		{name: "sha256 mismatch", plugin: "foo", uri: releaseURL, sha256: strings.Repeat("0", 64), bin: "foo", wantErr: true},
+		{name: "empty sha256", plugin: "foo", uri: releaseURL, bin: "foo", wantErr: true},
+		{name: "uppercase sha256", plugin: "foo", uri: releaseURL, sha256: strings.ToUpper(testArchiveSha256), bin: "foo", wantErr: true},
+		{name: "no bin", plugin: "foo", uri: releaseURL, sha256: testArchiveSha256, wantErr: true},
+		{name: "not http", plugin: "foo", uri: "file:///foo.tar.gz", sha256: testArchiveSha256, bin: "foo", wantErr: true},
+		{name: "unsafe name", plugin: "../foo", uri: releaseURL, sha256: testArchiveSha256, bin: "foo", wantErr: true},
+		{name: "indexed plugin", plugin: "bar", uri: releaseURL, sha256: testArchiveSha256, bin: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			writeIndexPlugins(t, p, newTestPlugin("bar"))
+
+			err := InstallFromURL(p, tt.plugin, tt.uri, tt.sha256, tt.bin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallFromURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if isInstalled(p, tt.plugin) {
+					t.Errorf("plugin %q should not be installed", tt.plugin)
+				}
+				return
+			}
+			r, err := receipt.Load(p.PluginInstallReceiptPath(tt.plugin))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Status.Source.Name != constants.URLIndexName {
+				t.Errorf("expected source index %q, got %q", constants.URLIndexName, r.Status.Source.Name)
+			}
+			if r.Spec.Version != tt.wantVersion {
+				t.Errorf("expected version %q, got %q", tt.wantVersion, r.Spec.Version)
+			}
+		})
+	}
+}
+
+func Test_releaseVersion(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "https://github.com/org/repo/releases/download/v0.4.1/foo.tar.gz", want: "v0.4.1"},
+		{uri: "https://github.com/org/repo/releases/download/1.0/foo.tar.gz", want: urlPluginVersion},
+		{uri: "https://github.com/org/repo/releases/download/v0.4.1", want: urlPluginVersion},
+		{uri: "https://example.com/foo.tar.gz", want: urlPluginVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			u, err := url.Parse(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := releaseVersion(u); got != tt.want {
+				t.Errorf("releaseVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
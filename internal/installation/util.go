@@ -15,16 +15,33 @@
 package installation
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/pkg/errors"
 	"k8s.io/klog"
 
+	"sigs.k8s.io/krew/internal/environment"
 	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/installation/semver"
 	"sigs.k8s.io/krew/pkg/constants"
 	"sigs.k8s.io/krew/pkg/index"
 )
 
+// makeTempDir creates a new temporary directory in dir, which is created if it
+// does not exist, or in the temp directory of the OS if dir is empty.
+func makeTempDir(dir, pattern string) (string, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", errors.Wrapf(err, "could not create temporary directory %q", dir)
+		}
+	}
+	tmp, err := ioutil.TempDir(dir, pattern)
+	return tmp, errors.Wrap(err, "failed to create a temporary directory")
+}
+
 // InstalledPluginsFromIndex returns a list of all install plugins from a particular index.
 func InstalledPluginsFromIndex(receiptsDir, indexName string) ([]index.Receipt, error) {
 	var out []index.Receipt
@@ -58,3 +75,73 @@ func GetInstalledPluginReceipts(receiptsDir string) ([]index.Receipt, error) {
 	}
 	return out, nil
 }
+
+// InstalledPlugin describes an installed plugin.
+type InstalledPlugin struct {
+	Name        string
+	Version     string
+	InstallPath string
+}
+
+// ListInstalled returns the plugins that have an install receipt. Unlike
+// GetInstalledPluginReceipts, receipts that cannot be read are skipped.
+func ListInstalled(p environment.Paths) ([]InstalledPlugin, error) {
+	files, err := filepath.Glob(filepath.Join(p.InstallReceiptsPath(), "*"+constants.ManifestExtension))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to glob receipts directory (%s) for manifests", p.InstallReceiptsPath())
+	}
+	out := make([]InstalledPlugin, 0, len(files))
+	for _, f := range files {
+		r, err := receipt.Load(f)
+		if err != nil {
+			klog.Warningf("Skipping plugin install receipt %s that cannot be read: %v", f, err)
+			continue
+		}
+		out = append(out, InstalledPlugin{
+			Name:        r.Name,
+			Version:     r.Spec.Version,
+			InstallPath: p.PluginVersionInstallPath(r.Name, r.Spec.Version),
+		})
+	}
+	return out, nil
+}
+
+// InstalledVersions returns the versions of the plugin that exist on disk,
+// which are the version directories under its install path, sorted from the
+// newest to the oldest version. Entries that are not directories or whose name
+// is not a valid semantic version are skipped. If the plugin has no install
+// path, no versions are returned.
+func InstalledVersions(p environment.Paths, name string) ([]string, error) {
+	dir := p.PluginInstallPath(name)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read install directory of plugin %q", name)
+	}
+
+	type version struct {
+		name string
+		v    semver.Version
+	}
+	var versions []version
+	for _, e := range entries {
+		if !e.IsDir() {
+			klog.V(2).Infof("Skipping %q in install directory of plugin %q, not a directory", e.Name(), name)
+			continue
+		}
+		v, err := semver.Parse(e.Name())
+		if err != nil {
+			klog.V(2).Infof("Skipping %q in install directory of plugin %q, not a valid version: %v", e.Name(), name, err)
+			continue
+		}
+		versions = append(versions, version{name: e.Name(), v: v})
+	}
+	sort.SliceStable(versions, func(i, j int) bool { return semver.Less(versions[j].v, versions[i].v) })
+
+	out := make([]string, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, v.name)
+	}
+	return out, nil
+}
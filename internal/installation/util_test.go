@@ -15,11 +15,14 @@
 package installation
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 
+	"sigs.k8s.io/krew/internal/environment"
 	"sigs.k8s.io/krew/internal/testutil"
 	"sigs.k8s.io/krew/pkg/constants"
 	"sigs.k8s.io/krew/pkg/index"
@@ -103,3 +106,59 @@ func TestInstalledPluginsFromIndex(t *testing.T) {
 		t.Fatalf("expected %d, got: %d for index 'a'", expected, got)
 	}
 }
+
+func TestListInstalled(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	p := environment.NewPaths(tempDir.Root())
+
+	for _, testReceipt := range []index.Receipt{
+		testutil.NewReceipt().WithPlugin(testutil.NewPlugin().WithName("a").WithVersion("v1.0.0").V()).V(),
+		testutil.NewReceipt().WithPlugin(testutil.NewPlugin().WithName("b").WithVersion("v0.2.0").V()).V(),
+	} {
+		tempDir.WriteYAML(filepath.Join("receipts", testReceipt.Name+constants.ManifestExtension), testReceipt)
+	}
+	tempDir.Write(filepath.Join("receipts", "corrupt"+constants.ManifestExtension), []byte("{invalid yaml"))
+
+	actual, err := ListInstalled(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []InstalledPlugin{
+		{Name: "a", Version: "v1.0.0", InstallPath: p.PluginVersionInstallPath("a", "v1.0.0")},
+		{Name: "b", Version: "v0.2.0", InstallPath: p.PluginVersionInstallPath("b", "v0.2.0")},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestInstalledVersions(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	p := environment.NewPaths(tempDir.Root())
+
+	for _, v := range []string{"v0.9.0", "v1.10.0", "v1.2.0", "v1.2.0-rc.1", "not-a-version"} {
+		if err := os.MkdirAll(p.PluginVersionInstallPath("foo", v), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(p.PluginInstallPath("foo"), "v2.0.0"), []byte("not a directory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := InstalledVersions(p, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"v1.10.0", "v1.2.0", "v1.2.0-rc.1", "v0.9.0"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+
+	actual, err = InstalledVersions(p, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("expected no versions of a plugin that is not installed, got %v", actual)
+	}
+}
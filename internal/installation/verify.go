@@ -0,0 +1,127 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+// VerifyInstalled checks that the files in the installation directory of the
+// plugin have not changed since it was installed, by comparing their sha256
+// sums to the ones stored in the install receipt.
+func VerifyInstalled(p environment.Paths, name string) error {
+	r, err := receipt.Load(p.PluginInstallReceiptPath(name))
+	if os.IsNotExist(err) {
+		return ErrIsNotInstalled
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to load install receipt for plugin %q", name)
+	}
+	if r.Status.Install == nil || len(r.Status.Install.Files) == 0 {
+		return errors.Errorf("install receipt of plugin %q has no file checksums, reinstall the plugin to record them", name)
+	}
+
+	installDir := p.PluginVersionInstallPath(name, r.Spec.Version)
+	klog.V(2).Infof("Verifying installed files of plugin %s in %s", name, installDir)
+	actual, err := hashInstalledFiles(installDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute checksums of installed files of plugin %q", name)
+	}
+
+	found := make(map[string]string, len(actual))
+	for _, f := range actual {
+		found[f.Path] = f.SHA256
+	}
+	var modified, missing, unexpected []string
+	for _, f := range r.Status.Install.Files {
+		sum, ok := found[f.Path]
+		switch {
+		case !ok:
+			missing = append(missing, f.Path)
+		case sum != f.SHA256:
+			modified = append(modified, f.Path)
+		}
+		delete(found, f.Path)
+	}
+	for _, f := range actual {
+		if _, ok := found[f.Path]; ok {
+			unexpected = append(unexpected, f.Path)
+		}
+	}
+	if len(modified)+len(missing)+len(unexpected) == 0 {
+		return nil
+	}
+
+	var details []string
+	if len(modified) > 0 {
+		details = append(details, "modified: "+strings.Join(modified, ", "))
+	}
+	if len(missing) > 0 {
+		details = append(details, "missing: "+strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		details = append(details, "unexpected: "+strings.Join(unexpected, ", "))
+	}
+	return errors.Errorf("installed files of plugin %q do not match the install receipt (%s)", name, strings.Join(details, "; "))
+}
+
+// hashInstalledFiles returns the sha256 sums of the regular files under dir,
+// sorted by path.
+func hashInstalledFiles(dir string) ([]index.InstalledFile, error) {
+	var out []index.InstalledFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get relative path of %q", path)
+		}
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		out = append(out, index.InstalledFile{Path: filepath.ToSlash(rel), SHA256: sum})
+		return nil
+	})
+	return out, err
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %q", path)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "failed to read %q", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
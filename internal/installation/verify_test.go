@@ -0,0 +1,99 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+func TestVerifyInstalled(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(installDir string) error
+		wantErr string
+	}{
+		{
+			name:   "unchanged",
+			tamper: func(string) error { return nil },
+		},
+		{
+			name: "modified file",
+			tamper: func(installDir string) error {
+				return ioutil.WriteFile(filepath.Join(installDir, "foo"), []byte("evil"), 0755)
+			},
+			wantErr: "modified: foo",
+		},
+		{
+			name: "missing file",
+			tamper: func(installDir string) error {
+				return os.Remove(filepath.Join(installDir, "foo"))
+			},
+			wantErr: "missing: foo",
+		},
+		{
+			name: "unexpected file",
+			tamper: func(installDir string) error {
+				return ioutil.WriteFile(filepath.Join(installDir, "bar"), nil, 0644)
+			},
+			wantErr: "unexpected: bar",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			plugin := testutil.NewPlugin().WithName("foo").WithVersion("v1.0.0").WithPlatforms(newTestArchivePlatform().V()).V()
+			if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.tamper(p.PluginVersionInstallPath("foo", "v1.0.0")); err != nil {
+				t.Fatal(err)
+			}
+
+			err := VerifyInstalled(p, "foo")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyInstalled() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("VerifyInstalled() error = %v, expected to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyInstalled_errors(t *testing.T) {
+	p := newTestPaths(t)
+	if err := VerifyInstalled(p, "foo"); err != ErrIsNotInstalled {
+		t.Errorf("VerifyInstalled() of plugin not installed error = %v, want %v", err, ErrIsNotInstalled)
+	}
+
+	r := testutil.NewReceipt().WithPlugin(testutil.NewPlugin().WithName("foo").V()).V()
+	if err := receipt.Store(r, p.PluginInstallReceiptPath("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyInstalled(p, "foo"); err == nil {
+		t.Error("expected error for receipt without file checksums")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"sigs.k8s.io/krew/internal/environment"
+	"sigs.k8s.io/krew/internal/installation/receipt"
+)
+
+// Which returns the absolute path of the executable of the installed plugin.
+// The symbolic link to the executable in the bin directory is resolved, and if
+// the plugin is not linked with a symbolic link, the path is found from the
+// install receipt. ErrIsNotInstalled is returned if the plugin is not
+// installed.
+func Which(p environment.Paths, name string) (string, error) {
+	r, err := receipt.Load(p.PluginInstallReceiptPath(name))
+	if os.IsNotExist(err) {
+		return "", ErrIsNotInstalled
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed to look up install receipt for plugin %q", name)
+	}
+
+	if lt := installedLinkType(r); lt == "" || lt == linkTypeRelative {
+		link := filepath.Join(p.BinPath(), BinaryNameForPlugin(name))
+		if target, err := os.Readlink(link); err == nil {
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(p.BinPath(), target)
+			}
+			if _, err := os.Stat(target); err == nil {
+				return filepath.Abs(target)
+			}
+		}
+		klog.V(2).Infof("Link %q of plugin %s cannot be resolved, looking up the executable from the receipt", link, name)
+	}
+
+	platform, ok, err := GetMatchingPlatform(r.Spec.Platforms)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find the installed platform of plugin %q", name)
+	}
+	if !ok {
+		return "", errors.Errorf("plugin %q has no platform matching this machine in its receipt", name)
+	}
+	path := filepath.Join(p.PluginVersionInstallPath(name, r.Spec.Version), filepath.FromSlash(platform.Bin))
+	if _, err := os.Stat(path); err != nil {
+		return "", errors.Wrapf(err, "executable of plugin %q is missing", name)
+	}
+	return filepath.Abs(path)
+}
+
+// FindByBinary returns the names of the installed plugins that are linked in
+// the bin directory as the executable for binName, which is the name of the
+// kubectl command (e.g. "view-logs" or "foo@1.2.3"), optionally prefixed with
+// "kubectl-". As dashes are converted to underscores in the executable names,
+// more than one plugin can be linked as the same executable, and the plugins
+// overwrite each other's link. Plugins installed without a link are not
+// considered.
+func FindByBinary(p environment.Paths, binName string) ([]string, error) {
+	binName = strings.TrimSuffix(strings.TrimPrefix(binName, "kubectl-"), ".exe")
+	want := BinaryNameForPlugin(binName)
+
+	receipts, err := GetInstalledPluginReceipts(p.InstallReceiptsPath())
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, r := range receipts {
+		if installedLinkType(r) == linkTypeNone {
+			continue
+		}
+		bins := []string{BinaryNameForPlugin(r.Name)}
+		if r.Status.Install != nil && r.Status.Install.VersionedAlias {
+			bins = append(bins, VersionedBinaryNameForPlugin(r.Name, r.Spec.Version))
+		}
+		for _, bin := range bins {
+			if bin == want {
+				klog.V(2).Infof("Plugin %q is linked as %q", r.Name, bin)
+				out = append(out, r.Name)
+				break
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/krew/internal/installation/receipt"
+	"sigs.k8s.io/krew/internal/testutil"
+	"sigs.k8s.io/krew/pkg/constants"
+	"sigs.k8s.io/krew/pkg/index"
+)
+
+func TestWhich(t *testing.T) {
+	tests := []struct {
+		name string
+		opts InstallOpts
+	}{
+		{name: "symbolic link"},
+		{name: "relative link", opts: InstallOpts{RelativeLink: true}},
+		{name: "no link", opts: InstallOpts{SkipLink: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPaths(t)
+			plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+			tt.opts.ArchiveFileOverride = testArchivePath(t)
+			if err := InstallContext(context.Background(), p, plugin, constants.DefaultIndexName, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Which(p, "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := filepath.Join(p.PluginVersionInstallPath("foo", plugin.Spec.Version), "foo")
+			if got != want {
+				t.Errorf("Which() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWhich_brokenLink(t *testing.T) {
+	p := newTestPaths(t)
+	plugin := testutil.NewPlugin().WithName("foo").WithPlatforms(newTestArchivePlatform().V()).V()
+	if err := Install(p, plugin, constants.DefaultIndexName, InstallOpts{ArchiveFileOverride: testArchivePath(t)}); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(p.BinPath(), BinaryNameForPlugin("foo"))
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(p.BasePath(), "missing"), link); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+
+	got, err := Which(p, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(p.PluginVersionInstallPath("foo", plugin.Spec.Version), "foo"); got != want {
+		t.Errorf("Which() = %q, want %q", got, want)
+	}
+}
+
+func TestWhich_notInstalled(t *testing.T) {
+	if _, err := Which(newTestPaths(t), "foo"); errors.Cause(err) != ErrIsNotInstalled {
+		t.Errorf("expected ErrIsNotInstalled, got %v", err)
+	}
+}
+
+func TestFindByBinary(t *testing.T) {
+	p := newTestPaths(t)
+	for _, v := range []struct {
+		name   string
+		status *index.InstallStatus
+	}{
+		{name: "view-logs"},
+		{name: "view_logs", status: &index.InstallStatus{LinkType: linkTypeRelative}},
+		{name: "foo", status: &index.InstallStatus{VersionedAlias: true}},
+		{name: "bar", status: &index.InstallStatus{LinkType: linkTypeNone}},
+	} {
+		r := receipt.New(testutil.NewPlugin().WithName(v.name).WithVersion("v1.2.3").V(), constants.DefaultIndexName)
+		r.Status.Install = v.status
+		if err := receipt.Store(r, p.PluginInstallReceiptPath(v.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		binName string
+		want    []string
+	}{
+		{binName: "view-logs", want: []string{"view-logs", "view_logs"}},
+		{binName: "kubectl-view_logs", want: []string{"view-logs", "view_logs"}},
+		{binName: "foo", want: []string{"foo"}},
+		{binName: "foo@1.2.3", want: []string{"foo"}},
+		{binName: "foo@1.0.0"},
+		{binName: "bar"},
+		{binName: "baz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.binName, func(t *testing.T) {
+			got, err := FindByBinary(p, tt.binName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindByBinary() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
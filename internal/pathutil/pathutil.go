@@ -54,3 +54,54 @@ func CanonicalPluginName(in string) (string, string) {
 	p := strings.SplitN(in, "/", 2)
 	return p[0], p[1]
 }
+
+// ExpandBraces expands the alternatives of a pattern like "{bin,lib}/*" into
+// the patterns "bin/*" and "lib/*", in order. Braces can be nested, as in
+// "{bin,lib/{a,b}}". A pattern without braces is returned as is. Unbalanced
+// braces are an error.
+func ExpandBraces(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "{}") {
+		return []string{pattern}, nil
+	}
+	start, end, alternatives := -1, -1, []string(nil)
+	depth, from := 0, 0
+	for i, c := range pattern {
+		switch c {
+		case '{':
+			if depth == 0 {
+				start, from = i, i+1
+			}
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return nil, errors.Errorf("unbalanced braces in pattern %q", pattern)
+			}
+			if depth == 0 {
+				end = i
+				alternatives = append(alternatives, pattern[from:i])
+			}
+		case ',':
+			if depth == 1 {
+				alternatives = append(alternatives, pattern[from:i])
+				from = i + 1
+			}
+		}
+		if end >= 0 {
+			break
+		}
+	}
+	if start < 0 || end < 0 {
+		return nil, errors.Errorf("unbalanced braces in pattern %q", pattern)
+	}
+
+	var out []string
+	for _, alt := range alternatives {
+		expanded, err := ExpandBraces(pattern[:start] + alt + pattern[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
@@ -208,3 +208,33 @@ func TestCanonicalPluginName(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "bin/*", want: []string{"bin/*"}},
+		{in: "{bin,lib}/*", want: []string{"bin/*", "lib/*"}},
+		{in: "foo-{a,b}-{x,y}", want: []string{"foo-a-x", "foo-a-y", "foo-b-x", "foo-b-y"}},
+		{in: "{bin,lib/{a,b}}/*", want: []string{"bin/*", "lib/a/*", "lib/b/*"}},
+		{in: "{,lib/}foo", want: []string{"foo", "lib/foo"}},
+		{in: "{bin}", want: []string{"bin"}},
+		{in: "{bin,lib", wantErr: true},
+		{in: "bin,lib}", wantErr: true},
+		{in: "{bin}}", wantErr: true},
+		{in: "{a,{b,c}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ExpandBraces(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandBraces(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandBraces(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -62,6 +62,7 @@ func (p *P) WithShortDescription(v string) *P     { p.v.Spec.ShortDescription =
 func (p *P) WithTypeMeta(v metav1.TypeMeta) *P    { p.v.TypeMeta = v; return p }
 func (p *P) WithPlatforms(v ...index.Platform) *P { p.v.Spec.Platforms = v; return p }
 func (p *P) WithVersion(v string) *P              { p.v.Spec.Version = v; return p }
+func (p *P) WithDependencies(v ...string) *P      { p.v.Spec.Dependencies = v; return p }
 func (p *P) V() index.Plugin                      { return p.v }
 
 func NewPlatform() *R {
@@ -101,4 +102,8 @@ func (p *R) WithFiles(v []index.FileOperation) *R    { p.v.Files = v; return p }
 func (p *R) WithBin(v string) *R                     { p.v.Bin = v; return p }
 func (p *R) WithURI(v string) *R                     { p.v.URI = v; return p }
 func (p *R) WithSHA256(v string) *R                  { p.v.Sha256 = v; return p }
+func (p *R) WithSHA256URL(v string) *R               { p.v.Sha256URL = v; return p }
+func (p *R) WithSHA512(v string) *R                  { p.v.Sha512 = v; return p }
+func (p *R) WithStripComponents(v int) *R            { p.v.StripComponents = v; return p }
+func (p *R) WithMirrors(v []string) *R               { p.v.Mirrors = v; return p }
 func (p *R) V() index.Platform                       { return p.v }
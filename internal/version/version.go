@@ -15,6 +15,16 @@
 // Package version contains the version information of the krew binary.
 package version
 
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// userAgentEnv is the environment variable overriding the User-Agent header
+// of the HTTP requests made by krew.
+const userAgentEnv = "KREW_USER_AGENT"
+
 var (
 	// gitCommit contains the git commit identifier.
 	gitCommit string
@@ -40,3 +50,13 @@ func GitTag() string {
 	}
 	return gitTag
 }
+
+// UserAgent returns the User-Agent header of the HTTP requests made by krew,
+// like "krew/v0.4.0 (linux/amd64)", or the value of the KREW_USER_AGENT
+// environment variable if it is set.
+func UserAgent() string {
+	if v := os.Getenv(userAgentEnv); v != "" {
+		return v
+	}
+	return fmt.Sprintf("krew/%s (%s/%s)", GitTag(), runtime.GOOS, runtime.GOARCH)
+}
@@ -14,7 +14,11 @@
 
 package version
 
-import "testing"
+import (
+	"os"
+	"runtime"
+	"testing"
+)
 
 func TestGitCommit(t *testing.T) {
 	orig := gitCommit
@@ -45,3 +49,19 @@ func TestGitTag(t *testing.T) {
 		t.Errorf("empty gitTag, expected=\"abcdef\" got=%q", v)
 	}
 }
+
+func TestUserAgent(t *testing.T) {
+	orig := gitTag
+	defer func() { gitTag = orig }()
+	defer os.Unsetenv(userAgentEnv)
+
+	gitTag = "v0.4.0"
+	if v, want := UserAgent(), "krew/v0.4.0 ("+runtime.GOOS+"/"+runtime.GOARCH+")"; v != want {
+		t.Errorf("UserAgent() expected=%q got=%q", want, v)
+	}
+
+	os.Setenv(userAgentEnv, "custom-agent/1.0")
+	if v := UserAgent(); v != "custom-agent/1.0" {
+		t.Errorf("UserAgent() with %s set, expected=\"custom-agent/1.0\" got=%q", userAgentEnv, v)
+	}
+}
@@ -24,4 +24,10 @@ const (
 	DefaultIndexURI = "https://github.com/kubernetes-sigs/krew-index.git"
 	// DefaultIndexName is a magic string that's used for a plugin name specified without an index.
 	DefaultIndexName = "default"
+	// DetachedIndexName is the index name recorded for plugins installed from
+	// a manifest that is not part of an index.
+	DetachedIndexName = "detached"
+	// URLIndexName is the index name recorded for plugins installed from an
+	// archive URL without a manifest.
+	URLIndexName = "url"
 )
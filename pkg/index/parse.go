@@ -0,0 +1,158 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/krew/pkg/constants"
+)
+
+// topLevelFields are the fields a plugin manifest may have at the top level.
+var topLevelFields = map[string]bool{
+	"apiVersion": true,
+	"kind":       true,
+	"metadata":   true,
+	"spec":       true,
+}
+
+// validSha256 matches a hex-encoded sha256 sum in lowercase.
+var validSha256 = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// validSha512 matches a hex-encoded sha512 sum in lowercase.
+var validSha512 = regexp.MustCompile(`^[a-f0-9]{128}$`)
+
+// kubeVersion matches the version part of an apiVersion, like "v1alpha2".
+var kubeVersion = regexp.MustCompile(`^v([1-9][0-9]*)(?:(alpha|beta)([1-9][0-9]*))?$`)
+
+// CheckAPIVersion checks if plugin manifests with the apiVersion can be parsed
+// by this version of krew. A newer version of the current major version (like
+// v1beta1 or v1 for v1alpha2) is parsed on a best-effort basis, and a warning
+// is returned for it. An error is returned for other API groups, older
+// versions and newer major versions, whose manifests are not compatible.
+func CheckAPIVersion(apiVersion string) (warning string, err error) {
+	if apiVersion == constants.CurrentAPIVersion {
+		return "", nil
+	}
+	group, current := splitAPIVersion(constants.CurrentAPIVersion)
+	g, v := splitAPIVersion(apiVersion)
+	if g != group || !kubeVersion.MatchString(v) {
+		return "", errors.Errorf("apiVersion %q is not supported, must be %q", apiVersion, constants.CurrentAPIVersion)
+	}
+	if version.CompareKubeAwareVersionStrings(v, current) < 0 {
+		return "", errors.Errorf("apiVersion %q is older than %q and no longer supported", apiVersion, constants.CurrentAPIVersion)
+	}
+	if majorVersion(v) != majorVersion(current) {
+		return "", errors.Errorf("apiVersion %q is not compatible with %q, a newer version of krew is required", apiVersion, constants.CurrentAPIVersion)
+	}
+	return fmt.Sprintf("apiVersion %q is newer than %q, fields added in the newer version are ignored (try installing a newer version of krew)",
+		apiVersion, constants.CurrentAPIVersion), nil
+}
+
+// splitAPIVersion splits an apiVersion into the API group and version.
+func splitAPIVersion(apiVersion string) (group, version string) {
+	i := strings.LastIndex(apiVersion, "/")
+	if i < 0 {
+		return "", apiVersion
+	}
+	return apiVersion[:i], apiVersion[i+1:]
+}
+
+// majorVersion returns the major version of a version matching kubeVersion.
+func majorVersion(v string) string {
+	return kubeVersion.FindStringSubmatch(v)[1]
+}
+
+// ParseAndValidate parses a plugin manifest and checks that it has the fields
+// required to install the plugin. Unknown top-level fields are rejected, but
+// unknown nested fields are ignored, so that manifests using fields added in
+// newer versions can still be parsed. The returned error lists all problems
+// with the paths of the offending fields.
+func ParseAndValidate(b []byte) (*Plugin, error) {
+	p, _, err := ParseAndValidateWithWarnings(b)
+	return p, err
+}
+
+// ParseAndValidateWithWarnings is like ParseAndValidate, but also returns the
+// problems with the manifest that do not prevent it from being parsed, like a
+// newer apiVersion than supported by this version of krew.
+func ParseAndValidateWithWarnings(b []byte) (*Plugin, []string, error) {
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(b, &fields); err != nil {
+		return nil, nil, err
+	}
+	var p Plugin
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, nil, err
+	}
+	p.ManifestSHA256 = fmt.Sprintf("%x", sha256.Sum256(b))
+
+	var errs field.ErrorList
+	for k := range fields {
+		if !topLevelFields[k] {
+			errs = append(errs, field.NotSupported(field.NewPath(k), k, []string{"apiVersion", "kind", "metadata", "spec"}))
+		}
+	}
+	var warnings []string
+	if p.APIVersion == "" {
+		errs = append(errs, field.Required(field.NewPath("apiVersion"), ""))
+	} else if warning, err := CheckAPIVersion(p.APIVersion); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("apiVersion"), p.APIVersion, err.Error()))
+	} else if warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if p.Kind != constants.PluginKind {
+		errs = append(errs, field.NotSupported(field.NewPath("kind"), p.Kind, []string{constants.PluginKind}))
+	}
+	if p.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("metadata", "name"), ""))
+	}
+	spec := field.NewPath("spec")
+	if p.Spec.Version == "" {
+		errs = append(errs, field.Required(spec.Child("version"), ""))
+	}
+	if len(p.Spec.Platforms) == 0 {
+		errs = append(errs, field.Required(spec.Child("platforms"), "must have at least one platform"))
+	}
+	for i, platform := range p.Spec.Platforms {
+		path := spec.Child("platforms").Index(i)
+		if platform.URI == "" {
+			errs = append(errs, field.Required(path.Child("uri"), ""))
+		}
+		if platform.Sha256 == "" && platform.Sha256URL == "" && platform.Sha512 == "" {
+			errs = append(errs, field.Required(path.Child("sha256"), "sha256, sha256URL or sha512 must be set"))
+		} else if platform.Sha256 != "" && !validSha256.MatchString(platform.Sha256) {
+			errs = append(errs, field.Invalid(path.Child("sha256"), platform.Sha256, "must be 64 lowercase hex characters"))
+		}
+		if platform.Sha512 != "" && !validSha512.MatchString(platform.Sha512) {
+			errs = append(errs, field.Invalid(path.Child("sha512"), platform.Sha512, "must be 128 lowercase hex characters"))
+		}
+		if platform.Bin == "" {
+			errs = append(errs, field.Required(path.Child("bin"), ""))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, warnings, errs.ToAggregate()
+	}
+	return &p, warnings, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const validManifest = `apiVersion: krew.googlecontainertools.github.com/v1alpha2
+kind: Plugin
+metadata:
+  name: foo
+spec:
+  version: v1.0.0
+  shortDescription: foo
+  newField: ignored
+  platforms:
+  - uri: https://example.com/foo.tar.gz
+    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e
+    bin: foo
+`
+
+func TestParseAndValidate(t *testing.T) {
+	p, err := ParseAndValidate([]byte(validManifest))
+	if err != nil {
+		t.Fatalf("ParseAndValidate() error = %v", err)
+	}
+	if p.Name != "foo" || p.Spec.Version != "v1.0.0" || len(p.Spec.Platforms) != 1 {
+		t.Errorf("ParseAndValidate() parsed unexpected plugin: %+v", p)
+	}
+}
+
+func TestParseAndValidate_manifestSHA256(t *testing.T) {
+	p, err := ParseAndValidate([]byte(validManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(validManifest))); p.ManifestSHA256 != want {
+		t.Errorf("ManifestSHA256 = %q, want %q", p.ManifestSHA256, want)
+	}
+
+	other, err := ParseAndValidate([]byte(validManifest + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ManifestSHA256 == p.ManifestSHA256 {
+		t.Error("manifests with different bytes have the same ManifestSHA256")
+	}
+}
+
+func TestParseAndValidate_sha256URL(t *testing.T) {
+	manifest := strings.Replace(validManifest,
+		"    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e\n",
+		"    sha256URL: https://example.com/checksums.txt\n", 1)
+	p, err := ParseAndValidate([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Spec.Platforms[0].Sha256URL; got != "https://example.com/checksums.txt" {
+		t.Errorf("unexpected sha256URL %q", got)
+	}
+}
+
+func TestParseAndValidate_sha512(t *testing.T) {
+	manifest := strings.Replace(validManifest,
+		"    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e\n",
+		"    sha512: 3088deeded990e27e39505fb3651d97512505a547ffcc36e601ed5ec63b77c7ee5b96d2a7343410334564129dabeb56cdf4dc170bf09d5f146e93119bf66b5c2\n", 1)
+	p, err := ParseAndValidate([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Spec.Platforms[0].Sha512; got != "3088deeded990e27e39505fb3651d97512505a547ffcc36e601ed5ec63b77c7ee5b96d2a7343410334564129dabeb56cdf4dc170bf09d5f146e93119bf66b5c2" {
+		t.Errorf("unexpected sha512 %q", got)
+	}
+}
+
+func TestCheckAPIVersion(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantWarning bool
+		wantErr     bool
+	}{
+		{in: "krew.googlecontainertools.github.com/v1alpha2"},
+		{in: "krew.googlecontainertools.github.com/v1alpha3", wantWarning: true},
+		{in: "krew.googlecontainertools.github.com/v1beta1", wantWarning: true},
+		{in: "krew.googlecontainertools.github.com/v1", wantWarning: true},
+		{in: "krew.googlecontainertools.github.com/v1alpha1", wantErr: true},
+		{in: "krew.googlecontainertools.github.com/v2alpha1", wantErr: true},
+		{in: "krew.googlecontainertools.github.com/v2", wantErr: true},
+		{in: "krew.googlecontainertools.github.com/latest", wantErr: true},
+		{in: "krew.googlecontainertools.github.com", wantErr: true},
+		{in: "networking.k8s.io/v1", wantErr: true},
+		{in: "v1alpha2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			warning, err := CheckAPIVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckAPIVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("CheckAPIVersion() warning = %q, wantWarning %v", warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestParseAndValidateWithWarnings_newerAPIVersion(t *testing.T) {
+	manifest := strings.Replace(validManifest, "/v1alpha2", "/v1beta1", 1)
+	p, warnings, err := ParseAndValidateWithWarnings([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "foo" {
+		t.Errorf("parsed unexpected plugin: %+v", p)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "v1beta1") {
+		t.Errorf("expected a warning about the newer apiVersion, got %q", warnings)
+	}
+
+	if _, warnings, err := ParseAndValidateWithWarnings([]byte(validManifest)); err != nil || len(warnings) != 0 {
+		t.Errorf("expected no warnings for the current apiVersion, got %q (err=%v)", warnings, err)
+	}
+}
+
+func TestParseAndValidate_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		manifest   string
+		wantFields []string
+	}{
+		{
+			name:       "not yaml",
+			manifest:   "{",
+			wantFields: []string{""},
+		},
+		{
+			name:       "unknown top-level field",
+			manifest:   validManifest + "status: {}\n",
+			wantFields: []string{"status"},
+		},
+		{
+			name:       "wrong kind",
+			manifest:   strings.Replace(validManifest, "kind: Plugin", "kind: Receipt", 1),
+			wantFields: []string{"kind"},
+		},
+		{
+			name: "missing name and version",
+			manifest: strings.NewReplacer("  name: foo\n", "  labels: {}\n",
+				"  version: v1.0.0\n", "").Replace(validManifest),
+			wantFields: []string{"metadata.name", "spec.version"},
+		},
+		{
+			name: "no platforms",
+			manifest: `apiVersion: krew.googlecontainertools.github.com/v1alpha2
+kind: Plugin
+metadata:
+  name: foo
+spec:
+  version: v1.0.0
+`,
+			wantFields: []string{"spec.platforms"},
+		},
+		{
+			name: "incomplete platform",
+			manifest: strings.NewReplacer("    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e\n", "",
+				"    bin: foo\n", "").Replace(validManifest),
+			wantFields: []string{"spec.platforms[0].sha256", "spec.platforms[0].bin"},
+		},
+		{
+			name:       "uppercase sha256",
+			manifest:   strings.Replace(validManifest, "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e", "433B9E0B6CB9F064548F451150799DAADCC70A3496953490C5148C8E550D2F4E", 1),
+			wantFields: []string{"spec.platforms[0].sha256"},
+		},
+		{
+			name:       "sha256 too short",
+			manifest:   strings.Replace(validManifest, "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e", "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4", 1),
+			wantFields: []string{"spec.platforms[0].sha256"},
+		},
+		{
+			name:       "sha256 too long",
+			manifest:   strings.Replace(validManifest, "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e", "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e0", 1),
+			wantFields: []string{"spec.platforms[0].sha256"},
+		},
+		{
+			name:       "non-hex sha256",
+			manifest:   strings.Replace(validManifest, "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e", "z33b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e", 1),
+			wantFields: []string{"spec.platforms[0].sha256"},
+		},
+		{
+			name:       "empty sha256",
+			manifest:   strings.Replace(validManifest, "433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e", `""`, 1),
+			wantFields: []string{"spec.platforms[0].sha256"},
+		},
+		{
+			name:       "incompatible apiVersion",
+			manifest:   strings.Replace(validManifest, "/v1alpha2", "/v2", 1),
+			wantFields: []string{"apiVersion"},
+		},
+		{
+			name: "sha512 too short",
+			manifest: strings.Replace(validManifest,
+				"    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e\n",
+				"    sha512: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e\n", 1),
+			wantFields: []string{"spec.platforms[0].sha512"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseAndValidate([]byte(tt.manifest))
+			if err == nil {
+				t.Fatalf("expected error, parsed: %+v", p)
+			}
+			for _, f := range tt.wantFields {
+				if !strings.Contains(err.Error(), f) {
+					t.Errorf("expected error for field %q, got: %v", f, err)
+				}
+			}
+		})
+	}
+}
@@ -24,6 +24,11 @@ type Plugin struct {
 	metav1.ObjectMeta `json:"metadata,omitempty" yaml:"metadata"`
 
 	Spec PluginSpec `json:"spec"`
+
+	// ManifestSHA256 is the hex-encoded sha256 sum of the manifest file the
+	// plugin was parsed from by ParseAndValidate. It is not a field of the
+	// manifest, and empty for plugins that were not parsed from a file.
+	ManifestSHA256 string `json:"-"`
 }
 
 // PluginSpec is the plugin specification.
@@ -34,6 +39,10 @@ type PluginSpec struct {
 	Caveats          string `json:"caveats,omitempty"`
 	Homepage         string `json:"homepage,omitempty"`
 
+	// Dependencies are the names of the plugins this plugin requires. They
+	// are installed from the same index before the plugin if missing.
+	Dependencies []string `json:"dependencies,omitempty"`
+
 	Platforms []Platform `json:"platforms,omitempty"`
 }
 
@@ -43,9 +52,34 @@ type Platform struct {
 	URI    string `json:"uri,omitempty"`
 	Sha256 string `json:"sha256,omitempty"`
 
+	// Sha256URL is the URI of a checksums file in the format of the sha256sum
+	// command, like a "checksums.txt" published with the release. If Sha256
+	// is not set, the sha256 sum listed for the file name of URI in this file
+	// is used.
+	Sha256URL string `json:"sha256URL,omitempty"`
+
+	// Sha512 is the sha512 sum of the archive at URI. It can be specified
+	// instead of Sha256, or together with it, in which case both sums are
+	// verified.
+	Sha512 string `json:"sha512,omitempty"`
+
+	// Mirrors are alternative URIs of the same archive, which are tried in
+	// order if the download from URI fails.
+	Mirrors []string `json:"mirrors,omitempty"`
+
+	// Signature is the URI of an optional ASCII-armored detached GPG
+	// signature of the archive at URI.
+	Signature string `json:"signature,omitempty"`
+
 	Selector *metav1.LabelSelector `json:"selector,omitempty"`
 	Files    []FileOperation       `json:"files"`
 
+	// StripComponents is the number of leading path components removed from
+	// the paths of the extracted files before the FileOperations are
+	// executed, like the --strip-components flag of tar. Files with fewer
+	// path components are dropped.
+	StripComponents int `json:"stripComponents,omitempty"`
+
 	// Bin specifies the path to the plugin executable.
 	// The path is relative to the root of the installation folder.
 	// The binary will be linked after all FileOperations are executed.
@@ -57,6 +91,16 @@ type Platform struct {
 type FileOperation struct {
 	From string `json:"from,omitempty"`
 	To   string `json:"to,omitempty"`
+
+	// Exclude lists glob patterns of files that are not copied. The patterns
+	// are matched against the slash-separated path relative to the archive
+	// root.
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Rename specifies that To is the file name to install the file matching
+	// From as, instead of the directory to move the matching files into. It
+	// is an error if From matches more than one file.
+	Rename bool `json:"rename,omitempty"`
 }
 
 // Receipt describes a plugin receipt file.
@@ -69,6 +113,63 @@ type Receipt struct {
 // ReceiptStatus contains information about the installed plugin.
 type ReceiptStatus struct {
 	Source SourceIndex `json:"source"`
+
+	// Install contains details about the installation of the plugin. It is
+	// not set in receipts written by older versions of krew.
+	Install *InstallStatus `json:"install,omitempty"`
+
+	// RetainedVersions lists the previously installed versions of the plugin
+	// that are kept on disk for rolling back, most recent first.
+	RetainedVersions []RetainedVersion `json:"retainedVersions,omitempty"`
+}
+
+// RetainedVersion describes a previously installed version of a plugin.
+type RetainedVersion struct {
+	Spec    PluginSpec     `json:"spec"`
+	Source  SourceIndex    `json:"source"`
+	Install *InstallStatus `json:"install,omitempty"`
+}
+
+// InstallStatus contains details about how a plugin was installed.
+type InstallStatus struct {
+	// URI is the location of the plugin archive.
+	URI string `json:"uri,omitempty"`
+
+	// Size is the size of the plugin archive in bytes.
+	Size int64 `json:"size,omitempty"`
+
+	// DownloadDuration is how long it took to download the plugin archive.
+	DownloadDuration metav1.Duration `json:"downloadDuration,omitempty"`
+
+	// Files lists the installed files of the plugin with their checksums.
+	Files []InstalledFile `json:"files,omitempty"`
+
+	// LinkType is how the plugin executable is made available in the bin
+	// directory. It is empty for a symbolic link, or "hardlink" or "copy" if
+	// symbolic links cannot be created (e.g. on Windows without the
+	// privilege to create them). It is "relative" for a symbolic link with a
+	// path relative to the bin directory, and "none" if the plugin was
+	// installed without a link in the bin directory.
+	LinkType string `json:"linkType,omitempty"`
+
+	// VersionedAlias is set if the plugin executable is also linked into the
+	// bin directory with a version-suffixed name (e.g. kubectl-foo@1.2.3),
+	// with the same LinkType, for using multiple versions side by side.
+	VersionedAlias bool `json:"versionedAlias,omitempty"`
+
+	// PreserveModes is set if the files of the plugin were extracted with the
+	// permission bits in the plugin archive, so that upgrades keep them too.
+	PreserveModes bool `json:"preserveModes,omitempty"`
+}
+
+// InstalledFile describes a file in the installation directory of a plugin.
+type InstalledFile struct {
+	// Path is the slash-separated path of the file relative to the
+	// installation directory.
+	Path string `json:"path"`
+
+	// SHA256 is the hex-encoded sha256 sum of the file contents.
+	SHA256 string `json:"sha256"`
 }
 
 // SourceIndex contains information about the index a plugin was installed from.
@@ -0,0 +1,147 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+const (
+	// archivedCacheTTL is how long the archived status of a repository is
+	// cached. Repositories are rarely archived or unarchived, so the status
+	// is looked up at most once a day.
+	archivedCacheTTL = 24 * time.Hour
+
+	// archivedFailureTTL is how long a failure to look up the archived status
+	// of a repository is cached, so that a lookup failing e.g. because of the
+	// GitHub API rate limit is not retried on every request.
+	archivedFailureTTL = 5 * time.Minute
+
+	// archivedLookupConcurrency is the number of repositories whose archived
+	// status is looked up in parallel.
+	archivedLookupConcurrency = 10
+)
+
+// repoArchivedFunc reports whether the GitHub repository owner/repo is
+// archived.
+type repoArchivedFunc func(ctx context.Context, owner, repo string) (bool, error)
+
+// githubRepoArchived looks up whether the repository is archived with the
+// GitHub API.
+func githubRepoArchived(ctx context.Context, owner, repo string) (bool, error) {
+	r, _, err := githubClient(ctx).Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return false, err
+	}
+	return r.GetArchived(), nil
+}
+
+// archivedCache caches the archived status of GitHub repositories, keyed by
+// their lowercase "owner/repo".
+type archivedCache struct {
+	mu         sync.Mutex
+	entries    map[string]archivedEntry
+	ttl        time.Duration
+	failureTTL time.Duration
+	lookup     repoArchivedFunc
+	now        func() time.Time
+}
+
+type archivedEntry struct {
+	archived bool
+	failed   bool
+	fetched  time.Time
+}
+
+func newArchivedCache(lookup repoArchivedFunc, ttl, failureTTL time.Duration, now func() time.Time) *archivedCache {
+	return &archivedCache{
+		entries:    make(map[string]archivedEntry),
+		ttl:        ttl,
+		failureTTL: failureTTL,
+		lookup:     lookup,
+		now:        now,
+	}
+}
+
+// archived reports whether the GitHub repository "owner/repo" is archived. It
+// returns false if the status cannot be determined. Repositories that do not
+// exist are cached as not archived, other lookup errors are cached for the
+// failure TTL.
+func (c *archivedCache) archived(ctx context.Context, repo string) bool {
+	key := strings.ToLower(repo)
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	ttl := c.ttl
+	if e.failed {
+		ttl = c.failureTTL
+	}
+	if ok && c.now().Sub(e.fetched) < ttl {
+		return e.archived
+	}
+
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return false
+	}
+	archived, err := c.lookup(ctx, parts[0], parts[1])
+	failed := false
+	if err != nil {
+		var ge *github.ErrorResponse
+		if !errors.As(err, &ge) || ge.Response == nil || ge.Response.StatusCode != http.StatusNotFound {
+			log.Printf("cannot determine if repository %s is archived: %v", repo, err)
+			if ctx.Err() != nil {
+				return false
+			}
+			archived, failed = false, true
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = archivedEntry{archived: archived, failed: failed, fetched: c.now()}
+	return archived
+}
+
+// annotateArchived sets the Archived field of the plugins whose GitHub
+// repository is known and archived.
+func (s *server) annotateArchived(ctx context.Context, plugins []pluginInfo) {
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < archivedLookupConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				plugins[j].Archived = s.archived.archived(ctx, plugins[j].GithubRepo)
+			}
+		}()
+	}
+	for i, p := range plugins {
+		if p.GithubRepo != "" {
+			queue <- i
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
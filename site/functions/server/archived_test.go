@@ -0,0 +1,147 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// fakeArchivedLookup reports the repositories in archived as archived and
+// counts the lookups of each repository.
+type fakeArchivedLookup struct {
+	mu       sync.Mutex
+	archived map[string]bool
+	err      map[string]error
+	calls    map[string]int
+}
+
+func (f *fakeArchivedLookup) lookup(_ context.Context, owner, repo string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[owner+"/"+repo]++
+	return f.archived[owner+"/"+repo], f.err[owner+"/"+repo]
+}
+
+func Test_archivedCache(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	notFound := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	f := &fakeArchivedLookup{
+		archived: map[string]bool{"foo/old": true},
+		err: map[string]error{
+			"foo/gone":  notFound,
+			"foo/error": errors.New("rate limited"),
+		},
+	}
+	c := newArchivedCache(f.lookup, time.Hour, time.Minute, func() time.Time { return now })
+	ctx := context.Background()
+
+	tests := []struct {
+		repo      string
+		want      bool
+		wantCalls int
+	}{
+		{repo: "foo/old", want: true, wantCalls: 1},
+		{repo: "FOO/Old", want: true, wantCalls: 0}, // cached as foo/old
+		{repo: "foo/new", want: false, wantCalls: 1},
+		{repo: "foo/gone", want: false, wantCalls: 1},
+		{repo: "foo/error", want: false, wantCalls: 1}, // failure cached
+		{repo: "invalid", want: false, wantCalls: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				if got := c.archived(ctx, tt.repo); got != tt.want {
+					t.Errorf("archived(%q) = %v, want %v", tt.repo, got, tt.want)
+				}
+			}
+			if got := f.calls[tt.repo]; got != tt.wantCalls {
+				t.Errorf("looked up %q %d times, want %d", tt.repo, got, tt.wantCalls)
+			}
+		})
+	}
+
+	now = now.Add(time.Minute)
+	c.archived(ctx, "foo/error")
+	c.archived(ctx, "foo/old")
+	if got := f.calls["foo/error"]; got != 2 {
+		t.Errorf("looked up expired failure %d times in total, want 2", got)
+	}
+	if got := f.calls["foo/old"]; got != 1 {
+		t.Errorf("looked up unexpired entry %d times in total, want 1", got)
+	}
+
+	now = now.Add(2 * time.Hour)
+	c.archived(ctx, "foo/old")
+	if got := f.calls["foo/old"]; got != 2 {
+		t.Errorf("looked up expired entry %d times in total, want 2", got)
+	}
+}
+
+func TestHandlers_archived(t *testing.T) {
+	s := newServer(dirSource{dir: newTestIndexDir(t, "foo", "bar", "baz")}, defaultCacheTTL, time.Now)
+	f := &fakeArchivedLookup{archived: map[string]bool{"foo/bar": true}}
+	s.archived = newArchivedCache(f.lookup, archivedCacheTTL, archivedFailureTTL, time.Now)
+
+	tests := []struct {
+		path string
+		want map[string]bool
+	}{
+		{path: "/.netlify/functions/api/plugins", want: map[string]bool{"bar": false, "baz": false, "foo": false}},
+		{path: "/.netlify/functions/api/plugins?fields=archived", want: map[string]bool{"bar": true, "baz": false, "foo": false}},
+		{path: "/.netlify/functions/api/search?q=ba&fields=platforms,archived", want: map[string]bool{"bar": true, "baz": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if req.URL.Path == "/.netlify/functions/api/search" {
+				s.searchHandler(w, req)
+			} else {
+				s.pluginsHandler(w, req)
+			}
+			var resp PluginsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]bool)
+			for _, p := range resp.Data.Plugins {
+				got[p.Name] = p.Archived
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got plugins %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("plugin %q archived = %v, want %v", name, got[name], want)
+				}
+			}
+		})
+	}
+	if got := f.calls["foo/foo"]; got != 1 {
+		t.Errorf("looked up foo/foo %d times, want 1 (cached)", got)
+	}
+}
@@ -16,16 +16,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -34,7 +37,6 @@ import (
 	"github.com/google/go-github/v32/github"
 	"golang.org/x/oauth2"
 	krew "sigs.k8s.io/krew/pkg/index"
-	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -43,13 +45,115 @@ const (
 	pluginsDir = "plugins"
 
 	urlFetchBatchSize = 40
-	cacheSeconds      = 60 * 60
+
+	// defaultCacheTTL is how long the responses can be cached, unless
+	// overridden by the cacheTTLEnv environment variable.
+	defaultCacheTTL = time.Hour
+	cacheTTLEnv     = "KREW_CACHE_TTL"
+
+	// contentsPageSize is the number of entries requested per page when
+	// listing the plugins directory.
+	contentsPageSize = 100
+
+	// defaultUserAgent is the User-Agent header of the requests made by the
+	// function, unless overridden by the userAgentEnv environment variable.
+	defaultUserAgent = "krew-website (+https://krew.sigs.k8s.io)"
+	userAgentEnv     = "KREW_USER_AGENT"
 )
 
 var (
-	githubRepoPattern = regexp.MustCompile(`.*github\.com/([^/]+/[^/#]+)`)
+	// knownHomePages maps the homepages of the plugins hosted on GitHub that are
+	// not repository URLs to their "owner/repo".
+	knownHomePages = map[string]string{
+		`https://krew.sigs.k8s.io/`:                                  "kubernetes-sigs/krew",
+		`https://sigs.k8s.io/krew`:                                   "kubernetes-sigs/krew",
+		`https://kubernetes.github.io/ingress-nginx/kubectl-plugin/`: "kubernetes/ingress-nginx",
+		`https://kudo.dev/`:                                          "kudobuilder/kudo",
+		`https://kubevirt.io`:                                        "kubevirt/kubectl-virt-plugin",
+		`https://popeyecli.io`:                                       "derailed/popeye",
+		`https://soluble-ai.github.io/kubetap/`:                      "soluble-ai/kubetap",
+	}
+
+	// manifests caches the parsed plugin manifests across invocations, keyed
+	// by the git blob SHA of the manifest file, so that unchanged manifests
+	// are not downloaded again.
+	manifests = &manifestCache{entries: make(map[string]*krew.Plugin)}
 )
 
+// server serves the plugin API from a PluginSource.
+type server struct {
+	source   PluginSource
+	cacheTTL time.Duration
+	now      func() time.Time
+	archived *archivedCache
+	updated  *updatedCache
+}
+
+// newServer returns a server reading the plugin manifests from source, whose
+// responses can be cached for cacheTTL. The now function is the clock used to
+// compute the cache and retry headers.
+func newServer(source PluginSource, cacheTTL time.Duration, now func() time.Time) *server {
+	return &server{
+		source:   source,
+		cacheTTL: cacheTTL,
+		now:      now,
+		archived: newArchivedCache(githubRepoArchived, archivedCacheTTL, archivedFailureTTL, now),
+		updated:  newUpdatedCache(updatedFailureTTL, now),
+	}
+}
+
+// cacheTTLFromEnv returns the cache TTL configured by the cacheTTLEnv
+// environment variable as a duration like "15m", or defaultCacheTTL if it is
+// unset or invalid.
+func cacheTTLFromEnv() time.Duration {
+	v := os.Getenv(cacheTTLEnv)
+	if v == "" {
+		return defaultCacheTTL
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("ignoring invalid %s=%q, using %v", cacheTTLEnv, v, defaultCacheTTL)
+		return defaultCacheTTL
+	}
+	return d
+}
+
+// setCacheHeaders marks the response as cacheable for the cache TTL of the
+// server.
+func (s *server) setCacheHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.cacheTTL.Seconds())))
+	w.Header().Set("Expires", s.now().Add(s.cacheTTL).UTC().Format(http.TimeFormat))
+}
+
+type manifestCache struct {
+	mu      sync.Mutex
+	entries map[string]*krew.Plugin
+}
+
+func (c *manifestCache) get(sha string) (*krew.Plugin, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.entries[sha]
+	return p, ok
+}
+
+func (c *manifestCache) put(sha string, p *krew.Plugin) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[sha] = p
+}
+
+// retain drops the cached manifests whose SHA is not in the given set.
+func (c *manifestCache) retain(shas map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if !shas[k] {
+			delete(c.entries, k)
+		}
+	}
+}
+
 type PluginCountResponse struct {
 	Data struct {
 		Count int `json:"count"`
@@ -58,14 +162,92 @@ type PluginCountResponse struct {
 }
 
 type pluginInfo struct {
-	Name             string `json:"name,omitempty"`
-	Homepage         string `json:"homepage,omitempty"`
-	ShortDescription string `json:"short_description,omitempty"`
-	GithubRepo       string `json:"github_repo,omitempty"`
+	Name             string      `json:"name,omitempty"`
+	Homepage         string      `json:"homepage,omitempty"`
+	ShortDescription string      `json:"short_description,omitempty"`
+	GithubRepo       string      `json:"github_repo,omitempty"`
+	SourceRepo       *sourceRepo `json:"source_repo,omitempty"`
+
+	// Version and Platforms are only populated when requested with
+	// ?fields=platforms.
+	Version   string         `json:"version,omitempty"`
+	Platforms []platformInfo `json:"platforms,omitempty"`
+
+	// Archived is set if the GitHub repository of the plugin is archived. It
+	// is only populated when requested with ?fields=archived.
+	Archived bool `json:"archived,omitempty"`
+
+	// UpdatedAt is the time of the last commit to the plugin manifest. It is
+	// only populated when requested with ?fields=updated_at.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// platformInfo describes the os/arch values a plugin platform is selected for.
+// An empty list means the platform is not restricted on that key.
+type platformInfo struct {
+	OS   []string `json:"os,omitempty"`
+	Arch []string `json:"arch,omitempty"`
+}
+
+// sourceRepo is the source code repository of a plugin.
+type sourceRepo struct {
+	Host  string `json:"host"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
 }
 
 type ErrorResponse struct {
 	Message string `json:"message,omitempty"`
+
+	// RateLimited is set if the request failed because the GitHub API rate
+	// limit was exceeded, and RetryAfterSeconds is when to retry.
+	RateLimited       bool `json:"rate_limited,omitempty"`
+	RetryAfterSeconds int  `json:"retry_after_seconds,omitempty"`
+}
+
+// defaultRetryAfter is the back-off advertised for the GitHub abuse rate
+// limit if GitHub does not specify one.
+const defaultRetryAfter = time.Minute
+
+// errorResponse writes the status code and headers of the response for err,
+// which is http 429 with a Retry-After header if the GitHub API rate limit was
+// exceeded, and http 500 otherwise. It returns the error for the body.
+func (s *server) errorResponse(w http.ResponseWriter, err error) ErrorResponse {
+	retryAfter, limited := rateLimitRetryAfter(err, s.now())
+	if !limited {
+		w.WriteHeader(http.StatusInternalServerError)
+		return ErrorResponse{Message: err.Error()}
+	}
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	log.Printf("github rate limit exceeded, retry after %ds: %v", secs, err)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.WriteHeader(http.StatusTooManyRequests)
+	return ErrorResponse{
+		Message:           err.Error(),
+		RateLimited:       true,
+		RetryAfterSeconds: secs,
+	}
+}
+
+// rateLimitRetryAfter reports whether err is caused by exceeding a GitHub API
+// rate limit, and how long to wait from now until the limit is reset.
+func rateLimitRetryAfter(err error, now time.Time) (time.Duration, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return rateErr.Rate.Reset.Time.Sub(now), true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return defaultRetryAfter, true
+	}
+	return 0, false
 }
 
 type PluginsResponse struct {
@@ -75,6 +257,14 @@ type PluginsResponse struct {
 	Error ErrorResponse `json:"error"`
 }
 
+// PluginResponse is the response of the plugin endpoint.
+type PluginResponse struct {
+	Data struct {
+		Plugin *krew.Plugin `json:"plugin,omitempty"`
+	} `json:"data,omitempty"`
+	Error ErrorResponse `json:"error"`
+}
+
 func githubClient(ctx context.Context) *github.Client {
 	var hc *http.Client
 
@@ -85,29 +275,59 @@ func githubClient(ctx context.Context) *github.Client {
 		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: v})
 		hc = oauth2.NewClient(ctx, ts)
 	}
-	return github.NewClient(hc)
+	client := github.NewClient(hc)
+	client.UserAgent = userAgent()
+	return client
 }
 
-func pluginCountHandler(w http.ResponseWriter, req *http.Request) {
-	_, dir, resp, err := githubClient(req.Context()).
-		Repositories.GetContents(req.Context(), orgName, repoName, pluginsDir, &github.RepositoryContentGetOptions{})
+// userAgent returns the User-Agent header of the requests made by the
+// function, which can be overridden with the KREW_USER_AGENT environment
+// variable.
+func userAgent() string {
+	if v := os.Getenv(userAgentEnv); v != "" {
+		return v
+	}
+	return defaultUserAgent
+}
+
+func (s *server) pluginCountHandler(w http.ResponseWriter, req *http.Request) {
+	count, err := s.source.Count(req.Context())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		writeJSON(w, PluginCountResponse{Error: ErrorResponse{Message: fmt.Sprintf("error retrieving repo contents: %v", err)}})
+		writeJSON(w, PluginCountResponse{Error: s.errorResponse(w, err)})
 		return
 	}
-	yamls := filterYAMLs(dir)
-	count := len(yamls)
-	log.Printf("github response=%s count=%d rate: limit=%d remaining=%d",
-		resp.Status, count, resp.Rate.Limit, resp.Rate.Remaining)
 
 	var out PluginCountResponse
 	out.Data.Count = count
 
-	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", cacheSeconds))
+	s.setCacheHeaders(w)
 	writeJSON(w, out)
 }
 
+// listPluginEntries returns the entries of the plugins directory of the index
+// repository. The GitHub API paginates large directory listings, so all pages
+// are fetched and aggregated. It returns the response of the last page.
+func listPluginEntries(ctx context.Context, client *github.Client) ([]*github.RepositoryContent, *github.Response, error) {
+	var out []*github.RepositoryContent
+	for page := 1; ; {
+		u := fmt.Sprintf("repos/%s/%s/contents/%s?per_page=%d&page=%d", orgName, repoName, pluginsDir, contentsPageSize, page)
+		req, err := client.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		var entries []*github.RepositoryContent
+		resp, err := client.Do(ctx, req, &entries)
+		if err != nil {
+			return nil, resp, err
+		}
+		out = append(out, entries...)
+		if resp.NextPage <= page {
+			return out, resp, nil
+		}
+		page = resp.NextPage
+	}
+}
+
 func writeJSON(w io.Writer, v interface{}) {
 	e := json.NewEncoder(w)
 	e.SetIndent("", "  ")
@@ -140,52 +360,335 @@ func loggingHandler(f http.Handler) http.Handler {
 	})
 }
 
-func pluginsHandler(w http.ResponseWriter, req *http.Request) {
-	_, dir, resp, err := githubClient(req.Context()).
-		Repositories.GetContents(req.Context(), orgName, repoName, pluginsDir, &github.RepositoryContentGetOptions{})
+func (s *server) pluginsHandler(w http.ResponseWriter, req *http.Request) {
+	plugins, err := s.listPlugins(req.Context(), hasField(req, "platforms"))
+	if err == nil {
+		err = s.annotatePlugins(req, plugins)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		writeJSON(w, PluginsResponse{Error: ErrorResponse{Message: fmt.Sprintf("error retrieving repo contents: %v", err)}})
+		writeJSON(w, PluginsResponse{Error: s.errorResponse(w, err)})
 		return
 	}
-	log.Printf("github response=%s rate: limit=%d remaining=%d",
-		resp.Status, resp.Rate.Limit, resp.Rate.Remaining)
+
 	var out PluginsResponse
+	out.Data.Plugins = plugins
+	s.setCacheHeaders(w)
+	writeJSON(w, out)
+}
+
+// pluginsNDJSONHandler streams the info of the plugins as newline-delimited
+// JSON, one object per line, as each manifest is parsed. An error while
+// streaming is written as a final line of the form {"error": {...}}.
+func (s *server) pluginsNDJSONHandler(w http.ResponseWriter, req *http.Request) {
+	withPlatforms, withArchived := hasField(req, "platforms"), hasField(req, "archived")
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	fw := &flushWriter{w: w}
+	e := json.NewEncoder(fw)
+	var updated map[string]time.Time
+	var err error
+	if hasField(req, "updated_at") {
+		updated, err = s.source.UpdatedTimes(req.Context(), nil, s.updated)
+	}
+	if err == nil {
+		err = s.source.StreamPlugins(req.Context(), func(p *krew.Plugin) error {
+			pi := newPluginInfo(p, withPlatforms)
+			if withArchived && pi.GithubRepo != "" {
+				pi.Archived = s.archived.archived(req.Context(), pi.GithubRepo)
+			}
+			setUpdatedAt(&pi, updated)
+			return e.Encode(pi)
+		})
+	}
+	if err == nil {
+		return
+	}
+	log.Printf("error streaming plugins: %v", err)
+	var out ndjsonError
+	if fw.wrote {
+		// the status code has already been sent
+		out.Error = ErrorResponse{Message: err.Error()}
+	} else {
+		out.Error = s.errorResponse(w, err)
+	}
+	if err := e.Encode(out); err != nil {
+		log.Printf("json write error: %v", err)
+	}
+}
 
-	plugins, err := fetchPlugins(filterYAMLs(dir))
+// ndjsonError is the last line of a newline-delimited JSON stream that failed.
+type ndjsonError struct {
+	Error ErrorResponse `json:"error"`
+}
+
+// flushWriter flushes the response after each write, so that the client
+// receives each line of a stream as soon as it is written.
+type flushWriter struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.wrote = true
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
+
+func (s *server) searchHandler(w http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	if q == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, PluginsResponse{Error: ErrorResponse{Message: "missing search term in query parameter \"q\""}})
+		return
+	}
+	limit := -1
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, PluginsResponse{Error: ErrorResponse{Message: fmt.Sprintf("invalid limit %q", v)}})
+			return
+		}
+		limit = n
+	}
+
+	plugins, err := s.listPlugins(req.Context(), hasField(req, "platforms"))
+	if err == nil {
+		// only annotate the matching plugins
+		plugins = searchPlugins(plugins, q, limit)
+		err = s.annotatePlugins(req, plugins)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		writeJSON(w, PluginsResponse{Error: ErrorResponse{Message: fmt.Sprintf("failed to fetch plugins: %v", err)}})
+		writeJSON(w, PluginsResponse{Error: s.errorResponse(w, err)})
 		return
 	}
 
+	var out PluginsResponse
+	out.Data.Plugins = plugins
+	s.setCacheHeaders(w)
+	writeJSON(w, out)
+}
+
+func (s *server) pluginHandler(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimSpace(req.URL.Query().Get("name"))
+	if !validPluginName.MatchString(name) {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, PluginResponse{Error: ErrorResponse{Message: fmt.Sprintf("invalid plugin name %q in query parameter \"name\"", name)}})
+		return
+	}
+
+	plugin, err := s.source.Plugin(req.Context(), name)
+	if errors.Is(err, errPluginNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, PluginResponse{Error: ErrorResponse{Message: fmt.Sprintf("plugin %q not found", name)}})
+		return
+	} else if err != nil {
+		writeJSON(w, PluginResponse{Error: s.errorResponse(w, err)})
+		return
+	}
+
+	var out PluginResponse
+	out.Data.Plugin = plugin
+	s.setCacheHeaders(w)
+	writeJSON(w, out)
+}
+
+// listPlugins returns the info of all plugins in the index. Version and
+// platforms are only populated if withPlatforms is set.
+func (s *server) listPlugins(ctx context.Context, withPlatforms bool) ([]pluginInfo, error) {
+	plugins, err := s.source.Plugins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []pluginInfo
 	for _, v := range plugins {
-		log.Printf("short description: %#v", v.Spec)
-		pi := pluginInfo{
-			Name:             v.Name,
-			Homepage:         v.Spec.Homepage,
-			ShortDescription: v.Spec.ShortDescription,
-			GithubRepo:       findRepo(v.Spec.Homepage),
+		out = append(out, newPluginInfo(v, withPlatforms))
+	}
+	return out, nil
+}
+
+// annotatePlugins populates the optional fields of the plugins that are
+// requested in the "fields" query parameter of the request, other than
+// platforms.
+func (s *server) annotatePlugins(req *http.Request, plugins []pluginInfo) error {
+	if hasField(req, "archived") {
+		s.annotateArchived(req.Context(), plugins)
+	}
+	if hasField(req, "updated_at") && len(plugins) > 0 {
+		// only the times of the given plugins are looked up
+		names := make([]string, 0, len(plugins))
+		for _, p := range plugins {
+			names = append(names, p.Name)
+		}
+		updated, err := s.source.UpdatedTimes(req.Context(), names, s.updated)
+		if err != nil {
+			return err
+		}
+		for i := range plugins {
+			setUpdatedAt(&plugins[i], updated)
 		}
-		out.Data.Plugins = append(out.Data.Plugins, pi)
 	}
+	return nil
+}
 
-	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", cacheSeconds))
-	writeJSON(w, out)
+// setUpdatedAt sets the UpdatedAt field of the plugin from the given times,
+// keyed by plugin name, if it is known.
+func setUpdatedAt(p *pluginInfo, updated map[string]time.Time) {
+	if t, ok := updated[p.Name]; ok {
+		t := t.UTC()
+		p.UpdatedAt = &t
+	}
+}
+
+// newPluginInfo returns the info of the plugin. Version and platforms are only
+// populated if withPlatforms is set.
+func newPluginInfo(v *krew.Plugin, withPlatforms bool) pluginInfo {
+	pi := pluginInfo{
+		Name:             v.Name,
+		Homepage:         v.Spec.Homepage,
+		ShortDescription: v.Spec.ShortDescription,
+		GithubRepo:       findRepo(v.Spec.Homepage),
+		SourceRepo:       findSourceRepo(v.Spec.Homepage),
+	}
+	if withPlatforms {
+		pi.Version = v.Spec.Version
+		for _, p := range v.Spec.Platforms {
+			pi.Platforms = append(pi.Platforms, platformSelectors(p))
+		}
+	}
+	return pi
 }
 
-func fetchPlugins(entries []*github.RepositoryContent) ([]*krew.Plugin, error) {
-	ctx := context.Background()
+// searchPlugins returns the plugins whose name or short description contain
+// the search term, case-insensitively. Exact name matches are ranked first,
+// followed by name prefix matches, other name matches and description
+// matches. A negative limit returns all matches.
+func searchPlugins(plugins []pluginInfo, q string, limit int) []pluginInfo {
+	q = strings.ToLower(q)
+	rank := func(p pluginInfo) int {
+		name := strings.ToLower(p.Name)
+		switch {
+		case name == q:
+			return 0
+		case strings.HasPrefix(name, q):
+			return 1
+		case strings.Contains(name, q):
+			return 2
+		case strings.Contains(strings.ToLower(p.ShortDescription), q):
+			return 3
+		default:
+			return -1
+		}
+	}
+
+	type match struct {
+		plugin pluginInfo
+		rank   int
+	}
+	var matches []match
+	for _, p := range plugins {
+		if r := rank(p); r >= 0 {
+			matches = append(matches, match{p, r})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].plugin.Name < matches[j].plugin.Name
+	})
+	if limit >= 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	out := make([]pluginInfo, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, m.plugin)
+	}
+	return out
+}
+
+// hasField reports whether the comma-separated "fields" query parameter of the
+// request contains the given field.
+func hasField(req *http.Request, field string) bool {
+	for _, v := range req.URL.Query()["fields"] {
+		for _, f := range strings.Split(v, ",") {
+			if strings.TrimSpace(f) == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// platformSelectors extracts the os and arch values from the label selector
+// of the platform, from both matchLabels and "In" matchExpressions.
+func platformSelectors(p krew.Platform) platformInfo {
+	var out platformInfo
+	if p.Selector == nil {
+		return out
+	}
+	add := func(key string, values ...string) {
+		switch key {
+		case "os":
+			out.OS = append(out.OS, values...)
+		case "arch":
+			out.Arch = append(out.Arch, values...)
+		}
+	}
+	for k, v := range p.Selector.MatchLabels {
+		add(k, v)
+	}
+	for _, expr := range p.Selector.MatchExpressions {
+		if expr.Operator == "In" {
+			add(expr.Key, expr.Values...)
+		}
+	}
+	return out
+}
+
+// fetchPlugins returns the plugin manifests for the given entries, only
+// downloading the manifests that are not in the cache.
+func fetchPlugins(ctx context.Context, entries []*github.RepositoryContent) ([]*krew.Plugin, error) {
+	var out []*krew.Plugin
+	err := streamPlugins(ctx, entries, func(p *krew.Plugin) error {
+		out = append(out, p)
+		return nil
+	})
+	return out, err
+}
+
+// streamPlugins calls fn with the plugin manifest of each of the given entries
+// as soon as it is parsed, only downloading the manifests that are not in the
+// cache. The calls to fn are serialized. If fn returns an error, streaming
+// stops and the error is returned.
+func streamPlugins(ctx context.Context, entries []*github.RepositoryContent, fn func(*krew.Plugin) error) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	var (
 		mu     sync.Mutex
-		out    []*krew.Plugin
 		retErr error
 	)
 
-	queue := make(chan string)
+	shas := make(map[string]bool)
+	var misses []*github.RepositoryContent
+	for _, v := range entries {
+		shas[v.GetSHA()] = true
+		if p, ok := manifests.get(v.GetSHA()); ok {
+			if err := fn(p); err != nil {
+				return err
+			}
+			continue
+		}
+		misses = append(misses, v)
+	}
+	log.Printf("manifest cache: hits=%d misses=%d", len(entries)-len(misses), len(misses))
+
+	queue := make(chan *github.RepositoryContent)
 	var wg sync.WaitGroup
 
 	for i := 0; i < urlFetchBatchSize; i++ {
@@ -196,84 +699,151 @@ func fetchPlugins(entries []*github.RepositoryContent) ([]*krew.Plugin, error) {
 				select {
 				case <-ctx.Done():
 					return
-				case url, ok := <-queue:
+				case entry, ok := <-queue:
 					if !ok {
 						return
 					}
-					p, err := readPlugin(url)
-					if err != nil {
+					p, err := readPlugin(ctx, entry.GetDownloadURL())
+					if err == nil {
+						manifests.put(entry.GetSHA(), p)
+					}
+					mu.Lock()
+					if err == nil && retErr == nil {
+						err = fn(p)
+					}
+					if err != nil && retErr == nil {
 						retErr = err
+					}
+					mu.Unlock()
+					if err != nil {
 						cancel()
 						return
 					}
-					mu.Lock()
-					out = append(out, p)
-					mu.Unlock()
 				}
 			}
 		}(i)
 	}
 
-	for _, v := range entries {
-		url := v.GetDownloadURL()
+loop:
+	for _, v := range misses {
 		select {
 		case <-ctx.Done():
-			break
-		case queue <- url:
+			break loop
+		case queue <- v:
 		}
 	}
 
 	close(queue)
 	wg.Wait()
 
-	return out, retErr
+	if retErr == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		manifests.retain(shas)
+	}
+	return retErr
 }
 
-func readPlugin(url string) (*krew.Plugin, error) {
-	resp, err := http.Get(url)
+// readPlugin fetches and validates the plugin manifest at url. The request is
+// aborted if ctx is cancelled.
+func readPlugin(ctx context.Context, url string) (*krew.Plugin, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %s: %w", url, err)
 	}
 	if resp.Body != nil {
 		defer resp.Body.Close()
 	}
-	var v krew.Plugin
-
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s: unexpected http status %s", url, resp.Status)
+	}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", url, err)
 	}
 
-	if err = yaml.Unmarshal(b, &v); err != nil {
-		return nil, fmt.Errorf("failed to parse plugin manifest for %s: %w", url, err)
+	v, err := krew.ParseAndValidate(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest %s: %w", url, err)
+	}
+	return v, nil
+}
+
+// parseSourceRepo extracts the hosting service and repository from the
+// homepage of a plugin. It recognizes github.com, gitlab.com (including
+// subgroups) and bitbucket.org URLs, and falls back to knownHomePages for the
+// plugins whose homepage is not a repository URL. It returns empty strings if
+// the repository cannot be determined.
+func parseSourceRepo(homepage string) (host, owner, repo string) {
+	raw := homepage
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	if u, err := url.Parse(raw); err == nil {
+		host = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		path := u.Path
+		if i := strings.Index(path, "/-/"); i >= 0 {
+			path = path[:i]
+		}
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		if len(parts) >= 2 {
+			switch host {
+			case "github.com", "bitbucket.org":
+				return host, parts[0], strings.TrimSuffix(parts[1], ".git")
+			case "gitlab.com":
+				n := len(parts) - 1
+				return host, strings.Join(parts[:n], "/"), strings.TrimSuffix(parts[n], ".git")
+			}
+		}
+	}
+
+	if v, ok := knownHomePages[homepage]; ok {
+		parts := strings.SplitN(v, "/", 2)
+		return "github.com", parts[0], parts[1]
 	}
-	return &v, nil
+	return "", "", ""
 }
 
+// findRepo returns the "owner/repo" of the plugin if it is hosted on GitHub.
 func findRepo(homePage string) string {
-	if matches := githubRepoPattern.FindStringSubmatch(homePage); matches != nil {
-		return matches[1]
+	if host, owner, repo := parseSourceRepo(homePage); host == "github.com" {
+		return owner + "/" + repo
 	}
+	return ""
+}
 
-	knownHomePages := map[string]string{
-		`https://krew.sigs.k8s.io/`:                                  "kubernetes-sigs/krew",
-		`https://sigs.k8s.io/krew`:                                   "kubernetes-sigs/krew",
-		`https://kubernetes.github.io/ingress-nginx/kubectl-plugin/`: "kubernetes/ingress-nginx",
-		`https://kudo.dev/`:                                          "kudobuilder/kudo",
-		`https://kubevirt.io`:                                        "kubevirt/kubectl-virt-plugin",
-		`https://popeyecli.io`:                                       "derailed/popeye",
-		`https://soluble-ai.github.io/kubetap/`:                      "soluble-ai/kubetap",
+// findSourceRepo returns the repository of the plugin on any of the supported
+// hosting services, or nil if it is not known.
+func findSourceRepo(homePage string) *sourceRepo {
+	host, owner, repo := parseSourceRepo(homePage)
+	if host == "" {
+		return nil
+	}
+	return &sourceRepo{
+		Host:  host,
+		Owner: owner,
+		Name:  repo,
+		URL:   fmt.Sprintf("https://%s/%s/%s", host, owner, repo),
 	}
-	return knownHomePages[homePage]
 }
 
 func main() {
 	port := flag.Int("port", -1, "specify a port to use http rather than AWS Lambda")
 	flag.Parse()
+	s := newServer(newPluginSource(), cacheTTLFromEnv(), time.Now)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/.netlify/functions/api/pluginCount", pluginCountHandler)
-	mux.HandleFunc("/.netlify/functions/api/plugins", pluginsHandler)
+	mux.HandleFunc("/.netlify/functions/api/pluginCount", s.pluginCountHandler)
+	mux.HandleFunc("/.netlify/functions/api/plugins", s.pluginsHandler)
+	mux.HandleFunc("/.netlify/functions/api/plugins.ndjson", s.pluginsNDJSONHandler)
+	mux.HandleFunc("/.netlify/functions/api/plugin", s.pluginHandler)
+	mux.HandleFunc("/.netlify/functions/api/search", s.searchHandler)
 	// To debug locally, you can run this server with -port=:8080 and run "hugo serve" and uncomment this:
 	mux.Handle("/", httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: "localhost:1313"}))
 
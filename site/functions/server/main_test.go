@@ -0,0 +1,326 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_parseSourceRepo(t *testing.T) {
+	tests := []struct {
+		homepage  string
+		wantHost  string
+		wantOwner string
+		wantRepo  string
+	}{
+		{"https://github.com/ahmetb/kubectx", "github.com", "ahmetb", "kubectx"},
+		{"https://github.com/ahmetb/kubectx/tree/master/cmd#readme", "github.com", "ahmetb", "kubectx"},
+		{"http://www.github.com/ahmetb/kubectx.git", "github.com", "ahmetb", "kubectx"},
+		{"github.com/ahmetb/kubectx", "github.com", "ahmetb", "kubectx"},
+		{"https://gitlab.com/foo/bar", "gitlab.com", "foo", "bar"},
+		{"https://gitlab.com/foo/subgroup/bar/-/tree/master", "gitlab.com", "foo/subgroup", "bar"},
+		{"https://bitbucket.org/foo/bar/src/master/", "bitbucket.org", "foo", "bar"},
+		{"https://krew.sigs.k8s.io/", "github.com", "kubernetes-sigs", "krew"},
+		{"https://github.com/ahmetb", "", "", ""},
+		{"https://example.com/foo/bar", "", "", ""},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.homepage, func(t *testing.T) {
+			host, owner, repo := parseSourceRepo(tt.homepage)
+			if host != tt.wantHost || owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("parseSourceRepo(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tt.homepage, host, owner, repo, tt.wantHost, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+}
+
+func Test_findRepo(t *testing.T) {
+	tests := []struct {
+		homepage string
+		want     string
+	}{
+		{"https://github.com/ahmetb/kubectx", "ahmetb/kubectx"},
+		{"https://kudo.dev/", "kudobuilder/kudo"},
+		{"https://gitlab.com/foo/bar", ""},
+		{"https://example.com", ""},
+	}
+	for _, tt := range tests {
+		if got := findRepo(tt.homepage); got != tt.want {
+			t.Errorf("findRepo(%q) = %q, want %q", tt.homepage, got, tt.want)
+		}
+	}
+}
+
+// githubResponse returns the response a go-github error is created for.
+func githubResponse() *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusForbidden,
+		Request:    httptest.NewRequest(http.MethodGet, "https://api.github.com/repos/kubernetes-sigs/krew-index/contents/plugins", nil),
+	}
+}
+
+func Test_errorResponse(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	retryAfter := 30 * time.Second
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantLimited bool
+		minSecs     int
+		maxSecs     int
+	}{
+		{
+			name:       "other error",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "rate limit",
+			err: fmt.Errorf("error retrieving repo contents: %w", &github.RateLimitError{Response: githubResponse(),
+				Rate: github.Rate{Reset: github.Timestamp{Time: now.Add(90 * time.Second)}}}),
+			wantStatus:  http.StatusTooManyRequests,
+			wantLimited: true,
+			minSecs:     90,
+			maxSecs:     90,
+		},
+		{
+			name: "rate limit already reset",
+			err: &github.RateLimitError{Response: githubResponse(),
+				Rate: github.Rate{Reset: github.Timestamp{Time: now.Add(-time.Minute)}}},
+			wantStatus:  http.StatusTooManyRequests,
+			wantLimited: true,
+			minSecs:     1,
+			maxSecs:     1,
+		},
+		{
+			name:        "abuse rate limit",
+			err:         fmt.Errorf("failed: %w", &github.AbuseRateLimitError{Response: githubResponse(), RetryAfter: &retryAfter}),
+			wantStatus:  http.StatusTooManyRequests,
+			wantLimited: true,
+			minSecs:     30,
+			maxSecs:     30,
+		},
+		{
+			name:        "abuse rate limit without retry-after",
+			err:         &github.AbuseRateLimitError{Response: githubResponse()},
+			wantStatus:  http.StatusTooManyRequests,
+			wantLimited: true,
+			minSecs:     60,
+			maxSecs:     60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s := newServer(nil, defaultCacheTTL, func() time.Time { return now })
+			writeJSON(w, PluginsResponse{Error: s.errorResponse(w, tt.err)})
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp PluginsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error.RateLimited != tt.wantLimited {
+				t.Errorf("rate_limited = %v, want %v", resp.Error.RateLimited, tt.wantLimited)
+			}
+			if !tt.wantLimited {
+				if h := w.Header().Get("Retry-After"); h != "" {
+					t.Errorf("unexpected Retry-After header %q", h)
+				}
+				return
+			}
+			secs, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if err != nil || secs < tt.minSecs || secs > tt.maxSecs {
+				t.Errorf("Retry-After = %q, want between %d and %d", w.Header().Get("Retry-After"), tt.minSecs, tt.maxSecs)
+			}
+			if resp.Error.RetryAfterSeconds != secs {
+				t.Errorf("retry_after_seconds = %d, want %d", resp.Error.RetryAfterSeconds, secs)
+			}
+		})
+	}
+}
+
+func Test_setCacheHeaders(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	s := newServer(nil, 15*time.Minute, func() time.Time { return now })
+
+	w := httptest.NewRecorder()
+	s.setCacheHeaders(w)
+	if got, want := w.Header().Get("Cache-Control"), "public, max-age=900"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+	if got, want := w.Header().Get("Expires"), "Mon, 01 Jun 2020 10:15:00 GMT"; got != want {
+		t.Errorf("Expires = %q, want %q", got, want)
+	}
+}
+
+func Test_cacheTTLFromEnv(t *testing.T) {
+	defer os.Unsetenv(cacheTTLEnv)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: time.Hour},
+		{value: "15m", want: 15 * time.Minute},
+		{value: "0s", want: 0},
+		{value: "-1m", want: time.Hour},
+		{value: "3600", want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			os.Setenv(cacheTTLEnv, tt.value)
+			if got := cacheTTLFromEnv(); got != tt.want {
+				t.Errorf("cacheTTLFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_listPluginEntries(t *testing.T) {
+	const pages = 3
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/repos/kubernetes-sigs/krew-index/contents/plugins" {
+			http.NotFound(w, req)
+			return
+		}
+		page, err := strconv.Atoi(req.URL.Query().Get("page"))
+		if err != nil || page < 1 || page > pages {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+		if page < pages {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=%d>; rel="next"`, server.URL, req.URL.Path, page+1))
+		}
+		var entries []*github.RepositoryContent
+		for i := 0; i < 100; i++ {
+			entries = append(entries, &github.RepositoryContent{
+				Type: github.String("file"),
+				Name: github.String(fmt.Sprintf("plugin-%d-%d.yaml", page, i)),
+			})
+		}
+		// every page also has an entry that is not a plugin manifest
+		entries = append(entries, &github.RepositoryContent{Type: github.String("file"), Name: github.String(fmt.Sprintf("README-%d.md", page))})
+		_ = json.NewEncoder(w).Encode(entries)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	entries, _, err := listPluginEntries(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != pages*101 {
+		t.Errorf("got %d entries, want %d", len(entries), pages*101)
+	}
+	if got := len(filterYAMLs(entries)); got != pages*100 {
+		t.Errorf("got %d plugin manifests, want %d", got, pages*100)
+	}
+}
+
+func Test_readPlugin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/foo.yaml":
+			fmt.Fprintf(w, testManifest, "foo")
+		case "/limited.yaml":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, "<html>rate limited</html>")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		wantName  string
+		wantError string
+	}{
+		{name: "valid manifest", path: "/foo.yaml", wantName: "foo"},
+		{name: "not found", path: "/missing.yaml", wantError: "404"},
+		{name: "rate limited", path: "/limited.yaml", wantError: "429"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := readPlugin(context.Background(), server.URL+tt.path)
+			if tt.wantError != "" {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if !strings.Contains(err.Error(), tt.wantError) || strings.Contains(err.Error(), "invalid plugin manifest") {
+					t.Fatalf("got error %q, want an http status error containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != tt.wantName {
+				t.Errorf("got plugin %q, want %q", p.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func Test_readPlugin_cancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := readPlugin(ctx, server.URL+"/foo.yaml")
+		errCh <- err
+	}()
+	cancel()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("readPlugin was not aborted by the cancelled context")
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	krew "sigs.k8s.io/krew/pkg/index"
+)
+
+// indexDirEnv is the environment variable specifying the path of a local
+// clone of the krew-index repository to read the plugin manifests from,
+// instead of the GitHub API.
+const indexDirEnv = "KREW_INDEX_DIR"
+
+// PluginSource provides the plugin manifests of the krew-index.
+type PluginSource interface {
+	// Count returns the number of plugins in the index.
+	Count(ctx context.Context) (int, error)
+
+	// Plugins returns the manifests of all plugins in the index.
+	Plugins(ctx context.Context) ([]*krew.Plugin, error)
+
+	// StreamPlugins calls fn with the manifest of each plugin in the index as
+	// soon as it is read. It stops at the first error returned by fn.
+	StreamPlugins(ctx context.Context, fn func(*krew.Plugin) error) error
+
+	// Plugin returns the manifest of the named plugin, or errPluginNotFound
+	// if the index has no such plugin.
+	Plugin(ctx context.Context, name string) (*krew.Plugin, error)
+
+	// UpdatedTimes returns the time of the last change to the manifests of
+	// the named plugins, or of all plugins in the index if names is nil,
+	// keyed by plugin name. Plugins whose time cannot be determined are left
+	// out. Times that are looked up remotely are cached in cache. It fails if
+	// the GitHub API rate limit is exceeded.
+	UpdatedTimes(ctx context.Context, names []string, cache *updatedCache) (map[string]time.Time, error)
+}
+
+// errPluginNotFound is returned by PluginSource.Plugin if the plugin does not
+// exist in the index.
+var errPluginNotFound = errors.New("plugin not found")
+
+// validPluginName matches the plugin names that are looked up in the index,
+// so that the name cannot refer to files outside the plugins directory.
+var validPluginName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// newPluginSource returns the source configured by the environment, a local
+// clone if indexDirEnv is set, and the GitHub API otherwise.
+func newPluginSource() PluginSource {
+	if dir := os.Getenv(indexDirEnv); dir != "" {
+		log.Printf("reading plugin manifests from %s", dir)
+		return dirSource{dir: dir}
+	}
+	return githubSource{}
+}
+
+// githubSource reads the plugin manifests from the krew-index repository
+// through the GitHub API.
+type githubSource struct{}
+
+func (githubSource) Count(ctx context.Context) (int, error) {
+	dir, resp, err := listPluginEntries(ctx, githubClient(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving repo contents: %w", err)
+	}
+	count := len(filterYAMLs(dir))
+	log.Printf("github response=%s count=%d rate: limit=%d remaining=%d",
+		resp.Status, count, resp.Rate.Limit, resp.Rate.Remaining)
+	return count, nil
+}
+
+func (githubSource) Plugins(ctx context.Context) ([]*krew.Plugin, error) {
+	entries, err := githubPluginEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plugins, err := fetchPlugins(ctx, entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plugins: %w", err)
+	}
+	return plugins, nil
+}
+
+func (githubSource) StreamPlugins(ctx context.Context, fn func(*krew.Plugin) error) error {
+	entries, err := githubPluginEntries(ctx)
+	if err != nil {
+		return err
+	}
+	if err := streamPlugins(ctx, entries, fn); err != nil {
+		return fmt.Errorf("failed to fetch plugins: %w", err)
+	}
+	return nil
+}
+
+func (githubSource) UpdatedTimes(ctx context.Context, names []string, cache *updatedCache) (map[string]time.Time, error) {
+	entries, err := githubPluginEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shas := make(map[string]bool, len(entries))
+	for _, v := range entries {
+		shas[v.GetSHA()] = true
+	}
+	cache.retain(shas)
+	return fetchUpdatedTimes(ctx, githubClient(ctx), cache, selectEntries(entries, names))
+}
+
+// selectEntries returns the manifest entries of the named plugins, or all
+// entries if names is nil.
+func selectEntries(entries []*github.RepositoryContent, names []string) []*github.RepositoryContent {
+	if names == nil {
+		return entries
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+	var out []*github.RepositoryContent
+	for _, v := range entries {
+		if selected[manifestPluginName(v)] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// githubPluginEntries returns the manifest files in the plugins directory of
+// the index repository.
+func githubPluginEntries(ctx context.Context) ([]*github.RepositoryContent, error) {
+	dir, resp, err := listPluginEntries(ctx, githubClient(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving repo contents: %w", err)
+	}
+	log.Printf("github response=%s rate: limit=%d remaining=%d",
+		resp.Status, resp.Rate.Limit, resp.Rate.Remaining)
+	return filterYAMLs(dir), nil
+}
+
+func (githubSource) Plugin(ctx context.Context, name string) (*krew.Plugin, error) {
+	file, _, resp, err := githubClient(ctx).Repositories.GetContents(ctx, orgName, repoName,
+		path.Join(pluginsDir, name+".yaml"), &github.RepositoryContentGetOptions{})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errPluginNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving plugin manifest: %w", err)
+	}
+	if file == nil {
+		return nil, errPluginNotFound
+	}
+	if p, ok := manifests.get(file.GetSHA()); ok {
+		return p, nil
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode plugin manifest: %w", err)
+	}
+	p, err := krew.ParseAndValidate([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest %s: %w", file.GetPath(), err)
+	}
+	manifests.put(file.GetSHA(), p)
+	return p, nil
+}
+
+// dirSource reads the plugin manifests from a local clone of the krew-index
+// repository.
+type dirSource struct {
+	dir string
+}
+
+// manifestPaths returns the paths of the plugin manifests in the clone.
+func (s dirSource) manifestPaths() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, pluginsDir))
+	if err != nil {
+		return nil, fmt.Errorf("error reading index directory: %w", err)
+	}
+	var out []string
+	for _, f := range files {
+		if f.Mode().IsRegular() && strings.HasSuffix(f.Name(), ".yaml") {
+			out = append(out, filepath.Join(s.dir, pluginsDir, f.Name()))
+		}
+	}
+	return out, nil
+}
+
+func (s dirSource) Count(context.Context) (int, error) {
+	paths, err := s.manifestPaths()
+	return len(paths), err
+}
+
+func (s dirSource) Plugins(ctx context.Context) ([]*krew.Plugin, error) {
+	var out []*krew.Plugin
+	err := s.StreamPlugins(ctx, func(p *krew.Plugin) error {
+		out = append(out, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s dirSource) StreamPlugins(ctx context.Context, fn func(*krew.Plugin) error) error {
+	paths, err := s.manifestPaths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		p, err := krew.ParseAndValidate(b)
+		if err != nil {
+			return fmt.Errorf("invalid plugin manifest %s: %w", path, err)
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s dirSource) Plugin(_ context.Context, name string) (*krew.Plugin, error) {
+	path := filepath.Join(s.dir, pluginsDir, name+".yaml")
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errPluginNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	p, err := krew.ParseAndValidate(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin manifest %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// UpdatedTimes returns the modification times of the manifest files, as the
+// commit times are not available without running git. They are not cached.
+func (s dirSource) UpdatedTimes(_ context.Context, names []string, _ *updatedCache) (map[string]time.Time, error) {
+	paths, err := s.manifestPaths()
+	if err != nil {
+		return nil, err
+	}
+	var selected map[string]bool
+	if names != nil {
+		selected = make(map[string]bool, len(names))
+		for _, name := range names {
+			selected[name] = true
+		}
+	}
+	out := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		if selected != nil && !selected[name] {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file %s: %w", path, err)
+		}
+		out[name] = fi.ModTime()
+	}
+	return out, nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testManifest = `apiVersion: krew.googlecontainertools.github.com/v1alpha2
+kind: Plugin
+metadata:
+  name: %s
+spec:
+  version: v1.0.0
+  homepage: https://github.com/foo/%[1]s
+  shortDescription: The %[1]s plugin
+  platforms:
+  - uri: https://example.com/%[1]s.tar.gz
+    sha256: 433b9e0b6cb9f064548f451150799daadcc70a3496953490c5148c8e550d2f4e
+    bin: %[1]s
+`
+
+// newTestIndexDir returns a directory laid out like a krew-index clone with
+// manifests of the given plugins.
+func newTestIndexDir(t *testing.T, names ...string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "krew-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Mkdir(filepath.Join(dir, pluginsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, pluginsDir, name+".yaml"), []byte(fmt.Sprintf(testManifest, name)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, pluginsDir, "README.md"), []byte("not a manifest"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func Test_dirSource(t *testing.T) {
+	s := dirSource{dir: newTestIndexDir(t, "foo", "bar")}
+
+	count, err := s.Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+	plugins, err := s.Plugins(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugins) != 2 || plugins[0].Name != "bar" || plugins[1].Name != "foo" {
+		t.Errorf("Plugins() returned unexpected plugins: %+v", plugins)
+	}
+
+	if _, err := (dirSource{dir: filepath.Join(s.dir, "missing")}).Count(context.Background()); err == nil {
+		t.Error("expected error for a missing index directory")
+	}
+}
+
+func Test_newPluginSource(t *testing.T) {
+	defer os.Unsetenv(indexDirEnv)
+	os.Unsetenv(indexDirEnv)
+	if _, ok := newPluginSource().(githubSource); !ok {
+		t.Errorf("expected the GitHub source by default")
+	}
+	os.Setenv(indexDirEnv, "/path/to/krew-index")
+	if s, ok := newPluginSource().(dirSource); !ok || s.dir != "/path/to/krew-index" {
+		t.Errorf("expected a source reading from %s, got %#v", indexDirEnv, newPluginSource())
+	}
+}
+
+func TestHandlers_dirSource(t *testing.T) {
+	s := newServer(dirSource{dir: newTestIndexDir(t, "foo", "bar", "baz")}, defaultCacheTTL, time.Now)
+
+	w := httptest.NewRecorder()
+	s.pluginCountHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/pluginCount", nil))
+	var count PluginCountResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &count); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || count.Data.Count != 3 {
+		t.Errorf("pluginCount returned status=%d count=%d, want 200 and 3", w.Code, count.Data.Count)
+	}
+
+	w = httptest.NewRecorder()
+	s.pluginsHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/plugins", nil))
+	var plugins PluginsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &plugins); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(plugins.Data.Plugins) != 3 {
+		t.Fatalf("plugins returned status=%d with %d plugins, want 200 and 3", w.Code, len(plugins.Data.Plugins))
+	}
+	if got := plugins.Data.Plugins[0].GithubRepo; got != "foo/bar" {
+		t.Errorf("unexpected github repo %q", got)
+	}
+}
+
+func TestPluginHandler(t *testing.T) {
+	s := newServer(dirSource{dir: newTestIndexDir(t, "foo")}, defaultCacheTTL, time.Now)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantPlugin string
+	}{
+		{query: "name=foo", wantStatus: http.StatusOK, wantPlugin: "foo"},
+		{query: "name=bar", wantStatus: http.StatusNotFound},
+		{query: "name=../foo", wantStatus: http.StatusBadRequest},
+		{query: "", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.pluginHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/plugin?"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp PluginResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantPlugin == "" {
+				if resp.Error.Message == "" || resp.Data.Plugin != nil {
+					t.Errorf("expected an error response, got %+v", resp)
+				}
+				return
+			}
+			p := resp.Data.Plugin
+			if p == nil || p.Name != tt.wantPlugin || p.Spec.Version != "v1.0.0" || len(p.Spec.Platforms) != 1 {
+				t.Errorf("unexpected plugin in response: %+v", p)
+			}
+		})
+	}
+}
+
+func TestPluginsNDJSONHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		dir        func(t *testing.T) string
+		wantStatus int
+		wantNames  []string
+		wantError  bool
+	}{
+		{
+			name:       "all plugins",
+			dir:        func(t *testing.T) string { return newTestIndexDir(t, "bar", "foo") },
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"bar", "foo"},
+		},
+		{
+			name: "invalid manifest mid-stream",
+			dir: func(t *testing.T) string {
+				dir := newTestIndexDir(t, "bar", "foo")
+				if err := ioutil.WriteFile(filepath.Join(dir, pluginsDir, "zzz.yaml"), []byte("not: [valid"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return dir
+			},
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"bar", "foo"},
+			wantError:  true,
+		},
+		{
+			name:       "missing index",
+			dir:        func(t *testing.T) string { return filepath.Join(newTestIndexDir(t), "missing") },
+			wantStatus: http.StatusInternalServerError,
+			wantError:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(dirSource{dir: tt.dir(t)}, defaultCacheTTL, time.Now)
+			w := httptest.NewRecorder()
+			s.pluginsNDJSONHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/plugins.ndjson", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if !w.Flushed {
+				t.Error("expected the response to be flushed")
+			}
+
+			lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+			var names []string
+			for i, line := range lines {
+				if tt.wantError && i == len(lines)-1 {
+					var e ndjsonError
+					if err := json.Unmarshal([]byte(line), &e); err != nil || e.Error.Message == "" {
+						t.Errorf("expected an error on the last line, got %q", line)
+					}
+					continue
+				}
+				var p pluginInfo
+				if err := json.Unmarshal([]byte(line), &p); err != nil {
+					t.Fatalf("line %d is not a plugin: %q", i, line)
+				}
+				names = append(names, p.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("streamed plugins %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// updatedFailureTTL is how long a failure to look up the last commit of a
+// manifest is cached, so that a lookup failing e.g. because of the GitHub API
+// rate limit is not retried on every request.
+const updatedFailureTTL = 5 * time.Minute
+
+// updatedCache caches the time of the last commit of the plugin manifests
+// across invocations, keyed by the git blob SHA of the manifest file, so that
+// the commits of unchanged manifests are not looked up again. Failed lookups
+// are cached for failureTTL.
+type updatedCache struct {
+	mu         sync.Mutex
+	entries    map[string]updatedEntry
+	failureTTL time.Duration
+	now        func() time.Time
+}
+
+type updatedEntry struct {
+	updated time.Time
+	failed  bool
+	fetched time.Time
+}
+
+func newUpdatedCache(failureTTL time.Duration, now func() time.Time) *updatedCache {
+	return &updatedCache{
+		entries:    make(map[string]updatedEntry),
+		failureTTL: failureTTL,
+		now:        now,
+	}
+}
+
+// get returns the cached lookup of the manifest with the SHA, unless it is not
+// cached or is a failure older than the failure TTL.
+func (c *updatedCache) get(sha string) (updatedEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[sha]
+	if ok && e.failed && c.now().Sub(e.fetched) >= c.failureTTL {
+		return updatedEntry{}, false
+	}
+	return e, ok
+}
+
+func (c *updatedCache) put(sha string, e updatedEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.fetched = c.now()
+	c.entries[sha] = e
+}
+
+// retain drops the cached times whose SHA is not in the given set.
+func (c *updatedCache) retain(shas map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if !shas[k] {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// updatedLookupWorkers is the number of manifests whose last commit is looked
+// up concurrently, and maxUpdatedLookups is the number of manifests looked up
+// for a single request at most, so that a request with a cold cache does not
+// use up the GitHub API rate limit. The manifests left out are looked up by
+// the next requests.
+const (
+	updatedLookupWorkers = 4
+	maxUpdatedLookups    = 30
+)
+
+// fetchUpdatedTimes returns the time of the last commit touching each of the
+// given manifest entries, keyed by plugin name. Only the commits of the
+// manifests that are not in the cache are looked up, up to maxUpdatedLookups
+// of them. Manifests whose commit cannot be looked up are left out of the
+// result, but if the GitHub API rate limit is exceeded, the lookups stop and
+// the rate limit error is returned.
+func fetchUpdatedTimes(ctx context.Context, client *github.Client, cache *updatedCache, entries []*github.RepositoryContent) (map[string]time.Time, error) {
+	var (
+		mu      sync.Mutex
+		out     = make(map[string]time.Time)
+		rateErr error
+	)
+
+	var misses []*github.RepositoryContent
+	for _, v := range entries {
+		if e, ok := cache.get(v.GetSHA()); ok {
+			if !e.failed {
+				out[manifestPluginName(v)] = e.updated
+			}
+			continue
+		}
+		misses = append(misses, v)
+	}
+	if len(misses) > maxUpdatedLookups {
+		log.Printf("looking up the last commit of %d of %d uncached manifests", maxUpdatedLookups, len(misses))
+		misses = misses[:maxUpdatedLookups]
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := make(chan *github.RepositoryContent)
+	var wg sync.WaitGroup
+	for i := 0; i < updatedLookupWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range queue {
+				t, err := lastCommitTime(ctx, client, entry.GetPath())
+				if _, limited := rateLimitRetryAfter(err, time.Now()); limited {
+					mu.Lock()
+					if rateErr == nil {
+						rateErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				if err != nil {
+					log.Printf("cannot determine last commit of %s: %v", entry.GetPath(), err)
+					if ctx.Err() == nil {
+						cache.put(entry.GetSHA(), updatedEntry{failed: true})
+					}
+					continue
+				}
+				cache.put(entry.GetSHA(), updatedEntry{updated: t})
+				mu.Lock()
+				out[manifestPluginName(entry)] = t
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, v := range misses {
+		queue <- v
+	}
+	close(queue)
+	wg.Wait()
+	if rateErr != nil {
+		return nil, fmt.Errorf("failed to look up the last commits of the plugin manifests: %w", rateErr)
+	}
+	return out, nil
+}
+
+// lastCommitTime returns the committer date of the last commit touching the
+// file at path in the index repository.
+func lastCommitTime(ctx context.Context, client *github.Client, path string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	commits, _, err := client.Repositories.ListCommits(ctx, orgName, repoName, &github.CommitsListOptions{
+		Path:        path,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(commits) == 0 {
+		return time.Time{}, errors.New("no commits found")
+	}
+	return commits[0].GetCommit().GetCommitter().GetDate(), nil
+}
+
+// manifestPluginName returns the name of the plugin of a manifest entry,
+// which is the file name without the .yaml extension.
+func manifestPluginName(entry *github.RepositoryContent) string {
+	return strings.TrimSuffix(entry.GetName(), ".yaml")
+}
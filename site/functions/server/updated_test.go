@@ -0,0 +1,265 @@
+// Copyright 2020 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func Test_fetchUpdatedTimes(t *testing.T) {
+	date := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/repos/kubernetes-sigs/krew-index/commits" {
+			http.NotFound(w, req)
+			return
+		}
+		path := req.URL.Query().Get("path")
+		mu.Lock()
+		calls[path]++
+		mu.Unlock()
+		switch path {
+		case "plugins/foo.yaml":
+			_ = json.NewEncoder(w).Encode([]*github.RepositoryCommit{{
+				Commit: &github.Commit{Committer: &github.CommitAuthor{Date: &date}},
+			}})
+		case "plugins/bar.yaml":
+			_ = json.NewEncoder(w).Encode([]*github.RepositoryCommit{})
+		default:
+			http.Error(w, "rate limited", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	entry := func(name, sha string) *github.RepositoryContent {
+		return &github.RepositoryContent{
+			Name: github.String(name + ".yaml"),
+			Path: github.String("plugins/" + name + ".yaml"),
+			SHA:  github.String(sha),
+		}
+	}
+	entries := []*github.RepositoryContent{entry("foo", "1"), entry("bar", "2"), entry("baz", "3")}
+	now := date
+	cache := newUpdatedCache(updatedFailureTTL, func() time.Time { return now })
+
+	for i := 0; i < 2; i++ {
+		got, err := fetchUpdatedTimes(context.Background(), client, cache, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || !got["foo"].Equal(date) {
+			t.Errorf("unexpected updated times: %v", got)
+		}
+	}
+	if calls["plugins/foo.yaml"] != 1 {
+		t.Errorf("looked up foo %d times, want 1 (cached)", calls["plugins/foo.yaml"])
+	}
+	if calls["plugins/baz.yaml"] != 1 {
+		t.Errorf("looked up baz %d times, want 1 (failure cached)", calls["plugins/baz.yaml"])
+	}
+
+	// failures are looked up again after the failure TTL
+	now = now.Add(updatedFailureTTL)
+	if _, err := fetchUpdatedTimes(context.Background(), client, cache, entries); err != nil {
+		t.Fatal(err)
+	}
+	if calls["plugins/baz.yaml"] != 2 {
+		t.Errorf("looked up baz %d times, want 2 (failure expired)", calls["plugins/baz.yaml"])
+	}
+	if calls["plugins/foo.yaml"] != 1 {
+		t.Errorf("looked up foo %d times, want 1 (successes do not expire)", calls["plugins/foo.yaml"])
+	}
+
+	// a new version of the manifest is looked up again
+	cache.retain(map[string]bool{"4": true})
+	if _, ok := cache.get("1"); ok {
+		t.Error("expected the time of the previous manifest to be dropped from the cache")
+	}
+	if _, err := fetchUpdatedTimes(context.Background(), client, cache, []*github.RepositoryContent{entry("foo", "4")}); err != nil {
+		t.Fatal(err)
+	}
+	if calls["plugins/foo.yaml"] != 2 {
+		t.Errorf("looked up foo %d times, want 2 (changed manifest)", calls["plugins/foo.yaml"])
+	}
+}
+
+func Test_fetchUpdatedTimes_rateLimited(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message": "API rate limit exceeded for 127.0.0.1."}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	var entries []*github.RepositoryContent
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("plugin%d", i)
+		entries = append(entries, &github.RepositoryContent{
+			Name: github.String(name + ".yaml"),
+			Path: github.String("plugins/" + name + ".yaml"),
+			SHA:  github.String(name),
+		})
+	}
+	cache := newUpdatedCache(updatedFailureTTL, time.Now)
+
+	_, err := fetchUpdatedTimes(context.Background(), client, cache, entries)
+	var rateErr *github.RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("expected a rate limit error, got: %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n > updatedLookupWorkers {
+		t.Errorf("made %d requests, expected the lookups to stop at the rate limit", n)
+	}
+	for _, v := range entries {
+		if _, ok := cache.get(v.GetSHA()); ok {
+			t.Errorf("expected the rate limited lookup of %s not to be cached", v.GetName())
+		}
+	}
+}
+
+func Test_fetchUpdatedTimes_maxLookups(t *testing.T) {
+	date := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_ = json.NewEncoder(w).Encode([]*github.RepositoryCommit{{
+			Commit: &github.Commit{Committer: &github.CommitAuthor{Date: &date}},
+		}})
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	var entries []*github.RepositoryContent
+	for i := 0; i < maxUpdatedLookups+5; i++ {
+		name := fmt.Sprintf("plugin%02d", i)
+		entries = append(entries, &github.RepositoryContent{
+			Name: github.String(name + ".yaml"),
+			Path: github.String("plugins/" + name + ".yaml"),
+			SHA:  github.String(name),
+		})
+	}
+	cache := newUpdatedCache(updatedFailureTTL, time.Now)
+
+	got, err := fetchUpdatedTimes(context.Background(), client, cache, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != maxUpdatedLookups || atomic.LoadInt32(&calls) != maxUpdatedLookups {
+		t.Errorf("looked up %d manifests with %d requests, want %d", len(got), calls, maxUpdatedLookups)
+	}
+	// the rest is looked up by the next request
+	if got, err = fetchUpdatedTimes(context.Background(), client, cache, entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Errorf("got %d updated times on the next request, want %d", len(got), len(entries))
+	}
+}
+
+// namesRecordingSource records the plugin names the updated times are looked
+// up for.
+type namesRecordingSource struct {
+	dirSource
+	names []string
+}
+
+func (s *namesRecordingSource) UpdatedTimes(ctx context.Context, names []string, cache *updatedCache) (map[string]time.Time, error) {
+	s.names = names
+	return s.dirSource.UpdatedTimes(ctx, names, cache)
+}
+
+func TestSearchHandler_updatedAtOfMatches(t *testing.T) {
+	src := &namesRecordingSource{dirSource: dirSource{dir: newTestIndexDir(t, "foo", "bar", "baz")}}
+	s := newServer(src, defaultCacheTTL, time.Now)
+
+	w := httptest.NewRecorder()
+	s.searchHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/search?q=foo&fields=updated_at", nil))
+	var resp PluginsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Plugins) != 1 || resp.Data.Plugins[0].UpdatedAt == nil {
+		t.Fatalf("expected plugin foo with updated_at, got %+v", resp.Data.Plugins)
+	}
+	if want := []string{"foo"}; !reflect.DeepEqual(src.names, want) {
+		t.Errorf("looked up updated times of %v, want %v", src.names, want)
+	}
+}
+
+func TestHandlers_updatedAt(t *testing.T) {
+	dir := newTestIndexDir(t, "foo", "bar")
+	mtime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, pluginsDir, "foo.yaml"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(dirSource{dir: dir}, defaultCacheTTL, time.Now)
+
+	w := httptest.NewRecorder()
+	s.pluginsHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/plugins", nil))
+	var resp PluginsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range resp.Data.Plugins {
+		if p.UpdatedAt != nil {
+			t.Errorf("plugin %q has updated_at without requesting it", p.Name)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.pluginsHandler(w, httptest.NewRequest(http.MethodGet, "/.netlify/functions/api/plugins?fields=updated_at", nil))
+	resp = PluginsResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Plugins) != 2 {
+		t.Fatalf("got %d plugins, want 2", len(resp.Data.Plugins))
+	}
+	for _, p := range resp.Data.Plugins {
+		if p.UpdatedAt == nil {
+			t.Errorf("plugin %q has no updated_at", p.Name)
+		} else if p.Name == "foo" && !p.UpdatedAt.Equal(mtime) {
+			t.Errorf("plugin foo updated_at = %v, want %v", p.UpdatedAt, mtime)
+		}
+	}
+}